@@ -51,4 +51,12 @@ func main() {
 	// 启动 HTTP 服务器
 	logger.Info("启动服务器", logger.String("port", port))
 	server.Start(port, authService)
+
+	// 停止后台任务并关闭数据库
+	authService.Close()
+	stats.CloseLogDB()
+	if err := auth.CloseDB(); err != nil {
+		logger.Warn("关闭数据库失败", logger.Err(err))
+	}
+	logger.Info("kiro2api 已退出")
 }
@@ -1,60 +1,253 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"os"
+	"path"
+	"strings"
 	"sync"
+	"time"
 
 	"kiro2api/internal/logger"
 )
 
+var (
+	// ErrAPIKeyNotFound key 不存在
+	ErrAPIKeyNotFound = errors.New("API Key 不存在")
+	// ErrAPIKeyDisabled key 已禁用
+	ErrAPIKeyDisabled = errors.New("API Key 已禁用")
+	// ErrAPIKeyExpired key 已过期
+	ErrAPIKeyExpired = errors.New("API Key 已过期")
+	// ErrGroupNotAllowed key 无权访问分组
+	ErrGroupNotAllowed = errors.New("无权访问该分组")
+)
+
+// lastUsedPersistInterval last_used_at 落库的最小间隔，避免每个请求都写库
+const lastUsedPersistInterval = time.Minute
+
 // APIKeyManager 管理多个 API key
+// 只保存加盐哈希与展示前缀，管理接口通过不透明 ID 访问
 type APIKeyManager struct {
-	mu   sync.RWMutex
-	keys map[string]*APIKeyConfig
-	db   *sql.DB
+	mu        sync.RWMutex
+	keys      map[string]*APIKeyConfig // ID -> 配置
+	persisted map[string]time.Time     // ID -> 最近一次落库的 last_used_at
+	db        *sql.DB
+	quota     *KeyQuotaTracker
 }
 
 // NewAPIKeyManager 创建 API Key 管理器
 func NewAPIKeyManager(db *sql.DB) *APIKeyManager {
 	m := &APIKeyManager{
-		keys: make(map[string]*APIKeyConfig),
-		db:   db,
+		keys:      make(map[string]*APIKeyConfig),
+		persisted: make(map[string]time.Time),
+		db:        db,
+		quota:     NewKeyQuotaTracker(db),
 	}
 
+	envKey := os.Getenv("KIRO_CLIENT_TOKEN")
+
 	// 优先从数据库加载
 	dbKeys := m.loadAPIKeysFromDB()
+	changed := make(map[int]bool)
+	for _, i := range assignLegacyRoles(dbKeys, envKey) {
+		changed[i] = true
+		logger.Info("旧API Key补充角色",
+			logger.String("name", dbKeys[i].Name),
+			logger.String("role", string(dbKeys[i].Role)))
+	}
 	for i := range dbKeys {
 		cfg := &dbKeys[i]
-		if cfg.Key != "" {
-			m.keys[cfg.Key] = cfg
-		}
-	}
-
-	// 向后兼容：如果数据库没有，使用 KIRO_CLIENT_TOKEN
-	if len(m.keys) == 0 {
-		envKey := os.Getenv("KIRO_CLIENT_TOKEN")
-		if envKey != "" {
-			cfg := &APIKeyConfig{
-				Key:           envKey,
-				Name:          "default",
-				AllowedGroups: nil,
+		if cfg.KeyHash == "" {
+			// 旧版本明文存储：ID 列即明文 key，改为哈希存储
+			if !m.hashLegacyKey(cfg) {
+				continue
 			}
-			m.keys[envKey] = cfg
-			// 保存到数据库
+			changed[i] = true
+		}
+		if changed[i] {
 			m.saveAPIKeyToDB(cfg)
 		}
+		m.keys[cfg.ID] = cfg
+	}
+
+	// 向后兼容：如果数据库没有，使用 KIRO_CLIENT_TOKEN（管理员）
+	if len(m.keys) == 0 && envKey != "" {
+		m.AddKey(APIKeyConfig{
+			Key:  envKey,
+			Name: "default",
+			Role: RoleAdmin,
+		})
 	}
 
 	return m
 }
 
-// Get 获取 API key 配置
+// assignLegacyRoles 为未设置角色的旧 key 补充角色
+// 旧版本所有 key 均可访问管理接口：与 KIRO_CLIENT_TOKEN 相同的 key 设为 admin；
+// 仍没有 admin 时最早创建的旧 key 设为 admin，避免升级后无法登录管理后台；其余设为 client
+func assignLegacyRoles(keys []APIKeyConfig, envKey string) []int {
+	var legacy []int
+	hasAdmin := false
+	for i := range keys {
+		switch {
+		case keys[i].Role == RoleAdmin:
+			hasAdmin = true
+		case keys[i].Role == "":
+			legacy = append(legacy, i)
+		}
+	}
+
+	for _, i := range legacy {
+		if envKey != "" && keys[i].Matches(envKey) {
+			keys[i].Role = RoleAdmin
+			hasAdmin = true
+		}
+	}
+	for _, i := range legacy {
+		if keys[i].Role != "" {
+			continue
+		}
+		if !hasAdmin {
+			keys[i].Role = RoleAdmin
+			hasAdmin = true
+			continue
+		}
+		keys[i].Role = RoleClient
+	}
+	return legacy
+}
+
+// randomHex 生成 n 字节随机数的十六进制串
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// hashAPIKey 计算加盐哈希
+func hashAPIKey(raw, salt string) string {
+	sum := sha256.Sum256([]byte(salt + raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyPrefix 展示用前缀（最多 8 位，且不超过 key 长度的一半）
+func apiKeyPrefix(raw string) string {
+	return raw[:min(8, len(raw)/2)]
+}
+
+// sealAPIKey 生成哈希、前缀与 ID，并清除明文
+func sealAPIKey(cfg *APIKeyConfig) {
+	if cfg.ID == "" {
+		cfg.ID = "key_" + randomHex(8)
+	}
+	cfg.Salt = randomHex(16)
+	cfg.KeyHash = hashAPIKey(cfg.Key, cfg.Salt)
+	cfg.Prefix = apiKeyPrefix(cfg.Key)
+	cfg.Key = ""
+}
+
+// Matches 检查明文 key 是否与该配置匹配
+func (cfg *APIKeyConfig) Matches(raw string) bool {
+	if cfg.KeyHash == "" {
+		// 尚未哈希的旧记录
+		return cfg.Key != "" && subtle.ConstantTimeCompare([]byte(cfg.Key), []byte(raw)) == 1
+	}
+	if len(raw) < len(cfg.Prefix) || raw[:len(cfg.Prefix)] != cfg.Prefix {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashAPIKey(raw, cfg.Salt)), []byte(cfg.KeyHash)) == 1
+}
+
+// Usable 检查 key 当前是否可用（未禁用且未过期）
+func (cfg *APIKeyConfig) Usable(now time.Time) error {
+	if cfg.Disabled {
+		return ErrAPIKeyDisabled
+	}
+	if cfg.ExpiresAt != nil && !now.Before(*cfg.ExpiresAt) {
+		return ErrAPIKeyExpired
+	}
+	return nil
+}
+
+// hashLegacyKey 将明文存储的旧记录改为哈希存储
+func (m *APIKeyManager) hashLegacyKey(cfg *APIKeyConfig) bool {
+	legacyID := cfg.ID
+	cfg.ID = ""
+	sealAPIKey(cfg)
+	if m.db != nil {
+		_, err := m.db.Exec(`UPDATE api_keys SET id = ?, key_hash = ?, salt = ?, prefix = ? WHERE id = ?`,
+			cfg.ID, cfg.KeyHash, cfg.Salt, cfg.Prefix, legacyID)
+		if err != nil {
+			logger.Warn("API Key哈希迁移失败", logger.Err(err))
+			return false
+		}
+	}
+	logger.Info("API Key已改为哈希存储", logger.String("id", cfg.ID), logger.String("prefix", cfg.Prefix))
+	return true
+}
+
+// Get 按明文 key 查找配置（不检查禁用/过期）
 func (m *APIKeyManager) Get(key string) *APIKeyConfig {
+	if key == "" {
+		return nil
+	}
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.keys[key]
+	for _, cfg := range m.keys {
+		if cfg.Matches(key) {
+			return cfg
+		}
+	}
+	return nil
+}
+
+// GetByID 按 ID 获取配置
+func (m *APIKeyManager) GetByID(id string) *APIKeyConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.keys[id]
+}
+
+// Authenticate 校验明文 key：存在、未禁用、未过期，并记录最近使用时间
+func (m *APIKeyManager) Authenticate(key string) (*APIKeyConfig, error) {
+	cfg := m.Get(key)
+	if cfg == nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	now := time.Now()
+	if err := cfg.Usable(now); err != nil {
+		return nil, err
+	}
+	m.touch(cfg.ID, now)
+	return cfg, nil
+}
+
+// touch 更新最近使用时间（落库按间隔节流）
+func (m *APIKeyManager) touch(id string, now time.Time) {
+	m.mu.Lock()
+	cfg, ok := m.keys[id]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	cfg.LastUsedAt = &now
+	persist := now.Sub(m.persisted[id]) >= lastUsedPersistInterval
+	if persist {
+		m.persisted[id] = now
+	}
+	m.mu.Unlock()
+
+	if persist && m.db != nil {
+		if _, err := m.db.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, now, id); err != nil {
+			logger.Warn("更新API Key最近使用时间失败", logger.Err(err))
+		}
+	}
 }
 
 // HasGroupPermission 检查 key 是否有访问指定 group 的权限
@@ -80,6 +273,33 @@ func (cfg *APIKeyConfig) HasGroupPermission(group string) bool {
 	return false
 }
 
+// RouteGroup 计算未带分组前缀的请求应使用的分组
+// 优先级：override（X-Kiro-Group 头）> key 默认分组 > 空（全局默认分组）
+func (cfg *APIKeyConfig) RouteGroup(override string) (string, error) {
+	if override != "" {
+		if !cfg.HasGroupPermission(override) {
+			return "", ErrGroupNotAllowed
+		}
+		return override, nil
+	}
+	return cfg.DefaultGroup, nil
+}
+
+// AllowsModel 检查是否允许使用指定模型
+// 白名单支持 * 通配（如 claude-*-haiku-*），不区分大小写；空列表 = 全部模型
+func (cfg *APIKeyConfig) AllowsModel(model string) bool {
+	if len(cfg.AllowedModels) == 0 {
+		return true
+	}
+	model = strings.ToLower(model)
+	for _, pattern := range cfg.AllowedModels {
+		if ok, _ := path.Match(strings.ToLower(pattern), model); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // GetAllowedGroups 获取允许的分组列表
 func (m *APIKeyManager) GetAllowedGroups(key string) []string {
 	cfg := m.Get(key)
@@ -96,28 +316,45 @@ func (m *APIKeyManager) IsEmpty() bool {
 	return len(m.keys) == 0
 }
 
-// AddKey 添加 API key
-func (m *APIKeyManager) AddKey(cfg APIKeyConfig) {
+// AddKey 添加 API key（cfg.Key 为明文，只保存哈希；未指定角色时为 client）
+// 返回保存后的配置（含 ID 与前缀）
+func (m *APIKeyManager) AddKey(cfg APIKeyConfig) *APIKeyConfig {
+	if cfg.Role == "" {
+		cfg.Role = RoleClient
+	}
+	if cfg.CreatedAt.IsZero() {
+		cfg.CreatedAt = time.Now()
+	}
+	sealAPIKey(&cfg)
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.keys[cfg.Key] = &cfg
+	m.keys[cfg.ID] = &cfg
 	// 同步到数据库
 	m.saveAPIKeyToDB(&cfg)
+	return &cfg
 }
 
 // DeleteKey 删除 API key
-func (m *APIKeyManager) DeleteKey(key string) bool {
+func (m *APIKeyManager) DeleteKey(id string) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if _, ok := m.keys[key]; !ok {
+	if _, ok := m.keys[id]; !ok {
 		return false
 	}
-	delete(m.keys, key)
+	delete(m.keys, id)
+	delete(m.persisted, id)
 	// 同步到数据库
-	m.deleteAPIKeyFromDB(key)
+	m.deleteAPIKeyFromDB(id)
+	m.quota.Forget(id)
 	return true
 }
 
+// Quota 返回 key 配额跟踪器
+func (m *APIKeyManager) Quota() *KeyQuotaTracker {
+	return m.quota
+}
+
 // GetAll 获取所有 API key 配置
 func (m *APIKeyManager) GetAll() []APIKeyConfig {
 	m.mu.RLock()
@@ -129,46 +366,180 @@ func (m *APIKeyManager) GetAll() []APIKeyConfig {
 	return result
 }
 
-// UpdateAllowedGroups 更新 key 的允许分组
-func (m *APIKeyManager) UpdateAllowedGroups(key string, groups []string) bool {
+// update 修改 key 配置并落库
+func (m *APIKeyManager) update(id string, fn func(cfg *APIKeyConfig)) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	cfg, ok := m.keys[key]
+	cfg, ok := m.keys[id]
 	if !ok {
 		return false
 	}
-	cfg.AllowedGroups = groups
+	fn(cfg)
 	// 同步到数据库
 	m.saveAPIKeyToDB(cfg)
 	return true
 }
 
+// UpdateAllowedGroups 更新 key 的允许分组
+func (m *APIKeyManager) UpdateAllowedGroups(id string, groups []string) bool {
+	return m.update(id, func(cfg *APIKeyConfig) { cfg.AllowedGroups = groups })
+}
+
+// UpdateRole 更新 key 的角色
+func (m *APIKeyManager) UpdateRole(id string, role APIKeyRole) bool {
+	return m.update(id, func(cfg *APIKeyConfig) { cfg.Role = role })
+}
+
+// SetDisabled 启用/禁用 key
+func (m *APIKeyManager) SetDisabled(id string, disabled bool) bool {
+	return m.update(id, func(cfg *APIKeyConfig) { cfg.Disabled = disabled })
+}
+
+// SetExpiresAt 设置过期时间（nil = 永不过期）
+func (m *APIKeyManager) SetExpiresAt(id string, expiresAt *time.Time) bool {
+	return m.update(id, func(cfg *APIKeyConfig) { cfg.ExpiresAt = expiresAt })
+}
+
+// SetLimits 设置配额
+func (m *APIKeyManager) SetLimits(id string, limits APIKeyLimits) bool {
+	return m.update(id, func(cfg *APIKeyConfig) { cfg.Limits = limits })
+}
+
+// SetDefaultGroup 设置默认分组（空 = 全局默认分组）
+func (m *APIKeyManager) SetDefaultGroup(id, group string) bool {
+	return m.update(id, func(cfg *APIKeyConfig) { cfg.DefaultGroup = group })
+}
+
+// SetRequestCaps 设置模型白名单与请求上限
+func (m *APIKeyManager) SetRequestCaps(id string, allowedModels []string, maxTokens, maxInputTokens, maxTools int) bool {
+	return m.update(id, func(cfg *APIKeyConfig) {
+		cfg.AllowedModels = allowedModels
+		cfg.MaxTokens = maxTokens
+		cfg.MaxInputTokens = maxInputTokens
+		cfg.MaxTools = maxTools
+	})
+}
+
+// Rotate 轮换 key：用明文 rawKey 签发继承原配置的新 key，旧 key 在宽限期内继续可用
+func (m *APIKeyManager) Rotate(id, rawKey string, grace time.Duration) (*APIKeyConfig, error) {
+	old := m.GetByID(id)
+	if old == nil {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	m.mu.RLock()
+	replacement := APIKeyConfig{
+		Key:           rawKey,
+		Name:          old.Name,
+		AllowedGroups: append([]string(nil), old.AllowedGroups...),
+		DefaultGroup:  old.DefaultGroup,
+		Role:          old.Role,
+		ExpiresAt:     old.ExpiresAt,
+		Limits:        old.Limits,
+
+		AllowedModels:  append([]string(nil), old.AllowedModels...),
+		MaxTokens:      old.MaxTokens,
+		MaxInputTokens: old.MaxInputTokens,
+		MaxTools:       old.MaxTools,
+	}
+	m.mu.RUnlock()
+	newCfg := m.AddKey(replacement)
+
+	graceEnd := time.Now().Add(grace)
+	m.update(id, func(cfg *APIKeyConfig) {
+		if cfg.ExpiresAt == nil || graceEnd.Before(*cfg.ExpiresAt) {
+			cfg.ExpiresAt = &graceEnd
+		}
+		cfg.ReplacedBy = newCfg.ID
+	})
+	return newCfg, nil
+}
+
+// IsLastAdmin 检查 key 是否为唯一可用的 admin（删除、降级或禁用会导致无法管理）
+func (m *APIKeyManager) IsLastAdmin(id string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cfg, ok := m.keys[id]
+	if !ok || cfg.Role != RoleAdmin {
+		return false
+	}
+	now := time.Now()
+	for otherID, other := range m.keys {
+		if otherID != id && other.Role == RoleAdmin && other.Usable(now) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// nullableTime 可空时间转为数据库参数
+func nullableTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
 // saveAPIKeyToDB 保存单个 API Key 到数据库
 func (m *APIKeyManager) saveAPIKeyToDB(cfg *APIKeyConfig) {
 	if m.db == nil {
 		return
 	}
+	if err := saveAPIKey(m.db, cfg); err != nil {
+		logger.Warn("保存API Key到数据库失败", logger.Err(err))
+	}
+}
 
+// saveAPIKey 写入（或更新）API Key 记录
+func saveAPIKey(db *sql.DB, cfg *APIKeyConfig) error {
 	allowedGroups := "[]"
 	if len(cfg.AllowedGroups) > 0 {
 		data, _ := json.Marshal(cfg.AllowedGroups)
 		allowedGroups = string(data)
 	}
-
-	_, err := m.db.Exec(`INSERT OR REPLACE INTO api_keys (key, name, allowed_groups) VALUES (?, ?, ?)`,
-		cfg.Key, cfg.Name, allowedGroups)
-	if err != nil {
-		logger.Warn("保存API Key到数据库失败", logger.Err(err))
+	allowedModels := "[]"
+	if len(cfg.AllowedModels) > 0 {
+		data, _ := json.Marshal(cfg.AllowedModels)
+		allowedModels = string(data)
+	}
+	disabled := 0
+	if cfg.Disabled {
+		disabled = 1
 	}
+	createdAt := cfg.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO api_keys (id, key_hash, salt, prefix, name, allowed_groups, role, expires_at, last_used_at, disabled, replaced_by,
+			rpm_limit, concurrency_limit, daily_token_limit, monthly_token_limit, daily_credit_limit,
+			allowed_models, max_tokens, max_input_tokens, max_tools, default_group, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name, allowed_groups = excluded.allowed_groups, role = excluded.role,
+			expires_at = excluded.expires_at, last_used_at = excluded.last_used_at,
+			disabled = excluded.disabled, replaced_by = excluded.replaced_by,
+			rpm_limit = excluded.rpm_limit, concurrency_limit = excluded.concurrency_limit,
+			daily_token_limit = excluded.daily_token_limit, monthly_token_limit = excluded.monthly_token_limit,
+			daily_credit_limit = excluded.daily_credit_limit,
+			allowed_models = excluded.allowed_models, max_tokens = excluded.max_tokens,
+			max_input_tokens = excluded.max_input_tokens, max_tools = excluded.max_tools,
+			default_group = excluded.default_group`,
+		cfg.ID, cfg.KeyHash, cfg.Salt, cfg.Prefix, cfg.Name, allowedGroups, string(cfg.Role),
+		nullableTime(cfg.ExpiresAt), nullableTime(cfg.LastUsedAt), disabled, cfg.ReplacedBy,
+		cfg.Limits.RPM, cfg.Limits.MaxConcurrent, cfg.Limits.DailyTokens, cfg.Limits.MonthlyTokens, cfg.Limits.DailyCredit,
+		allowedModels, cfg.MaxTokens, cfg.MaxInputTokens, cfg.MaxTools, cfg.DefaultGroup, createdAt)
+	return err
 }
 
 // deleteAPIKeyFromDB 从数据库删除 API Key
-func (m *APIKeyManager) deleteAPIKeyFromDB(key string) {
+func (m *APIKeyManager) deleteAPIKeyFromDB(id string) {
 	if m.db == nil {
 		return
 	}
 
-	_, err := m.db.Exec(`DELETE FROM api_keys WHERE key = ?`, key)
+	_, err := m.db.Exec(`DELETE FROM api_keys WHERE id = ?`, id)
 	if err != nil {
 		logger.Warn("从数据库删除API Key失败", logger.Err(err))
 	}
@@ -180,7 +551,15 @@ func (m *APIKeyManager) loadAPIKeysFromDB() []APIKeyConfig {
 		return nil
 	}
 
-	rows, err := m.db.Query(`SELECT key, name, allowed_groups FROM api_keys`)
+	rows, err := m.db.Query(`
+		SELECT id, COALESCE(key_hash, ''), COALESCE(salt, ''), COALESCE(prefix, ''), COALESCE(name, ''),
+			COALESCE(allowed_groups, '[]'), COALESCE(role, ''), expires_at, last_used_at,
+			COALESCE(disabled, 0), COALESCE(replaced_by, ''),
+			COALESCE(rpm_limit, 0), COALESCE(concurrency_limit, 0), COALESCE(daily_token_limit, 0),
+			COALESCE(monthly_token_limit, 0), COALESCE(daily_credit_limit, 0),
+			COALESCE(allowed_models, '[]'), COALESCE(max_tokens, 0), COALESCE(max_input_tokens, 0), COALESCE(max_tools, 0),
+			COALESCE(default_group, ''), created_at
+		FROM api_keys ORDER BY created_at, rowid`)
 	if err != nil {
 		logger.Warn("从数据库加载API Keys失败", logger.Err(err))
 		return nil
@@ -189,19 +568,54 @@ func (m *APIKeyManager) loadAPIKeysFromDB() []APIKeyConfig {
 
 	var keys []APIKeyConfig
 	for rows.Next() {
-		var key, name, allowedGroupsJSON string
-		if err := rows.Scan(&key, &name, &allowedGroupsJSON); err != nil {
+		var id, keyHash, salt, prefix, name, allowedGroupsJSON, role, replacedBy, allowedModelsJSON, defaultGroup string
+		var maxTokens, maxInputTokens, maxTools int
+		var expiresAt, lastUsedAt, createdAt sql.NullTime
+		var disabled int
+		var limits APIKeyLimits
+		if err := rows.Scan(&id, &keyHash, &salt, &prefix, &name, &allowedGroupsJSON, &role,
+			&expiresAt, &lastUsedAt, &disabled, &replacedBy,
+			&limits.RPM, &limits.MaxConcurrent, &limits.DailyTokens, &limits.MonthlyTokens, &limits.DailyCredit,
+			&allowedModelsJSON, &maxTokens, &maxInputTokens, &maxTools,
+			&defaultGroup, &createdAt); err != nil {
+			logger.Warn("读取API Key失败", logger.Err(err))
 			continue
 		}
 
-		var allowedGroups []string
+		var allowedGroups, allowedModels []string
 		json.Unmarshal([]byte(allowedGroupsJSON), &allowedGroups)
+		json.Unmarshal([]byte(allowedModelsJSON), &allowedModels)
 
-		keys = append(keys, APIKeyConfig{
-			Key:           key,
+		cfg := APIKeyConfig{
+			ID:            id,
+			KeyHash:       keyHash,
+			Salt:          salt,
+			Prefix:        prefix,
 			Name:          name,
 			AllowedGroups: allowedGroups,
-		})
+			DefaultGroup:  defaultGroup,
+			Role:          APIKeyRole(role),
+			Disabled:      disabled != 0,
+			ReplacedBy:    replacedBy,
+			Limits:        limits,
+			CreatedAt:     createdAt.Time,
+
+			AllowedModels:  allowedModels,
+			MaxTokens:      maxTokens,
+			MaxInputTokens: maxInputTokens,
+			MaxTools:       maxTools,
+		}
+		if keyHash == "" {
+			// 旧版本明文存储，ID 列即明文 key
+			cfg.Key = id
+		}
+		if expiresAt.Valid {
+			cfg.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			cfg.LastUsedAt = &lastUsedAt.Time
+		}
+		keys = append(keys, cfg)
 	}
 	return keys
 }
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAPIKeyRole(t *testing.T) {
+	role, ok := ParseAPIKeyRole("")
+	assert.True(t, ok)
+	assert.Equal(t, RoleClient, role)
+
+	role, ok = ParseAPIKeyRole("viewer")
+	assert.True(t, ok)
+	assert.Equal(t, RoleViewer, role)
+
+	_, ok = ParseAPIKeyRole("root")
+	assert.False(t, ok)
+}
+
+func TestAssignLegacyRoles_EnvKeyBecomesAdmin(t *testing.T) {
+	keys := []APIKeyConfig{{Key: "old"}, {Key: "env"}, {Key: "new", Role: RoleViewer}}
+
+	updated := assignLegacyRoles(keys, "env")
+
+	assert.Equal(t, []int{0, 1}, updated)
+	assert.Equal(t, RoleClient, keys[0].Role)
+	assert.Equal(t, RoleAdmin, keys[1].Role)
+	assert.Equal(t, RoleViewer, keys[2].Role)
+}
+
+func TestAssignLegacyRoles_OldestBecomesAdminWithoutEnvKey(t *testing.T) {
+	keys := []APIKeyConfig{{Key: "first"}, {Key: "second"}}
+
+	assignLegacyRoles(keys, "")
+
+	assert.Equal(t, RoleAdmin, keys[0].Role)
+	assert.Equal(t, RoleClient, keys[1].Role)
+}
+
+func TestAssignLegacyRoles_ExistingAdminKept(t *testing.T) {
+	keys := []APIKeyConfig{{Key: "legacy"}, {Key: "admin", Role: RoleAdmin}}
+
+	assignLegacyRoles(keys, "")
+
+	assert.Equal(t, RoleClient, keys[0].Role)
+}
+
+func TestAPIKeyManager_IsLastAdmin(t *testing.T) {
+	t.Setenv("KIRO_CLIENT_TOKEN", "")
+	m := NewAPIKeyManager(nil)
+	admin := m.AddKey(APIKeyConfig{Key: "admin-key", Role: RoleAdmin})
+	client := m.AddKey(APIKeyConfig{Key: "client-key"})
+
+	assert.True(t, m.IsLastAdmin(admin.ID))
+	assert.False(t, m.IsLastAdmin(client.ID))
+
+	other := m.AddKey(APIKeyConfig{Key: "other-admin", Role: RoleAdmin})
+	assert.False(t, m.IsLastAdmin(admin.ID))
+
+	// 已禁用的 admin 不计入
+	m.SetDisabled(other.ID, true)
+	assert.True(t, m.IsLastAdmin(admin.ID))
+}
+
+func TestAPIKeyManager_StoresOnlyHash(t *testing.T) {
+	t.Setenv("KIRO_CLIENT_TOKEN", "")
+	m := NewAPIKeyManager(nil)
+	cfg := m.AddKey(APIKeyConfig{Key: "k2a_secret-value-123"})
+
+	assert.Empty(t, cfg.Key)
+	assert.NotEmpty(t, cfg.KeyHash)
+	assert.Equal(t, "k2a_secr", cfg.Prefix)
+	assert.NotContains(t, cfg.KeyHash, "secret")
+	assert.True(t, strings.HasPrefix(cfg.ID, "key_"))
+
+	assert.Equal(t, cfg, m.Get("k2a_secret-value-123"))
+	assert.Nil(t, m.Get("k2a_secret-value-124"))
+}
+
+func TestAPIKeyManager_AuthenticateRejectsDisabledAndExpired(t *testing.T) {
+	t.Setenv("KIRO_CLIENT_TOKEN", "")
+	m := NewAPIKeyManager(nil)
+	cfg := m.AddKey(APIKeyConfig{Key: "k2a_auth-test"})
+
+	got, err := m.Authenticate("k2a_auth-test")
+	assert.NoError(t, err)
+	assert.NotNil(t, got.LastUsedAt)
+
+	m.SetDisabled(cfg.ID, true)
+	_, err = m.Authenticate("k2a_auth-test")
+	assert.ErrorIs(t, err, ErrAPIKeyDisabled)
+
+	m.SetDisabled(cfg.ID, false)
+	past := time.Now().Add(-time.Minute)
+	m.SetExpiresAt(cfg.ID, &past)
+	_, err = m.Authenticate("k2a_auth-test")
+	assert.ErrorIs(t, err, ErrAPIKeyExpired)
+
+	_, err = m.Authenticate("unknown")
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+}
+
+func TestAPIKeyManager_RotateKeepsOldKeyDuringGrace(t *testing.T) {
+	t.Setenv("KIRO_CLIENT_TOKEN", "")
+	m := NewAPIKeyManager(nil)
+	old := m.AddKey(APIKeyConfig{Key: "k2a_old-key", Name: "team", Role: RoleViewer, AllowedGroups: []string{"pro"}})
+
+	newCfg, err := m.Rotate(old.ID, "k2a_new-key", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "team", newCfg.Name)
+	assert.Equal(t, RoleViewer, newCfg.Role)
+	assert.Equal(t, []string{"pro"}, newCfg.AllowedGroups)
+
+	_, err = m.Authenticate("k2a_old-key")
+	assert.NoError(t, err, "宽限期内旧 key 仍可用")
+	_, err = m.Authenticate("k2a_new-key")
+	assert.NoError(t, err)
+	assert.Equal(t, newCfg.ID, m.GetByID(old.ID).ReplacedBy)
+
+	_, err = m.Rotate(old.ID, "k2a_newer-key", 0)
+	assert.NoError(t, err)
+	_, err = m.Authenticate("k2a_old-key")
+	assert.ErrorIs(t, err, ErrAPIKeyExpired, "宽限期为 0 时旧 key 立即失效")
+}
+
+func TestNewAPIKeyManager_HashesLegacyPlaintextKeys(t *testing.T) {
+	t.Setenv("KIRO_CLIENT_TOKEN", "")
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// 旧版本表结构：明文 key 作为主键
+	_, err = db.Exec(`CREATE TABLE api_keys (key TEXT PRIMARY KEY, name TEXT, allowed_groups TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP)`)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO api_keys (key, name, allowed_groups) VALUES ('legacy-plain-key', 'old', '[]')`)
+	assert.NoError(t, err)
+	_, err = db.Exec(schema)
+	assert.NoError(t, err)
+	assert.NoError(t, renameColumns(db))
+	assert.NoError(t, migrateColumns(db))
+
+	m := NewAPIKeyManager(db)
+	cfg, err := m.Authenticate("legacy-plain-key")
+	assert.NoError(t, err)
+	assert.Equal(t, RoleAdmin, cfg.Role, "唯一的旧 key 升为 admin")
+
+	var count int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM api_keys WHERE id = 'legacy-plain-key'`).Scan(&count))
+	assert.Equal(t, 0, count, "数据库不应再保存明文 key")
+
+	// 重新加载后仍可认证
+	reloaded := NewAPIKeyManager(db)
+	_, err = reloaded.Authenticate("legacy-plain-key")
+	assert.NoError(t, err)
+}
+
+func TestAPIKeyConfig_AllowsModel(t *testing.T) {
+	all := &APIKeyConfig{}
+	assert.True(t, all.AllowsModel("claude-opus-4-5"))
+
+	cfg := &APIKeyConfig{AllowedModels: []string{"claude-*haiku*", "claude-sonnet-4-5"}}
+	assert.True(t, cfg.AllowsModel("claude-3-5-haiku-20241022"))
+	assert.True(t, cfg.AllowsModel("Claude-Haiku-4-5"))
+	assert.True(t, cfg.AllowsModel("claude-sonnet-4-5"))
+	assert.False(t, cfg.AllowsModel("claude-sonnet-4-5-20250929"))
+	assert.False(t, cfg.AllowsModel("claude-opus-4-5"))
+}
+
+func TestAPIKeyConfig_RouteGroup(t *testing.T) {
+	cfg := &APIKeyConfig{AllowedGroups: []string{"team", "pro"}, DefaultGroup: "team"}
+
+	group, err := cfg.RouteGroup("")
+	assert.NoError(t, err)
+	assert.Equal(t, "team", group)
+
+	group, err = cfg.RouteGroup("pro")
+	assert.NoError(t, err)
+	assert.Equal(t, "pro", group)
+
+	_, err = cfg.RouteGroup("other")
+	assert.ErrorIs(t, err, ErrGroupNotAllowed)
+
+	group, err = (&APIKeyConfig{}).RouteGroup("")
+	assert.NoError(t, err)
+	assert.Equal(t, "", group, "未设置默认分组时使用全局默认")
+}
@@ -14,6 +14,7 @@ import (
 type AuthService struct {
 	poolManager *TokenPoolManager
 	repo        *TokenRepository
+	refresher   *BackgroundRefresher
 }
 
 // NewAuthService 创建新的认证服务
@@ -86,6 +87,7 @@ func NewAuthService() (*AuthService, error) {
 		}
 	}
 
+	groupManager.repo = repo
 	groupManager.Init(groups)
 
 	// 创建 Token 池管理器
@@ -100,6 +102,7 @@ func NewAuthService() (*AuthService, error) {
 	as := &AuthService{
 		poolManager: poolManager,
 		repo:        repo,
+		refresher:   refresher,
 	}
 
 	// 注册回调：Token刷新后同步更新poolManager缓存
@@ -144,15 +147,38 @@ func (as *AuthService) GetToken(group string) (types.TokenInfo, error) {
 	if as.poolManager == nil {
 		return types.TokenInfo{}, fmt.Errorf("token管理器未初始化")
 	}
-	return as.poolManager.GetBestToken(group)
+	return as.poolManager.GetBestToken(group, "")
 }
 
-// GetTokenWithUsage 获取可用的token（包含使用信息）
-func (as *AuthService) GetTokenWithUsage(group string, sessionID string) (*types.TokenWithUsage, error) {
+// GetTokenForModel 获取可用的token（跳过已知不支持该模型的 token）
+func (as *AuthService) GetTokenForModel(group string, model string) (types.TokenInfo, error) {
+	if as.poolManager == nil {
+		return types.TokenInfo{}, fmt.Errorf("token管理器未初始化")
+	}
+	return as.poolManager.GetBestToken(group, model)
+}
+
+// GetTokenWithUsage 获取可用的token（包含使用信息，model 非空时跳过不支持该模型的 token）
+func (as *AuthService) GetTokenWithUsage(group string, sessionID string, model string) (*types.TokenWithUsage, error) {
 	if as.poolManager == nil {
 		return nil, fmt.Errorf("token管理器未初始化")
 	}
-	return as.poolManager.GetBestTokenWithUsage(group, sessionID)
+	return as.poolManager.GetBestTokenWithUsage(group, sessionID, model)
+}
+
+// RecordModelAccess 记录 token 对模型的可用性（上游返回模型不可用时 supported=false）
+func (as *AuthService) RecordModelAccess(token types.TokenInfo, model string, supported bool, reason string) {
+	if as.poolManager != nil {
+		as.poolManager.modelAccess.Record(token.ID, model, supported, reason)
+	}
+}
+
+// GetModelAccess 获取 token 的模型可用性记录
+func (as *AuthService) GetModelAccess(tokenID int64) []ModelAccess {
+	if as.poolManager == nil {
+		return nil
+	}
+	return as.poolManager.modelAccess.ForToken(tokenID)
 }
 
 // GetPoolManager 获取底层的 TokenPoolManager
@@ -160,6 +186,30 @@ func (as *AuthService) GetPoolManager() *TokenPoolManager {
 	return as.poolManager
 }
 
+// GetGroupManager 获取分组管理器（与 Token 池共享同一实例）
+func (as *AuthService) GetGroupManager() *GroupManager {
+	if as.poolManager == nil || as.poolManager.GetGroupManager() == nil {
+		return groupManager
+	}
+	return as.poolManager.GetGroupManager()
+}
+
+// GetGroupSettings 获取分组自身设置（未覆盖的字段为零值）
+func (as *AuthService) GetGroupSettings(group string) GroupSettings {
+	if group == "" {
+		group = GetDefaultGroup()
+	}
+	return as.GetGroupManager().Settings(group)
+}
+
+// GetFallbackChain 获取分组降级链（首位为分组自身）
+func (as *AuthService) GetFallbackChain(group string) []string {
+	if group == "" {
+		group = GetDefaultGroup()
+	}
+	return as.GetGroupManager().FallbackChain(group)
+}
+
 // MarkTokenFailed 标记 token 失败
 func (as *AuthService) MarkTokenFailed(token types.TokenInfo) {
 	if as.poolManager != nil {
@@ -167,10 +217,39 @@ func (as *AuthService) MarkTokenFailed(token types.TokenInfo) {
 	}
 }
 
-// RecordRequest 记录请求结果
-func (as *AuthService) RecordRequest(token types.TokenInfo, latency time.Duration, success bool) {
+// MarkTokenFailedWithCooldown 按指定时长熔断 token
+func (as *AuthService) MarkTokenFailedWithCooldown(token types.TokenInfo, cooldown time.Duration) {
+	if as.poolManager != nil {
+		as.poolManager.MarkTokenFailedWithCooldown(token, cooldown)
+	}
+}
+
+// MarkTokenExhausted 标记 token 额度耗尽
+func (as *AuthService) MarkTokenExhausted(token types.TokenInfo) {
+	if as.poolManager != nil {
+		as.poolManager.MarkTokenExhausted(token)
+	}
+}
+
+// RecordUpstreamResult 记录上游请求结果（计入 Token 统计并驱动熔断器）
+func (as *AuthService) RecordUpstreamResult(token types.TokenInfo, success bool) {
+	if as.poolManager != nil {
+		as.poolManager.RecordUpstreamResult(token, success)
+	}
+}
+
+// ResetBreaker 手动重置 Token 熔断器
+func (as *AuthService) ResetBreaker(tokenID int64) bool {
+	if as.poolManager == nil {
+		return false
+	}
+	return as.poolManager.ResetBreaker(tokenID)
+}
+
+// RecordLatency 记录请求耗时
+func (as *AuthService) RecordLatency(token types.TokenInfo, latency time.Duration) {
 	if as.poolManager != nil {
-		as.poolManager.RecordRequest(token, latency, success)
+		as.poolManager.RecordLatency(token, latency)
 	}
 }
 
@@ -225,6 +304,9 @@ func (as *AuthService) RemoveConfig(id int) error {
 	if err := as.repo.Delete(int64(id)); err != nil {
 		return err
 	}
+	if as.poolManager != nil {
+		as.poolManager.modelAccess.Forget(int64(id))
+	}
 
 	as.refreshPoolManager()
 	return nil
@@ -263,6 +345,13 @@ func (as *AuthService) GetRepository() *TokenRepository {
 	return as.repo
 }
 
+// Close 停止后台任务（退出时调用，数据库由 CloseDB 关闭）
+func (as *AuthService) Close() {
+	if as.refresher != nil {
+		as.refresher.Stop()
+	}
+}
+
 // refreshPoolManager 刷新 poolManager 配置
 func (as *AuthService) refreshPoolManager() {
 	configs, err := loadConfigsFromDB(as.repo)
@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState 熔断器状态
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // 正常放行
+	BreakerOpen     BreakerState = "open"      // 熔断中，拒绝所有请求
+	BreakerHalfOpen BreakerState = "half_open" // 半开，仅放行一个探测请求
+)
+
+const (
+	breakerWindowSize          = 20               // 失败率统计窗口（请求数）
+	breakerMinRequests         = 5                // 窗口内最少请求数才按失败率熔断
+	breakerFailureRate         = 0.5              // 触发熔断的窗口失败率
+	breakerConsecutiveFailures = 3                // 连续失败次数触发熔断
+	breakerMaxBackoff          = 30 * time.Minute // 熔断时长上限
+	breakerProbeTimeout        = 2 * time.Minute  // 探测请求超时未回报则允许新的探测
+)
+
+// CircuitBreaker 单 Token 熔断器（closed/open/half-open，指数退避）
+// 失败统计来自 TokenMetrics，熔断器只记录当前统计窗口的起点
+type CircuitBreaker struct {
+	mu           sync.Mutex
+	state        BreakerState
+	trips        int       // 连续熔断次数（决定退避倍数）
+	openUntil    time.Time // 熔断结束时间
+	probing      bool      // 半开状态下是否已有探测请求
+	probeStarted time.Time
+	window       BreakerCounts // 统计窗口起点
+	rebase       bool          // 下次记录时以本次结果开启新窗口（熔断、重置之后）
+}
+
+// BreakerCounts TokenMetrics 中驱动熔断器的累计计数
+type BreakerCounts struct {
+	Requests            int64
+	Failures            int64
+	ConsecutiveFailures int64
+}
+
+// BreakerSnapshot 熔断器状态快照
+type BreakerSnapshot struct {
+	State     BreakerState `json:"state"`
+	Trips     int          `json:"trips"`
+	OpenUntil time.Time    `json:"open_until,omitempty"`
+}
+
+// currentState 计算当前状态（熔断到期自动进入半开），调用者需持有锁
+func (b *CircuitBreaker) currentState(now time.Time) BreakerState {
+	switch b.state {
+	case BreakerOpen:
+		if !now.Before(b.openUntil) {
+			b.state = BreakerHalfOpen
+			b.probing = false
+		}
+	case "":
+		b.state = BreakerClosed
+	}
+	if b.state == BreakerHalfOpen && b.probing && now.Sub(b.probeStarted) > breakerProbeTimeout {
+		b.probing = false
+	}
+	return b.state
+}
+
+// Available 是否可被选择（不占用探测名额）
+func (b *CircuitBreaker) Available(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState(now) {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		return !b.probing
+	}
+	return false
+}
+
+// TryAcquire 选中 Token 时调用，半开状态下只有一个请求能成功占用探测名额
+func (b *CircuitBreaker) TryAcquire(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState(now) {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		b.probeStarted = now
+		return true
+	}
+	return false
+}
+
+// Record 按 TokenMetrics 的计数判断是否熔断（counts 需已包含本次结果），base 为首次熔断时长
+func (b *CircuitBreaker) Record(success bool, counts BreakerCounts, now time.Time, base time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState(now) {
+	case BreakerHalfOpen:
+		if success {
+			b.reset()
+		} else {
+			b.trip(now, base)
+		}
+	case BreakerClosed:
+		requests := counts.Requests - b.window.Requests
+		if b.rebase || requests <= 0 || requests > breakerWindowSize {
+			// 窗口从本次结果开始
+			b.window = BreakerCounts{Requests: counts.Requests - 1, Failures: counts.Failures}
+			if !success {
+				b.window.Failures--
+			}
+			b.rebase = false
+			requests = 1
+		}
+		if success {
+			return
+		}
+
+		failures := counts.Failures - b.window.Failures
+		consecutive := min(counts.ConsecutiveFailures, requests)
+		rate := float64(failures) / float64(requests)
+		if consecutive >= breakerConsecutiveFailures ||
+			(requests >= breakerMinRequests && rate >= breakerFailureRate) {
+			b.trip(now, base)
+		}
+	}
+}
+
+// Trip 立即熔断（如上游返回 429/5xx）
+func (b *CircuitBreaker) Trip(now time.Time, base time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// 已熔断时不重复累加（并发请求同时失败）
+	if b.currentState(now) == BreakerOpen {
+		return
+	}
+	b.trip(now, base)
+}
+
+// Reset 手动恢复为关闭状态
+func (b *CircuitBreaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reset()
+}
+
+// Snapshot 获取状态快照
+func (b *CircuitBreaker) Snapshot(now time.Time) BreakerSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snap := BreakerSnapshot{State: b.currentState(now), Trips: b.trips}
+	if snap.State == BreakerOpen {
+		snap.OpenUntil = b.openUntil
+	}
+	return snap
+}
+
+// trip 进入熔断，时长按连续熔断次数指数退避，调用者需持有锁
+func (b *CircuitBreaker) trip(now time.Time, base time.Duration) {
+	b.trips++
+	b.state = BreakerOpen
+	b.openUntil = now.Add(breakerBackoff(base, b.trips))
+	b.probing = false
+	b.rebase = true
+}
+
+// reset 恢复关闭状态，调用者需持有锁
+func (b *CircuitBreaker) reset() {
+	b.state = BreakerClosed
+	b.trips = 0
+	b.openUntil = time.Time{}
+	b.probing = false
+	b.rebase = true
+}
+
+// breakerBackoff 计算第 trips 次熔断的时长 base * 2^(trips-1)，不超过上限
+func breakerBackoff(base time.Duration, trips int) time.Duration {
+	if base <= 0 {
+		base = time.Second
+	}
+	d := base
+	for i := 1; i < trips; i++ {
+		d *= 2
+		if d >= breakerMaxBackoff {
+			return breakerMaxBackoff
+		}
+	}
+	if d > breakerMaxBackoff {
+		return breakerMaxBackoff
+	}
+	return d
+}
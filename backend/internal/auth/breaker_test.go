@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordResult 按上游结果更新 TokenMetrics 并驱动熔断器（与 RecordUpstreamResult 一致）
+func recordResult(m *TokenMetrics, success bool, now time.Time) {
+	m.RecordRequest(0, success)
+	m.Breaker().Record(success, m.BreakerCounts(), now, time.Minute)
+}
+
+func TestCircuitBreaker_TripsOnConsecutiveFailures(t *testing.T) {
+	m := &TokenMetrics{}
+	b := m.Breaker()
+	now := time.Now()
+
+	recordResult(m, false, now)
+	recordResult(m, false, now)
+	assert.True(t, b.Available(now))
+
+	recordResult(m, false, now)
+	assert.False(t, b.Available(now))
+	assert.Equal(t, BreakerOpen, b.Snapshot(now).State)
+}
+
+func TestCircuitBreaker_TripsOnFailureRate(t *testing.T) {
+	m := &TokenMetrics{}
+	now := time.Now()
+
+	// 交替成功失败，不会连续失败 3 次，但窗口失败率达到 50%
+	for i := 0; i < 3; i++ {
+		recordResult(m, true, now)
+		recordResult(m, false, now)
+	}
+
+	assert.Equal(t, BreakerOpen, m.Breaker().Snapshot(now).State)
+	assert.Equal(t, 0.5, m.FailureRate())
+}
+
+func TestCircuitBreaker_WindowIgnoresHistoryBeforeReset(t *testing.T) {
+	m := &TokenMetrics{}
+	m.Restore(100, 90, 0) // 历史失败率很高
+	now := time.Now()
+
+	m.Breaker().Reset()
+	recordResult(m, false, now)
+	recordResult(m, true, now)
+	recordResult(m, false, now)
+	assert.Equal(t, BreakerClosed, m.Breaker().Snapshot(now).State)
+
+	// 只按重置后窗口内的结果判断
+	recordResult(m, false, now)
+	recordResult(m, false, now)
+	assert.Equal(t, BreakerOpen, m.Breaker().Snapshot(now).State)
+}
+
+func TestCircuitBreaker_HalfOpenAllowsSingleProbe(t *testing.T) {
+	b := &CircuitBreaker{}
+	now := time.Now()
+	b.Trip(now, time.Minute)
+
+	assert.False(t, b.TryAcquire(now.Add(30*time.Second)))
+
+	later := now.Add(time.Minute)
+	assert.True(t, b.Available(later))
+	assert.True(t, b.TryAcquire(later))
+	assert.False(t, b.TryAcquire(later))
+	assert.False(t, b.Available(later))
+	assert.Equal(t, BreakerHalfOpen, b.Snapshot(later).State)
+
+	// 探测成功后关闭
+	b.Record(true, BreakerCounts{Requests: 1}, later, time.Minute)
+	assert.Equal(t, BreakerClosed, b.Snapshot(later).State)
+	assert.Equal(t, 0, b.Snapshot(later).Trips)
+}
+
+func TestCircuitBreaker_ExponentialBackoff(t *testing.T) {
+	b := &CircuitBreaker{}
+	now := time.Now()
+
+	b.Trip(now, time.Minute)
+	assert.Equal(t, now.Add(time.Minute), b.Snapshot(now).OpenUntil)
+
+	// 已熔断时重复 Trip 不累加
+	b.Trip(now, time.Minute)
+	assert.Equal(t, 1, b.Snapshot(now).Trips)
+
+	// 探测失败，熔断时长翻倍
+	probe := now.Add(time.Minute)
+	assert.True(t, b.TryAcquire(probe))
+	b.Record(false, BreakerCounts{Requests: 1, Failures: 1, ConsecutiveFailures: 1}, probe, time.Minute)
+	snap := b.Snapshot(probe)
+	assert.Equal(t, BreakerOpen, snap.State)
+	assert.Equal(t, 2, snap.Trips)
+	assert.Equal(t, probe.Add(2*time.Minute), snap.OpenUntil)
+}
+
+func TestCircuitBreaker_ProbeTimeout(t *testing.T) {
+	b := &CircuitBreaker{}
+	now := time.Now()
+	b.Trip(now, time.Second)
+
+	probe := now.Add(time.Second)
+	assert.True(t, b.TryAcquire(probe))
+	assert.False(t, b.TryAcquire(probe.Add(time.Minute)))
+	assert.True(t, b.TryAcquire(probe.Add(breakerProbeTimeout+time.Second)))
+}
+
+func TestCircuitBreaker_Reset(t *testing.T) {
+	b := &CircuitBreaker{}
+	now := time.Now()
+	b.Trip(now, time.Hour)
+
+	b.Reset()
+
+	assert.True(t, b.Available(now))
+	assert.Equal(t, BreakerClosed, b.Snapshot(now).State)
+}
+
+func TestBreakerBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, breakerBackoff(30*time.Second, 1))
+	assert.Equal(t, 120*time.Second, breakerBackoff(30*time.Second, 3))
+	assert.Equal(t, breakerMaxBackoff, breakerBackoff(30*time.Second, 20))
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"kiro2api/internal/logger"
 )
@@ -66,11 +67,50 @@ func loadConfigs() ([]AuthConfig, error) {
 	return []AuthConfig{}, nil
 }
 
+// APIKeyRole API Key 角色
+type APIKeyRole string
+
+const (
+	RoleAdmin  APIKeyRole = "admin"  // 全部管理接口 + AI API
+	RoleViewer APIKeyRole = "viewer" // 只读统计与日志
+	RoleClient APIKeyRole = "client" // 仅 AI API（/v1）
+)
+
+// ParseAPIKeyRole 解析角色名（空值为 client）
+func ParseAPIKeyRole(s string) (APIKeyRole, bool) {
+	switch APIKeyRole(s) {
+	case "", RoleClient:
+		return RoleClient, true
+	case RoleAdmin, RoleViewer:
+		return APIKeyRole(s), true
+	}
+	return "", false
+}
+
 // APIKeyConfig API Key 配置
+// 明文 Key 仅在创建/导入时传入，落库与常驻内存的只有加盐哈希和展示前缀
 type APIKeyConfig struct {
-	Key           string   `json:"key"`
-	Name          string   `json:"name,omitempty"`
-	AllowedGroups []string `json:"allowed_groups"` // 白名单，空=全权限
+	ID            string       `json:"id,omitempty"`  // 不透明 ID，管理接口使用
+	Key           string       `json:"key,omitempty"` // 明文 key（仅创建/导入）
+	KeyHash       string       `json:"-"`
+	Salt          string       `json:"-"`
+	Prefix        string       `json:"prefix,omitempty"` // 展示前缀
+	Name          string       `json:"name,omitempty"`
+	AllowedGroups []string     `json:"allowed_groups"`          // 白名单，空=全权限
+	DefaultGroup  string       `json:"default_group,omitempty"` // 未带分组前缀的请求使用的分组，空=全局默认
+	Role          APIKeyRole   `json:"role,omitempty"`
+	ExpiresAt     *time.Time   `json:"expires_at,omitempty"`
+	LastUsedAt    *time.Time   `json:"last_used_at,omitempty"`
+	Disabled      bool         `json:"disabled,omitempty"`
+	ReplacedBy    string       `json:"replaced_by,omitempty"` // 轮换后的新 key ID
+	Limits        APIKeyLimits `json:"limits"`
+	CreatedAt     time.Time    `json:"created_at,omitempty"`
+
+	// 请求限制（0 = 不限制），在获取 Token 前检查
+	AllowedModels  []string `json:"allowed_models"`             // 模型白名单（支持 * 通配），空=全部
+	MaxTokens      int      `json:"max_tokens,omitempty"`       // max_tokens 上限
+	MaxInputTokens int      `json:"max_input_tokens,omitempty"` // 估算输入 tokens 上限
+	MaxTools       int      `json:"max_tools,omitempty"`        // 工具数量上限
 }
 
 // GlobalConfig 全局配置结构（新格式）
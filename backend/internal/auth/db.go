@@ -61,16 +61,122 @@ CREATE TABLE IF NOT EXISTS groups (
     rate_limit_qps REAL DEFAULT 0,
     rate_limit_burst INTEGER DEFAULT 0,
     cooldown_sec INTEGER DEFAULT 0,
+    strategy TEXT DEFAULT '',
+    fallback_groups TEXT DEFAULT '',
+    stream_first_byte_timeout_sec INTEGER DEFAULT 0,
+    stream_idle_timeout_sec INTEGER DEFAULT 0,
+    stream_total_timeout_sec INTEGER DEFAULT 0,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
+-- API Key 只保存加盐哈希；id 为不透明 ID（旧版本该列名为 key 且保存明文，启动时迁移）
 CREATE TABLE IF NOT EXISTS api_keys (
-    key TEXT PRIMARY KEY,
+    id TEXT PRIMARY KEY,
+    key_hash TEXT DEFAULT '',
+    salt TEXT DEFAULT '',
+    prefix TEXT DEFAULT '',
     name TEXT,
     allowed_groups TEXT,
+    role TEXT DEFAULT '',
+    expires_at DATETIME,
+    last_used_at DATETIME,
+    disabled INTEGER DEFAULT 0,
+    replaced_by TEXT DEFAULT '',
+    rpm_limit INTEGER DEFAULT 0,
+    concurrency_limit INTEGER DEFAULT 0,
+    daily_token_limit INTEGER DEFAULT 0,
+    monthly_token_limit INTEGER DEFAULT 0,
+    daily_credit_limit REAL DEFAULT 0,
+    allowed_models TEXT DEFAULT '[]',
+    max_tokens INTEGER DEFAULT 0,
+    max_input_tokens INTEGER DEFAULT 0,
+    max_tools INTEGER DEFAULT 0,
+    default_group TEXT DEFAULT '',
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
+-- API Key 用量（period 为 UTC 日 2006-01-02 或月 2006-01）
+CREATE TABLE IF NOT EXISTS api_key_usage (
+    key_id TEXT NOT NULL,
+    period TEXT NOT NULL,
+    tokens INTEGER DEFAULT 0,
+    credit REAL DEFAULT 0,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (key_id, period)
+);
+
+-- 模型注册表（对外别名 -> 上游模型 ID，定价为每百万 tokens）
+CREATE TABLE IF NOT EXISTS models (
+    id TEXT PRIMARY KEY,
+    upstream_id TEXT NOT NULL,
+    display_name TEXT DEFAULT '',
+    context_window INTEGER DEFAULT 200000,
+    max_output INTEGER DEFAULT 64000,
+    input_price REAL DEFAULT 0,
+    output_price REAL DEFAULT 0,
+    cache_read_price REAL DEFAULT 0,
+    enabled INTEGER DEFAULT 1,
+    allowed_groups TEXT DEFAULT '[]',
+    deleted INTEGER DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 模型路由规则（列表与目标分组以 JSON 保存）
+CREATE TABLE IF NOT EXISTS routing_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT DEFAULT '',
+    priority INTEGER DEFAULT 0,
+    enabled INTEGER DEFAULT 1,
+    models TEXT DEFAULT '[]',
+    api_keys TEXT DEFAULT '[]',
+    has_tools INTEGER,
+    thinking INTEGER,
+    min_complexity INTEGER DEFAULT 0,
+    max_complexity INTEGER DEFAULT 0,
+    targets TEXT DEFAULT '[]',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Token 模型可用性（从上游错误学习，模型为上游模型 ID）
+CREATE TABLE IF NOT EXISTS token_model_access (
+    token_id INTEGER NOT NULL,
+    model TEXT NOT NULL,
+    supported INTEGER DEFAULT 1,
+    reason TEXT DEFAULT '',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (token_id, model)
+);
+
+-- 消息批处理（Message Batches API），status: in_progress / canceling / ended
+CREATE TABLE IF NOT EXISTS message_batches (
+    id TEXT PRIMARY KEY,
+    api_key_id TEXT DEFAULT '',
+    group_name TEXT DEFAULT '',
+    status TEXT DEFAULT 'in_progress',
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    cancel_initiated_at DATETIME,
+    ended_at DATETIME
+);
+
+-- 批处理中的单个请求，status: pending / succeeded / errored / canceled / expired
+-- not_before 为重试时间（Unix 毫秒）
+CREATE TABLE IF NOT EXISTS message_batch_requests (
+    batch_id TEXT NOT NULL,
+    idx INTEGER NOT NULL,
+    custom_id TEXT NOT NULL,
+    params TEXT NOT NULL,
+    status TEXT DEFAULT 'pending',
+    result TEXT,
+    attempts INTEGER DEFAULT 0,
+    not_before INTEGER DEFAULT 0,
+    PRIMARY KEY (batch_id, idx)
+);
+
+CREATE INDEX IF NOT EXISTS idx_batch_requests_status ON message_batch_requests(status, batch_id);
+
 CREATE TABLE IF NOT EXISTS migrations (
     version INTEGER PRIMARY KEY,
     applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
@@ -83,6 +189,115 @@ CREATE TABLE IF NOT EXISTS settings (
 );
 `
 
+// columnMigration 为已有表补充新增列
+type columnMigration struct {
+	table  string
+	column string
+	ddl    string
+}
+
+// columnMigrations 新增列清单（CREATE TABLE IF NOT EXISTS 不会为旧库补列）
+var columnMigrations = []columnMigration{
+	{"groups", "strategy", "TEXT DEFAULT ''"},
+	{"groups", "fallback_groups", "TEXT DEFAULT ''"},
+	{"groups", "stream_first_byte_timeout_sec", "INTEGER DEFAULT 0"},
+	{"groups", "stream_idle_timeout_sec", "INTEGER DEFAULT 0"},
+	{"groups", "stream_total_timeout_sec", "INTEGER DEFAULT 0"},
+	{"api_keys", "role", "TEXT DEFAULT ''"},
+	{"api_keys", "key_hash", "TEXT DEFAULT ''"},
+	{"api_keys", "salt", "TEXT DEFAULT ''"},
+	{"api_keys", "prefix", "TEXT DEFAULT ''"},
+	{"api_keys", "expires_at", "DATETIME"},
+	{"api_keys", "last_used_at", "DATETIME"},
+	{"api_keys", "disabled", "INTEGER DEFAULT 0"},
+	{"api_keys", "replaced_by", "TEXT DEFAULT ''"},
+	{"api_keys", "rpm_limit", "INTEGER DEFAULT 0"},
+	{"api_keys", "concurrency_limit", "INTEGER DEFAULT 0"},
+	{"api_keys", "daily_token_limit", "INTEGER DEFAULT 0"},
+	{"api_keys", "monthly_token_limit", "INTEGER DEFAULT 0"},
+	{"api_keys", "daily_credit_limit", "REAL DEFAULT 0"},
+	{"api_keys", "allowed_models", "TEXT DEFAULT '[]'"},
+	{"api_keys", "max_tokens", "INTEGER DEFAULT 0"},
+	{"api_keys", "max_input_tokens", "INTEGER DEFAULT 0"},
+	{"api_keys", "max_tools", "INTEGER DEFAULT 0"},
+	{"api_keys", "default_group", "TEXT DEFAULT ''"},
+	{"models", "deleted", "INTEGER DEFAULT 0"},
+}
+
+// columnRename 已有表的列重命名
+type columnRename struct {
+	table string
+	from  string
+	to    string
+}
+
+// columnRenames 列重命名清单（旧列存在且新列不存在时执行，先于补列）
+var columnRenames = []columnRename{
+	{"api_keys", "key", "id"},
+}
+
+// renameColumns 执行列重命名
+func renameColumns(db *sql.DB) error {
+	for _, r := range columnRenames {
+		hasFrom, err := columnExists(db, r.table, r.from)
+		if err != nil {
+			return err
+		}
+		hasTo, err := columnExists(db, r.table, r.to)
+		if err != nil {
+			return err
+		}
+		if !hasFrom || hasTo {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", r.table, r.from, r.to)); err != nil {
+			return fmt.Errorf("重命名列 %s.%s 失败: %w", r.table, r.from, err)
+		}
+		logger.Info("数据库列重命名", logger.String("table", r.table), logger.String("from", r.from), logger.String("to", r.to))
+	}
+	return nil
+}
+
+// migrateColumns 检查并补充缺失列
+func migrateColumns(db *sql.DB) error {
+	for _, m := range columnMigrations {
+		exists, err := columnExists(db, m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.ddl)); err != nil {
+			return fmt.Errorf("添加列 %s.%s 失败: %w", m.table, m.column, err)
+		}
+		logger.Info("数据库补充列", logger.String("table", m.table), logger.String("column", m.column))
+	}
+	return nil
+}
+
+// columnExists 检查表中是否存在指定列
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
 // InitDB 初始化数据库连接
 func InitDB(path string) error {
 	dbOnce.Do(func() {
@@ -121,6 +336,14 @@ func initDatabase() error {
 		db.Close()
 		return fmt.Errorf("初始化数据库表失败: %w", err)
 	}
+	if err := renameColumns(db); err != nil {
+		db.Close()
+		return fmt.Errorf("数据库列重命名失败: %w", err)
+	}
+	if err := migrateColumns(db); err != nil {
+		db.Close()
+		return fmt.Errorf("数据库列迁移失败: %w", err)
+	}
 
 	globalDB = db
 	logger.Info("SQLite数据库初始化完成", logger.String("path", dbPath))
@@ -2,17 +2,64 @@ package auth
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
+	"kiro2api/internal/config"
 	"kiro2api/internal/logger"
 )
 
 // GroupSettings 分组级别设置
 type GroupSettings struct {
-	Priority       int     `json:"priority,omitempty"`         // 分组优先级
+	Priority       int     `json:"priority,omitempty"`         // 分组优先级（限流排队时高优先级先获取令牌）
 	RateLimitQPS   float64 `json:"rate_limit_qps,omitempty"`   // 0 = 使用全局
 	RateLimitBurst int     `json:"rate_limit_burst,omitempty"` // 0 = 使用全局
 	CooldownSec    int     `json:"cooldown_sec,omitempty"`     // 0 = 使用全局
+	Strategy       string  `json:"strategy,omitempty"`         // Token 选择策略，空 = 轮询
+
+	StreamFirstByteTimeoutSec int `json:"stream_first_byte_timeout_sec,omitempty"` // 0 = 使用全局
+	StreamIdleTimeoutSec      int `json:"stream_idle_timeout_sec,omitempty"`       // 0 = 使用全局
+	StreamTotalTimeoutSec     int `json:"stream_total_timeout_sec,omitempty"`      // 0 = 使用全局
+}
+
+// HasRateLimit 分组是否覆盖了全局限流
+func (s GroupSettings) HasRateLimit() bool {
+	return s.RateLimitQPS > 0 || s.RateLimitBurst > 0
+}
+
+// Resolve 合并全局设置，返回分组生效设置（分组非零值覆盖全局）
+func (s GroupSettings) Resolve(global config.Settings) GroupSettings {
+	if s.RateLimitQPS <= 0 {
+		s.RateLimitQPS = global.RateLimitQPS
+	}
+	if s.RateLimitBurst <= 0 {
+		s.RateLimitBurst = global.RateLimitBurst
+	}
+	if s.CooldownSec <= 0 {
+		s.CooldownSec = global.CooldownSec
+	}
+	if s.CooldownSec <= 0 {
+		s.CooldownSec = int(config.TokenCooldownDuration.Seconds())
+	}
+	if s.Strategy == "" {
+		s.Strategy = StrategyRoundRobin
+	}
+	if s.StreamFirstByteTimeoutSec <= 0 {
+		s.StreamFirstByteTimeoutSec = global.StreamFirstByteTimeoutSec
+	}
+	if s.StreamFirstByteTimeoutSec <= 0 {
+		s.StreamFirstByteTimeoutSec = int(config.DefaultStreamFirstByteTimeout.Seconds())
+	}
+	if s.StreamIdleTimeoutSec <= 0 {
+		s.StreamIdleTimeoutSec = global.StreamIdleTimeoutSec
+	}
+	if s.StreamIdleTimeoutSec <= 0 {
+		s.StreamIdleTimeoutSec = int(config.DefaultStreamIdleTimeout.Seconds())
+	}
+	if s.StreamTotalTimeoutSec <= 0 {
+		s.StreamTotalTimeoutSec = global.StreamTotalTimeoutSec
+	}
+	return s
 }
 
 // GroupConfig 分组配置
@@ -20,6 +67,8 @@ type GroupConfig struct {
 	Name        string        `json:"name"`
 	DisplayName string        `json:"display_name,omitempty"`
 	Settings    GroupSettings `json:"settings"`
+
+	FallbackGroups []string `json:"fallback_groups,omitempty"` // 有序降级分组（本组无可用 Token 时依次尝试）
 }
 
 // GroupManager 分组管理器
@@ -90,7 +139,7 @@ func (gm *GroupManager) Get(name string) *GroupConfig {
 	return gm.groups[name]
 }
 
-// List 列出所有分组
+// List 列出所有分组（按优先级降序、名称升序）
 func (gm *GroupManager) List() []*GroupConfig {
 	gm.mu.RLock()
 	defer gm.mu.RUnlock()
@@ -99,9 +148,30 @@ func (gm *GroupManager) List() []*GroupConfig {
 	for _, g := range gm.groups {
 		result = append(result, g)
 	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Settings.Priority != result[j].Settings.Priority {
+			return result[i].Settings.Priority > result[j].Settings.Priority
+		}
+		return result[i].Name < result[j].Name
+	})
 	return result
 }
 
+// Settings 获取分组自身设置（未配置的分组返回零值）
+func (gm *GroupManager) Settings(name string) GroupSettings {
+	gm.mu.RLock()
+	defer gm.mu.RUnlock()
+	if g, ok := gm.groups[name]; ok {
+		return g.Settings
+	}
+	return GroupSettings{}
+}
+
+// EffectiveSettings 获取分组生效设置（分组覆盖全局）
+func (gm *GroupManager) EffectiveSettings(name string) GroupSettings {
+	return gm.Settings(name).Resolve(getSettings())
+}
+
 // Create 创建分组
 func (gm *GroupManager) Create(name, displayName string) error {
 	gm.mu.Lock()
@@ -163,6 +233,88 @@ func (gm *GroupManager) Update(name string, displayName *string, settings *Group
 	return nil
 }
 
+// SetFallbackGroups 设置分组的降级链
+func (gm *GroupManager) SetFallbackGroups(name string, fallbacks []string) error {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+
+	g, exists := gm.groups[name]
+	if !exists {
+		return fmt.Errorf("分组不存在: %s", name)
+	}
+
+	seen := make(map[string]bool, len(fallbacks))
+	cleaned := make([]string, 0, len(fallbacks))
+	for _, fb := range fallbacks {
+		if fb == name {
+			return fmt.Errorf("降级分组不能包含自身: %s", fb)
+		}
+		if _, ok := gm.groups[fb]; !ok {
+			return fmt.Errorf("降级分组不存在: %s", fb)
+		}
+		if seen[fb] {
+			continue
+		}
+		seen[fb] = true
+		cleaned = append(cleaned, fb)
+	}
+	g.FallbackGroups = cleaned
+
+	if gm.repo != nil {
+		if err := gm.repo.UpdateGroup(g); err != nil {
+			logger.Warn("更新分组到数据库失败", logger.Err(err), logger.String("name", name))
+		}
+	}
+
+	logger.Info("更新分组降级链", logger.String("name", name), logger.Any("fallback_groups", cleaned))
+	return nil
+}
+
+// FallbackChain 获取分组降级链（首位为分组自身，后续为已存在的降级分组）
+func (gm *GroupManager) FallbackChain(name string) []string {
+	gm.mu.RLock()
+	defer gm.mu.RUnlock()
+
+	chain := []string{name}
+	g, exists := gm.groups[name]
+	if !exists {
+		return chain
+	}
+	for _, fb := range g.FallbackGroups {
+		if _, ok := gm.groups[fb]; ok && fb != name {
+			chain = append(chain, fb)
+		}
+	}
+	return chain
+}
+
+// replaceFallbackRef 更新其他分组降级链中的引用（newName 为空表示移除），调用者需持有写锁
+func (gm *GroupManager) replaceFallbackRef(oldName, newName string) {
+	for _, g := range gm.groups {
+		changed := false
+		updated := make([]string, 0, len(g.FallbackGroups))
+		for _, fb := range g.FallbackGroups {
+			if fb != oldName {
+				updated = append(updated, fb)
+				continue
+			}
+			changed = true
+			if newName != "" {
+				updated = append(updated, newName)
+			}
+		}
+		if !changed {
+			continue
+		}
+		g.FallbackGroups = updated
+		if gm.repo != nil {
+			if err := gm.repo.UpdateGroup(g); err != nil {
+				logger.Warn("更新分组到数据库失败", logger.Err(err), logger.String("name", g.Name))
+			}
+		}
+	}
+}
+
 // Rename 重命名分组
 func (gm *GroupManager) Rename(oldName, newName string) error {
 	gm.mu.Lock()
@@ -196,6 +348,7 @@ func (gm *GroupManager) Rename(oldName, newName string) error {
 	delete(gm.groups, oldName)
 	g.Name = newName
 	gm.groups[newName] = g
+	gm.replaceFallbackRef(oldName, newName)
 
 	logger.Info("重命名分组", logger.String("old", oldName), logger.String("new", newName))
 	return nil
@@ -225,6 +378,7 @@ func (gm *GroupManager) Delete(name string) error {
 	}
 
 	delete(gm.groups, name)
+	gm.replaceFallbackRef(name, "")
 	logger.Info("删除分组", logger.String("name", name))
 	return nil
 }
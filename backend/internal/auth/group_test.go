@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"testing"
+
+	"kiro2api/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupSettings_Resolve_FallbackToGlobal(t *testing.T) {
+	global := config.Settings{RateLimitQPS: 50, RateLimitBurst: 100, CooldownSec: 30}
+
+	eff := GroupSettings{}.Resolve(global)
+
+	assert.Equal(t, 50.0, eff.RateLimitQPS)
+	assert.Equal(t, 100, eff.RateLimitBurst)
+	assert.Equal(t, 30, eff.CooldownSec)
+}
+
+func TestGroupSettings_Resolve_GroupOverrides(t *testing.T) {
+	global := config.Settings{RateLimitQPS: 50, RateLimitBurst: 100, CooldownSec: 30}
+
+	eff := GroupSettings{Priority: 3, RateLimitQPS: 5, CooldownSec: 120}.Resolve(global)
+
+	assert.Equal(t, 3, eff.Priority)
+	assert.Equal(t, 5.0, eff.RateLimitQPS)
+	assert.Equal(t, 100, eff.RateLimitBurst)
+	assert.Equal(t, 120, eff.CooldownSec)
+}
+
+func TestGroupSettings_Resolve_DefaultCooldown(t *testing.T) {
+	eff := GroupSettings{}.Resolve(config.Settings{})
+
+	assert.Equal(t, int(config.TokenCooldownDuration.Seconds()), eff.CooldownSec)
+}
+
+func TestGroupManager_ListSortedByPriority(t *testing.T) {
+	gm := NewGroupManager(nil)
+	gm.Init(map[string]*GroupConfig{
+		"low":  {Name: "low"},
+		"high": {Name: "high", Settings: GroupSettings{Priority: 10}},
+		"mid":  {Name: "mid", Settings: GroupSettings{Priority: 5}},
+	})
+
+	names := make([]string, 0)
+	for _, g := range gm.List() {
+		names = append(names, g.Name)
+	}
+
+	assert.Equal(t, []string{"high", "mid", "default", "low"}, names)
+}
+
+func TestGroupManager_EffectiveSettings(t *testing.T) {
+	gm := NewGroupManager(nil)
+	gm.Init(map[string]*GroupConfig{
+		"pro": {Name: "pro", Settings: GroupSettings{CooldownSec: 600}},
+	})
+
+	assert.Equal(t, 600, gm.EffectiveSettings("pro").CooldownSec)
+	assert.Equal(t, GroupSettings{}.Resolve(getSettings()).CooldownSec, gm.EffectiveSettings("default").CooldownSec)
+}
+
+func TestGroupManager_FallbackChain(t *testing.T) {
+	gm := NewGroupManager(nil)
+	gm.Init(map[string]*GroupConfig{
+		"pro":      {Name: "pro"},
+		"overflow": {Name: "overflow"},
+	})
+
+	assert.Error(t, gm.SetFallbackGroups("pro", []string{"pro"}))
+	assert.Error(t, gm.SetFallbackGroups("pro", []string{"missing"}))
+	assert.NoError(t, gm.SetFallbackGroups("pro", []string{"default", "overflow", "default"}))
+
+	assert.Equal(t, []string{"pro", "default", "overflow"}, gm.FallbackChain("pro"))
+	assert.Equal(t, []string{"default"}, gm.FallbackChain("default"))
+}
+
+func TestGroupManager_FallbackRefsFollowRenameAndDelete(t *testing.T) {
+	gm := NewGroupManager(nil)
+	gm.Init(map[string]*GroupConfig{
+		"pro":      {Name: "pro"},
+		"overflow": {Name: "overflow"},
+	})
+	assert.NoError(t, gm.SetFallbackGroups("pro", []string{"overflow", "default"}))
+
+	assert.NoError(t, gm.Rename("overflow", "spare"))
+	assert.Equal(t, []string{"pro", "spare", "default"}, gm.FallbackChain("pro"))
+
+	assert.NoError(t, gm.Delete("spare"))
+	assert.Equal(t, []string{"pro", "default"}, gm.FallbackChain("pro"))
+}
@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"kiro2api/internal/logger"
+)
+
+// APIKeyLimits API Key 配额（0 = 不限制）
+type APIKeyLimits struct {
+	RPM           int     `json:"rpm,omitempty"`            // 每分钟请求数
+	MaxConcurrent int     `json:"max_concurrent,omitempty"` // 并发请求数
+	DailyTokens   int64   `json:"daily_tokens,omitempty"`   // 每日 input+output tokens
+	MonthlyTokens int64   `json:"monthly_tokens,omitempty"` // 每月 input+output tokens
+	DailyCredit   float64 `json:"daily_credit,omitempty"`   // 每日 credit 预算（来自 meteringEvent）
+}
+
+// 配额类型
+const (
+	QuotaRequests      = "requests"
+	QuotaConcurrency   = "concurrency"
+	QuotaDailyTokens   = "daily_tokens"
+	QuotaMonthlyTokens = "monthly_tokens"
+	QuotaDailyCredit   = "daily_credit"
+)
+
+// QuotaExceededError 配额超限
+type QuotaExceededError struct {
+	Kind    string
+	Limit   float64
+	Used    float64
+	ResetAt time.Time // 并发超限时为零值
+}
+
+func (e *QuotaExceededError) Error() string {
+	switch e.Kind {
+	case QuotaRequests:
+		return fmt.Sprintf("API Key 每分钟请求数超出限制 (%g)", e.Limit)
+	case QuotaConcurrency:
+		return fmt.Sprintf("API Key 并发请求数超出限制 (%g)", e.Limit)
+	case QuotaDailyTokens:
+		return fmt.Sprintf("API Key 今日 token 用量已达上限 (%g)", e.Limit)
+	case QuotaMonthlyTokens:
+		return fmt.Sprintf("API Key 本月 token 用量已达上限 (%g)", e.Limit)
+	case QuotaDailyCredit:
+		return fmt.Sprintf("API Key 今日 credit 预算已用尽 (%g)", e.Limit)
+	}
+	return "API Key 配额超限"
+}
+
+// KeyUsage API Key 当前用量
+type KeyUsage struct {
+	RequestsLastMinute int     `json:"requests_last_minute"`
+	Concurrent         int     `json:"concurrent"`
+	DailyTokens        int64   `json:"daily_tokens"`
+	MonthlyTokens      int64   `json:"monthly_tokens"`
+	DailyCredit        float64 `json:"daily_credit"`
+}
+
+// keyCounters 单个 key 的计数器
+type keyCounters struct {
+	requests []time.Time // 最近一分钟的请求时间（滑动窗口）
+	inflight int
+
+	day           string // 当前日周期（UTC，2006-01-02）
+	dailyTokens   int64
+	dailyCredit   float64
+	month         string // 当前月周期（UTC，2006-01）
+	monthlyTokens int64
+}
+
+// KeyQuotaTracker 按 API Key 统计用量并执行配额
+// 请求数与并发只在内存中计数；token 与 credit 按日/月周期落库，重启后继续累计
+type KeyQuotaTracker struct {
+	mu       sync.Mutex
+	db       *sql.DB
+	counters map[string]*keyCounters // key ID -> 计数器
+	now      func() time.Time
+}
+
+// NewKeyQuotaTracker 创建配额跟踪器（db 为 nil 时不持久化）
+func NewKeyQuotaTracker(db *sql.DB) *KeyQuotaTracker {
+	return &KeyQuotaTracker{
+		db:       db,
+		counters: make(map[string]*keyCounters),
+		now:      time.Now,
+	}
+}
+
+// dayPeriod / monthPeriod 周期标识（UTC）
+func dayPeriod(t time.Time) string   { return t.UTC().Format("2006-01-02") }
+func monthPeriod(t time.Time) string { return t.UTC().Format("2006-01") }
+
+// nextDay / nextMonth 周期重置时间（UTC 零点）
+func nextDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+func nextMonth(t time.Time) time.Time {
+	y, m, _ := t.UTC().Date()
+	return time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// loadPeriods 跨周期时从数据库加载 key 的日/月用量
+// 在锁外查询，锁内写入前复核周期，其他请求已先加载时不覆盖其累计值
+func (q *KeyQuotaTracker) loadPeriods(id string, now time.Time) {
+	day, month := dayPeriod(now), monthPeriod(now)
+	q.mu.Lock()
+	kc, ok := q.counters[id]
+	loaded := ok && kc.day == day && kc.month == month
+	q.mu.Unlock()
+	if loaded {
+		return
+	}
+
+	dailyTokens, dailyCredit := q.loadUsage(id, day)
+	monthlyTokens, _ := q.loadUsage(id, month)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	kc = q.countersLocked(id, now)
+	if kc.day != day {
+		kc.day = day
+		kc.dailyTokens, kc.dailyCredit = dailyTokens, dailyCredit
+	}
+	if kc.month != month {
+		kc.month = month
+		kc.monthlyTokens = monthlyTokens
+	}
+}
+
+// countersLocked 获取 key 计数器（调用方持有锁，日/月用量由 loadPeriods 预先加载）
+func (q *KeyQuotaTracker) countersLocked(id string, now time.Time) *keyCounters {
+	kc, ok := q.counters[id]
+	if !ok {
+		kc = &keyCounters{}
+		q.counters[id] = kc
+	}
+
+	// 清理滑动窗口外的请求
+	cutoff := now.Add(-time.Minute)
+	i := 0
+	for i < len(kc.requests) && !kc.requests[i].After(cutoff) {
+		i++
+	}
+	kc.requests = kc.requests[i:]
+	return kc
+}
+
+// Acquire 检查配额并占用一个请求名额，返回的 release 在请求结束时调用
+func (q *KeyQuotaTracker) Acquire(cfg *APIKeyConfig) (release func(), err error) {
+	now := q.now()
+	q.loadPeriods(cfg.ID, now)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	limits := cfg.Limits
+	kc := q.countersLocked(cfg.ID, now)
+
+	switch {
+	case limits.MaxConcurrent > 0 && kc.inflight >= limits.MaxConcurrent:
+		return nil, &QuotaExceededError{Kind: QuotaConcurrency, Limit: float64(limits.MaxConcurrent), Used: float64(kc.inflight)}
+	case limits.RPM > 0 && len(kc.requests) >= limits.RPM:
+		return nil, &QuotaExceededError{Kind: QuotaRequests, Limit: float64(limits.RPM), Used: float64(len(kc.requests)),
+			ResetAt: kc.requests[0].Add(time.Minute)}
+	case limits.DailyTokens > 0 && kc.dailyTokens >= limits.DailyTokens:
+		return nil, &QuotaExceededError{Kind: QuotaDailyTokens, Limit: float64(limits.DailyTokens), Used: float64(kc.dailyTokens),
+			ResetAt: nextDay(now)}
+	case limits.MonthlyTokens > 0 && kc.monthlyTokens >= limits.MonthlyTokens:
+		return nil, &QuotaExceededError{Kind: QuotaMonthlyTokens, Limit: float64(limits.MonthlyTokens), Used: float64(kc.monthlyTokens),
+			ResetAt: nextMonth(now)}
+	case limits.DailyCredit > 0 && kc.dailyCredit >= limits.DailyCredit:
+		return nil, &QuotaExceededError{Kind: QuotaDailyCredit, Limit: limits.DailyCredit, Used: kc.dailyCredit,
+			ResetAt: nextDay(now)}
+	}
+
+	kc.requests = append(kc.requests, now)
+	kc.inflight++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			kc.inflight--
+			q.mu.Unlock()
+		})
+	}, nil
+}
+
+// Record 累计请求结束后的 token 与 credit 用量
+func (q *KeyQuotaTracker) Record(id string, tokens int64, credit float64) {
+	if tokens <= 0 && credit <= 0 {
+		return
+	}
+	now := q.now()
+	q.loadPeriods(id, now)
+	q.mu.Lock()
+	kc := q.countersLocked(id, now)
+	kc.dailyTokens += tokens
+	kc.dailyCredit += credit
+	kc.monthlyTokens += tokens
+	day, month := kc.day, kc.month
+	q.mu.Unlock()
+
+	q.addUsage(id, day, tokens, credit)
+	q.addUsage(id, month, tokens, credit)
+}
+
+// Usage 返回 key 当前用量
+func (q *KeyQuotaTracker) Usage(id string) KeyUsage {
+	now := q.now()
+	q.loadPeriods(id, now)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	kc := q.countersLocked(id, now)
+	return KeyUsage{
+		RequestsLastMinute: len(kc.requests),
+		Concurrent:         kc.inflight,
+		DailyTokens:        kc.dailyTokens,
+		MonthlyTokens:      kc.monthlyTokens,
+		DailyCredit:        kc.dailyCredit,
+	}
+}
+
+// Forget 删除 key 的计数器与用量记录
+func (q *KeyQuotaTracker) Forget(id string) {
+	q.mu.Lock()
+	delete(q.counters, id)
+	q.mu.Unlock()
+
+	if q.db == nil {
+		return
+	}
+	if _, err := q.db.Exec(`DELETE FROM api_key_usage WHERE key_id = ?`, id); err != nil {
+		logger.Warn("删除API Key用量失败", logger.Err(err))
+	}
+}
+
+// loadUsage 读取周期用量
+func (q *KeyQuotaTracker) loadUsage(id, period string) (int64, float64) {
+	if q.db == nil {
+		return 0, 0
+	}
+	var tokens int64
+	var credit float64
+	err := q.db.QueryRow(`SELECT tokens, credit FROM api_key_usage WHERE key_id = ? AND period = ?`, id, period).
+		Scan(&tokens, &credit)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Warn("读取API Key用量失败", logger.Err(err))
+	}
+	return tokens, credit
+}
+
+// addUsage 累加周期用量
+func (q *KeyQuotaTracker) addUsage(id, period string, tokens int64, credit float64) {
+	if q.db == nil {
+		return
+	}
+	_, err := q.db.Exec(`
+		INSERT INTO api_key_usage (key_id, period, tokens, credit, updated_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key_id, period) DO UPDATE SET
+			tokens = tokens + excluded.tokens, credit = credit + excluded.credit, updated_at = CURRENT_TIMESTAMP`,
+		id, period, tokens, credit)
+	if err != nil {
+		logger.Warn("保存API Key用量失败", logger.Err(err))
+	}
+}
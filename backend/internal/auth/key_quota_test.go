@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestQuotaDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(schema)
+	assert.NoError(t, err)
+	return db
+}
+
+func TestKeyQuotaTracker_RPMSlidingWindow(t *testing.T) {
+	q := NewKeyQuotaTracker(nil)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+	cfg := &APIKeyConfig{ID: "key_a", Limits: APIKeyLimits{RPM: 2}}
+
+	for i := 0; i < 2; i++ {
+		release, err := q.Acquire(cfg)
+		assert.NoError(t, err)
+		release()
+	}
+
+	_, err := q.Acquire(cfg)
+	var qe *QuotaExceededError
+	assert.ErrorAs(t, err, &qe)
+	assert.Equal(t, QuotaRequests, qe.Kind)
+	assert.Equal(t, now.Add(time.Minute), qe.ResetAt)
+
+	now = now.Add(time.Minute + time.Second)
+	_, err = q.Acquire(cfg)
+	assert.NoError(t, err)
+}
+
+func TestKeyQuotaTracker_Concurrency(t *testing.T) {
+	q := NewKeyQuotaTracker(nil)
+	cfg := &APIKeyConfig{ID: "key_a", Limits: APIKeyLimits{MaxConcurrent: 1}}
+
+	release, err := q.Acquire(cfg)
+	assert.NoError(t, err)
+
+	_, err = q.Acquire(cfg)
+	var qe *QuotaExceededError
+	assert.ErrorAs(t, err, &qe)
+	assert.Equal(t, QuotaConcurrency, qe.Kind)
+	assert.True(t, qe.ResetAt.IsZero())
+
+	release()
+	release() // 重复释放无副作用
+	assert.Equal(t, 0, q.Usage("key_a").Concurrent)
+
+	_, err = q.Acquire(cfg)
+	assert.NoError(t, err)
+}
+
+func TestKeyQuotaTracker_TokenAndCreditBudgetsPersist(t *testing.T) {
+	db := newTestQuotaDB(t)
+	now := time.Date(2026, 1, 31, 23, 0, 0, 0, time.UTC)
+	cfg := &APIKeyConfig{ID: "key_a", Limits: APIKeyLimits{DailyTokens: 1000, MonthlyTokens: 1500, DailyCredit: 0.5}}
+
+	q := NewKeyQuotaTracker(db)
+	q.now = func() time.Time { return now }
+	q.Record("key_a", 1200, 0.1)
+
+	// 重启后从数据库恢复用量
+	restarted := NewKeyQuotaTracker(db)
+	restarted.now = func() time.Time { return now }
+	usage := restarted.Usage("key_a")
+	assert.Equal(t, int64(1200), usage.DailyTokens)
+	assert.Equal(t, int64(1200), usage.MonthlyTokens)
+	assert.InDelta(t, 0.1, usage.DailyCredit, 1e-9)
+
+	_, err := restarted.Acquire(cfg)
+	var qe *QuotaExceededError
+	assert.ErrorAs(t, err, &qe)
+	assert.Equal(t, QuotaDailyTokens, qe.Kind)
+	assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), qe.ResetAt)
+
+	// 跨日重置日配额，月配额仍然累计
+	now = now.Add(2 * time.Hour)
+	restarted.Record("key_a", 0, 0.6)
+	_, err = restarted.Acquire(cfg)
+	assert.ErrorAs(t, err, &qe)
+	assert.Equal(t, QuotaDailyCredit, qe.Kind)
+
+	cfg.Limits.DailyCredit = 0
+	_, err = restarted.Acquire(cfg)
+	assert.NoError(t, err, "新月份的月配额重新计算")
+}
+
+func TestKeyQuotaTracker_ConcurrentLoadKeepsRecordedUsage(t *testing.T) {
+	db := newTestQuotaDB(t)
+	NewKeyQuotaTracker(db).Record("key_a", 100, 0)
+
+	// 多个请求同时首次加载用量时，后加载的不覆盖已累计的用量
+	q := NewKeyQuotaTracker(db)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.Record("key_a", 10, 0)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(300), q.Usage("key_a").DailyTokens)
+	assert.Equal(t, int64(300), NewKeyQuotaTracker(db).Usage("key_a").DailyTokens)
+}
+
+func TestKeyQuotaTracker_Forget(t *testing.T) {
+	db := newTestQuotaDB(t)
+	q := NewKeyQuotaTracker(db)
+	q.Record("key_a", 10, 0)
+
+	q.Forget("key_a")
+
+	var count int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM api_key_usage WHERE key_id = 'key_a'`).Scan(&count))
+	assert.Equal(t, 0, count)
+	assert.Equal(t, int64(0), q.Usage("key_a").DailyTokens)
+}
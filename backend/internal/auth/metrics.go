@@ -14,8 +14,16 @@ type TokenMetrics struct {
 	requestCount int64 // 请求总数
 	totalLatency int64 // 总延迟 (纳秒)
 	failureCount int64 // 失败次数
+	consecutive  int64 // 连续失败次数
 	lastRequest  int64 // 最后请求时间 (Unix纳秒)
 	inFlight     int64 // 当前正在处理的请求数
+
+	breaker CircuitBreaker // 熔断器（由请求结果驱动）
+}
+
+// Breaker 获取熔断器
+func (m *TokenMetrics) Breaker() *CircuitBreaker {
+	return &m.breaker
 }
 
 // RecordRequest 记录一次请求
@@ -25,6 +33,24 @@ func (m *TokenMetrics) RecordRequest(latency time.Duration, success bool) {
 	atomic.StoreInt64(&m.lastRequest, time.Now().UnixNano())
 	if !success {
 		atomic.AddInt64(&m.failureCount, 1)
+		atomic.AddInt64(&m.consecutive, 1)
+	} else {
+		atomic.StoreInt64(&m.consecutive, 0)
+	}
+}
+
+// RecordLatency 记录请求耗时（成功/失败由 RecordRequest 按上游结果记录）
+func (m *TokenMetrics) RecordLatency(latency time.Duration) {
+	atomic.AddInt64(&m.totalLatency, int64(latency))
+	atomic.StoreInt64(&m.lastRequest, time.Now().UnixNano())
+}
+
+// BreakerCounts 熔断器使用的累计计数
+func (m *TokenMetrics) BreakerCounts() BreakerCounts {
+	return BreakerCounts{
+		Requests:            atomic.LoadInt64(&m.requestCount),
+		Failures:            atomic.LoadInt64(&m.failureCount),
+		ConsecutiveFailures: atomic.LoadInt64(&m.consecutive),
 	}
 }
 
@@ -128,16 +128,12 @@ func migrateAPIKeys(keys []APIKeyConfig) error {
 	}
 
 	for _, key := range keys {
-		allowedGroups := "[]"
-		if len(key.AllowedGroups) > 0 {
-			data, _ := json.Marshal(key.AllowedGroups)
-			allowedGroups = string(data)
+		if key.Key == "" {
+			continue
 		}
-
-		_, err := db.Exec(`INSERT OR IGNORE INTO api_keys (key, name, allowed_groups) VALUES (?, ?, ?)`,
-			key.Key, key.Name, allowedGroups)
-		if err != nil {
-			logger.Warn("迁移API Key失败", logger.Err(err), logger.String("key", key.Key[:8]+"..."))
+		sealAPIKey(&key)
+		if err := saveAPIKey(db, &key); err != nil {
+			logger.Warn("迁移API Key失败", logger.Err(err), logger.String("prefix", key.Prefix))
 		}
 	}
 	return nil
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/internal/config"
+	"kiro2api/internal/logger"
+)
+
+// modelAccessRecheckInterval 不支持记录的有效期，过期后允许再次尝试（账号可能已升级）
+const modelAccessRecheckInterval = 24 * time.Hour
+
+// ModelAccess 单个 Token 对某个上游模型的可用性
+type ModelAccess struct {
+	Model     string    `json:"model"` // 上游模型 ID
+	Supported bool      `json:"supported"`
+	Reason    string    `json:"reason,omitempty"` // 不支持时的上游原因
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ModelAccessMatrix Token × 模型 可用性矩阵（从上游响应学习，SQLite 持久化）
+// 未记录的组合视为可用
+type ModelAccessMatrix struct {
+	mu      sync.RWMutex
+	db      *sql.DB
+	entries map[int64]map[string]*ModelAccess // tokenID -> 上游模型 ID -> 记录
+}
+
+// NewModelAccessMatrix 创建可用性矩阵并从数据库加载
+func NewModelAccessMatrix(db *sql.DB) *ModelAccessMatrix {
+	m := &ModelAccessMatrix{db: db, entries: make(map[int64]map[string]*ModelAccess)}
+	if err := m.load(); err != nil {
+		logger.Warn("加载Token模型可用性失败", logger.Err(err))
+	}
+	return m
+}
+
+// upstreamModelKey 将请求模型解析为上游模型 ID（别名共享同一条记录）
+func upstreamModelKey(model string) string {
+	if upstream, ok := config.GetModelRegistry().Resolve(model); ok {
+		return upstream
+	}
+	return strings.ToLower(model)
+}
+
+// load 从数据库加载矩阵
+func (m *ModelAccessMatrix) load() error {
+	if m.db == nil {
+		return nil
+	}
+	rows, err := m.db.Query(`SELECT token_id, model, supported, COALESCE(reason, ''), updated_at FROM token_model_access`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for rows.Next() {
+		var tokenID int64
+		var supported int
+		entry := &ModelAccess{}
+		if err := rows.Scan(&tokenID, &entry.Model, &supported, &entry.Reason, &entry.UpdatedAt); err != nil {
+			return err
+		}
+		entry.Supported = supported != 0
+		m.setLocked(tokenID, entry)
+	}
+	return rows.Err()
+}
+
+// setLocked 写入内存（调用方持有写锁）
+func (m *ModelAccessMatrix) setLocked(tokenID int64, entry *ModelAccess) {
+	models, ok := m.entries[tokenID]
+	if !ok {
+		models = make(map[string]*ModelAccess)
+		m.entries[tokenID] = models
+	}
+	models[entry.Model] = entry
+}
+
+// Supports 检查 Token 是否可能支持模型（仅在有未过期的不支持记录时返回 false）
+func (m *ModelAccessMatrix) Supports(tokenID int64, model string) bool {
+	if m == nil || model == "" {
+		return true
+	}
+	key := upstreamModelKey(model)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entry, ok := m.entries[tokenID][key]
+	if !ok || entry.Supported {
+		return true
+	}
+	return time.Since(entry.UpdatedAt) > modelAccessRecheckInterval
+}
+
+// Record 记录 Token 对模型的可用性（状态未变化时不写库）
+func (m *ModelAccessMatrix) Record(tokenID int64, model string, supported bool, reason string) {
+	if m == nil || tokenID <= 0 || model == "" {
+		return
+	}
+	key := upstreamModelKey(model)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.entries[tokenID][key]; ok && existing.Supported && supported {
+		return
+	}
+	if supported {
+		reason = ""
+	}
+	entry := &ModelAccess{Model: key, Supported: supported, Reason: reason, UpdatedAt: time.Now()}
+	m.setLocked(tokenID, entry)
+
+	if m.db == nil {
+		return
+	}
+	flag := 0
+	if supported {
+		flag = 1
+	}
+	if _, err := m.db.Exec(`
+		INSERT INTO token_model_access (token_id, model, supported, reason, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(token_id, model) DO UPDATE SET
+			supported = excluded.supported, reason = excluded.reason, updated_at = excluded.updated_at`,
+		tokenID, key, flag, reason, entry.UpdatedAt); err != nil {
+		logger.Warn("保存Token模型可用性失败",
+			logger.Int64("token_id", tokenID),
+			logger.String("model", key),
+			logger.Err(err))
+	}
+}
+
+// ForToken 列出 Token 的模型可用性记录（按模型排序）
+func (m *ModelAccessMatrix) ForToken(tokenID int64) []ModelAccess {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := make([]ModelAccess, 0, len(m.entries[tokenID]))
+	for _, entry := range m.entries[tokenID] {
+		list = append(list, *entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].Model) < strings.ToLower(list[j].Model) })
+	return list
+}
+
+// Forget 删除 Token 的全部记录（Token 删除时调用）
+func (m *ModelAccessMatrix) Forget(tokenID int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, tokenID)
+	if m.db != nil {
+		if _, err := m.db.Exec(`DELETE FROM token_model_access WHERE token_id = ?`, tokenID); err != nil {
+			logger.Warn("删除Token模型可用性失败", logger.Int64("token_id", tokenID), logger.Err(err))
+		}
+	}
+}
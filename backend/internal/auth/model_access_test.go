@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelAccessMatrix_RecordAndSupports(t *testing.T) {
+	m := NewModelAccessMatrix(nil)
+
+	assert.True(t, m.Supports(1, "claude-opus-4-5"), "未记录视为可用")
+
+	m.Record(1, "claude-opus-4-5", false, "INVALID_MODEL_ID")
+	assert.False(t, m.Supports(1, "claude-opus-4-5"))
+	assert.False(t, m.Supports(1, "claude-opus-4-5-20251101"), "同一上游模型的别名共享记录")
+	assert.True(t, m.Supports(2, "claude-opus-4-5"))
+	assert.True(t, m.Supports(1, "claude-sonnet-4-5"))
+	assert.True(t, m.Supports(1, ""), "未指定模型不过滤")
+
+	// 过期后允许重新尝试
+	m.entries[1]["claude-opus-4.5"].UpdatedAt = time.Now().Add(-modelAccessRecheckInterval - time.Minute)
+	assert.True(t, m.Supports(1, "claude-opus-4-5"))
+
+	m.Record(1, "claude-opus-4-5", true, "ignored")
+	access := m.ForToken(1)
+	assert.Len(t, access, 1)
+	assert.Equal(t, "claude-opus-4.5", access[0].Model)
+	assert.True(t, access[0].Supported)
+	assert.Empty(t, access[0].Reason)
+
+	m.Forget(1)
+	assert.Empty(t, m.ForToken(1))
+}
+
+func TestModelAccessMatrix_Persists(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	db.SetMaxOpenConns(1)
+
+	m := NewModelAccessMatrix(db)
+	m.Record(7, "claude-opus-4-5", false, "INVALID_MODEL_ID")
+	m.Record(7, "claude-sonnet-4-5", true, "")
+	m.Record(8, "claude-opus-4-5", false, "INVALID_MODEL_ID")
+	m.Forget(8)
+
+	reloaded := NewModelAccessMatrix(db)
+	access := reloaded.ForToken(7)
+	assert.Len(t, access, 2)
+	assert.False(t, reloaded.Supports(7, "claude-opus-4-5"))
+	assert.Equal(t, "INVALID_MODEL_ID", access[0].Reason)
+	assert.Empty(t, reloaded.ForToken(8))
+}
+
+func TestSelectToken_SkipsTokensWithoutModelAccess(t *testing.T) {
+	gp, cache := newStickyTestPool(1, 2, 3)
+	gp.access = NewModelAccessMatrix(nil)
+	gp.access.Record(1, "claude-opus-4-5", false, "INVALID_MODEL_ID")
+	gp.access.Record(2, "claude-opus-4-5", false, "INVALID_MODEL_ID")
+
+	for i := 0; i < 5; i++ {
+		pt := gp.selectToken(cache, "", StrategyRoundRobin, "claude-opus-4-5")
+		assert.Equal(t, int64(3), pt.Config.TokenID)
+	}
+
+	pt := gp.stickySelect(cache, "session-x", "claude-opus-4-5", time.Now())
+	assert.Equal(t, int64(3), pt.Config.TokenID, "粘性选择同样跳过")
+
+	gp.access.Record(3, "claude-opus-4-5", false, "INVALID_MODEL_ID")
+	assert.False(t, gp.anySupports("claude-opus-4-5"))
+	assert.True(t, gp.anySupports("claude-sonnet-4-5"))
+}
@@ -14,11 +14,11 @@ import (
 
 // CachedToken 缓存的 Token 信息
 type CachedToken struct {
-	Token     types.TokenInfo     // Token 信息
-	UsageInfo *types.UsageLimits  // 使用限制信息
-	CachedAt  time.Time           // 缓存时间
-	Available float64             // 可用额度
-	LastUsed  time.Time           // 最后使用时间
+	Token     types.TokenInfo    // Token 信息
+	UsageInfo *types.UsageLimits // 使用限制信息
+	CachedAt  time.Time          // 缓存时间
+	Available float64            // 可用额度
+	LastUsed  time.Time          // 最后使用时间
 }
 
 // IsUsable 检查缓存的 token 是否可用
@@ -79,11 +79,8 @@ type GroupPool struct {
 	name     string
 	tokens   []*PooledToken        // 该分组的所有 Token
 	metrics  map[int]*TokenMetrics // configIndex -> metrics
-	cooldown map[int]time.Time     // configIndex -> 冷却结束时间
-	settings GroupSettings         // 分组级别设置
-
-	// 轮询索引 (atomic 操作，无锁读取)
-	roundRobinIndex uint64
+	strategy SelectionStrategy     // 选择策略（持有轮询等状态）
+	access   *ModelAccessMatrix    // Token 模型可用性（跳过已知不支持请求模型的 Token）
 }
 
 // PooledToken 池中的 Token
@@ -96,15 +93,16 @@ type PooledToken struct {
 
 // TokenPoolManager 分片锁架构的 Token 池管理器
 type TokenPoolManager struct {
-	globalMu      sync.RWMutex
-	pools         map[string]*GroupPool // group name -> pool
-	configs       []AuthConfig          // 所有配置
-	cache         *SimpleTokenCache     // 共享缓存
-	lastRefresh   time.Time
-	tokenIDToIdx  map[int64]int         // TokenID -> configIndex 映射
-	refreshing    int32                 // 异步刷新标志 (atomic)
-	groupMgr      *GroupManager         // 分组管理器
-	repo          *TokenRepository      // Token 仓库
+	globalMu     sync.RWMutex
+	pools        map[string]*GroupPool // group name -> pool
+	configs      []AuthConfig          // 所有配置
+	cache        *SimpleTokenCache     // 共享缓存
+	lastRefresh  time.Time
+	tokenIDToIdx map[int64]int      // TokenID -> configIndex 映射
+	refreshing   int32              // 异步刷新标志 (atomic)
+	groupMgr     *GroupManager      // 分组管理器
+	repo         *TokenRepository   // Token 仓库
+	modelAccess  *ModelAccessMatrix // Token 模型可用性矩阵
 }
 
 // NewTokenPoolManager 创建分片锁 Token 池管理器
@@ -117,6 +115,11 @@ func NewTokenPoolManager(configs []AuthConfig, groupMgr *GroupManager, repo *Tok
 		groupMgr:     groupMgr,
 		repo:         repo,
 	}
+	if repo != nil {
+		tpm.modelAccess = NewModelAccessMatrix(repo.db)
+	} else {
+		tpm.modelAccess = NewModelAccessMatrix(nil)
+	}
 	tpm.rebuildPools()
 
 	// 启动时同步初始化缓存（避免第一次请求失败）
@@ -226,19 +229,13 @@ func (tpm *TokenPoolManager) rebuildPools() {
 		pool, exists := tpm.pools[groupName]
 		if !exists {
 			pool = &GroupPool{
-				name:     groupName,
-				metrics:  make(map[int]*TokenMetrics),
-				cooldown: make(map[int]time.Time),
-			}
-			// 加载分组设置
-			if tpm.groupMgr != nil {
-				if gc := tpm.groupMgr.Get(groupName); gc != nil {
-					pool.settings = gc.Settings
-				}
+				name:    groupName,
+				metrics: make(map[int]*TokenMetrics),
 			}
 			tpm.pools[groupName] = pool
 		}
 		pool.tokens = tokens
+		pool.access = tpm.modelAccess
 	}
 
 	// 清理空分组
@@ -254,8 +251,9 @@ func (tpm *TokenPoolManager) rebuildPools() {
 }
 
 // GetBestToken 获取最优 Token (加权随机选择)
-func (tpm *TokenPoolManager) GetBestToken(group string) (types.TokenInfo, error) {
-	result, err := tpm.GetBestTokenWithUsage(group, "")
+// model 非空时跳过已知不支持该模型的 Token
+func (tpm *TokenPoolManager) GetBestToken(group string, model string) (types.TokenInfo, error) {
+	result, err := tpm.GetBestTokenWithUsage(group, "", model)
 	if err != nil {
 		return types.TokenInfo{}, err
 	}
@@ -263,7 +261,7 @@ func (tpm *TokenPoolManager) GetBestToken(group string) (types.TokenInfo, error)
 }
 
 // GetBestTokenWithUsage 获取最优 Token (包含使用信息)
-func (tpm *TokenPoolManager) GetBestTokenWithUsage(group string, sessionID string) (*types.TokenWithUsage, error) {
+func (tpm *TokenPoolManager) GetBestTokenWithUsage(group string, sessionID string, model string) (*types.TokenWithUsage, error) {
 	if group == "" {
 		group = GetDefaultGroup()
 	}
@@ -284,9 +282,16 @@ func (tpm *TokenPoolManager) GetBestTokenWithUsage(group string, sessionID strin
 		tpm.triggerAsyncRefresh()
 	}
 
-	// 在分组池内选择 (使用会话粘性策略，使用保存的cacheRef)
-	selected := pool.roundRobinSelect(cacheRef, sessionID)
+	// 在分组池内选择 (会话粘性 + 分组策略，使用保存的cacheRef)
+	var strategyName string
+	if tpm.groupMgr != nil {
+		strategyName = tpm.groupMgr.Settings(group).Strategy
+	}
+	selected := pool.selectToken(cacheRef, sessionID, strategyName, model)
 	if selected == nil {
+		if model != "" && !pool.anySupports(model) {
+			return nil, fmt.Errorf("分组 %s 没有支持模型 %s 的 Token", group, model)
+		}
 		return nil, fmt.Errorf("分组 %s 没有可用的 Token", group)
 	}
 
@@ -315,66 +320,52 @@ func (tpm *TokenPoolManager) GetBestTokenWithUsage(group string, sessionID strin
 	}, nil
 }
 
-// roundRobinSelect 选择 Token (支持会话粘性)
+// selectToken 选择 Token (会话粘性优先，其次按分组策略选择)
+// model 非空时候选中排除已知不支持该模型的 Token
 // 调用者不需要持有 pool.mu
-func (gp *GroupPool) roundRobinSelect(cache *SimpleTokenCache, sessionID string) *PooledToken {
+func (gp *GroupPool) selectToken(cache *SimpleTokenCache, sessionID string, strategyName string, model string) *PooledToken {
 	now := time.Now()
 	tokenCount := len(gp.tokens)
 	if tokenCount == 0 {
 		return nil
 	}
 
-	const defaultMaxConcurrent = int32(5) // 默认最大并发
-	const maxRetries = 5                  // 最多重试 5 次
+	const maxRetries = 5                     // 最多重试 5 次
 	const retryDelay = 50 * time.Millisecond // 每次重试间隔 50ms
 
-	// 计算会话粘性索引（如果提供了 sessionID）
-	var preferredIndex int = -1
-	if sessionID != "" {
-		// 使用简单的 hash 计算固定索引
-		hash := uint64(0)
-		for i := 0; i < len(sessionID); i++ {
-			hash = hash*31 + uint64(sessionID[i])
-		}
-		preferredIndex = int(hash % uint64(tokenCount))
-	}
-
-	// 只在第一次尝试时使用粘性 token
-	// 如果不可用，立即切换到轮询（不等待）
-	if preferredIndex >= 0 {
-		pt := gp.tokens[preferredIndex]
-		if gp.isTokenAvailable(pt, cache, now) {
-			logger.Info("会话粘性选择Token",
-				logger.Int("config_index", pt.ConfigIndex),
-				logger.Int("preferred_index", preferredIndex),
-				logger.String("session_id_prefix", sessionID[:minInt(20, len(sessionID))]))
-			return pt
-		}
-		// 粘性 token 不可用，记录日志后立即切换
-		logger.Warn("会话粘性Token不可用，切换到轮询",
-			logger.Int("preferred_index", preferredIndex),
-			logger.String("session_id_prefix", sessionID[:minInt(20, len(sessionID))]))
+	// 会话粘性优先（一致性哈希 + 有界负载），不满足时切换到策略选择
+	if pt := gp.stickySelect(cache, sessionID, model, now); pt != nil {
+		return pt
 	}
 
+	strategy := gp.getStrategy(strategyName)
+
 	// 多轮遍历，避免高并发时所有 token 都达到上限导致失败
 	for retry := 0; retry < maxRetries; retry++ {
-		// 遍历一轮所有 token（轮询策略）
-		for i := 0; i < tokenCount; i++ {
-			// 原子获取并递增索引
-			idx := atomic.AddUint64(&gp.roundRobinIndex, 1)
-			pt := gp.tokens[int(idx)%tokenCount]
-
-			if gp.isTokenAvailable(pt, cache, now) {
-				if retry > 0 {
-					logger.Info("轮询选择Token（重试后成功）",
-						logger.Int("config_index", pt.ConfigIndex),
-						logger.Int("retry", retry))
-				} else {
-					logger.Info("轮询选择Token",
-						logger.Int("config_index", pt.ConfigIndex))
-				}
+		candidates := make([]TokenCandidate, 0, tokenCount)
+		for _, pt := range gp.tokens {
+			if gp.isTokenAvailable(pt, cache, model, now) {
+				candidates = append(candidates, TokenCandidate{
+					Token:   pt,
+					Metrics: gp.getMetrics(pt.ConfigIndex, pt.Config.TokenID),
+				})
+			}
+		}
+
+		// 选中后占用熔断器名额，失败（半开探测已被占用）则排除后重选
+		for len(candidates) > 0 {
+			pt := strategy.Select(candidates)
+			if pt == nil {
+				break
+			}
+			if gp.claimToken(pt, now) {
+				logger.Info("策略选择Token",
+					logger.Int("config_index", pt.ConfigIndex),
+					logger.String("strategy", strategy.Name()),
+					logger.Int("retry", retry))
 				return pt
 			}
+			candidates = removeCandidate(candidates, pt)
 		}
 
 		// 一轮遍历后没找到，等待一小段时间后重试
@@ -396,8 +387,41 @@ func (gp *GroupPool) roundRobinSelect(cache *SimpleTokenCache, sessionID string)
 	return nil
 }
 
+// claimToken 占用熔断器名额（半开状态仅放行一个探测请求）
+func (gp *GroupPool) claimToken(pt *PooledToken, now time.Time) bool {
+	return gp.getMetrics(pt.ConfigIndex, pt.Config.TokenID).Breaker().TryAcquire(now)
+}
+
+// removeCandidate 从候选列表中移除指定 Token
+func removeCandidate(candidates []TokenCandidate, pt *PooledToken) []TokenCandidate {
+	result := candidates[:0]
+	for _, c := range candidates {
+		if c.Token != pt {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// getStrategy 获取分组策略实例（策略名称变化时重建，运行时切换即时生效）
+func (gp *GroupPool) getStrategy(name string) SelectionStrategy {
+	if name == "" {
+		name = StrategyRoundRobin
+	}
+
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	if gp.strategy == nil || gp.strategy.Name() != name {
+		gp.strategy = NewSelectionStrategy(name)
+		logger.Info("分组选择策略生效",
+			logger.String("group", gp.name),
+			logger.String("strategy", gp.strategy.Name()))
+	}
+	return gp.strategy
+}
+
 // isTokenAvailable 检查 token 是否可用
-func (gp *GroupPool) isTokenAvailable(pt *PooledToken, cache *SimpleTokenCache, now time.Time) bool {
+func (gp *GroupPool) isTokenAvailable(pt *PooledToken, cache *SimpleTokenCache, model string, now time.Time) bool {
 	const defaultMaxConcurrent = int32(5)
 
 	// 跳过禁用/封禁/耗尽
@@ -405,8 +429,13 @@ func (gp *GroupPool) isTokenAvailable(pt *PooledToken, cache *SimpleTokenCache,
 		return false
 	}
 
-	// 跳过冷却中
-	if cooldownUntil, ok := gp.cooldown[pt.ConfigIndex]; ok && now.Before(cooldownUntil) {
+	// 跳过已知不支持请求模型的 Token
+	if !gp.access.Supports(pt.Config.TokenID, model) {
+		return false
+	}
+
+	// 跳过熔断中（半开且已有探测请求同样跳过）
+	if !gp.getMetrics(pt.ConfigIndex, pt.Config.TokenID).Breaker().Available(now) {
 		return false
 	}
 
@@ -434,6 +463,16 @@ func (gp *GroupPool) isTokenAvailable(pt *PooledToken, cache *SimpleTokenCache,
 	return true
 }
 
+// anySupports 分组内是否存在可能支持模型的 Token
+func (gp *GroupPool) anySupports(model string) bool {
+	for _, pt := range gp.tokens {
+		if gp.access.Supports(pt.Config.TokenID, model) {
+			return true
+		}
+	}
+	return false
+}
+
 // minInt 返回两个整数中的较小值
 func minInt(a, b int) int {
 	if a < b {
@@ -453,9 +492,39 @@ func (gp *GroupPool) getMetrics(configIndex int, tokenID int64) *TokenMetrics {
 	return m
 }
 
-// RecordRequest 记录请求结果
-func (tpm *TokenPoolManager) RecordRequest(token types.TokenInfo, latency time.Duration, success bool) {
-	// 1. 复制pools快照（短暂持读锁）
+// RecordLatency 记录请求耗时（请求结果由 RecordUpstreamResult 记录）
+func (tpm *TokenPoolManager) RecordLatency(token types.TokenInfo, latency time.Duration) {
+	pool, pt := tpm.findPooledToken(token)
+	if pool == nil {
+		return
+	}
+	pool.getMetrics(pt.ConfigIndex, pt.Config.TokenID).RecordLatency(latency)
+	pool.mu.Unlock()
+}
+
+// GetGroupManager 获取分组管理器
+func (tpm *TokenPoolManager) GetGroupManager() *GroupManager {
+	return tpm.groupMgr
+}
+
+// EffectiveGroupSettings 获取分组生效设置（分组覆盖全局）
+func (tpm *TokenPoolManager) EffectiveGroupSettings(group string) GroupSettings {
+	if group == "" {
+		group = GetDefaultGroup()
+	}
+	if tpm.groupMgr == nil {
+		return GroupSettings{}.Resolve(getSettings())
+	}
+	return tpm.groupMgr.EffectiveSettings(group)
+}
+
+// breakerBase 分组首次熔断时长（分组冷却时间）
+func (tpm *TokenPoolManager) breakerBase(group string) time.Duration {
+	return time.Duration(tpm.EffectiveGroupSettings(group).CooldownSec) * time.Second
+}
+
+// findPooledToken 按 AccessToken 查找所在分组池与 Token，返回时持有 pool.mu
+func (tpm *TokenPoolManager) findPooledToken(token types.TokenInfo) (*GroupPool, *PooledToken) {
 	tpm.globalMu.RLock()
 	poolsSnapshot := make([]*GroupPool, 0, len(tpm.pools))
 	for _, pool := range tpm.pools {
@@ -464,7 +533,6 @@ func (tpm *TokenPoolManager) RecordRequest(token types.TokenInfo, latency time.D
 	cacheSnapshot := tpm.cache
 	tpm.globalMu.RUnlock()
 
-	// 2. 无globalMu的情况下操作pool.mu
 	for _, pool := range poolsSnapshot {
 		pool.mu.Lock()
 		for _, pt := range pool.tokens {
@@ -472,25 +540,67 @@ func (tpm *TokenPoolManager) RecordRequest(token types.TokenInfo, latency time.D
 			cacheSnapshot.mu.RLock()
 			cached, ok := cacheSnapshot.tokens[cacheKey]
 			cacheSnapshot.mu.RUnlock()
-			if ok {
-				if cached.Token.AccessToken == token.AccessToken {
-					pool.getMetrics(pt.ConfigIndex, pt.Config.TokenID).RecordRequest(latency, success)
-					pool.mu.Unlock()
-					return
-				}
+			if ok && cached.Token.AccessToken == token.AccessToken {
+				return pool, pt
 			}
 		}
 		pool.mu.Unlock()
 	}
+	return nil, nil
 }
 
-// MarkTokenFailed 标记 Token 失败 (触发冷却)
-func (tpm *TokenPoolManager) MarkTokenFailed(token types.TokenInfo) {
-	cooldownDuration := time.Duration(config.GetDefaultSettingsManager().Get().CooldownSec) * time.Second
-	if cooldownDuration <= 0 {
-		cooldownDuration = config.TokenCooldownDuration
+// RecordUpstreamResult 记录上游请求结果（计入 TokenMetrics 并驱动熔断器）
+func (tpm *TokenPoolManager) RecordUpstreamResult(token types.TokenInfo, success bool) {
+	pool, pt := tpm.findPooledToken(token)
+	if pool == nil {
+		return
+	}
+	m := pool.getMetrics(pt.ConfigIndex, pt.Config.TokenID)
+	pool.mu.Unlock()
+
+	breaker := m.Breaker()
+	before := breaker.Snapshot(time.Now()).State
+	m.RecordRequest(0, success)
+	breaker.Record(success, m.BreakerCounts(), time.Now(), tpm.breakerBase(pool.name))
+	if after := breaker.Snapshot(time.Now()); after.State != before {
+		logger.Info("Token熔断器状态变化",
+			logger.Int64("token_id", pt.Config.TokenID),
+			logger.String("group", pool.name),
+			logger.String("from", string(before)),
+			logger.String("to", string(after.State)),
+			logger.Int("trips", after.Trips))
+	}
+}
+
+// ResetBreaker 手动重置 Token 熔断器
+func (tpm *TokenPoolManager) ResetBreaker(tokenID int64) bool {
+	tpm.globalMu.RLock()
+	configIdx, ok := tpm.tokenIDToIdx[tokenID]
+	pools := make([]*GroupPool, 0, len(tpm.pools))
+	for _, pool := range tpm.pools {
+		pools = append(pools, pool)
+	}
+	tpm.globalMu.RUnlock()
+	if !ok {
+		return false
 	}
 
+	for _, pool := range pools {
+		pool.mu.Lock()
+		m, exists := pool.metrics[configIdx]
+		pool.mu.Unlock()
+		if exists {
+			m.Breaker().Reset()
+			logger.Info("Token熔断器已重置", logger.Int64("token_id", tokenID))
+			return true
+		}
+	}
+	// 从未被请求过，熔断器本就处于关闭状态
+	return true
+}
+
+// MarkTokenFailed 标记 Token 失败 (触发熔断，时长按分组冷却时间指数退避)
+func (tpm *TokenPoolManager) MarkTokenFailed(token types.TokenInfo) {
 	// 1. 复制pools快照（短暂持读锁）
 	tpm.globalMu.RLock()
 	poolsSnapshot := make([]*GroupPool, 0, len(tpm.pools))
@@ -510,11 +620,15 @@ func (tpm *TokenPoolManager) MarkTokenFailed(token types.TokenInfo) {
 			cacheSnapshot.mu.RUnlock()
 			if ok {
 				if cached.Token.AccessToken == token.AccessToken {
-					pool.cooldown[pt.ConfigIndex] = time.Now().Add(cooldownDuration)
-					pool.getMetrics(pt.ConfigIndex, pt.Config.TokenID).RecordRequest(0, false)
-					logger.Warn("Token标记冷却",
+					m := pool.getMetrics(pt.ConfigIndex, pt.Config.TokenID)
+					m.RecordRequest(0, false)
+					m.Breaker().Trip(time.Now(), tpm.breakerBase(pool.name))
+					snap := m.Breaker().Snapshot(time.Now())
+					logger.Warn("Token标记熔断",
 						logger.Int("config_index", pt.ConfigIndex),
-						logger.Duration("cooldown", cooldownDuration))
+						logger.String("group", pool.name),
+						logger.Int("trips", snap.Trips),
+						logger.Duration("cooldown", time.Until(snap.OpenUntil)))
 					pool.mu.Unlock()
 					return
 				}
@@ -524,6 +638,56 @@ func (tpm *TokenPoolManager) MarkTokenFailed(token types.TokenInfo) {
 	}
 }
 
+// MarkTokenFailedWithCooldown 按上游给出的时长熔断 Token（cooldown <= 0 时使用分组冷却时间）
+func (tpm *TokenPoolManager) MarkTokenFailedWithCooldown(token types.TokenInfo, cooldown time.Duration) {
+	if cooldown <= 0 {
+		tpm.MarkTokenFailed(token)
+		return
+	}
+
+	pool, pt := tpm.findPooledToken(token)
+	if pool == nil {
+		return
+	}
+	m := pool.getMetrics(pt.ConfigIndex, pt.Config.TokenID)
+	pool.mu.Unlock()
+
+	m.RecordRequest(0, false)
+	m.Breaker().Trip(time.Now(), cooldown)
+	snap := m.Breaker().Snapshot(time.Now())
+	logger.Warn("Token按上游Retry-After熔断",
+		logger.Int("config_index", pt.ConfigIndex),
+		logger.String("group", pool.name),
+		logger.Int("trips", snap.Trips),
+		logger.Duration("cooldown", time.Until(snap.OpenUntil)))
+}
+
+// MarkTokenExhausted 上游返回额度耗尽时立即标记 Token 为 exhausted（额度恢复由刷新流程检测）
+func (tpm *TokenPoolManager) MarkTokenExhausted(token types.TokenInfo) {
+	pool, pt := tpm.findPooledToken(token)
+	if pool == nil {
+		return
+	}
+	configIdx, tokenID := pt.ConfigIndex, pt.Config.TokenID
+	pool.mu.Unlock()
+
+	tpm.globalMu.Lock()
+	if configIdx >= len(tpm.configs) || tpm.configs[configIdx].Status == TokenStatusExhausted {
+		tpm.globalMu.Unlock()
+		return
+	}
+	logger.Warn("上游返回额度耗尽，标记Token为exhausted", logger.Int("config_index", configIdx))
+	tpm.configs[configIdx].Status = TokenStatusExhausted
+	tpm.configs[configIdx].Group = "exhausted"
+	tpm.rebuildPools()
+	tpm.globalMu.Unlock()
+
+	// 更新数据库
+	if tokenID > 0 && tpm.repo != nil {
+		tpm.repo.UpdateTokenStatus(tokenID, string(TokenStatusExhausted), "exhausted")
+	}
+}
+
 // triggerAsyncRefresh 触发异步刷新（不阻塞）
 func (tpm *TokenPoolManager) triggerAsyncRefresh() {
 	// CAS 防止重复刷新
@@ -677,9 +841,16 @@ func (tpm *TokenPoolManager) GetPoolStats() map[string]map[string]interface{} {
 	stats := make(map[string]map[string]interface{})
 	for name, pool := range tpm.pools {
 		pool.mu.Lock()
+		cooldownCount := 0
+		now := time.Now()
+		for _, m := range pool.metrics {
+			if m.Breaker().Snapshot(now).State != BreakerClosed {
+				cooldownCount++
+			}
+		}
 		poolStats := map[string]interface{}{
 			"token_count":    len(pool.tokens),
-			"cooldown_count": len(pool.cooldown),
+			"cooldown_count": cooldownCount,
 		}
 		pool.mu.Unlock()
 		stats[name] = poolStats
@@ -694,6 +865,7 @@ type TokenMetricsInfo struct {
 	FailureCount int64
 	InFlight     int64
 	AvgLatency   float64
+	Breaker      BreakerSnapshot
 }
 
 // GetAllMetrics 获取所有 Token 的 metrics 统计
@@ -711,6 +883,7 @@ func (tpm *TokenPoolManager) GetAllMetrics() map[int]TokenMetricsInfo {
 				FailureCount: m.FailureCount(),
 				InFlight:     m.InFlightCount(),
 				AvgLatency:   m.AvgLatency(),
+				Breaker:      m.Breaker().Snapshot(time.Now()),
 			}
 		}
 		pool.mu.Unlock()
@@ -760,7 +933,7 @@ func (tpm *TokenPoolManager) GetMetricsByTokenID(tokenID int64) *TokenMetricsInf
 	configIdx, ok := tpm.tokenIDToIdx[tokenID]
 	if !ok {
 		// TokenID 不在映射中，返回默认值
-		return &TokenMetricsInfo{}
+		return &TokenMetricsInfo{Breaker: BreakerSnapshot{State: BreakerClosed}}
 	}
 
 	for _, pool := range tpm.pools {
@@ -772,6 +945,7 @@ func (tpm *TokenPoolManager) GetMetricsByTokenID(tokenID int64) *TokenMetricsInf
 				FailureCount: m.FailureCount(),
 				InFlight:     m.InFlightCount(),
 				AvgLatency:   m.AvgLatency(),
+				Breaker:      m.Breaker().Snapshot(time.Now()),
 			}
 			pool.mu.Unlock()
 			return info
@@ -779,7 +953,7 @@ func (tpm *TokenPoolManager) GetMetricsByTokenID(tokenID int64) *TokenMetricsInf
 		pool.mu.Unlock()
 	}
 	// metrics 不存在（从未被请求），返回默认值
-	return &TokenMetricsInfo{ConfigIndex: configIdx}
+	return &TokenMetricsInfo{ConfigIndex: configIdx, Breaker: BreakerSnapshot{State: BreakerClosed}}
 }
 
 // StartRequest 标记开始处理请求 (增加 in-flight)
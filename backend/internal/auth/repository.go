@@ -2,6 +2,7 @@ package auth
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
@@ -401,7 +402,8 @@ func (r *TokenRepository) GetAllGroups() (map[string]*GroupConfig, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	query := `SELECT name, display_name, priority, rate_limit_qps, rate_limit_burst, cooldown_sec FROM groups`
+	query := `SELECT name, display_name, priority, rate_limit_qps, rate_limit_burst, cooldown_sec, strategy, fallback_groups,
+		stream_first_byte_timeout_sec, stream_idle_timeout_sec, stream_total_timeout_sec FROM groups`
 	rows, err := r.db.Query(query)
 	if err != nil {
 		return nil, err
@@ -415,11 +417,19 @@ func (r *TokenRepository) GetAllGroups() (map[string]*GroupConfig, error) {
 		var priority int
 		var rateLimitQPS float64
 		var rateLimitBurst, cooldownSec int
+		var strategy, fallbackJSON sql.NullString
+		var firstByteSec, idleSec, totalSec int
 
-		if err := rows.Scan(&name, &displayName, &priority, &rateLimitQPS, &rateLimitBurst, &cooldownSec); err != nil {
+		if err := rows.Scan(&name, &displayName, &priority, &rateLimitQPS, &rateLimitBurst, &cooldownSec, &strategy, &fallbackJSON,
+			&firstByteSec, &idleSec, &totalSec); err != nil {
 			continue
 		}
 
+		var fallbackGroups []string
+		if fallbackJSON.String != "" {
+			json.Unmarshal([]byte(fallbackJSON.String), &fallbackGroups)
+		}
+
 		groups[name] = &GroupConfig{
 			Name:        name,
 			DisplayName: displayName.String,
@@ -428,7 +438,13 @@ func (r *TokenRepository) GetAllGroups() (map[string]*GroupConfig, error) {
 				RateLimitQPS:   rateLimitQPS,
 				RateLimitBurst: rateLimitBurst,
 				CooldownSec:    cooldownSec,
+				Strategy:       strategy.String,
+
+				StreamFirstByteTimeoutSec: firstByteSec,
+				StreamIdleTimeoutSec:      idleSec,
+				StreamTotalTimeoutSec:     totalSec,
 			},
+			FallbackGroups: fallbackGroups,
 		}
 	}
 	return groups, nil
@@ -439,8 +455,10 @@ func (r *TokenRepository) CreateGroup(g *GroupConfig) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	_, err := r.db.Exec(`INSERT INTO groups (name, display_name, priority, rate_limit_qps, rate_limit_burst, cooldown_sec) VALUES (?, ?, ?, ?, ?, ?)`,
-		g.Name, g.DisplayName, g.Settings.Priority, g.Settings.RateLimitQPS, g.Settings.RateLimitBurst, g.Settings.CooldownSec)
+	_, err := r.db.Exec(`INSERT INTO groups (name, display_name, priority, rate_limit_qps, rate_limit_burst, cooldown_sec, strategy, fallback_groups,
+		stream_first_byte_timeout_sec, stream_idle_timeout_sec, stream_total_timeout_sec) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		g.Name, g.DisplayName, g.Settings.Priority, g.Settings.RateLimitQPS, g.Settings.RateLimitBurst, g.Settings.CooldownSec, g.Settings.Strategy, encodeGroupList(g.FallbackGroups),
+		g.Settings.StreamFirstByteTimeoutSec, g.Settings.StreamIdleTimeoutSec, g.Settings.StreamTotalTimeoutSec)
 	return err
 }
 
@@ -449,11 +467,22 @@ func (r *TokenRepository) UpdateGroup(g *GroupConfig) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	_, err := r.db.Exec(`UPDATE groups SET display_name = ?, priority = ?, rate_limit_qps = ?, rate_limit_burst = ?, cooldown_sec = ? WHERE name = ?`,
-		g.DisplayName, g.Settings.Priority, g.Settings.RateLimitQPS, g.Settings.RateLimitBurst, g.Settings.CooldownSec, g.Name)
+	_, err := r.db.Exec(`UPDATE groups SET display_name = ?, priority = ?, rate_limit_qps = ?, rate_limit_burst = ?, cooldown_sec = ?, strategy = ?, fallback_groups = ?,
+		stream_first_byte_timeout_sec = ?, stream_idle_timeout_sec = ?, stream_total_timeout_sec = ? WHERE name = ?`,
+		g.DisplayName, g.Settings.Priority, g.Settings.RateLimitQPS, g.Settings.RateLimitBurst, g.Settings.CooldownSec, g.Settings.Strategy, encodeGroupList(g.FallbackGroups),
+		g.Settings.StreamFirstByteTimeoutSec, g.Settings.StreamIdleTimeoutSec, g.Settings.StreamTotalTimeoutSec, g.Name)
 	return err
 }
 
+// encodeGroupList 分组列表序列化为 JSON（空列表存空字符串）
+func encodeGroupList(groups []string) string {
+	if len(groups) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(groups)
+	return string(data)
+}
+
 // DeleteGroup 删除分组
 func (r *TokenRepository) DeleteGroup(name string) error {
 	r.mu.Lock()
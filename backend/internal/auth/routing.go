@@ -0,0 +1,411 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"kiro2api/internal/logger"
+)
+
+// ErrRoutingRuleNotFound 路由规则不存在
+var ErrRoutingRuleNotFound = errors.New("路由规则不存在")
+
+// RoutingTarget 路由目标分组（按权重随机选择）
+type RoutingTarget struct {
+	Group  string `json:"group"`
+	Weight int    `json:"weight"`
+}
+
+// RoutingRule 路由规则：匹配条件全部满足时，将请求路由到目标分组
+// 条件为空（nil/空列表/0）表示不限制
+type RoutingRule struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Priority int    `json:"priority"` // 越大越先匹配
+	Enabled  bool   `json:"enabled"`
+
+	Models        []string `json:"models,omitempty"`         // 模型通配（如 claude-*opus*）
+	APIKeys       []string `json:"api_keys,omitempty"`       // API Key ID
+	HasTools      *bool    `json:"has_tools,omitempty"`      // 是否携带工具
+	Thinking      *bool    `json:"thinking,omitempty"`       // 是否开启 extended thinking
+	MinComplexity int      `json:"min_complexity,omitempty"` // 复杂度评分下限
+	MaxComplexity int      `json:"max_complexity,omitempty"` // 复杂度评分上限
+
+	Targets []RoutingTarget `json:"targets"`
+}
+
+// RoutingRequest 路由匹配输入
+type RoutingRequest struct {
+	Model      string
+	APIKeyID   string
+	HasTools   bool
+	Thinking   bool
+	Complexity int
+}
+
+// Validate 校验规则（权重 <= 0 视为 1）
+func (r *RoutingRule) Validate() error {
+	if len(r.Targets) == 0 {
+		return fmt.Errorf("至少需要一个目标分组")
+	}
+	for i := range r.Targets {
+		if r.Targets[i].Group == "" {
+			return fmt.Errorf("目标分组不能为空")
+		}
+		if r.Targets[i].Weight <= 0 {
+			r.Targets[i].Weight = 1
+		}
+	}
+	for _, pattern := range r.Models {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("无效的模型通配符: %s", pattern)
+		}
+	}
+	if r.MaxComplexity > 0 && r.MinComplexity > r.MaxComplexity {
+		return fmt.Errorf("复杂度下限不能大于上限")
+	}
+	return nil
+}
+
+// Matches 检查请求是否满足规则条件
+func (r *RoutingRule) Matches(req RoutingRequest) bool {
+	if !r.Enabled {
+		return false
+	}
+	if len(r.Models) > 0 && !matchAnyModel(r.Models, req.Model) {
+		return false
+	}
+	if len(r.APIKeys) > 0 && !containsString(r.APIKeys, req.APIKeyID) {
+		return false
+	}
+	if r.HasTools != nil && *r.HasTools != req.HasTools {
+		return false
+	}
+	if r.Thinking != nil && *r.Thinking != req.Thinking {
+		return false
+	}
+	if req.Complexity < r.MinComplexity {
+		return false
+	}
+	if r.MaxComplexity > 0 && req.Complexity > r.MaxComplexity {
+		return false
+	}
+	return true
+}
+
+// pickTarget 按权重随机选择目标分组，allowed 过滤无权访问的分组
+func (r *RoutingRule) pickTarget(allowed func(group string) bool) (string, bool) {
+	candidates := make([]RoutingTarget, 0, len(r.Targets))
+	total := 0
+	for _, t := range r.Targets {
+		if allowed != nil && !allowed(t.Group) {
+			continue
+		}
+		candidates = append(candidates, t)
+		total += t.Weight
+	}
+	if total == 0 {
+		return "", false
+	}
+	n := rand.IntN(total)
+	for _, t := range candidates {
+		if n < t.Weight {
+			return t.Group, true
+		}
+		n -= t.Weight
+	}
+	return candidates[len(candidates)-1].Group, true
+}
+
+// matchAnyModel 模型名是否匹配任一通配（不区分大小写）
+func matchAnyModel(patterns []string, model string) bool {
+	model = strings.ToLower(model)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), model); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// RoutingTable 路由规则表（SQLite 持久化，内存中按优先级排序）
+type RoutingTable struct {
+	mu    sync.RWMutex
+	rules []RoutingRule
+	db    *sql.DB
+}
+
+// NewRoutingTable 创建路由规则表并从数据库加载
+func NewRoutingTable(db *sql.DB) *RoutingTable {
+	t := &RoutingTable{db: db}
+	if db != nil {
+		rules, err := loadRoutingRules(db)
+		if err != nil {
+			logger.Warn("从数据库加载路由规则失败", logger.Err(err))
+		} else {
+			t.rules = rules
+			t.sortLocked()
+			logger.Info("路由规则加载完成", logger.Int("count", len(rules)))
+		}
+	}
+	return t
+}
+
+// sortLocked 按优先级降序、ID 升序排序（调用方持有写锁）
+func (t *RoutingTable) sortLocked() {
+	sort.SliceStable(t.rules, func(i, j int) bool {
+		if t.rules[i].Priority != t.rules[j].Priority {
+			return t.rules[i].Priority > t.rules[j].Priority
+		}
+		return t.rules[i].ID < t.rules[j].ID
+	})
+}
+
+// List 列出所有规则（按匹配顺序）
+func (t *RoutingTable) List() []RoutingRule {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]RoutingRule(nil), t.rules...)
+}
+
+// HasEnabled 是否存在启用的规则
+func (t *RoutingTable) HasEnabled() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, r := range t.rules {
+		if r.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// Route 按顺序匹配规则并选择目标分组
+// allowed 用于过滤 API Key 无权访问的分组；目标全部无权访问的规则会被跳过
+func (t *RoutingTable) Route(req RoutingRequest, allowed func(group string) bool) (string, *RoutingRule, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for i := range t.rules {
+		rule := &t.rules[i]
+		if !rule.Matches(req) {
+			continue
+		}
+		if group, ok := rule.pickTarget(allowed); ok {
+			matched := *rule
+			return group, &matched, true
+		}
+	}
+	return "", nil, false
+}
+
+// Create 新增规则
+func (t *RoutingTable) Create(rule RoutingRule) (RoutingRule, error) {
+	if err := rule.Validate(); err != nil {
+		return RoutingRule{}, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.db != nil {
+		id, err := insertRoutingRule(t.db, &rule)
+		if err != nil {
+			return RoutingRule{}, err
+		}
+		rule.ID = id
+	} else {
+		rule.ID = t.nextIDLocked()
+	}
+	t.rules = append(t.rules, rule)
+	t.sortLocked()
+	logger.Info("创建路由规则", logger.Int64("id", rule.ID), logger.String("name", rule.Name))
+	return rule, nil
+}
+
+// Update 替换规则
+func (t *RoutingTable) Update(id int64, rule RoutingRule) (RoutingRule, error) {
+	if err := rule.Validate(); err != nil {
+		return RoutingRule{}, err
+	}
+	rule.ID = id
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	idx := t.indexLocked(id)
+	if idx < 0 {
+		return RoutingRule{}, ErrRoutingRuleNotFound
+	}
+	if t.db != nil {
+		if err := updateRoutingRule(t.db, &rule); err != nil {
+			return RoutingRule{}, err
+		}
+	}
+	t.rules[idx] = rule
+	t.sortLocked()
+	logger.Info("更新路由规则", logger.Int64("id", id))
+	return rule, nil
+}
+
+// Delete 删除规则
+func (t *RoutingTable) Delete(id int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	idx := t.indexLocked(id)
+	if idx < 0 {
+		return ErrRoutingRuleNotFound
+	}
+	if t.db != nil {
+		if _, err := t.db.Exec(`DELETE FROM routing_rules WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+	t.rules = append(t.rules[:idx], t.rules[idx+1:]...)
+	logger.Info("删除路由规则", logger.Int64("id", id))
+	return nil
+}
+
+// ReplaceGroupRef 分组重命名/删除时更新规则中的目标分组（newName 为空表示移除）
+func (t *RoutingTable) ReplaceGroupRef(oldName, newName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.rules {
+		rule := &t.rules[i]
+		changed := false
+		targets := make([]RoutingTarget, 0, len(rule.Targets))
+		for _, target := range rule.Targets {
+			if target.Group != oldName {
+				targets = append(targets, target)
+				continue
+			}
+			changed = true
+			if newName != "" {
+				target.Group = newName
+				targets = append(targets, target)
+			}
+		}
+		if !changed {
+			continue
+		}
+		rule.Targets = targets
+		if len(targets) == 0 {
+			rule.Enabled = false // 没有目标的规则自动停用
+		}
+		if t.db != nil {
+			if err := updateRoutingRule(t.db, rule); err != nil {
+				logger.Warn("更新路由规则失败", logger.Err(err), logger.Int64("id", rule.ID))
+			}
+		}
+	}
+}
+
+func (t *RoutingTable) indexLocked(id int64) int {
+	for i := range t.rules {
+		if t.rules[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *RoutingTable) nextIDLocked() int64 {
+	var maxID int64
+	for _, r := range t.rules {
+		maxID = max(maxID, r.ID)
+	}
+	return maxID + 1
+}
+
+// nullableBool 可空布尔转为数据库参数
+func nullableBool(b *bool) any {
+	if b == nil {
+		return nil
+	}
+	if *b {
+		return 1
+	}
+	return 0
+}
+
+// routingRuleColumns 规则写入参数（不含 id）
+func routingRuleColumns(rule *RoutingRule) []any {
+	models, _ := json.Marshal(rule.Models)
+	apiKeys, _ := json.Marshal(rule.APIKeys)
+	targets, _ := json.Marshal(rule.Targets)
+	enabled := 0
+	if rule.Enabled {
+		enabled = 1
+	}
+	return []any{rule.Name, rule.Priority, enabled, string(models), string(apiKeys),
+		nullableBool(rule.HasTools), nullableBool(rule.Thinking), rule.MinComplexity, rule.MaxComplexity, string(targets)}
+}
+
+func insertRoutingRule(db *sql.DB, rule *RoutingRule) (int64, error) {
+	res, err := db.Exec(`
+		INSERT INTO routing_rules (name, priority, enabled, models, api_keys, has_tools, thinking, min_complexity, max_complexity, targets)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, routingRuleColumns(rule)...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func updateRoutingRule(db *sql.DB, rule *RoutingRule) error {
+	args := append(routingRuleColumns(rule), rule.ID)
+	_, err := db.Exec(`
+		UPDATE routing_rules SET name = ?, priority = ?, enabled = ?, models = ?, api_keys = ?, has_tools = ?, thinking = ?,
+			min_complexity = ?, max_complexity = ?, targets = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, args...)
+	return err
+}
+
+// loadRoutingRules 从数据库加载路由规则
+func loadRoutingRules(db *sql.DB) ([]RoutingRule, error) {
+	rows, err := db.Query(`
+		SELECT id, COALESCE(name, ''), priority, enabled, COALESCE(models, '[]'), COALESCE(api_keys, '[]'),
+			has_tools, thinking, min_complexity, max_complexity, COALESCE(targets, '[]')
+		FROM routing_rules`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []RoutingRule
+	for rows.Next() {
+		var rule RoutingRule
+		var enabled int
+		var models, apiKeys, targets string
+		var hasTools, thinking sql.NullBool
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.Priority, &enabled, &models, &apiKeys,
+			&hasTools, &thinking, &rule.MinComplexity, &rule.MaxComplexity, &targets); err != nil {
+			logger.Warn("读取路由规则失败", logger.Err(err))
+			continue
+		}
+		rule.Enabled = enabled != 0
+		json.Unmarshal([]byte(models), &rule.Models)
+		json.Unmarshal([]byte(apiKeys), &rule.APIKeys)
+		json.Unmarshal([]byte(targets), &rule.Targets)
+		if hasTools.Valid {
+			rule.HasTools = &hasTools.Bool
+		}
+		if thinking.Valid {
+			rule.Thinking = &thinking.Bool
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutingRule_Matches(t *testing.T) {
+	yes := true
+	rule := RoutingRule{
+		Enabled:       true,
+		Models:        []string{"claude-*opus*"},
+		HasTools:      &yes,
+		MinComplexity: 3,
+		Targets:       []RoutingTarget{{Group: "pro", Weight: 1}},
+	}
+
+	req := RoutingRequest{Model: "Claude-Opus-4-5", HasTools: true, Complexity: 4}
+	assert.True(t, rule.Matches(req))
+
+	req.HasTools = false
+	assert.False(t, rule.Matches(req), "工具条件不满足")
+
+	req = RoutingRequest{Model: "claude-sonnet-4-5", HasTools: true, Complexity: 4}
+	assert.False(t, rule.Matches(req), "模型不匹配")
+
+	req = RoutingRequest{Model: "claude-opus-4-5", HasTools: true, Complexity: 2}
+	assert.False(t, rule.Matches(req), "复杂度低于下限")
+
+	rule.Enabled = false
+	assert.False(t, rule.Matches(RoutingRequest{Model: "claude-opus-4-5", HasTools: true, Complexity: 5}))
+}
+
+func TestRoutingTable_RoutePriorityAndPermission(t *testing.T) {
+	table := NewRoutingTable(nil)
+	_, err := table.Create(RoutingRule{Name: "low", Priority: 1, Enabled: true,
+		Targets: []RoutingTarget{{Group: "default"}}})
+	assert.NoError(t, err)
+	_, err = table.Create(RoutingRule{Name: "high", Priority: 10, Enabled: true, APIKeys: []string{"key_a"},
+		Targets: []RoutingTarget{{Group: "pro", Weight: 3}}})
+	assert.NoError(t, err)
+
+	group, rule, ok := table.Route(RoutingRequest{APIKeyID: "key_a"}, nil)
+	assert.True(t, ok)
+	assert.Equal(t, "pro", group)
+	assert.Equal(t, "high", rule.Name)
+
+	// 目标分组无权访问时跳过该规则
+	group, rule, ok = table.Route(RoutingRequest{APIKeyID: "key_a"}, func(g string) bool { return g != "pro" })
+	assert.True(t, ok)
+	assert.Equal(t, "default", group)
+	assert.Equal(t, "low", rule.Name)
+
+	_, _, ok = table.Route(RoutingRequest{}, func(string) bool { return false })
+	assert.False(t, ok)
+}
+
+func TestRoutingRule_Validate(t *testing.T) {
+	rule := RoutingRule{Targets: []RoutingTarget{{Group: "pro"}}}
+	assert.NoError(t, rule.Validate())
+	assert.Equal(t, 1, rule.Targets[0].Weight, "权重缺省为 1")
+
+	assert.Error(t, (&RoutingRule{}).Validate(), "缺少目标分组")
+	assert.Error(t, (&RoutingRule{Models: []string{"claude-["}, Targets: rule.Targets}).Validate())
+	assert.Error(t, (&RoutingRule{MinComplexity: 5, MaxComplexity: 2, Targets: rule.Targets}).Validate())
+}
+
+func TestRoutingTable_PersistsRules(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(schema)
+	assert.NoError(t, err)
+
+	no := false
+	table := NewRoutingTable(db)
+	created, err := table.Create(RoutingRule{Name: "fast", Enabled: true, Thinking: &no,
+		Models: []string{"claude-*haiku*"}, Targets: []RoutingTarget{{Group: "cheap", Weight: 2}}})
+	assert.NoError(t, err)
+
+	reloaded := NewRoutingTable(db).List()
+	assert.Len(t, reloaded, 1)
+	assert.Equal(t, created, reloaded[0])
+
+	table.ReplaceGroupRef("cheap", "")
+	reloaded = NewRoutingTable(db).List()
+	assert.Empty(t, reloaded[0].Targets)
+	assert.False(t, reloaded[0].Enabled, "目标被移除后规则停用")
+
+	assert.NoError(t, table.Delete(created.ID))
+	assert.Empty(t, NewRoutingTable(db).List())
+	assert.ErrorIs(t, table.Delete(created.ID), ErrRoutingRuleNotFound)
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"kiro2api/internal/logger"
+)
+
+// stickyLoadFactor 粘性 Token 负载上限系数（相对分组平均在途请求数）
+const stickyLoadFactor = 1.25
+
+// rendezvousScore 计算会话与 Token 的 rendezvous 权重（按 TokenID，池变化不影响其他 Token）
+func rendezvousScore(sessionID string, tokenID int64) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(sessionID))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.FormatInt(tokenID, 10)))
+	return mix64(h.Sum64())
+}
+
+// mix64 打散 fnv 结果的低熵位（splitmix64 finalizer）
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// rendezvousOrder 按 rendezvous 权重降序排列 Token（首位为粘性 Token，其后为溢出邻居）
+func rendezvousOrder(sessionID string, tokens []*PooledToken) []*PooledToken {
+	type scored struct {
+		pt    *PooledToken
+		score uint64
+	}
+	list := make([]scored, len(tokens))
+	for i, pt := range tokens {
+		list[i] = scored{pt: pt, score: rendezvousScore(sessionID, pt.Config.TokenID)}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].score != list[j].score {
+			return list[i].score > list[j].score
+		}
+		return list[i].pt.Config.TokenID < list[j].pt.Config.TokenID
+	})
+
+	ordered := make([]*PooledToken, len(list))
+	for i, s := range list {
+		ordered[i] = s.pt
+	}
+	return ordered
+}
+
+// boundedLoadLimit 计算单 Token 在途请求上限 ceil((total+1) * factor / n)
+func boundedLoadLimit(totalInFlight int64, tokenCount int) int64 {
+	if tokenCount <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(float64(totalInFlight+1) * stickyLoadFactor / float64(tokenCount)))
+}
+
+// stickySelect 一致性哈希 + 有界负载的会话粘性选择
+// 粘性 Token 不可用或超载时溢出到 rendezvous 顺序中的下一个 Token，全部不满足返回 nil
+func (gp *GroupPool) stickySelect(cache *SimpleTokenCache, sessionID string, model string, now time.Time) *PooledToken {
+	if sessionID == "" || len(gp.tokens) == 0 {
+		return nil
+	}
+
+	var totalInFlight int64
+	for _, pt := range gp.tokens {
+		totalInFlight += gp.getMetrics(pt.ConfigIndex, pt.Config.TokenID).InFlightCount()
+	}
+	limit := boundedLoadLimit(totalInFlight, len(gp.tokens))
+
+	sessionPrefix := sessionID[:minInt(20, len(sessionID))]
+	for rank, pt := range rendezvousOrder(sessionID, gp.tokens) {
+		if !gp.isTokenAvailable(pt, cache, model, now) {
+			continue
+		}
+		if gp.getMetrics(pt.ConfigIndex, pt.Config.TokenID).InFlightCount() >= limit {
+			continue
+		}
+		if !gp.claimToken(pt, now) {
+			continue
+		}
+
+		if rank == 0 {
+			logger.Info("会话粘性选择Token",
+				logger.Int64("token_id", pt.Config.TokenID),
+				logger.String("session_id_prefix", sessionPrefix))
+		} else {
+			logger.Info("会话粘性Token不可用或超载，溢出到邻居",
+				logger.Int64("token_id", pt.Config.TokenID),
+				logger.Int("rank", rank),
+				logger.Int64("load_limit", limit),
+				logger.String("session_id_prefix", sessionPrefix))
+		}
+		return pt
+	}
+
+	logger.Warn("会话粘性无可用Token，切换到策略选择",
+		logger.String("group", gp.name),
+		logger.String("session_id_prefix", sessionPrefix))
+	return nil
+}
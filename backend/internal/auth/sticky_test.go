@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"kiro2api/internal/config"
+	"kiro2api/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newStickyTestPool 创建带可用缓存的测试分组池
+func newStickyTestPool(tokenIDs ...int64) (*GroupPool, *SimpleTokenCache) {
+	cache := NewSimpleTokenCache(time.Hour)
+	gp := &GroupPool{
+		name:    "test",
+		metrics: make(map[int]*TokenMetrics),
+	}
+	for i, id := range tokenIDs {
+		gp.tokens = append(gp.tokens, &PooledToken{
+			ConfigIndex: i,
+			Config:      &AuthConfig{TokenID: id},
+		})
+		cache.tokens[fmt.Sprintf(config.TokenCacheKeyFormat, i)] = &CachedToken{
+			Token:     types.TokenInfo{AccessToken: fmt.Sprintf("at_%d", id), ExpiresAt: time.Now().Add(time.Hour)},
+			Available: 100,
+		}
+	}
+	return gp, cache
+}
+
+func newTestTokens(n int) []*PooledToken {
+	tokens := make([]*PooledToken, n)
+	for i := range tokens {
+		tokens[i] = &PooledToken{ConfigIndex: i, Config: &AuthConfig{TokenID: int64(i + 1)}}
+	}
+	return tokens
+}
+
+func TestRendezvousOrder_IndependentOfSliceOrder(t *testing.T) {
+	tokens := newTestTokens(5)
+	reversed := make([]*PooledToken, len(tokens))
+	for i, pt := range tokens {
+		reversed[len(tokens)-1-i] = pt
+	}
+
+	assert.Equal(t, rendezvousOrder("session-a", tokens)[0].Config.TokenID,
+		rendezvousOrder("session-a", reversed)[0].Config.TokenID)
+}
+
+func TestRendezvousOrder_AddTokenMovesFewSessions(t *testing.T) {
+	const sessions = 2000
+	before := newTestTokens(10)
+	after := newTestTokens(11)
+
+	moved := 0
+	for i := 0; i < sessions; i++ {
+		sid := fmt.Sprintf("session-%d", i)
+		if rendezvousOrder(sid, before)[0].Config.TokenID != rendezvousOrder(sid, after)[0].Config.TokenID {
+			moved++
+		}
+	}
+
+	// 理论约 1/11 ≈ 9%，留出波动余量
+	ratio := float64(moved) / sessions
+	assert.Greater(t, ratio, 0.04)
+	assert.Less(t, ratio, 0.15)
+}
+
+func TestRendezvousOrder_RemoveTokenOnlyMovesItsSessions(t *testing.T) {
+	before := newTestTokens(6)
+	after := before[1:] // 移除 TokenID=1
+
+	for i := 0; i < 500; i++ {
+		sid := fmt.Sprintf("session-%d", i)
+		owner := rendezvousOrder(sid, before)[0].Config.TokenID
+		if owner != 1 {
+			assert.Equal(t, owner, rendezvousOrder(sid, after)[0].Config.TokenID)
+		}
+	}
+}
+
+func TestBoundedLoadLimit(t *testing.T) {
+	assert.Equal(t, int64(1), boundedLoadLimit(0, 4))
+	assert.Equal(t, int64(4), boundedLoadLimit(11, 4))
+	assert.Equal(t, int64(0), boundedLoadLimit(5, 0))
+}
+
+func TestStickySelect_StableAndSpillsToNeighbour(t *testing.T) {
+	gp, cache := newStickyTestPool(1, 2, 3, 4)
+	now := time.Now()
+
+	order := rendezvousOrder("session-x", gp.tokens)
+	first := gp.stickySelect(cache, "session-x", "", now)
+	assert.Equal(t, order[0].Config.TokenID, first.Config.TokenID)
+
+	// 粘性 Token 超载后溢出到 rendezvous 顺序中的下一个
+	gp.getMetrics(first.ConfigIndex, first.Config.TokenID).inFlight = 4
+	spilled := gp.stickySelect(cache, "session-x", "", now)
+	assert.Equal(t, order[1].Config.TokenID, spilled.Config.TokenID)
+
+	// 粘性 Token 熔断中同样溢出
+	gp.getMetrics(first.ConfigIndex, first.Config.TokenID).inFlight = 0
+	gp.getMetrics(first.ConfigIndex, first.Config.TokenID).Breaker().Trip(now, time.Minute)
+	assert.Equal(t, order[1].Config.TokenID, gp.stickySelect(cache, "session-x", "", now).Config.TokenID)
+}
+
+func TestStickySelect_EmptySession(t *testing.T) {
+	gp, cache := newStickyTestPool(1, 2)
+	assert.Nil(t, gp.stickySelect(cache, "", "", time.Now()))
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"sync/atomic"
+)
+
+// Token 选择策略名称
+const (
+	StrategyRoundRobin    = "round_robin"     // 轮询（默认）
+	StrategyLeastInFlight = "least_in_flight" // 最少在途请求
+	StrategyHighestCredit = "highest_credit"  // 剩余额度最高
+	StrategyWeightedScore = "weighted_score"  // 综合得分（TokenScore）
+)
+
+// TokenCandidate 通过可用性检查的候选 Token
+type TokenCandidate struct {
+	Token   *PooledToken
+	Metrics *TokenMetrics
+}
+
+// available 候选 Token 的剩余额度
+func (c TokenCandidate) available() float64 {
+	if c.Token == nil || c.Token.Cached == nil {
+		return 0
+	}
+	return c.Token.Cached.Available
+}
+
+// SelectionStrategy Token 选择策略接口
+// 每个分组池持有独立的策略实例，实现需保证并发安全
+type SelectionStrategy interface {
+	// Name 策略名称
+	Name() string
+	// Select 从候选 Token 中选择一个，candidates 为空时返回 nil
+	Select(candidates []TokenCandidate) *PooledToken
+}
+
+// NewSelectionStrategy 根据名称创建策略（未知名称回退到轮询）
+func NewSelectionStrategy(name string) SelectionStrategy {
+	switch name {
+	case StrategyLeastInFlight:
+		return &LeastInFlightStrategy{}
+	case StrategyHighestCredit:
+		return &HighestCreditStrategy{}
+	case StrategyWeightedScore:
+		return &WeightedScoreStrategy{}
+	default:
+		return &RoundRobinStrategy{}
+	}
+}
+
+// IsValidStrategy 检查策略名称是否有效（空字符串表示默认）
+func IsValidStrategy(name string) bool {
+	switch name {
+	case "", StrategyRoundRobin, StrategyLeastInFlight, StrategyHighestCredit, StrategyWeightedScore:
+		return true
+	}
+	return false
+}
+
+// RoundRobinStrategy 轮询策略
+type RoundRobinStrategy struct {
+	index uint64
+}
+
+// Name 策略名称
+func (s *RoundRobinStrategy) Name() string { return StrategyRoundRobin }
+
+// Select 按原子递增索引轮询选择
+func (s *RoundRobinStrategy) Select(candidates []TokenCandidate) *PooledToken {
+	if len(candidates) == 0 {
+		return nil
+	}
+	idx := atomic.AddUint64(&s.index, 1) - 1
+	return candidates[idx%uint64(len(candidates))].Token
+}
+
+// LeastInFlightStrategy 最少在途请求策略（并列时轮询打散）
+type LeastInFlightStrategy struct {
+	offset uint64
+}
+
+// Name 策略名称
+func (s *LeastInFlightStrategy) Name() string { return StrategyLeastInFlight }
+
+// Select 选择在途请求数最少的 Token
+func (s *LeastInFlightStrategy) Select(candidates []TokenCandidate) *PooledToken {
+	return selectBest(candidates, &s.offset, func(c TokenCandidate) float64 {
+		if c.Metrics == nil {
+			return 0
+		}
+		return -float64(c.Metrics.InFlightCount())
+	})
+}
+
+// HighestCreditStrategy 剩余额度最高策略
+type HighestCreditStrategy struct {
+	offset uint64
+}
+
+// Name 策略名称
+func (s *HighestCreditStrategy) Name() string { return StrategyHighestCredit }
+
+// Select 选择剩余额度最高的 Token
+func (s *HighestCreditStrategy) Select(candidates []TokenCandidate) *PooledToken {
+	return selectBest(candidates, &s.offset, func(c TokenCandidate) float64 {
+		return c.available()
+	})
+}
+
+// WeightedScoreStrategy 综合得分策略（额度/延迟/失败率加权）
+type WeightedScoreStrategy struct {
+	offset uint64
+}
+
+// Name 策略名称
+func (s *WeightedScoreStrategy) Name() string { return StrategyWeightedScore }
+
+// Select 选择 TokenScore 最高的 Token
+func (s *WeightedScoreStrategy) Select(candidates []TokenCandidate) *PooledToken {
+	return selectBest(candidates, &s.offset, func(c TokenCandidate) float64 {
+		var latency, failureRate float64
+		if c.Metrics != nil {
+			latency = c.Metrics.AvgLatency()
+			failureRate = c.Metrics.FailureRate()
+		}
+		return TokenScore(c.available(), latency, failureRate)
+	})
+}
+
+// selectBest 选择得分最高的候选，起始位置轮转以打散并列
+func selectBest(candidates []TokenCandidate, offset *uint64, score func(TokenCandidate) float64) *PooledToken {
+	n := len(candidates)
+	if n == 0 {
+		return nil
+	}
+
+	start := int((atomic.AddUint64(offset, 1) - 1) % uint64(n))
+	best := candidates[start]
+	bestScore := score(best)
+	for i := 1; i < n; i++ {
+		c := candidates[(start+i)%n]
+		if s := score(c); s > bestScore {
+			best, bestScore = c, s
+		}
+	}
+	return best.Token
+}
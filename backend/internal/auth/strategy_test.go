@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newCandidate 创建测试候选 Token
+func newCandidate(index int, available float64, inFlight int) TokenCandidate {
+	m := &TokenMetrics{inFlight: int64(inFlight)}
+	return TokenCandidate{
+		Token: &PooledToken{
+			ConfigIndex: index,
+			Cached:      &CachedToken{Available: available},
+			Config:      &AuthConfig{},
+		},
+		Metrics: m,
+	}
+}
+
+func TestNewSelectionStrategy(t *testing.T) {
+	assert.Equal(t, StrategyRoundRobin, NewSelectionStrategy("").Name())
+	assert.Equal(t, StrategyRoundRobin, NewSelectionStrategy("unknown").Name())
+	assert.Equal(t, StrategyLeastInFlight, NewSelectionStrategy(StrategyLeastInFlight).Name())
+	assert.Equal(t, StrategyHighestCredit, NewSelectionStrategy(StrategyHighestCredit).Name())
+	assert.Equal(t, StrategyWeightedScore, NewSelectionStrategy(StrategyWeightedScore).Name())
+}
+
+func TestIsValidStrategy(t *testing.T) {
+	assert.True(t, IsValidStrategy(""))
+	assert.True(t, IsValidStrategy(StrategyWeightedScore))
+	assert.False(t, IsValidStrategy("random"))
+}
+
+func TestStrategies_EmptyCandidates(t *testing.T) {
+	for _, name := range []string{StrategyRoundRobin, StrategyLeastInFlight, StrategyHighestCredit, StrategyWeightedScore} {
+		assert.Nil(t, NewSelectionStrategy(name).Select(nil), name)
+	}
+}
+
+func TestRoundRobinStrategy_Rotates(t *testing.T) {
+	candidates := []TokenCandidate{newCandidate(0, 10, 0), newCandidate(1, 10, 0), newCandidate(2, 10, 0)}
+	s := &RoundRobinStrategy{}
+
+	var got []int
+	for i := 0; i < 4; i++ {
+		got = append(got, s.Select(candidates).ConfigIndex)
+	}
+
+	assert.Equal(t, []int{0, 1, 2, 0}, got)
+}
+
+func TestLeastInFlightStrategy(t *testing.T) {
+	candidates := []TokenCandidate{newCandidate(0, 10, 3), newCandidate(1, 10, 1), newCandidate(2, 10, 2)}
+	s := &LeastInFlightStrategy{}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 1, s.Select(candidates).ConfigIndex)
+	}
+}
+
+func TestLeastInFlightStrategy_TiesSpread(t *testing.T) {
+	candidates := []TokenCandidate{newCandidate(0, 10, 0), newCandidate(1, 10, 0)}
+	s := &LeastInFlightStrategy{}
+
+	first := s.Select(candidates).ConfigIndex
+	second := s.Select(candidates).ConfigIndex
+
+	assert.NotEqual(t, first, second)
+}
+
+func TestHighestCreditStrategy(t *testing.T) {
+	candidates := []TokenCandidate{newCandidate(0, 10, 0), newCandidate(1, 80, 0), newCandidate(2, 40, 0)}
+	s := &HighestCreditStrategy{}
+
+	assert.Equal(t, 1, s.Select(candidates).ConfigIndex)
+}
+
+func TestWeightedScoreStrategy(t *testing.T) {
+	fast := newCandidate(0, 50, 0)
+	fast.Metrics.RecordRequest(100*time.Millisecond, true)
+
+	// 额度相同，但延迟高且有失败
+	slow := newCandidate(1, 50, 0)
+	slow.Metrics.RecordRequest(4*time.Second, false)
+
+	s := &WeightedScoreStrategy{}
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, 0, s.Select([]TokenCandidate{fast, slow}).ConfigIndex)
+	}
+}
+
+func TestGroupPool_GetStrategy_SwitchAtRuntime(t *testing.T) {
+	gp := &GroupPool{name: "test"}
+
+	s1 := gp.getStrategy("")
+	assert.Equal(t, StrategyRoundRobin, s1.Name())
+	assert.Same(t, s1, gp.getStrategy(StrategyRoundRobin))
+
+	s2 := gp.getStrategy(StrategyHighestCredit)
+	assert.Equal(t, StrategyHighestCredit, s2.Name())
+}
@@ -0,0 +1,414 @@
+package batch
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"kiro2api/internal/config"
+	"kiro2api/internal/logger"
+	"kiro2api/internal/types"
+	"kiro2api/internal/utils"
+)
+
+const (
+	// DefaultWorkers 默认并发执行的请求数（BATCH_WORKERS 可覆盖）
+	DefaultWorkers = 4
+	// MaxRequests 单个批处理的最大请求数
+	MaxRequests = 100000
+	// batchExpiry 批处理有效期，到期仍未执行的请求标记为 expired
+	batchExpiry = 24 * time.Hour
+	// maxAttempts 可重试错误（429/5xx）的最大尝试次数，超过后记为 errored（代理自身的限流不计入）
+	maxAttempts = 5
+	// maxRetryDelay 重试退避上限
+	maxRetryDelay = time.Minute
+	// pollInterval 空闲时轮询间隔（等待重试到期与过期检查）
+	pollInterval = 5 * time.Second
+)
+
+// customIDPattern custom_id 格式（与 Anthropic 一致）
+var customIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Response 单个请求的执行结果（与 /v1/messages 的 HTTP 响应一致）
+type Response struct {
+	StatusCode int
+	Body       []byte
+	RetryAfter time.Duration // 上游/限流给出的重试等待（可选）
+	Throttled  bool          // 被代理自身的限流或 API Key 配额拒绝（未发往上游）
+}
+
+// Executor 执行单个请求（非流式）
+type Executor func(ctx context.Context, job Job) Response
+
+// Manager 批处理管理器：持久化批处理并由工作池逐个执行请求
+// 请求结果写库后才算完成，重启后未完成的请求会重新执行
+type Manager struct {
+	store   *Store
+	execute Executor
+	workers int
+
+	mu      sync.Mutex
+	claimed map[string]map[int]bool // 执行中的请求：batchID -> idx
+	running int
+
+	wake      chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewManager 创建批处理管理器（需调用 Start 开始执行）
+func NewManager(db *sql.DB, execute Executor, workers int) *Manager {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		store:   NewStore(db),
+		execute: execute,
+		workers: workers,
+		claimed: make(map[string]map[int]bool),
+		wake:    make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+}
+
+// ValidateRequests 校验创建请求（custom_id 唯一且合法，params 为带 model 的对象）
+func ValidateRequests(requests []types.MessageBatchRequest) error {
+	if len(requests) == 0 {
+		return fmt.Errorf("requests 不能为空")
+	}
+	if len(requests) > MaxRequests {
+		return fmt.Errorf("requests 数量不能超过 %d", MaxRequests)
+	}
+	seen := make(map[string]bool, len(requests))
+	for i, req := range requests {
+		if !customIDPattern.MatchString(req.CustomID) {
+			return fmt.Errorf("requests[%d].custom_id 必须为 1-64 位字母、数字、- 或 _", i)
+		}
+		if seen[req.CustomID] {
+			return fmt.Errorf("requests[%d].custom_id 重复: %s", i, req.CustomID)
+		}
+		seen[req.CustomID] = true
+
+		var params map[string]any
+		if err := utils.SafeUnmarshal(req.Params, &params); err != nil || params == nil {
+			return fmt.Errorf("requests[%d].params 必须是 JSON 对象", i)
+		}
+		if model, _ := params["model"].(string); model == "" {
+			return fmt.Errorf("requests[%d].params.model 不能为空", i)
+		}
+	}
+	return nil
+}
+
+// Create 创建批处理（调用方需先 ValidateRequests）
+func (m *Manager) Create(apiKeyID, group string, requests []types.MessageBatchRequest) (*Batch, error) {
+	now := time.Now().UTC()
+	b := &Batch{
+		ID:        NewBatchID(),
+		APIKeyID:  apiKeyID,
+		Group:     group,
+		Status:    StatusInProgress,
+		CreatedAt: now,
+		ExpiresAt: now.Add(batchExpiry),
+		Counts:    types.MessageBatchRequestCounts{Processing: len(requests)},
+	}
+	if err := m.store.Create(b, requests); err != nil {
+		return nil, err
+	}
+	logger.Info("创建批处理",
+		logger.String("batch_id", b.ID),
+		logger.String("api_key_id", apiKeyID),
+		logger.String("group", group),
+		logger.Int("requests", len(requests)))
+	m.Notify()
+	return b, nil
+}
+
+// Get 读取批处理
+func (m *Manager) Get(id string) (*Batch, error) {
+	return m.store.Get(id)
+}
+
+// Cancel 取消批处理：未开始的请求标记为 canceled，执行中的请求完成后结束
+func (m *Manager) Cancel(id string) (*Batch, error) {
+	if _, err := m.store.Get(id); err != nil {
+		return nil, err
+	}
+	if _, err := m.store.SetCanceling(id, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	m.settleBatch(id, time.Now())
+	return m.store.Get(id)
+}
+
+// Results 按请求顺序遍历结果
+func (m *Manager) Results(id string, fn func(types.MessageBatchResult) error) error {
+	return m.store.Results(id, fn)
+}
+
+// Notify 唤醒调度（新批处理或请求完成后调用）
+func (m *Manager) Notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start 启动调度循环（恢复重启前未完成的批处理）
+func (m *Manager) Start() {
+	m.startOnce.Do(func() {
+		go m.run()
+	})
+}
+
+// Stop 停止调度并等待执行中的请求退出（未完成的请求保持 pending，下次启动继续）
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() {
+		m.cancel()
+		m.startOnce.Do(func() { close(m.done) })
+		<-m.done
+		m.wg.Wait()
+	})
+}
+
+// run 调度循环（请求完成时只检查所属批处理，全量检查按轮询间隔执行）
+func (m *Manager) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	m.sweep(time.Now())
+	for {
+		m.dispatch(time.Now())
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-m.wake:
+		case <-ticker.C:
+			m.sweep(time.Now())
+		}
+	}
+}
+
+// notifyAfter 在 delay 后唤醒调度（重试到期时立即执行，无需等待轮询）
+func (m *Manager) notifyAfter(delay time.Duration) {
+	time.AfterFunc(delay, m.Notify)
+}
+
+// sweep 结束已完成/已取消/已过期的批处理
+func (m *Manager) sweep(now time.Time) {
+	batches, err := m.store.Unfinished()
+	if err != nil {
+		logger.Warn("读取未完成批处理失败", logger.Err(err))
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, b := range batches {
+		m.settle(b, now)
+	}
+}
+
+// settleBatch 检查单个批处理是否可以结束
+func (m *Manager) settleBatch(id string, now time.Time) {
+	b, err := m.store.header(id)
+	if err != nil {
+		logger.Warn("读取批处理失败", logger.String("batch_id", id), logger.Err(err))
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.settle(b, now)
+}
+
+// settle 结束已完成/已取消/已过期的批处理（调用方持有锁）
+func (m *Manager) settle(b *Batch, now time.Time) {
+	// 已结束或仍有请求执行中时跳过
+	if b.Status == StatusEnded || len(m.claimed[b.ID]) > 0 {
+		return
+	}
+	switch {
+	case b.Status == StatusCanceling:
+		m.finish(b, RequestCanceled, now)
+	case now.After(b.ExpiresAt):
+		m.finish(b, RequestExpired, now)
+	default:
+		pending, err := m.store.HasPending(b.ID)
+		if err != nil {
+			logger.Warn("读取批处理请求状态失败", logger.String("batch_id", b.ID), logger.Err(err))
+			return
+		}
+		if !pending {
+			m.finish(b, "", now)
+		}
+	}
+}
+
+// finish 将剩余请求标记为 pendingStatus（为空则不处理）并结束批处理（调用方持有锁）
+func (m *Manager) finish(b *Batch, pendingStatus string, now time.Time) {
+	if pendingStatus != "" {
+		if err := m.store.FinishPending(b.ID, pendingStatus); err != nil {
+			logger.Warn("更新批处理请求状态失败", logger.String("batch_id", b.ID), logger.Err(err))
+			return
+		}
+	}
+	if err := m.store.End(b.ID, now.UTC()); err != nil {
+		logger.Warn("结束批处理失败", logger.String("batch_id", b.ID), logger.Err(err))
+		return
+	}
+	logger.Info("批处理结束", logger.String("batch_id", b.ID), logger.String("status", b.Status))
+}
+
+// dispatch 按空闲工作数领取待执行请求
+func (m *Manager) dispatch(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	free := m.workers - m.running
+	if free <= 0 || m.ctx.Err() != nil {
+		return
+	}
+	jobs, err := m.store.Pending(now, m.running+free)
+	if err != nil {
+		logger.Warn("读取待执行批处理请求失败", logger.Err(err))
+		return
+	}
+	for _, job := range jobs {
+		if free == 0 {
+			break
+		}
+		if m.claimed[job.BatchID][job.Index] {
+			continue
+		}
+		if m.claimed[job.BatchID] == nil {
+			m.claimed[job.BatchID] = make(map[int]bool)
+		}
+		m.claimed[job.BatchID][job.Index] = true
+		m.running++
+		free--
+
+		m.wg.Add(1)
+		go m.work(job)
+	}
+}
+
+// work 执行单个请求并写入结果
+func (m *Manager) work(job Job) {
+	defer m.wg.Done()
+	defer func() {
+		m.mu.Lock()
+		delete(m.claimed[job.BatchID], job.Index)
+		if len(m.claimed[job.BatchID]) == 0 {
+			delete(m.claimed, job.BatchID)
+		}
+		m.running--
+		m.mu.Unlock()
+		if m.ctx.Err() == nil {
+			m.settleBatch(job.BatchID, time.Now())
+		}
+		m.Notify()
+	}()
+
+	resp := m.execute(m.ctx, job)
+	if m.ctx.Err() != nil {
+		// 退出中断的请求保持 pending，重启后重新执行
+		return
+	}
+	if err := m.record(job, resp, time.Now()); err != nil {
+		logger.Warn("保存批处理结果失败",
+			logger.String("batch_id", job.BatchID),
+			logger.String("custom_id", job.CustomID),
+			logger.Err(err))
+	}
+}
+
+// record 按状态码写入结果：成功 -> succeeded，可重试错误 -> 退避重试，其余 -> errored
+// 代理自身的限流/配额拒绝按 API Key 整体退避，不计入尝试次数
+func (m *Manager) record(job Job, resp Response, now time.Time) error {
+	if resp.StatusCode == http.StatusOK {
+		return m.store.Complete(job.BatchID, job.Index, RequestSucceeded, resp.Body)
+	}
+	if resp.Throttled {
+		delay := resp.RetryAfter
+		if delay <= 0 {
+			delay = time.Second
+		}
+		logger.Debug("API Key 被限流，批处理请求稍后执行",
+			logger.String("batch_id", job.BatchID),
+			logger.String("api_key_id", job.APIKeyID),
+			logger.Duration("delay", delay))
+		if err := m.store.DeferKey(job.APIKeyID, now.Add(delay)); err != nil {
+			return err
+		}
+		m.notifyAfter(delay)
+		return nil
+	}
+	if isRetryable(resp.StatusCode) && job.Attempts+1 < maxAttempts {
+		delay := resp.RetryAfter
+		if delay <= 0 {
+			delay = min(time.Second<<job.Attempts, maxRetryDelay)
+		}
+		logger.Debug("批处理请求稍后重试",
+			logger.String("batch_id", job.BatchID),
+			logger.String("custom_id", job.CustomID),
+			logger.Int("status_code", resp.StatusCode),
+			logger.Duration("delay", delay))
+		if err := m.store.Retry(job.BatchID, job.Index, now.Add(delay)); err != nil {
+			return err
+		}
+		m.notifyAfter(delay)
+		return nil
+	}
+	return m.store.Complete(job.BatchID, job.Index, RequestErrored, errorResult(resp))
+}
+
+// isRetryable 是否为可重试的状态码（0 表示执行器未拿到响应）
+func isRetryable(status int) bool {
+	return status == 0 || status == 529 || config.IsRetryableStatus(status)
+}
+
+// errorResult 将错误响应统一为 {"type":"error","error":{"type","message"}}
+func errorResult(resp Response) []byte {
+	errType := types.ErrorTypeFromStatus(resp.StatusCode)
+	message := http.StatusText(resp.StatusCode)
+
+	var parsed map[string]any
+	if utils.SafeUnmarshal(resp.Body, &parsed) == nil {
+		switch e := parsed["error"].(type) {
+		case map[string]any:
+			if t, ok := e["type"].(string); ok && t != "" {
+				errType = t
+			}
+			if msg, ok := e["message"].(string); ok && msg != "" {
+				message = msg
+			}
+		case string:
+			message = e
+		}
+	} else if len(resp.Body) > 0 {
+		message = string(resp.Body)
+	}
+	if message == "" {
+		message = "请求失败"
+	}
+
+	data, _ := utils.SafeMarshal(map[string]any{
+		"type":  "error",
+		"error": map[string]any{"type": errType, "message": message},
+	})
+	return data
+}
@@ -0,0 +1,272 @@
+package batch
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"kiro2api/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+const testSchema = `
+CREATE TABLE message_batches (
+    id TEXT PRIMARY KEY,
+    api_key_id TEXT DEFAULT '',
+    group_name TEXT DEFAULT '',
+    status TEXT DEFAULT 'in_progress',
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    cancel_initiated_at DATETIME,
+    ended_at DATETIME
+);
+CREATE TABLE message_batch_requests (
+    batch_id TEXT NOT NULL,
+    idx INTEGER NOT NULL,
+    custom_id TEXT NOT NULL,
+    params TEXT NOT NULL,
+    status TEXT DEFAULT 'pending',
+    result TEXT,
+    attempts INTEGER DEFAULT 0,
+    not_before INTEGER DEFAULT 0,
+    PRIMARY KEY (batch_id, idx)
+);`
+
+func openTestDB(t *testing.T) *sql.DB {
+	path := filepath.Join(t.TempDir(), "batch.db")
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	assert.NoError(t, err)
+	_, err = db.Exec(testSchema)
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func testRequests(ids ...string) []types.MessageBatchRequest {
+	reqs := make([]types.MessageBatchRequest, 0, len(ids))
+	for _, id := range ids {
+		reqs = append(reqs, types.MessageBatchRequest{
+			CustomID: id,
+			Params:   json.RawMessage(`{"model":"claude-sonnet-4-5","max_tokens":16,"messages":[{"role":"user","content":"` + id + `"}]}`),
+		})
+	}
+	return reqs
+}
+
+// waitEnded 等待批处理结束
+func waitEnded(t *testing.T, m *Manager, id string) *Batch {
+	var b *Batch
+	assert.Eventually(t, func() bool {
+		var err error
+		b, err = m.Get(id)
+		return err == nil && b.Status == StatusEnded
+	}, 5*time.Second, 10*time.Millisecond)
+	return b
+}
+
+func collectResults(t *testing.T, m *Manager, id string) map[string]types.MessageBatchResultBody {
+	results := make(map[string]types.MessageBatchResultBody)
+	assert.NoError(t, m.Results(id, func(line types.MessageBatchResult) error {
+		results[line.CustomID] = line.Result
+		return nil
+	}))
+	return results
+}
+
+func TestValidateRequests(t *testing.T) {
+	assert.NoError(t, ValidateRequests(testRequests("a", "b-1", "c_2")))
+	assert.Error(t, ValidateRequests(nil))
+	assert.Error(t, ValidateRequests(testRequests("a", "a")), "custom_id 重复")
+	assert.Error(t, ValidateRequests(testRequests("bad id")))
+	assert.Error(t, ValidateRequests([]types.MessageBatchRequest{{CustomID: "a", Params: json.RawMessage(`{"messages":[]}`)}}))
+	assert.Error(t, ValidateRequests([]types.MessageBatchRequest{{CustomID: "a", Params: json.RawMessage(`[]`)}}))
+}
+
+func TestManager_ExecutesAndRecordsResults(t *testing.T) {
+	db := openTestDB(t)
+	var calls sync.Map
+	m := NewManager(db, func(ctx context.Context, job Job) Response {
+		n, _ := calls.LoadOrStore(job.CustomID, new(atomic.Int32))
+		attempt := n.(*atomic.Int32).Add(1)
+		switch job.CustomID {
+		case "bad":
+			return Response{StatusCode: http.StatusBadRequest, Body: []byte(`{"error":{"type":"invalid_request_error","message":"bad model"}}`)}
+		case "flaky":
+			if attempt == 1 {
+				return Response{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Millisecond}
+			}
+		}
+		assert.Equal(t, "key_1", job.APIKeyID)
+		assert.Equal(t, "team", job.Group)
+		return Response{StatusCode: http.StatusOK, Body: []byte(`{"id":"msg_` + job.CustomID + `","type":"message"}`)}
+	}, 2)
+	m.Start()
+	defer m.Stop()
+
+	created, err := m.Create("key_1", "team", testRequests("ok", "bad", "flaky"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, created.Counts.Processing)
+	assert.Nil(t, created.View("http://x/results").ResultsURL, "未结束时不返回结果地址")
+
+	b := waitEnded(t, m, created.ID)
+	assert.Equal(t, types.MessageBatchRequestCounts{Succeeded: 2, Errored: 1}, b.Counts)
+	assert.NotNil(t, b.EndedAt)
+	assert.NotNil(t, b.View("http://x/results").ResultsURL)
+
+	results := collectResults(t, m, created.ID)
+	assert.Equal(t, RequestSucceeded, results["ok"].Type)
+	assert.JSONEq(t, `{"id":"msg_ok","type":"message"}`, string(results["ok"].Message))
+	assert.Equal(t, RequestErrored, results["bad"].Type)
+	assert.JSONEq(t, `{"type":"error","error":{"type":"invalid_request_error","message":"bad model"}}`, string(results["bad"].Error))
+	assert.Equal(t, RequestSucceeded, results["flaky"].Type, "429 后重试成功")
+}
+
+func TestManager_GivesUpAfterMaxAttempts(t *testing.T) {
+	db := openTestDB(t)
+	var attempts atomic.Int32
+	m := NewManager(db, func(ctx context.Context, job Job) Response {
+		attempts.Add(1)
+		return Response{StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Millisecond}
+	}, 1)
+	m.Start()
+	defer m.Stop()
+
+	created, err := m.Create("", "", testRequests("a"))
+	assert.NoError(t, err)
+	b := waitEnded(t, m, created.ID)
+	assert.Equal(t, 1, b.Counts.Errored)
+	assert.Equal(t, int32(maxAttempts), attempts.Load())
+	assert.Contains(t, string(collectResults(t, m, created.ID)["a"].Error), "overloaded_error")
+}
+
+func TestManager_ProxyThrottlingDoesNotCountAttempts(t *testing.T) {
+	db := openTestDB(t)
+	var calls atomic.Int32
+	m := NewManager(db, func(ctx context.Context, job Job) Response {
+		if calls.Add(1) <= maxAttempts+2 {
+			return Response{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Millisecond, Throttled: true}
+		}
+		return Response{StatusCode: http.StatusOK, Body: []byte(`{}`)}
+	}, 1)
+	m.Start()
+	defer m.Stop()
+
+	created, err := m.Create("key_1", "", testRequests("a"))
+	assert.NoError(t, err)
+	b := waitEnded(t, m, created.ID)
+	assert.Equal(t, 1, b.Counts.Succeeded, "代理自身限流不计入尝试次数")
+	assert.Equal(t, int32(maxAttempts+3), calls.Load())
+}
+
+func TestManager_ProxyThrottlingDefersWholeKey(t *testing.T) {
+	db := openTestDB(t)
+	m := NewManager(db, nil, 1)
+
+	throttled, err := m.Create("key_1", "", testRequests("a", "b"))
+	assert.NoError(t, err)
+	_, err = m.Create("key_2", "", testRequests("c"))
+	assert.NoError(t, err)
+
+	now := time.Now()
+	job := Job{BatchID: throttled.ID, Index: 0, CustomID: "a", APIKeyID: "key_1"}
+	assert.NoError(t, m.record(job, Response{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour, Throttled: true}, now))
+
+	jobs, err := m.store.Pending(now, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1, "同一 Key 的请求整体退避") {
+		assert.Equal(t, "c", jobs[0].CustomID)
+	}
+
+	jobs, err = m.store.Pending(now.Add(2*time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 3)
+	for _, j := range jobs {
+		assert.Zero(t, j.Attempts)
+	}
+}
+
+func TestManager_ResumesAfterRestart(t *testing.T) {
+	db := openTestDB(t)
+
+	// 第一个实例在执行中退出
+	started := make(chan struct{}, 10)
+	first := NewManager(db, func(ctx context.Context, job Job) Response {
+		started <- struct{}{}
+		<-ctx.Done()
+		return Response{}
+	}, 1)
+	first.Start()
+	created, err := first.Create("key_1", "", testRequests("a", "b"))
+	assert.NoError(t, err)
+	<-started
+	first.Stop()
+
+	b, err := first.Get(created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusInProgress, b.Status)
+	assert.Equal(t, 2, b.Counts.Processing, "中断的请求保持 pending")
+
+	second := NewManager(db, func(ctx context.Context, job Job) Response {
+		return Response{StatusCode: http.StatusOK, Body: []byte(`{}`)}
+	}, 1)
+	second.Start()
+	defer second.Stop()
+	b = waitEnded(t, second, created.ID)
+	assert.Equal(t, 2, b.Counts.Succeeded)
+}
+
+func TestManager_Cancel(t *testing.T) {
+	db := openTestDB(t)
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	m := NewManager(db, func(ctx context.Context, job Job) Response {
+		started <- struct{}{}
+		<-release
+		return Response{StatusCode: http.StatusOK, Body: []byte(`{}`)}
+	}, 1)
+	m.Start()
+	defer m.Stop()
+
+	created, err := m.Create("", "", testRequests("a", "b", "c"))
+	assert.NoError(t, err)
+	<-started
+
+	b, err := m.Cancel(created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCanceling, b.Status, "执行中的请求完成前保持 canceling")
+	assert.NotNil(t, b.CancelInitiatedAt)
+
+	close(release)
+	b = waitEnded(t, m, created.ID)
+	assert.Equal(t, types.MessageBatchRequestCounts{Succeeded: 1, Canceled: 2}, b.Counts)
+
+	_, err = m.Cancel("msgbatch_missing")
+	assert.ErrorIs(t, err, ErrBatchNotFound)
+}
+
+func TestManager_ExpiresStaleBatches(t *testing.T) {
+	db := openTestDB(t)
+	m := NewManager(db, func(ctx context.Context, job Job) Response {
+		return Response{StatusCode: http.StatusOK, Body: []byte(`{}`)}
+	}, 1)
+
+	created, err := m.Create("", "", testRequests("a", "b"))
+	assert.NoError(t, err)
+	_, err = db.Exec(`UPDATE message_batches SET expires_at = ? WHERE id = ?`, time.Now().Add(-time.Minute).UTC(), created.ID)
+	assert.NoError(t, err)
+
+	m.sweep(time.Now())
+	b, err := m.Get(created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusEnded, b.Status)
+	assert.Equal(t, 2, b.Counts.Expired)
+	assert.Equal(t, RequestExpired, collectResults(t, m, created.ID)["a"].Type)
+}
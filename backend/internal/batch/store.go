@@ -0,0 +1,346 @@
+package batch
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"kiro2api/internal/types"
+	"kiro2api/internal/utils"
+)
+
+// ErrBatchNotFound 批处理不存在
+var ErrBatchNotFound = errors.New("批处理不存在")
+
+// 批处理状态
+const (
+	StatusInProgress = "in_progress"
+	StatusCanceling  = "canceling"
+	StatusEnded      = "ended"
+)
+
+// 请求状态（除 pending 外与结果类型一致）
+const (
+	RequestPending   = "pending"
+	RequestSucceeded = "succeeded"
+	RequestErrored   = "errored"
+	RequestCanceled  = "canceled"
+	RequestExpired   = "expired"
+)
+
+// Batch 批处理记录
+type Batch struct {
+	ID                string
+	APIKeyID          string // 创建者，仅创建者与管理员可访问
+	Group             string // 显式指定的分组（路径或 X-Kiro-Group），空表示按 API Key 默认分组与路由规则
+	Status            string
+	CreatedAt         time.Time
+	ExpiresAt         time.Time
+	CancelInitiatedAt *time.Time
+	EndedAt           *time.Time
+	Counts            types.MessageBatchRequestCounts
+}
+
+// View 转换为 API 响应对象（resultsURL 仅在结束后返回）
+func (b *Batch) View(resultsURL string) types.MessageBatch {
+	view := types.MessageBatch{
+		ID:                b.ID,
+		Type:              "message_batch",
+		ProcessingStatus:  b.Status,
+		RequestCounts:     b.Counts,
+		EndedAt:           b.EndedAt,
+		CreatedAt:         b.CreatedAt,
+		ExpiresAt:         b.ExpiresAt,
+		CancelInitiatedAt: b.CancelInitiatedAt,
+	}
+	if b.Status == StatusEnded && resultsURL != "" {
+		view.ResultsURL = &resultsURL
+	}
+	return view
+}
+
+// Job 待执行的单个请求
+type Job struct {
+	BatchID  string
+	Index    int
+	CustomID string
+	APIKeyID string
+	Group    string
+	Params   json.RawMessage
+	Attempts int
+}
+
+// Store 批处理持久化（SQLite）
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore 创建批处理存储
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Create 保存批处理及其全部请求
+func (s *Store) Create(b *Batch, requests []types.MessageBatchRequest) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO message_batches (id, api_key_id, group_name, status, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		b.ID, b.APIKeyID, b.Group, b.Status, b.CreatedAt, b.ExpiresAt); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO message_batch_requests (batch_id, idx, custom_id, params, status)
+		VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, req := range requests {
+		if _, err := stmt.Exec(b.ID, i, req.CustomID, string(req.Params), RequestPending); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Get 读取批处理（含各状态请求数）
+func (s *Store) Get(id string) (*Batch, error) {
+	b, err := s.header(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadCounts(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// header 读取批处理（不统计请求数）
+func (s *Store) header(id string) (*Batch, error) {
+	b := &Batch{}
+	var cancelAt, endedAt sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT id, api_key_id, group_name, status, created_at, expires_at, cancel_initiated_at, ended_at
+		FROM message_batches WHERE id = ?`, id).
+		Scan(&b.ID, &b.APIKeyID, &b.Group, &b.Status, &b.CreatedAt, &b.ExpiresAt, &cancelAt, &endedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrBatchNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cancelAt.Valid {
+		b.CancelInitiatedAt = &cancelAt.Time
+	}
+	if endedAt.Valid {
+		b.EndedAt = &endedAt.Time
+	}
+	return b, nil
+}
+
+// loadCounts 统计各状态请求数（pending 计为 processing）
+func (s *Store) loadCounts(b *Batch) error {
+	rows, err := s.db.Query(`SELECT status, COUNT(*) FROM message_batch_requests WHERE batch_id = ? GROUP BY status`, b.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	b.Counts = types.MessageBatchRequestCounts{}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return err
+		}
+		switch status {
+		case RequestPending:
+			b.Counts.Processing = n
+		case RequestSucceeded:
+			b.Counts.Succeeded = n
+		case RequestErrored:
+			b.Counts.Errored = n
+		case RequestCanceled:
+			b.Counts.Canceled = n
+		case RequestExpired:
+			b.Counts.Expired = n
+		}
+	}
+	return rows.Err()
+}
+
+// Unfinished 列出未结束的批处理（in_progress / canceling，不统计请求数）
+func (s *Store) Unfinished() ([]*Batch, error) {
+	rows, err := s.db.Query(`SELECT id FROM message_batches WHERE status != ? ORDER BY rowid`, StatusEnded)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	batches := make([]*Batch, 0, len(ids))
+	for _, id := range ids {
+		b, err := s.header(id)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, b)
+	}
+	return batches, nil
+}
+
+// Pending 按创建顺序读取可执行的请求（仅 in_progress 批处理，跳过未到重试时间的请求）
+func (s *Store) Pending(now time.Time, limit int) ([]Job, error) {
+	rows, err := s.db.Query(`
+		SELECT r.batch_id, r.idx, r.custom_id, r.params, r.attempts, b.api_key_id, b.group_name
+		FROM message_batch_requests r JOIN message_batches b ON b.id = r.batch_id
+		WHERE r.status = ? AND b.status = ? AND r.not_before <= ?
+		ORDER BY b.rowid, r.idx
+		LIMIT ?`,
+		RequestPending, StatusInProgress, now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var job Job
+		var params string
+		if err := rows.Scan(&job.BatchID, &job.Index, &job.CustomID, &params, &job.Attempts, &job.APIKeyID, &job.Group); err != nil {
+			return nil, err
+		}
+		job.Params = json.RawMessage(params)
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// HasPending 批处理是否仍有未完成的请求
+func (s *Store) HasPending(batchID string) (bool, error) {
+	var one int
+	err := s.db.QueryRow(`SELECT 1 FROM message_batch_requests WHERE status = ? AND batch_id = ? LIMIT 1`,
+		RequestPending, batchID).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Complete 写入请求的最终结果
+func (s *Store) Complete(batchID string, idx int, status string, result []byte) error {
+	_, err := s.db.Exec(`
+		UPDATE message_batch_requests SET status = ?, result = ?, attempts = attempts + 1
+		WHERE batch_id = ? AND idx = ? AND status = ?`,
+		status, nullableResult(result), batchID, idx, RequestPending)
+	return err
+}
+
+// Retry 记录一次失败并推迟到 notBefore 后重试
+func (s *Store) Retry(batchID string, idx int, notBefore time.Time) error {
+	_, err := s.db.Exec(`
+		UPDATE message_batch_requests SET attempts = attempts + 1, not_before = ?
+		WHERE batch_id = ? AND idx = ? AND status = ?`,
+		notBefore.UnixMilli(), batchID, idx, RequestPending)
+	return err
+}
+
+// DeferKey 将 API Key 下未完成的请求推迟到 notBefore 后执行（不计入尝试次数）
+func (s *Store) DeferKey(apiKeyID string, notBefore time.Time) error {
+	_, err := s.db.Exec(`
+		UPDATE message_batch_requests SET not_before = ?
+		WHERE status = ? AND not_before < ?
+			AND batch_id IN (SELECT id FROM message_batches WHERE api_key_id = ? AND status = ?)`,
+		notBefore.UnixMilli(), RequestPending, notBefore.UnixMilli(), apiKeyID, StatusInProgress)
+	return err
+}
+
+// FinishPending 将剩余未执行的请求标记为 canceled / expired
+func (s *Store) FinishPending(batchID, status string) error {
+	_, err := s.db.Exec(`UPDATE message_batch_requests SET status = ? WHERE batch_id = ? AND status = ?`,
+		status, batchID, RequestPending)
+	return err
+}
+
+// SetCanceling 发起取消（仅 in_progress 可取消）
+func (s *Store) SetCanceling(id string, now time.Time) (bool, error) {
+	res, err := s.db.Exec(`UPDATE message_batches SET status = ?, cancel_initiated_at = ? WHERE id = ? AND status = ?`,
+		StatusCanceling, now, id, StatusInProgress)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// End 标记批处理结束
+func (s *Store) End(id string, now time.Time) error {
+	_, err := s.db.Exec(`UPDATE message_batches SET status = ?, ended_at = ? WHERE id = ? AND status != ?`,
+		StatusEnded, now, id, StatusEnded)
+	return err
+}
+
+// Results 按请求顺序遍历结果
+func (s *Store) Results(id string, fn func(types.MessageBatchResult) error) error {
+	rows, err := s.db.Query(`
+		SELECT custom_id, status, COALESCE(result, '') FROM message_batch_requests
+		WHERE batch_id = ? ORDER BY idx`, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var customID, status, result string
+		if err := rows.Scan(&customID, &status, &result); err != nil {
+			return err
+		}
+		line := types.MessageBatchResult{CustomID: customID, Result: types.MessageBatchResultBody{Type: status}}
+		switch status {
+		case RequestSucceeded:
+			line.Result.Message = json.RawMessage(result)
+		case RequestErrored:
+			line.Result.Error = json.RawMessage(result)
+		case RequestPending:
+			// 结束后不应存在，按过期处理
+			line.Result.Type = RequestExpired
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// nullableResult 空结果存为 NULL
+func nullableResult(result []byte) any {
+	if len(result) == 0 {
+		return nil
+	}
+	return string(result)
+}
+
+// NewBatchID 生成批处理 ID
+func NewBatchID() string {
+	return "msgbatch_" + strings.ReplaceAll(utils.GenerateUUID(), "-", "")
+}
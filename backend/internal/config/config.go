@@ -6,7 +6,7 @@ import (
 	"time"
 )
 
-// ModelMap 模型映射表
+// ModelMap 内置模型映射表（首次启动写入模型注册表，运行时以 ModelRegistry 为准）
 var ModelMap = map[string]string{
 	// Sonnet 4.5 系列
 	"claude-sonnet-4-5":          "CLAUDE_SONNET_4_5_20250929_V1_0",
@@ -35,12 +35,26 @@ var ModelMap = map[string]string{
 
 // ModelPricing 模型定价信息（每百万 tokens）
 type ModelPricing struct {
-	InputPrice  float64 // 输入价格
-	OutputPrice float64 // 输出价格
-	CacheRead   float64 // 缓存读取价格
+	InputPrice  float64 `json:"input_price"`  // 输入价格
+	OutputPrice float64 `json:"output_price"` // 输出价格
+	CacheRead   float64 `json:"cache_read"`   // 缓存读取价格
 }
 
-// ModelPricingMap 模型定价映射表（基于 Anthropic 官方定价）
+// OutputTokensFromCredit 根据 credit 反推输出 tokens
+// 公式: output = (credit × 1,000,000 - input × inputPrice) / outputPrice
+// 输出价格非正（如免费模型）时无法反推，返回 0；结果为负（可能是缓存命中）时返回 0
+func (p ModelPricing) OutputTokensFromCredit(credit float64, inputTokens int) int {
+	if p.OutputPrice <= 0 {
+		return 0
+	}
+	tokens := int((credit*1000000 - float64(inputTokens)*p.InputPrice) / p.OutputPrice)
+	if tokens < 0 {
+		return 0
+	}
+	return tokens
+}
+
+// ModelPricingMap 内置模型定价（基于 Anthropic 官方定价，作为注册表默认值）
 var ModelPricingMap = map[string]ModelPricing{
 	// Opus 4.5
 	"claude-opus-4-5":          {InputPrice: 5, OutputPrice: 25, CacheRead: 0.50},
@@ -69,7 +83,7 @@ var ModelPricingMap = map[string]ModelPricing{
 	"claude-3-haiku-20240307": {InputPrice: 0.25, OutputPrice: 1.25, CacheRead: 0.03},
 }
 
-// GetModelPricing 获取模型定价，如果找不到则返回 Sonnet 4.5 的默认定价
+// GetModelPricing 获取内置模型定价，如果找不到则返回 Sonnet 4.5 的默认定价
 func GetModelPricing(model string) ModelPricing {
 	if pricing, ok := ModelPricingMap[model]; ok {
 		return pricing
@@ -21,6 +21,18 @@ const (
 
 	// RetryDelay 重试延迟
 	RetryDelay = 100 * time.Millisecond
+
+	// DefaultStreamFirstByteTimeout 流式请求默认首字节超时
+	DefaultStreamFirstByteTimeout = 60 * time.Second
+
+	// DefaultStreamIdleTimeout 流式请求默认数据块间空闲超时
+	DefaultStreamIdleTimeout = 60 * time.Second
+
+	// DefaultStreamKeepalive 流式响应默认心跳间隔
+	DefaultStreamKeepalive = 15 * time.Second
+
+	// ContinuationPrompt 流中断续写时追加的用户指令
+	ContinuationPrompt = "Your previous response was interrupted. Continue exactly from where it stopped, without repeating any text already written and without any preamble."
 )
 
 // Token估算常量
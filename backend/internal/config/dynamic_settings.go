@@ -14,6 +14,9 @@ type Settings struct {
 	MaxRetries        int     `json:"max_retries"`
 	CooldownSec       int     `json:"cooldown_sec"`
 
+	// 限流排队最长等待（毫秒）：0 = 令牌不足立即返回 429（默认）；大于 0 时按分组优先级排队
+	RateLimitQueueWaitMs int `json:"rate_limit_queue_wait_ms"`
+
 	// 单 token 限流与并发控制（0/负数=关闭）
 	TokenRateLimitQPS   float64 `json:"token_rate_limit_qps"`
 	TokenRateLimitBurst int     `json:"token_rate_limit_burst"`
@@ -25,6 +28,18 @@ type Settings struct {
 
 	// 会话 ID 持续时间（分钟，默认 60）
 	SessionDurationMin int `json:"session_duration_min"`
+
+	// 流中断续写：已下发内容后上游断流时换 token 续写（默认关闭，次数受 MaxRetries 限制）
+	StreamContinuation bool `json:"stream_continuation"`
+
+	// 流式超时（秒）：首字节超时、数据块间空闲超时（0=使用默认 60），总时长上限（0=不限制）
+	// 流式请求不受 RequestTimeoutSec 约束
+	StreamFirstByteTimeoutSec int `json:"stream_first_byte_timeout_sec"`
+	StreamIdleTimeoutSec      int `json:"stream_idle_timeout_sec"`
+	StreamTotalTimeoutSec     int `json:"stream_total_timeout_sec"`
+
+	// 流式心跳间隔（秒）：客户端持续无数据时发送 ping（0=使用默认 15，负数=关闭）
+	StreamKeepaliveSec int `json:"stream_keepalive_sec"`
 }
 
 const settingsKey = "global_settings"
@@ -44,6 +59,10 @@ func DefaultSettings(qps float64, burst int) Settings {
 		GroupMaxConcurrent:  0,
 
 		RefreshConcurrency: 20,
+
+		StreamFirstByteTimeoutSec: int(DefaultStreamFirstByteTimeout.Seconds()),
+		StreamIdleTimeoutSec:      int(DefaultStreamIdleTimeout.Seconds()),
+		StreamKeepaliveSec:        int(DefaultStreamKeepalive.Seconds()),
 	}
 }
 
@@ -0,0 +1,369 @@
+package config
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 模型注册表错误
+var (
+	ErrModelNotFound = errors.New("模型不存在")
+	ErrModelExists   = errors.New("模型已存在")
+)
+
+// 内置模型默认参数
+const (
+	DefaultContextWindow = 200000
+	DefaultMaxOutput     = 64000
+)
+
+// ModelInfo 模型注册信息（对外别名 -> 上游模型 ID）
+type ModelInfo struct {
+	ID            string       `json:"id"`          // 对外模型名（别名）
+	UpstreamID    string       `json:"upstream_id"` // CodeWhisperer modelId
+	DisplayName   string       `json:"display_name,omitempty"`
+	ContextWindow int          `json:"context_window"`
+	MaxOutput     int          `json:"max_output"`
+	Pricing       ModelPricing `json:"pricing"`
+	Enabled       bool         `json:"enabled"`
+	Groups        []string     `json:"groups,omitempty"` // 可用分组（空 = 所有分组）
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// AvailableIn 检查模型在指定分组是否可用
+func (m *ModelInfo) AvailableIn(group string) bool {
+	if !m.Enabled {
+		return false
+	}
+	if len(m.Groups) == 0 || group == "" {
+		return true
+	}
+	for _, g := range m.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 校验并补全默认值
+func (m *ModelInfo) Validate() error {
+	m.ID = strings.TrimSpace(m.ID)
+	m.UpstreamID = strings.TrimSpace(m.UpstreamID)
+	if m.ID == "" {
+		return fmt.Errorf("模型 ID 不能为空")
+	}
+	if m.UpstreamID == "" {
+		return fmt.Errorf("上游模型 ID 不能为空")
+	}
+	if m.ContextWindow < 0 || m.MaxOutput < 0 {
+		return fmt.Errorf("上下文窗口与最大输出不能为负数")
+	}
+	if m.Pricing.InputPrice < 0 || m.Pricing.OutputPrice < 0 || m.Pricing.CacheRead < 0 {
+		return fmt.Errorf("价格不能为负数")
+	}
+	if m.ContextWindow == 0 {
+		m.ContextWindow = DefaultContextWindow
+	}
+	if m.MaxOutput == 0 {
+		m.MaxOutput = DefaultMaxOutput
+	}
+	return nil
+}
+
+// BuiltinModels 内置模型（由 ModelMap 与 ModelPricingMap 生成，启动时补写注册表中缺少的内置模型）
+func BuiltinModels() []ModelInfo {
+	models := make([]ModelInfo, 0, len(ModelMap))
+	for id, upstream := range ModelMap {
+		models = append(models, ModelInfo{
+			ID:            id,
+			UpstreamID:    upstream,
+			ContextWindow: DefaultContextWindow,
+			MaxOutput:     DefaultMaxOutput,
+			Pricing:       GetModelPricing(id),
+			Enabled:       true,
+		})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models
+}
+
+// isBuiltinModel 是否为内置模型（不区分大小写）
+func isBuiltinModel(id string) bool {
+	for builtin := range ModelMap {
+		if strings.EqualFold(builtin, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// ========== 依赖注入 ==========
+
+var defaultModelRegistry atomic.Pointer[ModelRegistry]
+
+// GetModelRegistry 获取默认模型注册表（未初始化时使用内置模型，不持久化）
+func GetModelRegistry() *ModelRegistry {
+	if r := defaultModelRegistry.Load(); r != nil {
+		return r
+	}
+	defaultModelRegistry.CompareAndSwap(nil, NewModelRegistry(nil))
+	return defaultModelRegistry.Load()
+}
+
+// InitDefaultModelRegistry 初始化默认模型注册表
+func InitDefaultModelRegistry(db *sql.DB) error {
+	r := NewModelRegistry(db)
+	defaultModelRegistry.Store(r)
+	return r.Load()
+}
+
+// ModelRegistry 模型注册表（SQLite 持久化，内存缓存）
+type ModelRegistry struct {
+	mu     sync.RWMutex
+	db     *sql.DB
+	models map[string]*ModelInfo // 小写 ID -> 模型
+}
+
+// NewModelRegistry 创建模型注册表（初始内容为内置模型）
+func NewModelRegistry(db *sql.DB) *ModelRegistry {
+	r := &ModelRegistry{db: db, models: make(map[string]*ModelInfo)}
+	now := time.Now()
+	for _, m := range BuiltinModels() {
+		m.CreatedAt = now
+		r.models[strings.ToLower(m.ID)] = &m
+	}
+	return r
+}
+
+// Load 从数据库加载模型，并写入数据库中缺少的内置模型（新版本增加的内置模型在升级后自动注册，已删除的内置模型除外）
+func (r *ModelRegistry) Load() error {
+	if r.db == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rows, err := r.db.Query(`
+		SELECT id, upstream_id, COALESCE(display_name, ''), context_window, max_output,
+			input_price, output_price, cache_read_price, enabled, COALESCE(allowed_groups, '[]'), COALESCE(deleted, 0), created_at
+		FROM models`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	models := make(map[string]*ModelInfo)
+	deleted := make(map[string]bool)
+	for rows.Next() {
+		var m ModelInfo
+		var groups string
+		var enabled, isDeleted int
+		if err := rows.Scan(&m.ID, &m.UpstreamID, &m.DisplayName, &m.ContextWindow, &m.MaxOutput,
+			&m.Pricing.InputPrice, &m.Pricing.OutputPrice, &m.Pricing.CacheRead, &enabled, &groups, &isDeleted, &m.CreatedAt); err != nil {
+			return err
+		}
+		if isDeleted != 0 {
+			deleted[strings.ToLower(m.ID)] = true
+			continue
+		}
+		m.Enabled = enabled != 0
+		json.Unmarshal([]byte(groups), &m.Groups)
+		models[strings.ToLower(m.ID)] = &m
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// r.models 初始为内置模型
+	for key, m := range r.models {
+		if _, exists := models[key]; exists || deleted[key] {
+			continue
+		}
+		if err := r.saveLocked(m); err != nil {
+			return err
+		}
+		models[key] = m
+	}
+	r.models = models
+	return nil
+}
+
+// saveLocked 写入数据库（调用方持有写锁）
+func (r *ModelRegistry) saveLocked(m *ModelInfo) error {
+	if r.db == nil {
+		return nil
+	}
+	groups, _ := json.Marshal(m.Groups)
+	enabled := 0
+	if m.Enabled {
+		enabled = 1
+	}
+	_, err := r.db.Exec(`
+		INSERT INTO models (id, upstream_id, display_name, context_window, max_output,
+			input_price, output_price, cache_read_price, enabled, allowed_groups, deleted, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(id) DO UPDATE SET
+			upstream_id = excluded.upstream_id, display_name = excluded.display_name,
+			context_window = excluded.context_window, max_output = excluded.max_output,
+			input_price = excluded.input_price, output_price = excluded.output_price,
+			cache_read_price = excluded.cache_read_price, enabled = excluded.enabled,
+			allowed_groups = excluded.allowed_groups, deleted = 0, created_at = excluded.created_at,
+			updated_at = CURRENT_TIMESTAMP`,
+		m.ID, m.UpstreamID, m.DisplayName, m.ContextWindow, m.MaxOutput,
+		m.Pricing.InputPrice, m.Pricing.OutputPrice, m.Pricing.CacheRead, enabled, string(groups), m.CreatedAt)
+	return err
+}
+
+// Get 查找模型（不区分大小写，包含已停用的模型）
+func (r *ModelRegistry) Get(id string) (ModelInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.models[strings.ToLower(id)]
+	if !ok {
+		return ModelInfo{}, false
+	}
+	return *m, true
+}
+
+// Resolve 返回已启用模型的上游 ID
+func (r *ModelRegistry) Resolve(id string) (string, bool) {
+	m, ok := r.Get(id)
+	if !ok || !m.Enabled {
+		return "", false
+	}
+	return m.UpstreamID, true
+}
+
+// AvailableIn 检查模型在指定分组是否可用（未注册的模型不可用）
+func (r *ModelRegistry) AvailableIn(id, group string) bool {
+	m, ok := r.Get(id)
+	return ok && m.AvailableIn(group)
+}
+
+// Pricing 获取模型定价，未注册时使用 Sonnet 4.5 默认定价
+func (r *ModelRegistry) Pricing(id string) ModelPricing {
+	if m, ok := r.Get(id); ok {
+		return m.Pricing
+	}
+	return GetModelPricing(id)
+}
+
+// ContextWindow 获取模型上下文窗口，未注册时使用默认值
+func (r *ModelRegistry) ContextWindow(id string) int {
+	if m, ok := r.Get(id); ok && m.ContextWindow > 0 {
+		return m.ContextWindow
+	}
+	return DefaultContextWindow
+}
+
+// List 列出所有模型（按 ID 排序）
+func (r *ModelRegistry) List() []ModelInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	models := make([]ModelInfo, 0, len(r.models))
+	for _, m := range r.models {
+		models = append(models, *m)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models
+}
+
+// Create 注册新模型
+func (r *ModelRegistry) Create(m ModelInfo) (ModelInfo, error) {
+	if err := m.Validate(); err != nil {
+		return ModelInfo{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := strings.ToLower(m.ID)
+	if _, exists := r.models[key]; exists {
+		return ModelInfo{}, ErrModelExists
+	}
+	m.CreatedAt = time.Now()
+	if err := r.saveLocked(&m); err != nil {
+		return ModelInfo{}, err
+	}
+	r.models[key] = &m
+	return m, nil
+}
+
+// Update 替换模型配置（ID 与创建时间不变）
+func (r *ModelRegistry) Update(id string, m ModelInfo) (ModelInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := strings.ToLower(id)
+	existing, ok := r.models[key]
+	if !ok {
+		return ModelInfo{}, ErrModelNotFound
+	}
+	m.ID = existing.ID
+	m.CreatedAt = existing.CreatedAt
+	if err := m.Validate(); err != nil {
+		return ModelInfo{}, err
+	}
+	if err := r.saveLocked(&m); err != nil {
+		return ModelInfo{}, err
+	}
+	r.models[key] = &m
+	return m, nil
+}
+
+// Delete 删除模型（内置模型保留删除标记，避免启动时被重新写入）
+func (r *ModelRegistry) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := strings.ToLower(id)
+	existing, ok := r.models[key]
+	if !ok {
+		return ErrModelNotFound
+	}
+	if r.db != nil {
+		query := `DELETE FROM models WHERE id = ?`
+		if isBuiltinModel(existing.ID) {
+			query = `UPDATE models SET deleted = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+		}
+		if _, err := r.db.Exec(query, existing.ID); err != nil {
+			return err
+		}
+	}
+	delete(r.models, key)
+	return nil
+}
+
+// ReplaceGroupRef 分组重命名/删除时更新模型的可用分组（newName 为空表示移除）
+func (r *ModelRegistry) ReplaceGroupRef(oldName, newName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.models {
+		changed := false
+		groups := make([]string, 0, len(m.Groups))
+		for _, g := range m.Groups {
+			if g != oldName {
+				groups = append(groups, g)
+				continue
+			}
+			changed = true
+			if newName != "" {
+				groups = append(groups, newName)
+			}
+		}
+		if !changed {
+			continue
+		}
+		if len(groups) == 0 {
+			m.Enabled = false // 可用分组被清空时停用，避免变为所有分组可用
+		}
+		m.Groups = groups
+		r.saveLocked(m)
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+const testModelsSchema = `
+CREATE TABLE models (
+    id TEXT PRIMARY KEY,
+    upstream_id TEXT NOT NULL,
+    display_name TEXT DEFAULT '',
+    context_window INTEGER DEFAULT 200000,
+    max_output INTEGER DEFAULT 64000,
+    input_price REAL DEFAULT 0,
+    output_price REAL DEFAULT 0,
+    cache_read_price REAL DEFAULT 0,
+    enabled INTEGER DEFAULT 1,
+    allowed_groups TEXT DEFAULT '[]',
+    deleted INTEGER DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+)`
+
+func TestModelRegistry_BuiltinDefaults(t *testing.T) {
+	r := NewModelRegistry(nil)
+
+	upstream, ok := r.Resolve("claude-sonnet-4-5-20250929")
+	assert.True(t, ok)
+	assert.Equal(t, ModelMap["claude-sonnet-4-5-20250929"], upstream)
+
+	assert.Equal(t, ModelPricingMap["claude-opus-4-5"], r.Pricing("claude-opus-4-5"))
+	assert.Equal(t, GetModelPricing("unknown-model"), r.Pricing("unknown-model"))
+	assert.Len(t, r.List(), len(ModelMap))
+}
+
+func TestModelRegistry_GroupAvailability(t *testing.T) {
+	r := NewModelRegistry(nil)
+	_, err := r.Create(ModelInfo{ID: "claude-sonnet-5", UpstreamID: "CLAUDE_SONNET_5_V1_0", Enabled: true, Groups: []string{"pro"}})
+	assert.NoError(t, err)
+
+	assert.True(t, r.AvailableIn("claude-sonnet-5", "pro"))
+	assert.False(t, r.AvailableIn("claude-sonnet-5", "default"))
+	assert.True(t, r.AvailableIn("claude-sonnet-4-5", "default"), "未限制分组的模型所有分组可用")
+	assert.False(t, r.AvailableIn("unknown-model", "default"))
+
+	r.ReplaceGroupRef("pro", "")
+	m, _ := r.Get("claude-sonnet-5")
+	assert.Empty(t, m.Groups)
+	assert.False(t, m.Enabled, "可用分组被清空后停用")
+	_, ok := r.Resolve("claude-sonnet-5")
+	assert.False(t, ok)
+}
+
+func TestModelRegistry_Validate(t *testing.T) {
+	r := NewModelRegistry(nil)
+
+	_, err := r.Create(ModelInfo{ID: "no-upstream"})
+	assert.Error(t, err)
+
+	_, err = r.Create(ModelInfo{ID: "Claude-Sonnet-4-5", UpstreamID: "x"})
+	assert.ErrorIs(t, err, ErrModelExists, "ID 不区分大小写")
+
+	created, err := r.Create(ModelInfo{ID: "custom", UpstreamID: "auto"})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultContextWindow, created.ContextWindow)
+	assert.Equal(t, DefaultMaxOutput, created.MaxOutput)
+
+	_, err = r.Update("missing", ModelInfo{UpstreamID: "auto"})
+	assert.ErrorIs(t, err, ErrModelNotFound)
+}
+
+func TestModelRegistry_PersistsAndSeeds(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(testModelsSchema)
+	assert.NoError(t, err)
+
+	r := NewModelRegistry(db)
+	assert.NoError(t, r.Load())
+
+	var count int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM models`).Scan(&count))
+	assert.Equal(t, len(ModelMap), count, "首次加载写入内置模型")
+
+	_, err = r.Create(ModelInfo{ID: "claude-sonnet-5", UpstreamID: "CLAUDE_SONNET_5_V1_0", Enabled: true,
+		ContextWindow: 1000000, Pricing: ModelPricing{InputPrice: 3, OutputPrice: 15}, Groups: []string{"pro"}})
+	assert.NoError(t, err)
+	_, err = r.Update("claude-3-5-haiku-20241022", ModelInfo{UpstreamID: "auto", Enabled: false})
+	assert.NoError(t, err)
+	assert.NoError(t, r.Delete("claude-opus-4-0"))
+
+	reloaded := NewModelRegistry(db)
+	assert.NoError(t, reloaded.Load())
+
+	m, ok := reloaded.Get("claude-sonnet-5")
+	assert.True(t, ok)
+	assert.Equal(t, 1000000, m.ContextWindow)
+	assert.Equal(t, []string{"pro"}, m.Groups)
+	assert.False(t, m.CreatedAt.IsZero())
+
+	_, ok = reloaded.Resolve("claude-3-5-haiku-20241022")
+	assert.False(t, ok, "停用的模型不可解析")
+	_, ok = reloaded.Get("claude-opus-4-0")
+	assert.False(t, ok, "删除的内置模型不会被重新写入")
+}
+
+func TestModelRegistry_LoadMergesNewBuiltins(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(testModelsSchema)
+	assert.NoError(t, err)
+
+	assert.NoError(t, NewModelRegistry(db).Load())
+	// 模拟旧版本数据库：缺少后来新增的内置模型
+	_, err = db.Exec(`DELETE FROM models WHERE id = ?`, "claude-sonnet-4-5-20250929")
+	assert.NoError(t, err)
+
+	r := NewModelRegistry(db)
+	assert.NoError(t, r.Load())
+	upstream, ok := r.Resolve("claude-sonnet-4-5-20250929")
+	assert.True(t, ok, "新增的内置模型在加载时补写")
+	assert.Equal(t, ModelMap["claude-sonnet-4-5-20250929"], upstream)
+
+	var count int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM models WHERE id = ?`, "claude-sonnet-4-5-20250929").Scan(&count))
+	assert.Equal(t, 1, count)
+
+	// 删除后重新创建的内置模型可再次加载
+	assert.NoError(t, r.Delete("claude-opus-4-0"))
+	_, err = r.Create(ModelInfo{ID: "claude-opus-4-0", UpstreamID: "auto", Enabled: true})
+	assert.NoError(t, err)
+	reloaded := NewModelRegistry(db)
+	assert.NoError(t, reloaded.Load())
+	m, ok := reloaded.Get("claude-opus-4-0")
+	assert.True(t, ok)
+	assert.Equal(t, "auto", m.UpstreamID)
+}
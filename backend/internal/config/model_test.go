@@ -67,3 +67,13 @@ func TestSupportedModels_ContainsAllKeys(t *testing.T) {
 	assert.NotEmpty(t, ModelMap, "ModelMap should not be empty")
 	assert.Greater(t, len(ModelMap), 3, "ModelMap should contain at least 3 models")
 }
+
+func TestModelPricing_OutputTokensFromCredit(t *testing.T) {
+	pricing := ModelPricing{InputPrice: 3, OutputPrice: 15}
+	// 1000 input × 3 + 2000 output × 15 = 33000 / 1e6 credit
+	assert.Equal(t, 2000, pricing.OutputTokensFromCredit(0.033, 1000))
+	assert.Equal(t, 0, pricing.OutputTokensFromCredit(0, 1000), "结果为负时返回 0")
+
+	free := ModelPricing{}
+	assert.Equal(t, 0, free.OutputTokensFromCredit(0.5, 1000), "免费模型不做除法")
+}
@@ -306,9 +306,9 @@ func BuildCodeWhispererRequest(anthropicReq types.AnthropicRequest, ctx *gin.Con
 		}
 	}
 
-	// 检查模型映射是否存在，如果不存在则返回错误
-	modelId := config.ModelMap[anthropicReq.Model]
-	if modelId == "" {
+	// 从模型注册表解析上游模型 ID，未注册或已停用时返回错误
+	modelId, ok := config.GetModelRegistry().Resolve(anthropicReq.Model)
+	if !ok {
 		logger.Warn("模型映射不存在",
 			logger.String("requested_model", anthropicReq.Model),
 			logger.String("request_id", cwReq.ConversationState.AgentContinuationId))
@@ -0,0 +1,290 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidateJSONSchema 按 JSON Schema 校验解析后的 JSON 值
+// 支持结构化输出常用的子集：type、enum、const、properties、required、additionalProperties、
+// items、长度/数量/数值范围、anyOf/oneOf/allOf 以及 #/$defs、#/definitions 内的 $ref
+func ValidateJSONSchema(value any, schema map[string]any) error {
+	v := &schemaValidator{root: schema}
+	return v.validate(value, schema, "$")
+}
+
+type schemaValidator struct {
+	root  map[string]any
+	depth int
+}
+
+// maxSchemaDepth 防止递归 $ref 无限展开
+const maxSchemaDepth = 64
+
+func (v *schemaValidator) validate(value any, schema map[string]any, path string) error {
+	if schema == nil {
+		return nil
+	}
+	v.depth++
+	defer func() { v.depth-- }()
+	if v.depth > maxSchemaDepth {
+		return fmt.Errorf("%s: schema 嵌套过深", path)
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := v.resolveRef(ref)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if err := v.validate(value, target, path); err != nil {
+			return err
+		}
+	}
+
+	if t, ok := schema["type"]; ok && !matchesSchemaType(value, t) {
+		return fmt.Errorf("%s: 类型应为 %v，实际为 %s", path, t, jsonTypeName(value))
+	}
+	if enum, ok := schema["enum"].([]any); ok && !containsJSONValue(enum, value) {
+		return fmt.Errorf("%s: 值不在 enum 中", path)
+	}
+	if c, ok := schema["const"]; ok && !jsonValueEqual(c, value) {
+		return fmt.Errorf("%s: 值应为 %v", path, c)
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		if err := v.validateObject(val, schema, path); err != nil {
+			return err
+		}
+	case []any:
+		if err := v.validateArray(val, schema, path); err != nil {
+			return err
+		}
+	case string:
+		n := utf8.RuneCountInString(val)
+		if limit, ok := schemaNumber(schema["minLength"]); ok && float64(n) < limit {
+			return fmt.Errorf("%s: 长度不能小于 %v", path, limit)
+		}
+		if limit, ok := schemaNumber(schema["maxLength"]); ok && float64(n) > limit {
+			return fmt.Errorf("%s: 长度不能大于 %v", path, limit)
+		}
+	default:
+		if num, ok := schemaNumber(value); ok {
+			if limit, ok := schemaNumber(schema["minimum"]); ok && num < limit {
+				return fmt.Errorf("%s: 不能小于 %v", path, limit)
+			}
+			if limit, ok := schemaNumber(schema["maximum"]); ok && num > limit {
+				return fmt.Errorf("%s: 不能大于 %v", path, limit)
+			}
+		}
+	}
+
+	return v.validateCombinators(value, schema, path)
+}
+
+func (v *schemaValidator) validateObject(obj map[string]any, schema map[string]any, path string) error {
+	for _, key := range schemaStrings(schema["required"]) {
+		if _, exists := obj[key]; !exists {
+			return fmt.Errorf("%s: 缺少必填字段 %s", path, key)
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	for key, item := range obj {
+		childPath := path + "." + key
+		if propSchema, ok := properties[key].(map[string]any); ok {
+			if err := v.validate(item, propSchema, childPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, declared := properties[key]; declared {
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s: 不允许的字段", childPath)
+			}
+		case map[string]any:
+			if err := v.validate(item, additional, childPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateArray(arr []any, schema map[string]any, path string) error {
+	if limit, ok := schemaNumber(schema["minItems"]); ok && float64(len(arr)) < limit {
+		return fmt.Errorf("%s: 元素数量不能少于 %v", path, limit)
+	}
+	if limit, ok := schemaNumber(schema["maxItems"]); ok && float64(len(arr)) > limit {
+		return fmt.Errorf("%s: 元素数量不能多于 %v", path, limit)
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		for i, item := range arr {
+			if err := v.validate(item, items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateCombinators(value any, schema map[string]any, path string) error {
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, sub := range all {
+			subSchema, _ := sub.(map[string]any)
+			if err := v.validate(value, subSchema, path); err != nil {
+				return err
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok && v.countMatches(value, anyOf, path) == 0 {
+		return fmt.Errorf("%s: 不满足 anyOf 中的任何一项", path)
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok && v.countMatches(value, oneOf, path) != 1 {
+		return fmt.Errorf("%s: 应恰好满足 oneOf 中的一项", path)
+	}
+	return nil
+}
+
+func (v *schemaValidator) countMatches(value any, schemas []any, path string) int {
+	matches := 0
+	for _, sub := range schemas {
+		subSchema, _ := sub.(map[string]any)
+		if v.validate(value, subSchema, path) == nil {
+			matches++
+		}
+	}
+	return matches
+}
+
+// resolveRef 解析文档内引用（#/$defs/x、#/definitions/x）
+func (v *schemaValidator) resolveRef(ref string) (map[string]any, error) {
+	if ref == "#" {
+		return v.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("不支持的 $ref: %s", ref)
+	}
+	var node any = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("无法解析 $ref: %s", ref)
+		}
+		node = m[part]
+	}
+	target, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("无法解析 $ref: %s", ref)
+	}
+	return target, nil
+}
+
+// matchesSchemaType 判断值是否符合 type（字符串或字符串数组）
+func matchesSchemaType(value any, t any) bool {
+	switch tt := t.(type) {
+	case string:
+		return matchesTypeName(value, tt)
+	case []any:
+		for _, item := range tt {
+			if name, ok := item.(string); ok && matchesTypeName(value, name) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesTypeName(value any, name string) bool {
+	actual := jsonTypeName(value)
+	if name == "number" && actual == "integer" {
+		return true
+	}
+	return actual == name
+}
+
+// jsonTypeName 返回 JSON 值的类型名称（整数值的数字归为 integer）
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	if num, ok := schemaNumber(value); ok {
+		if num == math.Trunc(num) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// schemaNumber 将 JSON 数字转换为 float64
+func schemaNumber(value any) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// schemaStrings 读取字符串数组（JSON 解析为 []any，代码构造的 schema 可能为 []string）
+func schemaStrings(value any) []string {
+	switch list := value.(type) {
+	case []string:
+		return list
+	case []any:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func containsJSONValue(values []any, value any) bool {
+	for _, candidate := range values {
+		if jsonValueEqual(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonValueEqual 比较 JSON 值（数字按数值比较）
+func jsonValueEqual(a, b any) bool {
+	if x, ok := schemaNumber(a); ok {
+		y, ok := schemaNumber(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
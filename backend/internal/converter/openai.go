@@ -53,6 +53,7 @@ func ConvertOpenAIToAnthropic(openaiReq types.OpenAIRequest) types.AnthropicRequ
 	if openaiReq.Temperature != nil {
 		anthropicReq.Temperature = openaiReq.Temperature
 	}
+	anthropicReq.StopSequences = convertOpenAIStop(openaiReq.Stop)
 
 	// 转换 tools
 	if len(openaiReq.Tools) > 0 {
@@ -69,10 +70,48 @@ func ConvertOpenAIToAnthropic(openaiReq types.OpenAIRequest) types.AnthropicRequ
 	if openaiReq.ToolChoice != nil {
 		anthropicReq.ToolChoice = convertOpenAIToolChoiceToAnthropic(openaiReq.ToolChoice)
 	}
+	applyParallelToolCalls(&anthropicReq, openaiReq.ParallelToolCalls)
+
+	// response_format 由调用方通过 ApplyOutputFormat 转换为合成工具
+	anthropicReq.OutputFormat = convertOpenAIResponseFormat(openaiReq.ResponseFormat)
 
 	return anthropicReq
 }
 
+// convertOpenAIStop 将 stop（字符串或字符串数组）转换为 stop_sequences
+func convertOpenAIStop(stop any) []string {
+	switch v := stop.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []string:
+		return v
+	case []any:
+		sequences := make([]string, 0, len(v))
+		for _, item := range v {
+			if seq, ok := item.(string); ok && seq != "" {
+				sequences = append(sequences, seq)
+			}
+		}
+		return sequences
+	}
+	return nil
+}
+
+// OpenAIFinishReason 将流式 message_delta 的 stop_reason 映射为 OpenAI finish_reason
+func OpenAIFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		// end_turn / stop_sequence 等
+		return "stop"
+	}
+}
+
 // ConvertAnthropicToOpenAI 将Anthropic响应转换为OpenAI响应
 func ConvertAnthropicToOpenAI(anthropicResp map[string]any, model string, messageId string) types.OpenAIResponse {
 	content := ""
@@ -239,3 +239,45 @@ func TestConvertAnthropicToOpenAI_EmptyContent(t *testing.T) {
 	assert.Len(t, openaiResp.Choices, 1)
 	assert.Empty(t, openaiResp.Choices[0].Message.Content)
 }
+
+func TestConvertOpenAIToAnthropic_ParallelToolCalls(t *testing.T) {
+	parallel := false
+	tools := []types.OpenAITool{{
+		Type: "function",
+		Function: types.OpenAIFunction{
+			Name:       "get_weather",
+			Parameters: map[string]any{"type": "object", "properties": map[string]any{}},
+		},
+	}}
+
+	req := ConvertOpenAIToAnthropic(types.OpenAIRequest{Model: "gpt-4", Tools: tools, ParallelToolCalls: &parallel})
+	assert.Equal(t, &types.ToolChoice{Type: "auto", DisableParallelToolUse: true}, req.ToolChoice)
+	assert.True(t, ParallelToolUseDisabled(req.ToolChoice))
+
+	req = ConvertOpenAIToAnthropic(types.OpenAIRequest{Model: "gpt-4", Tools: tools, ToolChoice: "required", ParallelToolCalls: &parallel})
+	assert.Equal(t, &types.ToolChoice{Type: "any", DisableParallelToolUse: true}, req.ToolChoice)
+
+	req = ConvertOpenAIToAnthropic(types.OpenAIRequest{Model: "gpt-4", Tools: tools})
+	assert.Nil(t, req.ToolChoice, "未指定 parallel_tool_calls 时保持原样")
+	assert.False(t, ParallelToolUseDisabled(req.ToolChoice))
+
+	assert.True(t, ParallelToolUseDisabled(map[string]any{"type": "auto", "disable_parallel_tool_use": true}))
+}
+
+func TestOpenAIFinishReason(t *testing.T) {
+	assert.Equal(t, "stop", OpenAIFinishReason("end_turn"))
+	assert.Equal(t, "stop", OpenAIFinishReason("stop_sequence"))
+	assert.Equal(t, "length", OpenAIFinishReason("max_tokens"))
+	assert.Equal(t, "tool_calls", OpenAIFinishReason("tool_use"))
+}
+
+func TestConvertOpenAIToAnthropic_Stop(t *testing.T) {
+	req := ConvertOpenAIToAnthropic(types.OpenAIRequest{Model: "gpt-4", Stop: "END"})
+	assert.Equal(t, []string{"END"}, req.StopSequences)
+
+	req = ConvertOpenAIToAnthropic(types.OpenAIRequest{Model: "gpt-4", Stop: []any{"a", "", "b"}})
+	assert.Equal(t, []string{"a", "b"}, req.StopSequences)
+
+	req = ConvertOpenAIToAnthropic(types.OpenAIRequest{Model: "gpt-4"})
+	assert.Nil(t, req.StopSequences)
+}
@@ -0,0 +1,326 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"kiro2api/internal/types"
+	"kiro2api/internal/utils"
+)
+
+// OpenAI Responses API 格式转换器
+
+// NewResponseID 生成 Responses 响应 ID
+func NewResponseID() string {
+	return "resp_" + strings.ReplaceAll(utils.GenerateUUID(), "-", "")
+}
+
+// ResponsesItemID 生成输出项 ID（prefix 为 msg / fc，按响应 ID 与输出序号派生）
+func ResponsesItemID(prefix, responseID string, outputIndex int) string {
+	return fmt.Sprintf("%s_%s_%d", prefix, strings.TrimPrefix(responseID, "resp_"), outputIndex)
+}
+
+// ConvertResponsesToAnthropic 将 Responses 请求转换为 Anthropic 请求
+func ConvertResponsesToAnthropic(req types.ResponsesRequest) (types.AnthropicRequest, error) {
+	if req.PreviousResponseID != "" {
+		return types.AnthropicRequest{}, fmt.Errorf("不支持 previous_response_id，请在 input 中携带完整对话历史")
+	}
+
+	maxTokens := 16384
+	if req.MaxOutputTokens != nil {
+		maxTokens = *req.MaxOutputTokens
+	}
+	anthropicReq := types.AnthropicRequest{
+		Model:       req.Model,
+		MaxTokens:   maxTokens,
+		Stream:      req.Stream != nil && *req.Stream,
+		Temperature: req.Temperature,
+	}
+	if req.Instructions != "" {
+		anthropicReq.System = append(anthropicReq.System, types.AnthropicSystemMessage{Type: "text", Text: req.Instructions})
+	}
+
+	items, err := normalizeResponsesInput(req.Input)
+	if err != nil {
+		return types.AnthropicRequest{}, err
+	}
+
+	builder := &anthropicMessageBuilder{}
+	for i, item := range items {
+		switch item.Type {
+		case "", "message":
+			blocks, err := convertResponsesContent(item.Content)
+			if err != nil {
+				return types.AnthropicRequest{}, fmt.Errorf("input[%d]: %v", i, err)
+			}
+			switch item.Role {
+			case "system", "developer":
+				for _, block := range blocks {
+					if text, ok := block["text"].(string); ok && text != "" {
+						anthropicReq.System = append(anthropicReq.System, types.AnthropicSystemMessage{Type: "text", Text: text})
+					}
+				}
+			case "user", "assistant":
+				builder.add(item.Role, blocks...)
+			default:
+				return types.AnthropicRequest{}, fmt.Errorf("input[%d]: 不支持的角色 '%s'", i, item.Role)
+			}
+
+		case "function_call":
+			if item.CallID == "" || item.Name == "" {
+				return types.AnthropicRequest{}, fmt.Errorf("input[%d]: function_call 缺少 call_id 或 name", i)
+			}
+			var input any = map[string]any{}
+			if strings.TrimSpace(item.Arguments) != "" {
+				if err := utils.SafeUnmarshal([]byte(item.Arguments), &input); err != nil {
+					return types.AnthropicRequest{}, fmt.Errorf("input[%d]: function_call 的 arguments 不是合法 JSON", i)
+				}
+			}
+			builder.add("assistant", map[string]any{
+				"type":  "tool_use",
+				"id":    item.CallID,
+				"name":  item.Name,
+				"input": input,
+			})
+
+		case "function_call_output":
+			if item.CallID == "" {
+				return types.AnthropicRequest{}, fmt.Errorf("input[%d]: function_call_output 缺少 call_id", i)
+			}
+			builder.add("user", map[string]any{
+				"type":        "tool_result",
+				"tool_use_id": item.CallID,
+				"content":     responsesOutputText(item.Output),
+			})
+
+		case "reasoning":
+			// 推理摘要仅供客户端展示，不回传上游
+			continue
+
+		default:
+			return types.AnthropicRequest{}, fmt.Errorf("input[%d]: 不支持的输入类型 '%s'", i, item.Type)
+		}
+	}
+	anthropicReq.Messages = builder.messages
+	if len(anthropicReq.Messages) == 0 {
+		return types.AnthropicRequest{}, fmt.Errorf("input 不能为空")
+	}
+
+	// 转换 tools（仅支持 function 工具，内置工具如 web_search 静默忽略）
+	var functionTools []types.OpenAITool
+	for _, tool := range req.Tools {
+		if tool.Type != "function" {
+			continue
+		}
+		functionTools = append(functionTools, types.OpenAITool{
+			Type: "function",
+			Function: types.OpenAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+				Strict:      tool.Strict,
+			},
+		})
+	}
+	if len(functionTools) > 0 {
+		anthropicReq.Tools, _ = validateAndProcessTools(functionTools)
+	}
+
+	if req.ToolChoice != nil {
+		anthropicReq.ToolChoice = convertResponsesToolChoice(req.ToolChoice)
+	}
+
+	return anthropicReq, nil
+}
+
+// normalizeResponsesInput 将 input（字符串或数组）统一为输入项列表
+func normalizeResponsesInput(input any) ([]types.ResponsesInputItem, error) {
+	switch v := input.(type) {
+	case nil:
+		return nil, fmt.Errorf("input 不能为空")
+	case string:
+		return []types.ResponsesInputItem{{Type: "message", Role: "user", Content: v}}, nil
+	case []any:
+		data, err := utils.SafeMarshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var items []types.ResponsesInputItem
+		if err := utils.SafeUnmarshal(data, &items); err != nil {
+			return nil, fmt.Errorf("无效的 input: %v", err)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("input 必须是字符串或数组")
+	}
+}
+
+// convertResponsesContent 将消息内容（字符串或 input_text/output_text/input_image 数组）转换为 Anthropic 内容块
+func convertResponsesContent(content any) ([]map[string]any, error) {
+	switch v := content.(type) {
+	case string:
+		return []map[string]any{{"type": "text", "text": v}}, nil
+	case []any:
+		blocks := make([]map[string]any, 0, len(v))
+		for _, raw := range v {
+			part, ok := raw.(map[string]any)
+			if !ok {
+				continue
+			}
+			switch part["type"] {
+			case "input_text", "output_text", "text":
+				text, _ := part["text"].(string)
+				blocks = append(blocks, map[string]any{"type": "text", "text": text})
+			case "input_image":
+				url, _ := part["image_url"].(string)
+				if url == "" {
+					return nil, fmt.Errorf("input_image 仅支持 image_url（data URL）")
+				}
+				source, err := utils.ConvertImageURLToImageSource(map[string]any{"url": url})
+				if err != nil {
+					return nil, err
+				}
+				blocks = append(blocks, map[string]any{
+					"type": "image",
+					"source": map[string]any{
+						"type":       source.Type,
+						"media_type": source.MediaType,
+						"data":       source.Data,
+					},
+				})
+			case "refusal":
+				refusal, _ := part["refusal"].(string)
+				blocks = append(blocks, map[string]any{"type": "text", "text": refusal})
+			default:
+				return nil, fmt.Errorf("不支持的内容类型 '%v'", part["type"])
+			}
+		}
+		return blocks, nil
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("content 必须是字符串或数组")
+	}
+}
+
+// responsesOutputText 提取 function_call_output 的文本结果
+func responsesOutputText(output any) string {
+	switch v := output.(type) {
+	case string:
+		return v
+	case []any:
+		var parts []string
+		for _, raw := range v {
+			if part, ok := raw.(map[string]any); ok {
+				if text, ok := part["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	case nil:
+		return ""
+	default:
+		data, _ := utils.SafeMarshal(v)
+		return string(data)
+	}
+}
+
+// convertResponsesToolChoice 转换 tool_choice（对象形式为 {"type":"function","name":...}）
+func convertResponsesToolChoice(choice any) any {
+	if m, ok := choice.(map[string]any); ok {
+		if name, ok := m["name"].(string); ok && m["type"] == "function" {
+			return &types.ToolChoice{Type: "tool", Name: name}
+		}
+	}
+	return convertOpenAIToolChoiceToAnthropic(choice)
+}
+
+// anthropicMessageBuilder 合并相邻同角色的内容块（并行工具调用与多个工具结果需在同一条消息中）
+type anthropicMessageBuilder struct {
+	messages []types.AnthropicRequestMessage
+}
+
+func (b *anthropicMessageBuilder) add(role string, blocks ...map[string]any) {
+	if len(blocks) == 0 {
+		return
+	}
+	if n := len(b.messages); n > 0 && b.messages[n-1].Role == role {
+		content := b.messages[n-1].Content.([]any)
+		for _, block := range blocks {
+			content = append(content, block)
+		}
+		b.messages[n-1].Content = content
+		return
+	}
+	content := make([]any, 0, len(blocks))
+	for _, block := range blocks {
+		content = append(content, block)
+	}
+	b.messages = append(b.messages, types.AnthropicRequestMessage{Role: role, Content: content})
+}
+
+// ConvertAnthropicToResponses 将 Anthropic 非流式响应转换为 Responses 响应
+func ConvertAnthropicToResponses(anthropicResp map[string]any, responseID, model string) types.ResponsesResponse {
+	resp := types.ResponsesResponse{
+		ID:        responseID,
+		Object:    "response",
+		CreatedAt: time.Now().Unix(),
+		Status:    "completed",
+		Model:     model,
+		Output:    []types.ResponsesOutputItem{},
+	}
+
+	blocks, _ := anthropicResp["content"].([]map[string]any)
+	var text strings.Builder
+	for _, block := range blocks {
+		switch block["type"] {
+		case "text":
+			if t, ok := block["text"].(string); ok {
+				text.WriteString(t)
+			}
+		}
+	}
+	if text.Len() > 0 {
+		resp.Output = append(resp.Output, types.ResponsesOutputItem{
+			Type:    "message",
+			ID:      ResponsesItemID("msg", responseID, len(resp.Output)),
+			Status:  "completed",
+			Role:    "assistant",
+			Content: []types.ResponsesOutputContent{{Type: "output_text", Text: text.String(), Annotations: []any{}}},
+		})
+	}
+	for _, block := range blocks {
+		if block["type"] != "tool_use" {
+			continue
+		}
+		input := block["input"]
+		if input == nil {
+			input = map[string]any{}
+		}
+		argsJSON, _ := utils.SafeMarshal(input)
+		args := string(argsJSON)
+		callID, _ := block["id"].(string)
+		name, _ := block["name"].(string)
+		resp.Output = append(resp.Output, types.ResponsesOutputItem{
+			Type:      "function_call",
+			ID:        ResponsesItemID("fc", responseID, len(resp.Output)),
+			Status:    "completed",
+			CallID:    callID,
+			Name:      name,
+			Arguments: &args,
+		})
+	}
+
+	if stopReason, _ := anthropicResp["stop_reason"].(string); stopReason == "max_tokens" {
+		resp.Status = "incomplete"
+		resp.IncompleteDetails = &types.ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+	}
+	if usage, ok := anthropicResp["usage"].(map[string]any); ok {
+		input, _ := usage["input_tokens"].(int)
+		output, _ := usage["output_tokens"].(int)
+		resp.Usage = &types.ResponsesUsage{InputTokens: input, OutputTokens: output, TotalTokens: input + output}
+	}
+	return resp
+}
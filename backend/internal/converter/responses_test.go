@@ -0,0 +1,118 @@
+package converter
+
+import (
+	"testing"
+
+	"kiro2api/internal/types"
+	"kiro2api/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseResponsesRequest(t *testing.T, body string) types.ResponsesRequest {
+	var req types.ResponsesRequest
+	assert.NoError(t, utils.SafeUnmarshal([]byte(body), &req))
+	return req
+}
+
+func TestConvertResponsesToAnthropic_StringInput(t *testing.T) {
+	req := parseResponsesRequest(t, `{"model":"claude-sonnet-4-5","input":"你好","instructions":"简洁回答","stream":true}`)
+
+	anthropicReq, err := ConvertResponsesToAnthropic(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 16384, anthropicReq.MaxTokens)
+	assert.True(t, anthropicReq.Stream)
+	assert.Len(t, anthropicReq.System, 1)
+	assert.Equal(t, "简洁回答", anthropicReq.System[0].Text)
+	assert.Len(t, anthropicReq.Messages, 1)
+	assert.Equal(t, "user", anthropicReq.Messages[0].Role)
+}
+
+func TestConvertResponsesToAnthropic_FunctionCallRoundTrip(t *testing.T) {
+	req := parseResponsesRequest(t, `{
+		"model": "claude-sonnet-4-5",
+		"max_output_tokens": 512,
+		"input": [
+			{"role": "developer", "content": "你是助手"},
+			{"type": "message", "role": "user", "content": [
+				{"type": "input_text", "text": "这张图和天气"},
+				{"type": "input_image", "image_url": "data:image/png;base64,iVBORw0KGgo="}
+			]},
+			{"type": "reasoning", "id": "rs_1", "summary": []},
+			{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": "{\"city\":\"北京\"}"},
+			{"type": "function_call", "call_id": "call_2", "name": "get_weather", "arguments": "{\"city\":\"上海\"}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "晴"},
+			{"type": "function_call_output", "call_id": "call_2", "output": "雨"}
+		],
+		"tools": [
+			{"type": "function", "name": "get_weather", "description": "查询天气", "parameters": {"type": "object", "properties": {"city": {"type": "string"}}}},
+			{"type": "web_search"}
+		],
+		"tool_choice": {"type": "function", "name": "get_weather"}
+	}`)
+
+	anthropicReq, err := ConvertResponsesToAnthropic(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 512, anthropicReq.MaxTokens)
+	assert.Equal(t, "你是助手", anthropicReq.System[0].Text)
+
+	assert.Len(t, anthropicReq.Messages, 3, "并行工具调用与结果分别合并为一条消息")
+	user := anthropicReq.Messages[0].Content.([]any)
+	assert.Equal(t, "image", user[1].(map[string]any)["type"])
+
+	assistant := anthropicReq.Messages[1]
+	assert.Equal(t, "assistant", assistant.Role)
+	calls := assistant.Content.([]any)
+	assert.Len(t, calls, 2)
+	assert.Equal(t, "call_1", calls[0].(map[string]any)["id"])
+	assert.Equal(t, map[string]any{"city": "北京"}, calls[0].(map[string]any)["input"])
+
+	results := anthropicReq.Messages[2].Content.([]any)
+	assert.Len(t, results, 2)
+	assert.Equal(t, "call_2", results[1].(map[string]any)["tool_use_id"])
+	assert.Equal(t, "雨", results[1].(map[string]any)["content"])
+
+	assert.Len(t, anthropicReq.Tools, 1, "内置工具被忽略")
+	assert.Equal(t, &types.ToolChoice{Type: "tool", Name: "get_weather"}, anthropicReq.ToolChoice)
+}
+
+func TestConvertResponsesToAnthropic_Errors(t *testing.T) {
+	cases := []string{
+		`{"model":"m","input":"hi","previous_response_id":"resp_1"}`,
+		`{"model":"m"}`,
+		`{"model":"m","input":[{"type":"function_call","call_id":"c","name":"f","arguments":"{bad"}]}`,
+		`{"model":"m","input":[{"type":"computer_call"}]}`,
+		`{"model":"m","input":[{"role":"user","content":[{"type":"input_image","image_url":"https://example.com/a.png"}]}]}`,
+	}
+	for _, body := range cases {
+		_, err := ConvertResponsesToAnthropic(parseResponsesRequest(t, body))
+		assert.Error(t, err, body)
+	}
+}
+
+func TestConvertAnthropicToResponses(t *testing.T) {
+	anthropicResp := map[string]any{
+		"content": []map[string]any{
+			{"type": "text", "text": "查询中"},
+			{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": map[string]any{"city": "北京"}},
+		},
+		"stop_reason": "tool_use",
+		"usage":       map[string]any{"input_tokens": 10, "output_tokens": 5},
+	}
+
+	resp := ConvertAnthropicToResponses(anthropicResp, "resp_abc", "claude-sonnet-4-5")
+	assert.Equal(t, "response", resp.Object)
+	assert.Equal(t, "completed", resp.Status)
+	assert.Len(t, resp.Output, 2)
+	assert.Equal(t, "msg_abc_0", resp.Output[0].ID)
+	assert.Equal(t, "查询中", resp.Output[0].Content[0].Text)
+	assert.Equal(t, "function_call", resp.Output[1].Type)
+	assert.Equal(t, "toolu_1", resp.Output[1].CallID)
+	assert.JSONEq(t, `{"city":"北京"}`, *resp.Output[1].Arguments)
+	assert.Equal(t, 15, resp.Usage.TotalTokens)
+
+	anthropicResp["stop_reason"] = "max_tokens"
+	resp = ConvertAnthropicToResponses(anthropicResp, "resp_abc", "claude-sonnet-4-5")
+	assert.Equal(t, "incomplete", resp.Status)
+	assert.Equal(t, "max_output_tokens", resp.IncompleteDetails.Reason)
+}
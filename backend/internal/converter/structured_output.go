@@ -0,0 +1,91 @@
+package converter
+
+import (
+	"fmt"
+
+	"kiro2api/internal/types"
+)
+
+// StructuredOutputToolName 结构化输出使用的合成工具名称
+// 上游不支持 response_format，改为强制调用 input_schema 为目标 schema 的工具，再将工具输入还原为回答
+const StructuredOutputToolName = "structured_output"
+
+// structuredOutputPrompt 注入 system 的结构化输出指令（上游不保证遵守 tool_choice）
+const structuredOutputPrompt = `You MUST deliver your final answer by calling the "` + StructuredOutputToolName + `" tool exactly once. The tool input is the answer itself and must conform to the tool's input schema. Do not write the answer as plain text.`
+
+// ApplyOutputFormat 按 output_format 注入合成工具并强制 tool_choice（未设置时不处理）
+// 有其他工具时同样强制调用合成工具；指定了 auto 以外的 tool_choice 时与结构化输出冲突，返回错误
+func ApplyOutputFormat(req *types.AnthropicRequest) error {
+	format := req.OutputFormat
+	if format == nil {
+		return nil
+	}
+	if format.Type != "json_schema" {
+		return fmt.Errorf("output_format.type 不支持: %s", format.Type)
+	}
+	if format.Schema == nil {
+		return fmt.Errorf("output_format.schema 不能为空")
+	}
+	if rootType, ok := format.Schema["type"]; ok && rootType != "object" {
+		return fmt.Errorf("output_format.schema 的根类型必须为 object")
+	}
+	for _, tool := range req.Tools {
+		if tool.Name == StructuredOutputToolName {
+			return fmt.Errorf("工具名称 %s 为结构化输出保留", StructuredOutputToolName)
+		}
+	}
+	if choice := toolChoiceType(req.ToolChoice); choice != "" && choice != "auto" {
+		return fmt.Errorf("output_format 不能与 tool_choice=%s 同时使用", choice)
+	}
+
+	schema := make(map[string]any, len(format.Schema)+1)
+	for k, v := range format.Schema {
+		schema[k] = v
+	}
+	schema["type"] = "object"
+
+	req.ToolChoice = &types.ToolChoice{Type: "tool", Name: StructuredOutputToolName}
+	req.Tools = append(req.Tools, types.AnthropicTool{
+		Name:        StructuredOutputToolName,
+		Description: "Return the final answer as structured JSON matching the input schema.",
+		InputSchema: schema,
+	})
+	req.System = append(req.System, types.AnthropicSystemMessage{Type: "text", Text: structuredOutputPrompt})
+	return nil
+}
+
+// toolChoiceType 读取 tool_choice 的类型（未设置时返回空）
+func toolChoiceType(toolChoice any) string {
+	switch choice := toolChoice.(type) {
+	case *types.ToolChoice:
+		if choice != nil {
+			return choice.Type
+		}
+	case map[string]any:
+		t, _ := choice["type"].(string)
+		return t
+	}
+	return ""
+}
+
+// convertOpenAIResponseFormat 将 response_format 转换为 output_format（text 或未设置时返回 nil）
+func convertOpenAIResponseFormat(format *types.OpenAIResponseFormat) *types.OutputFormat {
+	if format == nil {
+		return nil
+	}
+	switch format.Type {
+	case "json_object":
+		return &types.OutputFormat{Type: "json_schema", Schema: map[string]any{"type": "object"}}
+	case "json_schema":
+		output := &types.OutputFormat{Type: "json_schema"}
+		if format.JSONSchema != nil {
+			output.Schema = format.JSONSchema.Schema
+		}
+		return output
+	case "", "text":
+		return nil
+	default:
+		// 交由 ApplyOutputFormat 返回错误
+		return &types.OutputFormat{Type: format.Type}
+	}
+}
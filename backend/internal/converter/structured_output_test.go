@@ -0,0 +1,105 @@
+package converter
+
+import (
+	"testing"
+
+	"kiro2api/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testOutputSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"city": map[string]any{"type": "string"},
+		"temp": map[string]any{"type": "number"},
+	},
+	"required":             []any{"city", "temp"},
+	"additionalProperties": false,
+}
+
+func TestApplyOutputFormat_ForcesSyntheticTool(t *testing.T) {
+	req := types.AnthropicRequest{
+		Model:        "claude-sonnet-4-5",
+		Messages:     []types.AnthropicRequestMessage{{Role: "user", Content: "weather?"}},
+		OutputFormat: &types.OutputFormat{Type: "json_schema", Schema: testOutputSchema},
+	}
+	assert.NoError(t, ApplyOutputFormat(&req))
+
+	assert.Len(t, req.Tools, 1)
+	assert.Equal(t, StructuredOutputToolName, req.Tools[0].Name)
+	assert.Equal(t, testOutputSchema["properties"], req.Tools[0].InputSchema["properties"])
+	assert.Equal(t, &types.ToolChoice{Type: "tool", Name: StructuredOutputToolName}, req.ToolChoice)
+	assert.Len(t, req.System, 1, "注入结构化输出指令")
+}
+
+func TestApplyOutputFormat_ForcesToolWithOtherTools(t *testing.T) {
+	req := types.AnthropicRequest{
+		Tools:        []types.AnthropicTool{{Name: "get_weather", InputSchema: map[string]any{"type": "object"}}},
+		ToolChoice:   map[string]any{"type": "auto"},
+		OutputFormat: &types.OutputFormat{Type: "json_schema", Schema: testOutputSchema},
+	}
+	assert.NoError(t, ApplyOutputFormat(&req))
+	assert.Len(t, req.Tools, 2)
+	assert.Equal(t, &types.ToolChoice{Type: "tool", Name: StructuredOutputToolName}, req.ToolChoice, "有业务工具时同样强制调用合成工具")
+
+	for _, choice := range []any{&types.ToolChoice{Type: "any"}, map[string]any{"type": "tool", "name": "get_weather"}} {
+		err := ApplyOutputFormat(&types.AnthropicRequest{
+			Tools:        []types.AnthropicTool{{Name: "get_weather", InputSchema: map[string]any{"type": "object"}}},
+			ToolChoice:   choice,
+			OutputFormat: &types.OutputFormat{Type: "json_schema", Schema: testOutputSchema},
+		})
+		assert.Error(t, err, "强制 tool_choice 与结构化输出冲突")
+	}
+}
+
+func TestApplyOutputFormat_Invalid(t *testing.T) {
+	assert.NoError(t, ApplyOutputFormat(&types.AnthropicRequest{}))
+	assert.Error(t, ApplyOutputFormat(&types.AnthropicRequest{OutputFormat: &types.OutputFormat{Type: "json_schema"}}))
+	assert.Error(t, ApplyOutputFormat(&types.AnthropicRequest{OutputFormat: &types.OutputFormat{Type: "xml", Schema: testOutputSchema}}))
+	assert.Error(t, ApplyOutputFormat(&types.AnthropicRequest{OutputFormat: &types.OutputFormat{Type: "json_schema", Schema: map[string]any{"type": "array"}}}))
+	assert.Error(t, ApplyOutputFormat(&types.AnthropicRequest{
+		Tools:        []types.AnthropicTool{{Name: StructuredOutputToolName}},
+		OutputFormat: &types.OutputFormat{Type: "json_schema", Schema: testOutputSchema},
+	}), "合成工具名称保留")
+}
+
+func TestConvertOpenAIToAnthropic_ResponseFormat(t *testing.T) {
+	req := ConvertOpenAIToAnthropic(types.OpenAIRequest{
+		Model: "gpt-4",
+		ResponseFormat: &types.OpenAIResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &types.OpenAIJSONSchema{Name: "weather", Schema: testOutputSchema},
+		},
+	})
+	assert.Equal(t, &types.OutputFormat{Type: "json_schema", Schema: testOutputSchema}, req.OutputFormat)
+
+	req = ConvertOpenAIToAnthropic(types.OpenAIRequest{Model: "gpt-4", ResponseFormat: &types.OpenAIResponseFormat{Type: "json_object"}})
+	assert.Equal(t, &types.OutputFormat{Type: "json_schema", Schema: map[string]any{"type": "object"}}, req.OutputFormat)
+
+	req = ConvertOpenAIToAnthropic(types.OpenAIRequest{Model: "gpt-4", ResponseFormat: &types.OpenAIResponseFormat{Type: "text"}})
+	assert.Nil(t, req.OutputFormat)
+}
+
+func TestValidateJSONSchema(t *testing.T) {
+	assert.NoError(t, ValidateJSONSchema(map[string]any{"city": "Paris", "temp": 21.5}, testOutputSchema))
+	assert.Error(t, ValidateJSONSchema(map[string]any{"city": "Paris"}, testOutputSchema), "缺少必填字段")
+	assert.Error(t, ValidateJSONSchema(map[string]any{"city": "Paris", "temp": "hot"}, testOutputSchema), "类型不符")
+	assert.Error(t, ValidateJSONSchema(map[string]any{"city": "Paris", "temp": 1.0, "x": 1.0}, testOutputSchema), "不允许额外字段")
+
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"tags":  map[string]any{"type": "array", "items": map[string]any{"$ref": "#/$defs/tag"}, "maxItems": 2.0},
+			"count": map[string]any{"type": "integer", "minimum": 0.0},
+			"mode":  map[string]any{"anyOf": []any{map[string]any{"enum": []any{"a", "b"}}, map[string]any{"type": "null"}}},
+		},
+		"$defs": map[string]any{"tag": map[string]any{"type": "string", "minLength": 1.0}},
+	}
+	assert.NoError(t, ValidateJSONSchema(map[string]any{"tags": []any{"x"}, "count": 3.0, "mode": nil}, schema))
+	assert.Error(t, ValidateJSONSchema(map[string]any{"tags": []any{""}}, schema), "$ref minLength")
+	assert.Error(t, ValidateJSONSchema(map[string]any{"tags": []any{"a", "b", "c"}}, schema), "maxItems")
+	assert.Error(t, ValidateJSONSchema(map[string]any{"count": 1.5}, schema), "integer")
+	assert.Error(t, ValidateJSONSchema(map[string]any{"count": -1.0}, schema), "minimum")
+	assert.Error(t, ValidateJSONSchema(map[string]any{"mode": "c"}, schema), "anyOf")
+}
@@ -224,6 +224,32 @@ func convertOpenAIToolChoiceToAnthropic(openaiToolChoice any) any {
 	}
 }
 
+// applyParallelToolCalls parallel_tool_calls=false 时在 tool_choice 上标记 disable_parallel_tool_use
+func applyParallelToolCalls(req *types.AnthropicRequest, parallel *bool) {
+	if parallel == nil || *parallel || len(req.Tools) == 0 {
+		return
+	}
+	switch choice := req.ToolChoice.(type) {
+	case nil:
+		req.ToolChoice = &types.ToolChoice{Type: "auto", DisableParallelToolUse: true}
+	case *types.ToolChoice:
+		choice.DisableParallelToolUse = true
+	}
+}
+
+// ParallelToolUseDisabled tool_choice 是否要求最多调用一个工具
+// 上游不支持该选项，由下发响应时只保留第一个工具调用实现
+func ParallelToolUseDisabled(toolChoice any) bool {
+	switch choice := toolChoice.(type) {
+	case *types.ToolChoice:
+		return choice != nil && choice.DisableParallelToolUse
+	case map[string]any:
+		disabled, _ := choice["disable_parallel_tool_use"].(bool)
+		return disabled
+	}
+	return false
+}
+
 // convertOpenAIContentToAnthropic 将OpenAI消息内容转换为Anthropic格式
 func convertOpenAIContentToAnthropic(content any) (any, error) {
 	switch v := content.(type) {
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"kiro2api/internal/auth"
+	"kiro2api/internal/batch"
+	"kiro2api/internal/server/handler"
+	"kiro2api/internal/service"
+	"kiro2api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// batchJobKey 内部请求上下文中的批处理任务
+type batchJobKey struct{}
+
+// batchAdmittedKey 内部请求上下文中的放行标记（*bool，通过限流与配额中间件后置为 true）
+type batchAdmittedKey struct{}
+
+// newBatchExecutor 批处理请求执行器
+// 每个请求以内部请求经过与 /v1/messages 相同的中间件与 handler，
+// 分组选择、路由规则、限流、API Key 配额、统计与 token 池并发限制保持一致
+func newBatchExecutor(authService *auth.AuthService, keyMgr *auth.APIKeyManager, rateLimiter *service.RateLimiter) batch.Executor {
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(batchJobMiddleware(keyMgr))
+	r.Use(KeyGroupMiddleware())
+	if rateLimiter != nil {
+		r.Use(rateLimiter.Middleware())
+	}
+	r.Use(StatsMiddleware())
+	r.Use(APIKeyQuotaMiddleware(keyMgr.Quota()))
+	r.Use(batchAdmittedMiddleware())
+	r.POST("/v1/messages", func(c *gin.Context) { handler.HandleMessages(c, authService, service.GetGroupFromContext(c)) })
+	r.POST("/:group/v1/messages", func(c *gin.Context) {
+		group := c.Param("group")
+		if !CheckGroupPermission(c, group) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该分组"})
+			return
+		}
+		handler.HandleMessages(c, authService, group)
+	})
+
+	return func(ctx context.Context, job batch.Job) batch.Response {
+		body, err := batchRequestBody(job.Params)
+		if err != nil {
+			return batch.Response{StatusCode: http.StatusBadRequest, Body: []byte(`{"error":{"type":"invalid_request_error","message":"params 不是合法的 JSON 对象"}}`)}
+		}
+
+		// 显式分组走 /:group 路由（与客户端直接请求一致，跳过路由规则）
+		path := "/v1/messages"
+		if job.Group != "" {
+			path = "/" + url.PathEscape(job.Group) + "/v1/messages"
+		}
+		admitted := new(bool)
+		ctx = context.WithValue(context.WithValue(ctx, batchJobKey{}, job), batchAdmittedKey{}, admitted)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(body))
+		if err != nil {
+			return batch.Response{StatusCode: http.StatusInternalServerError, Body: []byte(`{"error":{"type":"api_error","message":"创建内部请求失败"}}`)}
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		w := newBufferedResponseWriter()
+		r.ServeHTTP(w, req)
+		return batch.Response{
+			StatusCode: w.status,
+			Body:       w.body.Bytes(),
+			RetryAfter: parseRetryAfter(w.Header().Get("Retry-After")),
+			Throttled:  w.status == http.StatusTooManyRequests && !*admitted,
+		}
+	}
+}
+
+// batchJobMiddleware 以创建批处理的 API Key 身份执行内部请求（Key 已删除或停用时拒绝）
+func batchJobMiddleware(keyMgr *auth.APIKeyManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, _ := c.Request.Context().Value(batchJobKey{}).(batch.Job)
+		c.Set("request_id", "req_"+utils.GenerateUUID())
+
+		keyConfig := keyMgr.GetByID(job.APIKeyID)
+		if keyConfig == nil {
+			service.RespondError(c, http.StatusUnauthorized, "%s", "创建批处理的 API Key 已删除")
+			c.Abort()
+			return
+		}
+		if err := keyConfig.Usable(time.Now()); err != nil {
+			service.RespondError(c, http.StatusUnauthorized, "%v", err)
+			c.Abort()
+			return
+		}
+		c.Set("api_key_config", keyConfig)
+		c.Next()
+	}
+}
+
+// batchAdmittedMiddleware 标记内部请求已通过限流与 API Key 配额
+// 未放行的 429 来自代理自身，批处理按 Key 退避且不计入尝试次数
+func batchAdmittedMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if admitted, ok := c.Request.Context().Value(batchAdmittedKey{}).(*bool); ok {
+			*admitted = true
+		}
+		c.Next()
+	}
+}
+
+// batchRequestBody 批处理请求不支持流式，强制 stream=false
+func batchRequestBody(params []byte) ([]byte, error) {
+	var body map[string]any
+	if err := utils.SafeUnmarshal(params, &body); err != nil {
+		return nil, err
+	}
+	delete(body, "stream")
+	return utils.SafeMarshal(body)
+}
+
+// parseRetryAfter 解析 Retry-After 秒数
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// bufferedResponseWriter 缓存内部请求的完整响应
+type bufferedResponseWriter struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func newBufferedResponseWriter() *bufferedResponseWriter {
+	return &bufferedResponseWriter{header: make(http.Header), status: http.StatusOK}
+}
+
+func (w *bufferedResponseWriter) Header() http.Header { return w.header }
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+
+func (w *bufferedResponseWriter) WriteHeader(status int) { w.status = status }
+
+func (w *bufferedResponseWriter) Flush() {}
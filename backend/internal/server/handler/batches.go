@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"kiro2api/internal/auth"
+	"kiro2api/internal/batch"
+	"kiro2api/internal/logger"
+	"kiro2api/internal/service"
+	"kiro2api/internal/types"
+	"kiro2api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateMessageBatch POST /v1/messages/batches - 创建批处理
+// group 为路径分组；未指定时使用 X-Kiro-Group，两者都为空则执行时按 API Key 默认分组与路由规则选择
+func CreateMessageBatch(c *gin.Context, group string) {
+	mgr := GetBatchManager()
+	if mgr == nil {
+		service.RespondError(c, http.StatusServiceUnavailable, "%s", "批处理服务未启用")
+		return
+	}
+
+	var req types.MessageBatchCreateRequest
+	body, err := c.GetRawData()
+	if err == nil {
+		err = utils.SafeUnmarshal(body, &req)
+	}
+	if err != nil {
+		service.RespondError(c, http.StatusBadRequest, "解析请求体失败: %v", err)
+		return
+	}
+	if err := batch.ValidateRequests(req.Requests); err != nil {
+		service.RespondError(c, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	if group == "" {
+		group = strings.TrimSpace(c.GetHeader(service.HeaderGroupOverride))
+	}
+	keyID := ""
+	if keyConfig := apiKeyFromContext(c); keyConfig != nil {
+		keyID = keyConfig.ID
+	}
+
+	b, err := mgr.Create(keyID, group, req.Requests)
+	if err != nil {
+		logger.Error("创建批处理失败", logger.Err(err))
+		service.RespondError(c, http.StatusInternalServerError, "创建批处理失败: %v", err)
+		return
+	}
+	c.JSON(http.StatusOK, b.View(""))
+}
+
+// GetMessageBatch GET /v1/messages/batches/:id - 查询批处理
+func GetMessageBatch(c *gin.Context) {
+	b, ok := loadMessageBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, b.View(batchResultsURL(c, b.ID)))
+}
+
+// CancelMessageBatch POST /v1/messages/batches/:id/cancel - 取消批处理
+func CancelMessageBatch(c *gin.Context) {
+	b, ok := loadMessageBatch(c)
+	if !ok {
+		return
+	}
+	b, err := GetBatchManager().Cancel(b.ID)
+	if err != nil {
+		logger.Error("取消批处理失败", logger.String("batch_id", c.Param("id")), logger.Err(err))
+		service.RespondError(c, http.StatusInternalServerError, "取消批处理失败: %v", err)
+		return
+	}
+	c.JSON(http.StatusOK, b.View(batchResultsURL(c, b.ID)))
+}
+
+// GetMessageBatchResults GET /v1/messages/batches/:id/results - 下载结果（JSONL，每行一个请求）
+func GetMessageBatchResults(c *gin.Context) {
+	b, ok := loadMessageBatch(c)
+	if !ok {
+		return
+	}
+	if b.Status != batch.StatusEnded {
+		service.RespondError(c, http.StatusBadRequest, "批处理 %s 尚未结束，结果不可用", b.ID)
+		return
+	}
+
+	c.Header("Content-Type", "application/x-jsonl")
+	c.Status(http.StatusOK)
+	err := GetBatchManager().Results(b.ID, func(line types.MessageBatchResult) error {
+		data, err := utils.SafeMarshal(line)
+		if err != nil {
+			return err
+		}
+		if _, err := c.Writer.Write(append(data, '\n')); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		// 响应头已发送，只能记录日志
+		logger.Error("输出批处理结果失败", logger.String("batch_id", b.ID), logger.Err(err))
+	}
+}
+
+// loadMessageBatch 读取 :id 对应的批处理（仅创建者与管理员可见，其他情况返回 404）
+func loadMessageBatch(c *gin.Context) (*batch.Batch, bool) {
+	mgr := GetBatchManager()
+	if mgr == nil {
+		service.RespondError(c, http.StatusServiceUnavailable, "%s", "批处理服务未启用")
+		return nil, false
+	}
+
+	id := c.Param("id")
+	b, err := mgr.Get(id)
+	if err != nil && !errors.Is(err, batch.ErrBatchNotFound) {
+		logger.Error("读取批处理失败", logger.String("batch_id", id), logger.Err(err))
+		service.RespondError(c, http.StatusInternalServerError, "读取批处理失败: %v", err)
+		return nil, false
+	}
+	if err != nil || !canAccessBatch(c, b) {
+		service.RespondError(c, http.StatusNotFound, "批处理不存在: %s", id)
+		return nil, false
+	}
+	return b, true
+}
+
+// canAccessBatch 当前 API Key 是否可访问批处理
+func canAccessBatch(c *gin.Context, b *batch.Batch) bool {
+	keyConfig := apiKeyFromContext(c)
+	if keyConfig == nil {
+		return b.APIKeyID == ""
+	}
+	return keyConfig.Role == auth.RoleAdmin || keyConfig.ID == b.APIKeyID
+}
+
+// batchResultsURL 结果下载地址（保留请求的分组前缀，便于 SDK 直接访问）
+func batchResultsURL(c *gin.Context, id string) string {
+	scheme := "http"
+	if c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	prefix := ""
+	if group := c.Param("group"); group != "" {
+		prefix = "/" + group
+	}
+	return fmt.Sprintf("%s://%s%s/v1/messages/batches/%s/results", scheme, c.Request.Host, prefix, id)
+}
@@ -33,22 +33,13 @@ func NewRequestContext(c *gin.Context, authService *auth.AuthService, requestTyp
 	}
 }
 
-// GetTokenAndBody 通用的token获取和请求体读取
-func (rc *RequestContext) GetTokenAndBody() (types.TokenInfo, []byte, error) {
-	// 通过统一管线获取 token
-	tokenInfo, err := rc.Lifecycle.GetToken()
-	if err != nil {
-		logger.Error("获取token失败", logger.Err(err))
-		service.RespondError(rc.GinContext, http.StatusInternalServerError, "获取token失败: %v", err)
-		return types.TokenInfo{}, nil, err
-	}
-
-	// 读取请求体
+// ReadBody 读取请求体（先于获取 token，便于在占用 token 前完成请求校验）
+func (rc *RequestContext) ReadBody() ([]byte, error) {
 	body, err := rc.GinContext.GetRawData()
 	if err != nil {
 		logger.Error("读取请求体失败", logger.Err(err))
 		service.RespondError(rc.GinContext, http.StatusBadRequest, "读取请求体失败: %v", err)
-		return types.TokenInfo{}, nil, err
+		return nil, err
 	}
 
 	// 记录请求日志
@@ -60,36 +51,34 @@ func (rc *RequestContext) GetTokenAndBody() (types.TokenInfo, []byte, error) {
 		logger.String("user_agent", rc.GinContext.GetHeader("User-Agent")),
 		logger.String("group", rc.Group))
 
-	return tokenInfo, body, nil
+	return body, nil
 }
 
-// GetTokenWithUsageAndBody 获取token（包含使用信息）和请求体
-func (rc *RequestContext) GetTokenWithUsageAndBody() (*types.TokenWithUsage, []byte, error) {
-	// 通过统一管线获取 token
-	tokenWithUsage, err := rc.Lifecycle.GetTokenWithUsage()
+// AcquireToken 通过统一管线获取 token
+func (rc *RequestContext) AcquireToken() (types.TokenInfo, error) {
+	tokenInfo, err := rc.Lifecycle.GetToken()
 	if err != nil {
 		logger.Error("获取token失败", logger.Err(err))
 		service.RespondError(rc.GinContext, http.StatusInternalServerError, "获取token失败: %v", err)
-		return nil, nil, err
+		return types.TokenInfo{}, err
 	}
+	rc.Group = rc.Lifecycle.Group() // 可能已降级到备用分组
+	return tokenInfo, nil
+}
 
-	// 读取请求体
-	body, err := rc.GinContext.GetRawData()
+// AcquireTokenWithUsage 获取token（包含使用信息）
+func (rc *RequestContext) AcquireTokenWithUsage() (*types.TokenWithUsage, error) {
+	tokenWithUsage, err := rc.Lifecycle.GetTokenWithUsage()
 	if err != nil {
-		logger.Error("读取请求体失败", logger.Err(err))
-		service.RespondError(rc.GinContext, http.StatusBadRequest, "读取请求体失败: %v", err)
-		return nil, nil, err
+		logger.Error("获取token失败", logger.Err(err))
+		service.RespondError(rc.GinContext, http.StatusInternalServerError, "获取token失败: %v", err)
+		return nil, err
 	}
+	rc.Group = rc.Lifecycle.Group() // 可能已降级到备用分组
 
-	// 记录请求日志
-	logger.Debug(fmt.Sprintf("收到%s请求", rc.RequestType),
-		logger.String("direction", "client_request"),
-		logger.String("body", string(body)),
-		logger.Int("body_size", len(body)),
-		logger.String("remote_addr", rc.GinContext.ClientIP()),
-		logger.String("user_agent", rc.GinContext.GetHeader("User-Agent")),
+	logger.Debug("获取token成功",
 		logger.Float64("available_count", tokenWithUsage.AvailableCount),
 		logger.String("group", rc.Group))
 
-	return tokenWithUsage, body, nil
+	return tokenWithUsage, nil
 }
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"kiro2api/internal/auth"
+	"kiro2api/internal/batch"
 	"kiro2api/internal/config"
 	"kiro2api/internal/service"
 	"kiro2api/internal/stats"
@@ -13,6 +14,8 @@ type Context struct {
 	SettingsMgr    *config.SettingsManager
 	GroupMgr       *auth.GroupManager
 	StatsCollector *stats.Collector
+	RoutingTable   *auth.RoutingTable
+	Batches        *batch.Manager
 }
 
 var globalCtx *Context
@@ -53,3 +56,19 @@ func GetStatsCollector() *stats.Collector {
 	}
 	return globalCtx.StatsCollector
 }
+
+// GetRoutingTable 获取路由规则表
+func GetRoutingTable() *auth.RoutingTable {
+	if globalCtx == nil {
+		return nil
+	}
+	return globalCtx.RoutingTable
+}
+
+// GetBatchManager 获取批处理管理器
+func GetBatchManager() *batch.Manager {
+	if globalCtx == nil {
+		return nil
+	}
+	return globalCtx.Batches
+}
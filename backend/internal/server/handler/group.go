@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"kiro2api/internal/auth"
+	"kiro2api/internal/config"
 
 	"github.com/gin-gonic/gin"
 )
@@ -25,11 +26,13 @@ func ListGroups(c *gin.Context, authService *auth.AuthService) {
 	for _, g := range groups {
 		stats := groupStats[g.Name]
 		result = append(result, gin.H{
-			"name":         g.Name,
-			"display_name": g.DisplayName,
-			"settings":     g.Settings,
-			"token_count":  stats.Total,
-			"active_count": stats.Active,
+			"name":               g.Name,
+			"display_name":       g.DisplayName,
+			"settings":           g.Settings,
+			"effective_settings": gm.EffectiveSettings(g.Name),
+			"fallback_groups":    g.FallbackGroups,
+			"token_count":        stats.Total,
+			"active_count":       stats.Active,
 		})
 	}
 
@@ -61,19 +64,31 @@ func UpdateGroup(c *gin.Context) {
 	name := c.Param("name")
 
 	var req struct {
-		DisplayName *string             `json:"display_name"`
-		Settings    *auth.GroupSettings `json:"settings"`
+		DisplayName    *string             `json:"display_name"`
+		Settings       *auth.GroupSettings `json:"settings"`
+		FallbackGroups *[]string           `json:"fallback_groups"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求体: " + err.Error()})
 		return
 	}
 
+	if req.Settings != nil && !auth.IsValidStrategy(req.Settings.Strategy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未知的选择策略: " + req.Settings.Strategy})
+		return
+	}
+
 	gm := GetGroupManager()
 	if err := gm.Update(name, req.DisplayName, req.Settings); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.FallbackGroups != nil {
+		if err := gm.SetFallbackGroups(name, *req.FallbackGroups); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "分组已更新"})
 }
@@ -98,11 +113,16 @@ func RenameGroup(c *gin.Context, authService *auth.AuthService) {
 	}
 
 	// 更新 GroupManager 内存状态
-	gm := GetGroupManager()
-	if err := gm.Rename(oldName, req.NewName); err != nil {
-		// GroupManager 更新失败不阻塞，记录日志即可
-		// 因为数据库已经更新成功，下次重启会从数据库加载正确状态
+	if gm := GetGroupManager(); gm != nil {
+		if err := gm.Rename(oldName, req.NewName); err != nil {
+			// GroupManager 更新失败不阻塞，记录日志即可
+			// 因为数据库已经更新成功，下次重启会从数据库加载正确状态
+		}
+	}
+	if table := GetRoutingTable(); table != nil {
+		table.ReplaceGroupRef(oldName, req.NewName)
 	}
+	config.GetModelRegistry().ReplaceGroupRef(oldName, req.NewName)
 
 	// 刷新 poolManager 缓存
 	authService.GetPoolManager().UpdateConfigs(authService.GetConfigs())
@@ -127,10 +147,15 @@ func DeleteGroup(c *gin.Context, authService *auth.AuthService) {
 	}
 
 	// 更新 GroupManager 内存状态
-	gm := GetGroupManager()
-	if err := gm.Delete(name); err != nil {
-		// GroupManager 更新失败不阻塞
+	if gm := GetGroupManager(); gm != nil {
+		if err := gm.Delete(name); err != nil {
+			// GroupManager 更新失败不阻塞
+		}
+	}
+	if table := GetRoutingTable(); table != nil {
+		table.ReplaceGroupRef(name, "")
 	}
+	config.GetModelRegistry().ReplaceGroupRef(name, "")
 
 	// 刷新 poolManager 缓存
 	authService.GetPoolManager().UpdateConfigs(authService.GetConfigs())
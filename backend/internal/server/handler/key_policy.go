@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"net/http"
+
+	"kiro2api/internal/auth"
+	"kiro2api/internal/config"
+	"kiro2api/internal/logger"
+	"kiro2api/internal/service"
+	"kiro2api/internal/types"
+	"kiro2api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyFromContext 从 context 获取当前请求的 API Key 配置
+func apiKeyFromContext(c *gin.Context) *auth.APIKeyConfig {
+	v, exists := c.Get("api_key_config")
+	if !exists {
+		return nil
+	}
+	keyConfig, _ := v.(*auth.APIKeyConfig)
+	return keyConfig
+}
+
+// enforceKeyPolicy 在获取 token 前检查 API Key 的模型白名单与请求上限
+// 不通过时直接写入错误响应并返回 false
+func enforceKeyPolicy(c *gin.Context, req types.AnthropicRequest) bool {
+	keyConfig := apiKeyFromContext(c)
+	if keyConfig == nil {
+		return true
+	}
+
+	reject := func(status int, reason string, format string, args ...any) bool {
+		logger.Warn("请求超出API Key限制",
+			service.AddReqFields(c,
+				logger.String("key_id", keyConfig.ID),
+				logger.String("model", req.Model),
+				logger.String("reason", reason))...)
+		service.RespondError(c, status, format, args...)
+		return false
+	}
+
+	if !keyConfig.AllowsModel(req.Model) {
+		return reject(http.StatusForbidden, "model", "该 API Key 无权使用模型 %s", req.Model)
+	}
+	if keyConfig.MaxTokens > 0 && req.MaxTokens > keyConfig.MaxTokens {
+		return reject(http.StatusBadRequest, "max_tokens",
+			"max_tokens (%d) 超出该 API Key 的上限 %d", req.MaxTokens, keyConfig.MaxTokens)
+	}
+	if keyConfig.MaxTools > 0 && len(req.Tools) > keyConfig.MaxTools {
+		return reject(http.StatusBadRequest, "tools",
+			"工具数量 (%d) 超出该 API Key 的上限 %d", len(req.Tools), keyConfig.MaxTools)
+	}
+	if keyConfig.MaxInputTokens > 0 {
+		estimated := utils.NewTokenEstimator().EstimateTokens(&types.CountTokensRequest{
+			Model:    req.Model,
+			Messages: req.Messages,
+			System:   req.System,
+			Tools:    req.Tools,
+		})
+		if estimated > keyConfig.MaxInputTokens {
+			return reject(http.StatusBadRequest, "input_tokens",
+				"估算输入 tokens (%d) 超出该 API Key 的上限 %d", estimated, keyConfig.MaxInputTokens)
+		}
+	}
+	return true
+}
+
+// filterModelsForKey 按 API Key 的模型白名单过滤模型列表
+func filterModelsForKey(c *gin.Context, models []config.ModelInfo) []config.ModelInfo {
+	keyConfig := apiKeyFromContext(c)
+	if keyConfig == nil || len(keyConfig.AllowedModels) == 0 {
+		return models
+	}
+	filtered := make([]config.ModelInfo, 0, len(models))
+	for _, m := range models {
+		if keyConfig.AllowsModel(m.ID) {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered
+}
@@ -1,7 +1,12 @@
 package handler
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"path"
+	"sort"
+	"time"
 
 	"kiro2api/internal/auth"
 	"kiro2api/internal/utils"
@@ -9,57 +14,225 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// defaultKeyRotationGrace 轮换后旧 key 默认继续可用的时长
+const defaultKeyRotationGrace = 24 * time.Hour
+
+// apiKeyView 管理接口返回的 key 信息（不含明文与哈希）
+func apiKeyView(k *auth.APIKeyConfig) gin.H {
+	return gin.H{
+		"id":               k.ID,
+		"prefix":           k.Prefix,
+		"masked_key":       k.Prefix + "****",
+		"name":             k.Name,
+		"allowed_groups":   k.AllowedGroups,
+		"default_group":    k.DefaultGroup,
+		"role":             k.Role,
+		"expires_at":       k.ExpiresAt,
+		"last_used_at":     k.LastUsedAt,
+		"disabled":         k.Disabled,
+		"replaced_by":      k.ReplacedBy,
+		"limits":           k.Limits,
+		"allowed_models":   k.AllowedModels,
+		"max_tokens":       k.MaxTokens,
+		"max_input_tokens": k.MaxInputTokens,
+		"max_tools":        k.MaxTools,
+		"created_at":       k.CreatedAt,
+	}
+}
+
+// validDefaultGroup 默认分组为空或在允许分组内
+func validDefaultGroup(allowedGroups []string, defaultGroup string) bool {
+	return defaultGroup == "" || (&auth.APIKeyConfig{AllowedGroups: allowedGroups}).HasGroupPermission(defaultGroup)
+}
+
+// requestCaps 模型白名单与请求上限（0 = 不限制）
+type requestCaps struct {
+	AllowedModels  []string `json:"allowed_models"`
+	MaxTokens      int      `json:"max_tokens"`
+	MaxInputTokens int      `json:"max_input_tokens"`
+	MaxTools       int      `json:"max_tools"`
+}
+
+// valid 上限不能为负数，模型通配符必须合法
+func (r requestCaps) valid() bool {
+	if r.MaxTokens < 0 || r.MaxInputTokens < 0 || r.MaxTools < 0 {
+		return false
+	}
+	for _, pattern := range r.AllowedModels {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// validLimits 配额不能为负数（0 = 不限制）
+func validLimits(l auth.APIKeyLimits) bool {
+	return l.RPM >= 0 && l.MaxConcurrent >= 0 && l.DailyTokens >= 0 && l.MonthlyTokens >= 0 && l.DailyCredit >= 0
+}
+
+// parseExpiresAt 解析过期时间（RFC3339，空串 = 永不过期）
+func parseExpiresAt(value string) (*time.Time, bool) {
+	if value == "" {
+		return nil, true
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, false
+	}
+	return &t, true
+}
+
 // GetAPIKeys GET /api/keys
 func GetAPIKeys(c *gin.Context, keyManager *auth.APIKeyManager) {
 	keys := keyManager.GetAll()
-	// 隐藏实际 key 值，只返回前4位
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+
 	result := make([]gin.H, len(keys))
-	for i, k := range keys {
-		maskedKey := k.Key
-		if len(maskedKey) > 4 {
-			maskedKey = maskedKey[:4] + "****"
-		}
-		result[i] = gin.H{
-			"key":            k.Key, // 完整 key 用于标识
-			"masked_key":     maskedKey,
-			"name":           k.Name,
-			"allowed_groups": k.AllowedGroups,
-		}
+	for i := range keys {
+		result[i] = apiKeyView(&keys[i])
+		result[i]["usage"] = keyManager.Quota().Usage(keys[i].ID)
 	}
 	c.JSON(http.StatusOK, result)
 }
 
-// UpdateAPIKey PATCH /api/keys/:key
+// UpdateAPIKey PATCH /api/keys/:id
 func UpdateAPIKey(c *gin.Context, keyManager *auth.APIKeyManager) {
-	key := c.Param("key")
+	id := c.Param("id")
 	var req struct {
-		AllowedGroups []string `json:"allowed_groups"`
+		// 以下字段均可选，不传则不修改
+		AllowedGroups *[]string          `json:"allowed_groups"`
+		DefaultGroup  *string            `json:"default_group"` // 空串 = 全局默认分组
+		Role          *string            `json:"role"`
+		Disabled      *bool              `json:"disabled"`
+		ExpiresAt     *string            `json:"expires_at"` // RFC3339，空串 = 永不过期
+		Limits        *auth.APIKeyLimits `json:"limits"`
+		RequestCaps   *requestCaps       `json:"request_caps"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
 		return
 	}
 
-	if !keyManager.UpdateAllowedGroups(key, req.AllowedGroups) {
+	current := keyManager.GetByID(id)
+	if current == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "API Key 不存在"})
 		return
 	}
 
+	// 默认分组必须在（更新后的）允许分组内
+	allowedGroups, defaultGroup := current.AllowedGroups, current.DefaultGroup
+	if req.AllowedGroups != nil {
+		allowedGroups = *req.AllowedGroups
+	}
+	if req.DefaultGroup != nil {
+		defaultGroup = *req.DefaultGroup
+	}
+	if !validDefaultGroup(allowedGroups, defaultGroup) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "默认分组必须在允许的分组内"})
+		return
+	}
+
+	var role auth.APIKeyRole
+	if req.Role != nil {
+		var ok bool
+		if role, ok = auth.ParseAPIKeyRole(*req.Role); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色: " + *req.Role})
+			return
+		}
+	}
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		var ok bool
+		if expiresAt, ok = parseExpiresAt(*req.ExpiresAt); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的过期时间，需为 RFC3339 格式"})
+			return
+		}
+	}
+
+	if req.Limits != nil && !validLimits(*req.Limits) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "配额不能为负数"})
+		return
+	}
+	if req.RequestCaps != nil && !req.RequestCaps.valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求上限或模型通配符"})
+		return
+	}
+
+	// 不允许降级或禁用最后一个 admin
+	demote := req.Role != nil && role != auth.RoleAdmin
+	disable := req.Disabled != nil && *req.Disabled
+	if (demote || disable) && keyManager.IsLastAdmin(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "至少需要保留一个 admin API Key"})
+		return
+	}
+
+	if req.Role != nil {
+		keyManager.UpdateRole(id, role)
+	}
+	if req.AllowedGroups != nil {
+		keyManager.UpdateAllowedGroups(id, *req.AllowedGroups)
+	}
+	if req.DefaultGroup != nil {
+		keyManager.SetDefaultGroup(id, *req.DefaultGroup)
+	}
+	if req.Disabled != nil {
+		keyManager.SetDisabled(id, *req.Disabled)
+	}
+	if req.ExpiresAt != nil {
+		keyManager.SetExpiresAt(id, expiresAt)
+	}
+	if req.Limits != nil {
+		keyManager.SetLimits(id, *req.Limits)
+	}
+	if caps := req.RequestCaps; caps != nil {
+		keyManager.SetRequestCaps(id, caps.AllowedModels, caps.MaxTokens, caps.MaxInputTokens, caps.MaxTools)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
 }
 
 // CreateAPIKey POST /api/keys
+// 明文 key 只在创建响应中返回一次
 func CreateAPIKey(c *gin.Context, keyManager *auth.APIKeyManager) {
 	var req struct {
-		Key           string   `json:"key"`
-		Name          string   `json:"name"`
-		AllowedGroups []string `json:"allowed_groups"`
+		Key           string            `json:"key"`
+		Name          string            `json:"name"`
+		AllowedGroups []string          `json:"allowed_groups"`
+		DefaultGroup  string            `json:"default_group"`
+		Role          string            `json:"role"`       // 默认 client
+		ExpiresAt     string            `json:"expires_at"` // RFC3339，可选
+		Limits        auth.APIKeyLimits `json:"limits"`
+		RequestCaps   requestCaps       `json:"request_caps"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
 		return
 	}
 
+	role, ok := auth.ParseAPIKeyRole(req.Role)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色: " + req.Role})
+		return
+	}
+	expiresAt, ok := parseExpiresAt(req.ExpiresAt)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的过期时间，需为 RFC3339 格式"})
+		return
+	}
+	if !validLimits(req.Limits) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "配额不能为负数"})
+		return
+	}
+	if !validDefaultGroup(req.AllowedGroups, req.DefaultGroup) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "默认分组必须在允许的分组内"})
+		return
+	}
+	if !req.RequestCaps.valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求上限或模型通配符"})
+		return
+	}
+
 	key := req.Key
 	if key == "" {
 		key = "k2a_" + utils.GenerateUUID()
@@ -70,29 +243,64 @@ func CreateAPIKey(c *gin.Context, keyManager *auth.APIKeyManager) {
 		return
 	}
 
-	keyManager.AddKey(auth.APIKeyConfig{
+	cfg := keyManager.AddKey(auth.APIKeyConfig{
 		Key:           key,
 		Name:          req.Name,
 		AllowedGroups: req.AllowedGroups,
+		DefaultGroup:  req.DefaultGroup,
+		Role:          role,
+		ExpiresAt:     expiresAt,
+		Limits:        req.Limits,
+
+		AllowedModels:  req.RequestCaps.AllowedModels,
+		MaxTokens:      req.RequestCaps.MaxTokens,
+		MaxInputTokens: req.RequestCaps.MaxInputTokens,
+		MaxTools:       req.RequestCaps.MaxTools,
 	})
 
-	maskedKey := key
-	if len(maskedKey) > 4 {
-		maskedKey = maskedKey[:4] + "****"
+	result := apiKeyView(cfg)
+	result["key"] = key
+	c.JSON(http.StatusCreated, result)
+}
+
+// RotateAPIKey POST /api/keys/:id/rotate
+// 签发继承原配置的新 key，旧 key 在宽限期内继续可用
+func RotateAPIKey(c *gin.Context, keyManager *auth.APIKeyManager) {
+	id := c.Param("id")
+	var req struct {
+		GraceSec *int `json:"grace_sec"` // 旧 key 宽限期（秒），默认 24 小时，0 = 立即失效
 	}
-	c.JSON(http.StatusCreated, gin.H{
-		"key":            key,
-		"masked_key":     maskedKey,
-		"name":           req.Name,
-		"allowed_groups": req.AllowedGroups,
-	})
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	grace := defaultKeyRotationGrace
+	if req.GraceSec != nil {
+		grace = time.Duration(max(*req.GraceSec, 0)) * time.Second
+	}
+
+	key := "k2a_" + utils.GenerateUUID()
+	cfg, err := keyManager.Rotate(id, key, grace)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := apiKeyView(cfg)
+	result["key"] = key
+	result["previous_id"] = id
+	if previous := keyManager.GetByID(id); previous != nil {
+		result["previous_expires_at"] = previous.ExpiresAt
+	}
+	c.JSON(http.StatusCreated, result)
 }
 
-// DeleteAPIKey DELETE /api/keys/:key
+// DeleteAPIKey DELETE /api/keys/:id
 func DeleteAPIKey(c *gin.Context, keyManager *auth.APIKeyManager) {
-	key := c.Param("key")
+	id := c.Param("id")
 
-	if keyManager.Get(key) == nil {
+	if keyManager.GetByID(id) == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "API Key 不存在"})
 		return
 	}
@@ -103,7 +311,12 @@ func DeleteAPIKey(c *gin.Context, keyManager *auth.APIKeyManager) {
 		return
 	}
 
-	if !keyManager.DeleteKey(key) {
+	if keyManager.IsLastAdmin(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "至少需要保留一个 admin API Key"})
+		return
+	}
+
+	if !keyManager.DeleteKey(id) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "API Key 不存在"})
 		return
 	}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"kiro2api/internal/auth"
+	"kiro2api/internal/converter"
 	"kiro2api/internal/logger"
 	"kiro2api/internal/service"
 	"kiro2api/internal/stats"
@@ -29,7 +30,7 @@ func HandleMessages(c *gin.Context, authService *auth.AuthService, group string)
 		reqCtx.Lifecycle.End(success)
 	}()
 
-	tokenWithUsage, body, err := reqCtx.GetTokenWithUsageAndBody()
+	body, err := reqCtx.ReadBody()
 	if err != nil {
 		return
 	}
@@ -65,10 +66,35 @@ func HandleMessages(c *gin.Context, authService *auth.AuthService, group string)
 		return
 	}
 
+	// API Key 模型白名单与请求上限（先于占用 token）
+	if !enforceKeyPolicy(c, anthropicReq) {
+		return
+	}
+
+	// 路由规则（未显式指定分组时按模型/Key/请求特征选择分组）
+	applyRoutingRules(reqCtx, anthropicReq)
+
+	if !enforceModelAvailability(reqCtx, anthropicReq.Model) {
+		return
+	}
+
+	// output_format 结构化输出（注入合成工具）
+	// 在 Key 策略与路由之后注入，合成工具不计入工具数量上限与路由特征
+	if err := converter.ApplyOutputFormat(&anthropicReq); err != nil {
+		service.RespondError(c, http.StatusBadRequest, "%v", err)
+		return
+	}
+	reqCtx.Lifecycle.SetModel(anthropicReq.Model) // 跳过已知不支持该模型的 token
+
+	tokenWithUsage, err := reqCtx.AcquireTokenWithUsage()
+	if err != nil {
+		return
+	}
+
 	// 记录统计信息
 	stats.SetRequestType(c, "anthropic")
 	stats.SetModel(c, anthropicReq.Model)
-	stats.SetGroup(c, group)
+	stats.SetGroup(c, reqCtx.Lifecycle.Group())
 	stats.SetStream(c, anthropicReq.Stream)
 
 	if anthropicReq.Stream {
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"kiro2api/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListRegisteredModels GET /api/models - 列出模型注册表
+func ListRegisteredModels(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"models": config.GetModelRegistry().List()})
+}
+
+// CreateRegisteredModel POST /api/models - 注册模型
+func CreateRegisteredModel(c *gin.Context) {
+	info, ok := bindModelInfo(c)
+	if !ok {
+		return
+	}
+	created, err := config.GetModelRegistry().Create(info)
+	if errors.Is(err, config.ErrModelExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// UpdateRegisteredModel PUT /api/models/:id - 替换模型配置
+func UpdateRegisteredModel(c *gin.Context) {
+	info, ok := bindModelInfo(c)
+	if !ok {
+		return
+	}
+	updated, err := config.GetModelRegistry().Update(c.Param("id"), info)
+	if errors.Is(err, config.ErrModelNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteRegisteredModel DELETE /api/models/:id - 删除模型
+func DeleteRegisteredModel(c *gin.Context) {
+	if err := config.GetModelRegistry().Delete(c.Param("id")); err != nil {
+		if errors.Is(err, config.ErrModelNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// bindModelInfo 解析请求体并校验可用分组存在
+func bindModelInfo(c *gin.Context) (config.ModelInfo, bool) {
+	var info config.ModelInfo
+	if err := c.ShouldBindJSON(&info); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求体: " + err.Error()})
+		return info, false
+	}
+	gm := GetGroupManager()
+	for _, group := range info.Groups {
+		if gm != nil && !gm.Exists(group) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "分组不存在: " + group})
+			return info, false
+		}
+	}
+	return info, true
+}
@@ -1,34 +1,204 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"kiro2api/internal/auth"
 	"kiro2api/internal/config"
+	"kiro2api/internal/logger"
+	"kiro2api/internal/service"
 	"kiro2api/internal/types"
 
 	"github.com/gin-gonic/gin"
 )
 
-// HandleModels GET /v1/models - 返回可用模型列表
+// 模型列表分页（与 Anthropic Models API 一致）
+const (
+	defaultModelsPageSize = 20
+	maxModelsPageSize     = 1000
+)
+
+// HandleModels GET /v1/models - 返回当前分组可用的模型列表
+// 支持 after_id / before_id / limit 分页；按认证头风格返回 Anthropic 或 OpenAI 格式
 func HandleModels(c *gin.Context) {
-	models := []types.Model{}
-	for anthropicModel := range config.ModelMap {
-		model := types.Model{
-			ID:          anthropicModel,
-			Object:      "model",
-			Created:     1234567890,
-			OwnedBy:     "anthropic",
-			DisplayName: anthropicModel,
-			Type:        "text",
-			MaxTokens:   200000,
+	anthropicStyle := isAnthropicClient(c)
+
+	// Anthropic 默认每页 20 个；OpenAI 客户端不分页，未指定 limit 时返回全部
+	limit := 0
+	if anthropicStyle {
+		limit = defaultModelsPageSize
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxModelsPageSize {
+			service.RespondError(c, http.StatusBadRequest, "limit 必须在 1 到 %d 之间", maxModelsPageSize)
+			return
+		}
+		limit = n
+	}
+
+	page, hasMore, err := paginateModels(visibleModels(c), c.Query("after_id"), c.Query("before_id"), limit)
+	if err != nil {
+		service.RespondError(c, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	if anthropicStyle {
+		resp := types.AnthropicModelsResponse{Data: make([]types.AnthropicModel, 0, len(page)), HasMore: hasMore}
+		for _, info := range page {
+			resp.Data = append(resp.Data, toAnthropicModel(info))
+		}
+		if len(page) > 0 {
+			resp.FirstID = &page[0].ID
+			resp.LastID = &page[len(page)-1].ID
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	resp := types.ModelsResponse{Object: "list", Data: make([]types.Model, 0, len(page)), HasMore: hasMore}
+	for _, info := range page {
+		resp.Data = append(resp.Data, toAPIModel(info))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleModel GET /v1/models/:id - 返回单个模型信息
+func HandleModel(c *gin.Context) {
+	id := c.Param("id")
+	for _, info := range visibleModels(c) {
+		if !strings.EqualFold(info.ID, id) {
+			continue
+		}
+		if isAnthropicClient(c) {
+			c.JSON(http.StatusOK, toAnthropicModel(info))
+		} else {
+			c.JSON(http.StatusOK, toAPIModel(info))
+		}
+		return
+	}
+	service.RespondErrorWithCode(c, http.StatusNotFound, "model_not_found", "模型 %s 不存在", id)
+}
+
+// isAnthropicClient 根据认证头风格判断调用方
+// 携带 x-api-key 或 anthropic-version 视为 Anthropic SDK，否则按 OpenAI 处理
+func isAnthropicClient(c *gin.Context) bool {
+	return c.GetHeader("x-api-key") != "" || c.GetHeader("anthropic-version") != ""
+}
+
+// visibleModels 当前分组可用且 API Key 允许的模型（新注册的在前）
+func visibleModels(c *gin.Context) []config.ModelInfo {
+	group := c.Param("group")
+	if group == "" {
+		group = service.GetGroupFromContext(c)
+	}
+	if group == "" {
+		group = auth.GetDefaultGroup()
+	}
+
+	var models []config.ModelInfo
+	for _, info := range config.GetModelRegistry().List() {
+		if info.AvailableIn(group) {
+			models = append(models, info)
+		}
+	}
+	models = filterModelsForKey(c, models)
+
+	sort.SliceStable(models, func(i, j int) bool {
+		return models[i].CreatedAt.After(models[j].CreatedAt)
+	})
+	return models
+}
+
+// paginateModels 按 after_id / before_id 游标分页（limit 为 0 表示不限制）
+func paginateModels(models []config.ModelInfo, afterID, beforeID string, limit int) ([]config.ModelInfo, bool, error) {
+	if afterID != "" && beforeID != "" {
+		return nil, false, fmt.Errorf("after_id 与 before_id 不能同时使用")
+	}
+	indexOf := func(id string) int {
+		for i, m := range models {
+			if m.ID == id {
+				return i
+			}
+		}
+		return -1
+	}
+
+	start, end := 0, len(models)
+	switch {
+	case afterID != "":
+		idx := indexOf(afterID)
+		if idx < 0 {
+			return nil, false, fmt.Errorf("after_id 对应的模型不存在: %s", afterID)
+		}
+		start = idx + 1
+		if limit > 0 {
+			end = min(start+limit, len(models))
 		}
-		models = append(models, model)
+		return models[start:end], end < len(models), nil
+	case beforeID != "":
+		idx := indexOf(beforeID)
+		if idx < 0 {
+			return nil, false, fmt.Errorf("before_id 对应的模型不存在: %s", beforeID)
+		}
+		end = idx
+		if limit > 0 {
+			start = max(0, end-limit)
+		}
+		return models[start:end], start > 0, nil
+	}
+	if limit > 0 {
+		end = min(limit, len(models))
+	}
+	return models[start:end], end < len(models), nil
+}
+
+// toAnthropicModel 注册表模型转为 Anthropic 格式
+func toAnthropicModel(info config.ModelInfo) types.AnthropicModel {
+	return types.AnthropicModel{
+		Type:        "model",
+		ID:          info.ID,
+		DisplayName: modelDisplayName(info),
+		CreatedAt:   info.CreatedAt.UTC().Format(time.RFC3339),
 	}
+}
+
+// toAPIModel 注册表模型转为 OpenAI 格式
+func toAPIModel(info config.ModelInfo) types.Model {
+	return types.Model{
+		ID:          info.ID,
+		Object:      "model",
+		Created:     info.CreatedAt.Unix(),
+		OwnedBy:     "anthropic",
+		DisplayName: modelDisplayName(info),
+		Type:        "text",
+		MaxTokens:   info.ContextWindow,
+		MaxOutput:   info.MaxOutput,
+	}
+}
 
-	response := types.ModelsResponse{
-		Object: "list",
-		Data:   models,
+func modelDisplayName(info config.ModelInfo) string {
+	if info.DisplayName != "" {
+		return info.DisplayName
 	}
+	return info.ID
+}
 
-	c.JSON(http.StatusOK, response)
+// enforceModelAvailability 在获取 token 前检查模型已注册、已启用且在目标分组可用
+func enforceModelAvailability(rc *RequestContext, model string) bool {
+	group := rc.Lifecycle.Group()
+	if config.GetModelRegistry().AvailableIn(model, group) {
+		return true
+	}
+	logger.Warn("模型在分组不可用",
+		service.AddReqFields(rc.GinContext,
+			logger.String("model", model),
+			logger.String("group", group))...)
+	rc.GinContext.JSON(http.StatusBadRequest, types.NewGroupModelNotFoundError(group, model, service.GetRequestID(rc.GinContext)))
+	return false
 }
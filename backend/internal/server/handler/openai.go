@@ -33,7 +33,7 @@ func HandleChatCompletions(c *gin.Context, authService *auth.AuthService, group
 		reqCtx.Lifecycle.End(success)
 	}()
 
-	tokenInfo, body, err := reqCtx.GetTokenAndBody()
+	body, err := reqCtx.ReadBody()
 	if err != nil {
 		return
 	}
@@ -55,16 +55,48 @@ func HandleChatCompletions(c *gin.Context, authService *auth.AuthService, group
 			return 16384
 		}()))
 
+	// 未指定 max_tokens 时使用 API Key 上限，避免默认值触发限制
+	if keyConfig := apiKeyFromContext(c); keyConfig != nil && keyConfig.MaxTokens > 0 && openaiReq.MaxTokens == nil {
+		maxTokens := keyConfig.MaxTokens
+		openaiReq.MaxTokens = &maxTokens
+	}
+
 	anthropicReq := converter.ConvertOpenAIToAnthropic(openaiReq)
 
+	// API Key 模型白名单与请求上限（先于占用 token）
+	if !enforceKeyPolicy(c, anthropicReq) {
+		return
+	}
+
+	// 路由规则（未显式指定分组时按模型/Key/请求特征选择分组）
+	applyRoutingRules(reqCtx, anthropicReq)
+
+	if !enforceModelAvailability(reqCtx, anthropicReq.Model) {
+		return
+	}
+
+	// response_format 结构化输出（注入合成工具）
+	// 在 Key 策略与路由之后注入，合成工具不计入工具数量上限与路由特征
+	if err := converter.ApplyOutputFormat(&anthropicReq); err != nil {
+		service.RespondError(c, http.StatusBadRequest, "%v", err)
+		return
+	}
+	reqCtx.Lifecycle.SetModel(anthropicReq.Model) // 跳过已知不支持该模型的 token
+
+	tokenInfo, err := reqCtx.AcquireToken()
+	if err != nil {
+		return
+	}
+
 	// 记录统计信息
 	stats.SetRequestType(c, "openai")
 	stats.SetModel(c, anthropicReq.Model)
-	stats.SetGroup(c, group)
+	stats.SetGroup(c, reqCtx.Lifecycle.Group())
 	stats.SetStream(c, anthropicReq.Stream)
 
 	if anthropicReq.Stream {
-		handleOpenAIStreamRequest(c, anthropicReq, tokenInfo)
+		includeUsage := openaiReq.StreamOptions != nil && openaiReq.StreamOptions.IncludeUsage
+		handleOpenAIStreamRequest(c, anthropicReq, tokenInfo, includeUsage)
 		success = true
 		return
 	}
@@ -110,7 +142,16 @@ func handleOpenAINonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRe
 	contexts := []map[string]any{}
 	allContent := result.GetCompletionText()
 	toolCalls := result.GetToolCalls()
-	sawToolUse := len(toolCalls) > 0
+
+	// stop_sequences：在第一个停止序列处截断，之后的输出（含工具调用）丢弃
+	allContent, stopSequence := service.TruncateAtStopSequence(allContent, anthropicReq.StopSequences)
+	if stopSequence != "" {
+		toolCalls = nil
+	}
+	if len(toolCalls) > 1 && converter.ParallelToolUseDisabled(anthropicReq.ToolChoice) {
+		// parallel_tool_calls=false：只返回第一个工具调用
+		toolCalls = toolCalls[:1]
+	}
 
 	if allContent != "" {
 		contexts = append(contexts, map[string]any{
@@ -128,6 +169,17 @@ func handleOpenAINonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRe
 		})
 	}
 
+	// response_format：合成工具调用还原为 JSON 文本
+	sawToolUse := len(toolCalls) > 0
+	if output := service.NewStructuredOutput(anthropicReq); output != nil {
+		if contexts, err = output.UnwrapBlocks(contexts); err != nil {
+			logger.Warn("结构化输出校验失败", service.AddReqFields(c, logger.Err(err))...)
+			service.RespondError(c, http.StatusBadGateway, "%v", err)
+			return
+		}
+		sawToolUse = output.OtherToolUse()
+	}
+
 	// 计算输出tokens
 	outputTokens := 0
 	for _, block := range contexts {
@@ -152,6 +204,9 @@ func handleOpenAINonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRe
 	if sawToolUse {
 		stopReason = "tool_use"
 	}
+	if stopSequence != "" {
+		stopReason = "stop_sequence"
+	}
 	anthropicResp := map[string]any{
 		"content":       contexts,
 		"model":         anthropicReq.Model,
@@ -180,7 +235,8 @@ func handleOpenAINonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRe
 }
 
 // handleOpenAIStreamRequest 处理OpenAI流式请求
-func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest, token types.TokenInfo) {
+// includeUsage 对应 stream_options.include_usage，在 [DONE] 前追加 usage 分片
+func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest, token types.TokenInfo, includeUsage bool) {
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
@@ -209,37 +265,52 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 	// 立即刷新响应头
 	c.Writer.Flush()
 
-	sender := &service.OpenAIStreamSender{}
+	// 上游输出间隙发送 SSE 注释心跳，避免客户端因空闲断开
+	chunks := service.NewOpenAIStreamSender(messageId, anthropicReq.Model, includeUsage)
+	sender := service.StartKeepalive(c, chunks, service.KeepaliveComment)
+	defer sender.Stop()
 
 	// 发送初始OpenAI事件
-	initialEvent := map[string]any{
-		"id":      messageId,
-		"object":  "chat.completion.chunk",
-		"created": time.Now().Unix(),
-		"model":   anthropicReq.Model,
-		"choices": []map[string]any{
-			{
-				"index": 0,
-				"delta": map[string]any{
-					"role": "assistant",
-				},
-				"finish_reason": nil,
-			},
-		},
-	}
-	sender.SendEvent(c, initialEvent)
+	sender.SendEvent(c, chunks.Chunk(map[string]any{"role": "assistant", "content": ""}, nil))
 
 	// 创建符合AWS规范的流式解析器
 	compliantParser := parser.NewCompliantEventStreamParser()
 
-	// OpenAI 工具调用增量状态
-	toolIndexByToolUseId := make(map[string]int)  // tool_use_id -> tool_calls 数组索引
-	toolUseIdByBlockIndex := make(map[int]string) // 内容块 index -> tool_use_id
+	// OpenAI 工具调用增量状态：首个分片带 index/id/name，之后只带 index 与参数片段
+	toolIndexByBlockIndex := make(map[int]int) // 内容块 index -> tool_calls 数组索引
 	nextToolIndex := 0
-	sawToolUse := false
+	singleTool := converter.ParallelToolUseDisabled(anthropicReq.ToolChoice)  // parallel_tool_calls=false
+	output := service.NewStructuredOutput(anthropicReq)                       // response_format：合成工具事件改写为文本
+	stopMatcher := service.NewStopSequenceMatcher(anthropicReq.StopSequences) // stop：命中后截断并结束
 	sentFinal := false
 	outputTokens := 0 // 累计输出 token
 
+	// sendFinish 发送结束分片：有工具调用时 finish_reason 固定为 tool_calls；结构化输出校验失败时改为错误
+	sendFinish := func(stopReason string) {
+		if output != nil {
+			if _, err := output.Result(); err != nil {
+				logger.Warn("结构化输出校验失败", service.AddReqFields(c, logger.Err(err))...)
+				sender.SendError(c, err.Error(), err)
+				return
+			}
+		}
+		finishReason := converter.OpenAIFinishReason(stopReason)
+		if nextToolIndex > 0 {
+			finishReason = "tool_calls"
+		}
+		sender.SendEvent(c, chunks.Chunk(map[string]any{}, finishReason))
+	}
+
+	// flushText 下发 stop 扫描暂存的文本尾部（工具调用与结束分片前调用，保持顺序）
+	flushText := func() {
+		if stopMatcher == nil {
+			return
+		}
+		if rest := stopMatcher.Flush(); rest != "" {
+			sender.SendEvent(c, chunks.Chunk(map[string]any{"content": rest}, nil))
+		}
+	}
+
 	// 添加完整性跟踪
 	totalBytesRead := 0
 	messageCount := 0
@@ -261,191 +332,115 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 				continue
 			}
 			messageCount += len(events)
+		eventLoop:
 			for _, event := range events {
-				if event.Data != nil {
-					if dataMap, ok := event.Data.(map[string]any); ok {
-						switch dataMap["type"] {
-						case "content_block_delta":
-							if delta, ok := dataMap["delta"]; ok {
-								if deltaMap, ok := delta.(map[string]any); ok {
-									switch deltaMap["type"] {
-									case "text_delta":
-										if text, ok := deltaMap["text"]; ok {
-											// 发送文本内容的增量
-											contentEvent := map[string]any{
-												"id":      messageId,
-												"object":  "chat.completion.chunk",
-												"created": time.Now().Unix(),
-												"model":   anthropicReq.Model,
-												"choices": []map[string]any{
-													{
-														"index": 0,
-														"delta": map[string]any{
-															"content": text.(string),
-														},
-														"finish_reason": nil,
-													},
-												},
-											}
-											sender.SendEvent(c, contentEvent)
-										}
-									case "input_json_delta":
-										// 工具调用参数增量
-										// 找到对应的tool_use和OpenAI tool_calls索引
-										toolBlockIndex := 0
-										if idxAny, ok := dataMap["index"]; ok {
-											switch v := idxAny.(type) {
-											case int:
-												toolBlockIndex = v
-											case int32:
-												toolBlockIndex = int(v)
-											case int64:
-												toolBlockIndex = int(v)
-											case float64:
-												toolBlockIndex = int(v)
-											}
-										}
-										if toolUseId, ok := toolUseIdByBlockIndex[toolBlockIndex]; ok {
-											if toolIdx, ok := toolIndexByToolUseId[toolUseId]; ok {
-												var partial string
-												if pj, ok := deltaMap["partial_json"]; ok {
-													switch s := pj.(type) {
-													case string:
-														partial = s
-													case *string:
-														if s != nil {
-															partial = *s
-														}
-													}
-												}
-												if partial != "" {
-													toolDelta := map[string]any{
-														"id":      messageId,
-														"object":  "chat.completion.chunk",
-														"created": time.Now().Unix(),
-														"model":   anthropicReq.Model,
-														"choices": []map[string]any{
-															{
-																"index": 0,
-																"delta": map[string]any{
-																	"tool_calls": []map[string]any{
-																		{
-																			"index": toolIdx,
-																			"type":  "function",
-																			"function": map[string]any{
-																				"arguments": partial,
-																			},
-																		},
-																	},
-																},
-																"finish_reason": nil,
-															},
-														},
-													}
-													sender.SendEvent(c, toolDelta)
-												}
-											}
-										}
-									}
-								}
+				dataMap, ok := event.Data.(map[string]any)
+				if !ok {
+					continue
+				}
+				dataMaps := []map[string]any{dataMap}
+				if output != nil {
+					dataMaps = output.TransformEvent(dataMap)
+				}
+				for _, dataMap := range dataMaps {
+					switch dataMap["type"] {
+					case "content_block_start":
+						flushText()
+						blockMap, _ := dataMap["content_block"].(map[string]any)
+						if blockType, _ := blockMap["type"].(string); blockType != "tool_use" {
+							continue
+						}
+						toolUseId, _ := blockMap["id"].(string)
+						toolName, _ := blockMap["name"].(string)
+						if toolUseId == "" || (singleTool && nextToolIndex > 0) {
+							// 不允许并行工具调用时丢弃第一个之后的工具调用
+							continue
+						}
+						toolIdx := nextToolIndex
+						nextToolIndex++
+						toolIndexByBlockIndex[openAIEventIndex(dataMap)] = toolIdx
+						// 发送OpenAI工具调用开始增量
+						sender.SendEvent(c, chunks.Chunk(map[string]any{
+							"tool_calls": []map[string]any{
+								{
+									"index": toolIdx,
+									"id":    toolUseId,
+									"type":  "function",
+									"function": map[string]any{
+										"name":      toolName,
+										"arguments": "",
+									},
+								},
+							},
+						}, nil))
+
+					case "content_block_delta":
+						deltaMap, _ := dataMap["delta"].(map[string]any)
+						switch deltaMap["type"] {
+						case "text_delta":
+							text, _ := deltaMap["text"].(string)
+							matched := false
+							if stopMatcher != nil {
+								text, matched = stopMatcher.Feed(text)
 							}
-						case "content_block_start":
-							if contentBlock, ok := dataMap["content_block"]; ok {
-								if blockMap, ok := contentBlock.(map[string]any); ok {
-									if blockType, _ := blockMap["type"].(string); blockType == "tool_use" {
-										toolUseId, _ := blockMap["id"].(string)
-										toolName, _ := blockMap["name"].(string)
-										// 获取内容块索引
-										toolBlockIndex := 0
-										if idxAny, ok := dataMap["index"]; ok {
-											switch v := idxAny.(type) {
-											case int:
-												toolBlockIndex = v
-											case int32:
-												toolBlockIndex = int(v)
-											case int64:
-												toolBlockIndex = int(v)
-											case float64:
-												toolBlockIndex = int(v)
-											}
-										}
-										if toolUseId != "" {
-											if _, exists := toolIndexByToolUseId[toolUseId]; !exists {
-												toolIndexByToolUseId[toolUseId] = nextToolIndex
-												nextToolIndex++
-											}
-											toolUseIdByBlockIndex[toolBlockIndex] = toolUseId
-											sawToolUse = true
-											toolIdx := toolIndexByToolUseId[toolUseId]
-											// 发送OpenAI工具调用开始增量
-											toolStart := map[string]any{
-												"id":      messageId,
-												"object":  "chat.completion.chunk",
-												"created": time.Now().Unix(),
-												"model":   anthropicReq.Model,
-												"choices": []map[string]any{
-													{
-														"index": 0,
-														"delta": map[string]any{
-															"tool_calls": []map[string]any{
-																{
-																	"index": toolIdx,
-																	"id":    toolUseId,
-																	"type":  "function",
-																	"function": map[string]any{
-																		"name":      toolName,
-																		"arguments": "",
-																	},
-																},
-															},
-														},
-														"finish_reason": nil,
-													},
-												},
-											}
-											sender.SendEvent(c, toolStart)
-										}
-									}
-								}
+							if text != "" {
+								// 发送文本内容的增量
+								sender.SendEvent(c, chunks.Chunk(map[string]any{"content": text}, nil))
 							}
-						case "message_delta":
-							// 提取 output_tokens
-							if usage, ok := dataMap["usage"].(map[string]any); ok {
-								if ot, ok := usage["output_tokens"]; ok {
-									switch v := ot.(type) {
-									case int:
-										outputTokens = v
-									case int64:
-										outputTokens = int(v)
-									case float64:
-										outputTokens = int(v)
-									}
-								}
+							if matched {
+								// 命中停止序列：关闭上游连接并结束
+								resp.Body.Close()
+								sendFinish("stop_sequence")
+								sentFinal = true
+								hasMoreData = false
+								break eventLoop
 							}
-							// 将Claude的tool_use结束映射为OpenAI的finish_reason=tool_calls
-							if sawToolUse && !sentFinal {
-								if delta, ok := dataMap["delta"].(map[string]any); ok {
-									if sr, ok := delta["stop_reason"].(string); ok && sr == "tool_use" {
-										endEvent := map[string]any{
-											"id":      messageId,
-											"object":  "chat.completion.chunk",
-											"created": time.Now().Unix(),
-											"model":   anthropicReq.Model,
-											"choices": []map[string]any{
-												{
-													"index":         0,
-													"delta":         map[string]any{},
-													"finish_reason": "tool_calls",
-												},
-											},
-										}
-										sender.SendEvent(c, endEvent)
-										sentFinal = true
-									}
+						case "input_json_delta":
+							// 工具调用参数增量
+							toolIdx, ok := toolIndexByBlockIndex[openAIEventIndex(dataMap)]
+							if !ok {
+								continue
+							}
+							var partial string
+							switch s := deltaMap["partial_json"].(type) {
+							case string:
+								partial = s
+							case *string:
+								if s != nil {
+									partial = *s
 								}
 							}
-						case "content_block_stop":
-							// 忽略，最终结束由message_delta驱动
+							if partial != "" {
+								sender.SendEvent(c, chunks.Chunk(map[string]any{
+									"tool_calls": []map[string]any{
+										{
+											"index":    toolIdx,
+											"function": map[string]any{"arguments": partial},
+										},
+									},
+								}, nil))
+							}
+						}
+
+					case "message_delta":
+						flushText()
+						// 提取 output_tokens
+						if usage, ok := dataMap["usage"].(map[string]any); ok {
+							switch v := usage["output_tokens"].(type) {
+							case int:
+								outputTokens = v
+							case int64:
+								outputTokens = int(v)
+							case float64:
+								outputTokens = int(v)
+							}
+						}
+						// 将Claude的stop_reason映射为OpenAI的finish_reason
+						if delta, ok := dataMap["delta"].(map[string]any); ok && !sentFinal {
+							if sr, ok := delta["stop_reason"].(string); ok && sr != "" {
+								sendFinish(sr)
+								sentFinal = true
+							}
 						}
 					}
 				}
@@ -486,34 +481,54 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 		}
 	}
 
-	// 确保发送了结束原因（如果还没有发送）
-	if !sentFinal && messageCount > 0 {
-		finishReason := "stop"
-		if sawToolUse {
-			finishReason = "tool_calls"
+	// 结构化输出：流在 message_delta 之前结束时下发暂存的文本
+	if output != nil && !sentFinal {
+		for _, held := range output.Flush() {
+			delta, _ := held["delta"].(map[string]any)
+			text, _ := delta["text"].(string)
+			if delta["type"] != "text_delta" || text == "" {
+				continue
+			}
+			if stopMatcher != nil {
+				text, _ = stopMatcher.Feed(text)
+			}
+			if text != "" {
+				sender.SendEvent(c, chunks.Chunk(map[string]any{"content": text}, nil))
+			}
 		}
+	}
 
-		finalEvent := map[string]any{
-			"id":      messageId,
-			"object":  "chat.completion.chunk",
-			"created": time.Now().Unix(),
-			"model":   anthropicReq.Model,
-			"choices": []map[string]any{
-				{
-					"index":         0,
-					"delta":         map[string]any{},
-					"finish_reason": finishReason,
-				},
-			},
-		}
-		sender.SendEvent(c, finalEvent)
-		c.Writer.Flush()
+	// 确保发送了结束原因（如果还没有发送）
+	flushText()
+	if !sentFinal && messageCount > 0 {
+		sendFinish("end_turn")
 	}
 
 	// 记录 token 统计
 	stats.SetTokens(c, inputTokens, outputTokens)
 
+	// stream_options.include_usage：choices 为空的 usage 分片
+	if includeUsage {
+		sender.SendEvent(c, chunks.UsageChunk(inputTokens, outputTokens))
+	}
+
 	// 发送结束标记
+	sender.Stop()
 	fmt.Fprintf(c.Writer, "data: [DONE]\n\n")
 	c.Writer.Flush()
 }
+
+// openAIEventIndex 读取流事件的内容块 index
+func openAIEventIndex(dataMap map[string]any) int {
+	switch v := dataMap["index"].(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"net/http"
+
+	"kiro2api/internal/auth"
+	"kiro2api/internal/converter"
+	"kiro2api/internal/logger"
+	"kiro2api/internal/service"
+	"kiro2api/internal/stats"
+	"kiro2api/internal/types"
+	"kiro2api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleResponses POST /v1/responses - OpenAI Responses API 代理
+func HandleResponses(c *gin.Context, authService *auth.AuthService, group string) {
+	service.SetAuthServiceInContext(c, authService)
+	service.SetGroupInContext(c, group)
+
+	// 使用统一管线创建请求上下文
+	reqCtx := NewRequestContext(c, authService, "Responses", group)
+
+	// 确保请求结束时记录 metrics
+	success := false
+	defer func() {
+		reqCtx.Lifecycle.End(success)
+	}()
+
+	body, err := reqCtx.ReadBody()
+	if err != nil {
+		return
+	}
+
+	var responsesReq types.ResponsesRequest
+	if err := utils.SafeUnmarshal(body, &responsesReq); err != nil {
+		logger.Error("解析Responses请求体失败", logger.Err(err))
+		service.RespondError(c, http.StatusBadRequest, "解析请求体失败: %v", err)
+		return
+	}
+
+	// 未指定 max_output_tokens 时使用 API Key 上限，避免默认值触发限制
+	if keyConfig := apiKeyFromContext(c); keyConfig != nil && keyConfig.MaxTokens > 0 && responsesReq.MaxOutputTokens == nil {
+		maxTokens := keyConfig.MaxTokens
+		responsesReq.MaxOutputTokens = &maxTokens
+	}
+
+	anthropicReq, err := converter.ConvertResponsesToAnthropic(responsesReq)
+	if err != nil {
+		service.RespondError(c, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	// 验证请求
+	if err := validateAnthropicRequest(c, anthropicReq); err != nil {
+		return
+	}
+
+	// API Key 模型白名单与请求上限（先于占用 token）
+	if !enforceKeyPolicy(c, anthropicReq) {
+		return
+	}
+
+	// 路由规则（未显式指定分组时按模型/Key/请求特征选择分组）
+	applyRoutingRules(reqCtx, anthropicReq)
+
+	if !enforceModelAvailability(reqCtx, anthropicReq.Model) {
+		return
+	}
+	reqCtx.Lifecycle.SetModel(anthropicReq.Model) // 跳过已知不支持该模型的 token
+
+	tokenWithUsage, err := reqCtx.AcquireTokenWithUsage()
+	if err != nil {
+		return
+	}
+
+	// 记录统计信息
+	stats.SetRequestType(c, "responses")
+	stats.SetModel(c, anthropicReq.Model)
+	stats.SetGroup(c, reqCtx.Lifecycle.Group())
+	stats.SetStream(c, anthropicReq.Stream)
+
+	responseID := converter.NewResponseID()
+	if anthropicReq.Stream {
+		sender := service.NewResponsesStreamSender(responseID, responsesReq.Model)
+		HandleGenericStreamRequest(c, anthropicReq, tokenWithUsage, sender, service.CreateAnthropicStreamEvents)
+		success = true
+		return
+	}
+
+	anthropicResp, ok := buildAnthropicNonStreamResponse(c, anthropicReq, tokenWithUsage.TokenInfo)
+	if !ok {
+		return
+	}
+	resp := converter.ConvertAnthropicToResponses(anthropicResp, responseID, responsesReq.Model)
+	resp.Metadata = responsesReq.Metadata
+	c.JSON(http.StatusOK, resp)
+	success = true
+}
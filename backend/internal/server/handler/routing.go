@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"kiro2api/internal/auth"
+	"kiro2api/internal/config"
+	"kiro2api/internal/logger"
+	"kiro2api/internal/service"
+	"kiro2api/internal/types"
+	"kiro2api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// applyRoutingRules 在获取 token 前按路由规则选择分组
+// 仅在请求未指定分组（路径前缀、X-Kiro-Group 或 API Key 默认分组）时生效
+func applyRoutingRules(rc *RequestContext, req types.AnthropicRequest) {
+	table := GetRoutingTable()
+	if table == nil || !table.HasEnabled() {
+		return
+	}
+	c := rc.GinContext
+	if c.Param("group") != "" || c.GetHeader(service.HeaderGroupOverride) != "" {
+		return
+	}
+	keyConfig := apiKeyFromContext(c)
+	if keyConfig != nil && keyConfig.DefaultGroup != "" {
+		return
+	}
+
+	routingReq := auth.RoutingRequest{
+		Model:      req.Model,
+		HasTools:   len(req.Tools) > 0,
+		Thinking:   req.Thinking != nil && config.IsThinkingEnabled(req.Thinking.Type),
+		Complexity: utils.RequestComplexityScore(req),
+	}
+	if keyConfig != nil {
+		routingReq.APIKeyID = keyConfig.ID
+	}
+	allowed := func(group string) bool {
+		if gm := GetGroupManager(); gm != nil && !gm.Exists(group) {
+			return false
+		}
+		if !config.GetModelRegistry().AvailableIn(req.Model, group) {
+			return false
+		}
+		return keyConfig == nil || keyConfig.HasGroupPermission(group)
+	}
+
+	group, rule, ok := table.Route(routingReq, allowed)
+	if !ok || group == rc.Lifecycle.Group() {
+		return
+	}
+
+	logger.Debug("路由规则命中",
+		service.AddReqFields(c,
+			logger.Int64("rule_id", rule.ID),
+			logger.String("rule", rule.Name),
+			logger.String("from_group", rc.Lifecycle.Group()),
+			logger.String("to_group", group),
+			logger.Int("complexity", routingReq.Complexity))...)
+
+	rc.Lifecycle.SetGroup(group)
+	rc.Group = group
+	service.SetGroupInContext(c, group)
+}
+
+// ListRoutingRules GET /api/routing - 按匹配顺序列出路由规则
+func ListRoutingRules(c *gin.Context) {
+	table, ok := routingTableOrError(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": table.List()})
+}
+
+// CreateRoutingRule POST /api/routing - 创建路由规则
+func CreateRoutingRule(c *gin.Context) {
+	table, ok := routingTableOrError(c)
+	if !ok {
+		return
+	}
+	rule, ok := bindRoutingRule(c)
+	if !ok {
+		return
+	}
+	created, err := table.Create(rule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// UpdateRoutingRule PUT /api/routing/:id - 替换路由规则
+func UpdateRoutingRule(c *gin.Context) {
+	table, ok := routingTableOrError(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的规则ID"})
+		return
+	}
+	rule, ok := bindRoutingRule(c)
+	if !ok {
+		return
+	}
+	updated, err := table.Update(id, rule)
+	if errors.Is(err, auth.ErrRoutingRuleNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteRoutingRule DELETE /api/routing/:id - 删除路由规则
+func DeleteRoutingRule(c *gin.Context) {
+	table, ok := routingTableOrError(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的规则ID"})
+		return
+	}
+	if err := table.Delete(id); err != nil {
+		if errors.Is(err, auth.ErrRoutingRuleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// routingTableOrError 获取路由规则表，未初始化时返回 503
+func routingTableOrError(c *gin.Context) (*auth.RoutingTable, bool) {
+	table := GetRoutingTable()
+	if table == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "路由规则未启用"})
+		return nil, false
+	}
+	return table, true
+}
+
+// bindRoutingRule 解析请求体并校验目标分组存在
+func bindRoutingRule(c *gin.Context) (auth.RoutingRule, bool) {
+	var rule auth.RoutingRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求体: " + err.Error()})
+		return rule, false
+	}
+	gm := GetGroupManager()
+	for _, target := range rule.Targets {
+		if gm != nil && !gm.Exists(target.Group) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "分组不存在: " + target.Group})
+			return rule, false
+		}
+	}
+	return rule, true
+}
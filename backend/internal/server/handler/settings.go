@@ -69,6 +69,9 @@ func UpdateSettings(c *gin.Context) {
 	if req.RateLimitBurst <= 0 {
 		req.RateLimitBurst = service.DefaultRateLimitBurst
 	}
+	if req.RateLimitQueueWaitMs < 0 {
+		req.RateLimitQueueWaitMs = 0
+	}
 	if req.RequestTimeoutSec <= 0 {
 		req.RequestTimeoutSec = 120
 	}
@@ -90,6 +93,18 @@ func UpdateSettings(c *gin.Context) {
 	if req.GroupMaxConcurrent < 0 {
 		req.GroupMaxConcurrent = 0
 	}
+	if req.StreamFirstByteTimeoutSec < 0 {
+		req.StreamFirstByteTimeoutSec = 0
+	}
+	if req.StreamIdleTimeoutSec < 0 {
+		req.StreamIdleTimeoutSec = 0
+	}
+	if req.StreamTotalTimeoutSec < 0 {
+		req.StreamTotalTimeoutSec = 0
+	}
+	if req.StreamKeepaliveSec < 0 {
+		req.StreamKeepaliveSec = -1 // 关闭
+	}
 	if req.RefreshConcurrency <= 0 {
 		req.RefreshConcurrency = 5 // 默认并发数
 	} else if req.RefreshConcurrency > 50 {
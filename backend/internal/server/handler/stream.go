@@ -20,7 +20,10 @@ import (
 
 // HandleAnthropicStream 处理Anthropic流式请求
 func HandleAnthropicStream(c *gin.Context, anthropicReq types.AnthropicRequest, tokenWithUsage *types.TokenWithUsage) {
-	sender := &service.AnthropicStreamSender{}
+	var sender service.StreamEventSender = &service.AnthropicStreamSender{}
+	if output := service.NewStructuredOutput(anthropicReq); output != nil {
+		sender = service.NewStructuredOutputSender(sender, output)
+	}
 	HandleGenericStreamRequest(c, anthropicReq, tokenWithUsage, sender, service.CreateAnthropicStreamEvents)
 }
 
@@ -46,14 +49,18 @@ func HandleGenericStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequ
 		return
 	}
 
+	// 等待上游期间发送心跳，避免客户端因空闲断开
+	keepalive := service.StartKeepalive(c, sender, service.KeepaliveAnthropic)
+	defer keepalive.Stop()
+	sender = keepalive
+
 	// 生成消息ID并注入上下文
 	messageID := fmt.Sprintf(config.MessageIDFormat, time.Now().Format(config.MessageIDTimeFormat))
 	c.Set("message_id", messageID)
 
-	// 执行CodeWhisperer请求
-	// 需要 server 包暴露 ExecuteCWRequest
-	resp, err := service.ExecuteCWRequest(c, anthropicReq, token.TokenInfo, true)
-	if err != nil {
+	// 执行CodeWhisperer请求并处理事件流（首个内容事件前失败时切换 token 重试）
+	ctx, err := service.ProcessStreamWithFailover(c, anthropicReq, token, sender, messageID, inputTokens, eventCreator)
+	if ctx == nil {
 		var modelNotFoundErrorType *types.ModelNotFoundErrorType
 		if errors.As(err, &modelNotFoundErrorType) {
 			return
@@ -61,20 +68,8 @@ func HandleGenericStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequ
 		sender.SendError(c, "构建请求失败", err)
 		return
 	}
-	defer resp.Body.Close()
-
-	// 创建流处理上下文
-	ctx := service.NewStreamProcessorContext(c, anthropicReq, token, sender, messageID, inputTokens)
 	defer ctx.Cleanup()
-
-	// 发送初始事件
-	if err := ctx.SendInitialEvents(eventCreator); err != nil {
-		return
-	}
-
-	// 处理事件流
-	processor := service.NewEventStreamProcessor(ctx)
-	if err := processor.ProcessEventStream(resp.Body); err != nil {
+	if err != nil {
 		logger.Error("事件流处理失败", logger.Err(err))
 		return
 	}
@@ -101,6 +96,15 @@ func HandleGenericStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequ
 
 // HandleAnthropicNonStream 处理非流式请求
 func HandleAnthropicNonStream(c *gin.Context, anthropicReq types.AnthropicRequest, token types.TokenInfo) {
+	anthropicResp, ok := buildAnthropicNonStreamResponse(c, anthropicReq, token)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, anthropicResp)
+}
+
+// buildAnthropicNonStreamResponse 执行非流式请求并构建 Anthropic 响应（失败时已写出错误响应）
+func buildAnthropicNonStreamResponse(c *gin.Context, anthropicReq types.AnthropicRequest, token types.TokenInfo) (map[string]any, bool) {
 	// 计算输入tokens
 	estimator := utils.NewTokenEstimator()
 	countReq := &types.CountTokensRequest{
@@ -113,7 +117,7 @@ func HandleAnthropicNonStream(c *gin.Context, anthropicReq types.AnthropicReques
 
 	resp, err := service.ExecuteCWRequest(c, anthropicReq, token, false)
 	if err != nil {
-		return
+		return nil, false
 	}
 	defer resp.Body.Close()
 
@@ -121,7 +125,7 @@ func HandleAnthropicNonStream(c *gin.Context, anthropicReq types.AnthropicReques
 	body, err := utils.ReadHTTPResponse(resp.Body)
 	if err != nil {
 		service.HandleResponseReadError(c, err)
-		return
+		return nil, false
 	}
 
 	// 解析响应
@@ -153,7 +157,7 @@ func HandleAnthropicNonStream(c *gin.Context, anthropicReq types.AnthropicReques
 		}
 
 		c.JSON(statusCode, errorResp)
-		return
+		return nil, false
 	}
 
 	// 转换为Anthropic格式
@@ -173,7 +177,12 @@ func HandleAnthropicNonStream(c *gin.Context, anthropicReq types.AnthropicReques
 		allTools = append(allTools, tool)
 	}
 
-	sawToolUse := len(allTools) > 0
+	// stop_sequences：在第一个停止序列处截断，之后的输出（含工具调用）丢弃
+	var stopSequence string
+	textAgg, stopSequence = service.TruncateAtStopSequence(textAgg, anthropicReq.StopSequences)
+	if stopSequence != "" {
+		allTools = nil
+	}
 
 	// 添加文本内容
 	if textAgg != "" {
@@ -199,6 +208,17 @@ func HandleAnthropicNonStream(c *gin.Context, anthropicReq types.AnthropicReques
 		contexts = append(contexts, toolUseBlock)
 	}
 
+	// output_format：合成工具调用还原为 JSON 文本
+	sawToolUse := len(allTools) > 0
+	if output := service.NewStructuredOutput(anthropicReq); output != nil {
+		if contexts, err = output.UnwrapBlocks(contexts); err != nil {
+			logger.Warn("结构化输出校验失败", service.AddReqFields(c, logger.Err(err))...)
+			service.RespondError(c, http.StatusBadGateway, "%v", err)
+			return nil, false
+		}
+		sawToolUse = output.OtherToolUse()
+	}
+
 	// 使用新的stop_reason管理器
 	stopReasonManager := service.NewStopReasonManager(anthropicReq)
 
@@ -225,13 +245,18 @@ func HandleAnthropicNonStream(c *gin.Context, anthropicReq types.AnthropicReques
 
 	stopReasonManager.UpdateToolCallStatus(sawToolUse, sawToolUse)
 	stopReason := stopReasonManager.DetermineStopReason()
+	var stopSequenceValue any
+	if stopSequence != "" {
+		stopReason = "stop_sequence"
+		stopSequenceValue = stopSequence
+	}
 
 	anthropicResp := map[string]any{
 		"content":       contexts,
 		"model":         anthropicReq.Model,
 		"role":          "assistant",
 		"stop_reason":   stopReason,
-		"stop_sequence": nil,
+		"stop_sequence": stopSequenceValue,
 		"type":          "message",
 		"usage": map[string]any{
 			"input_tokens":  inputTokens,
@@ -268,5 +293,5 @@ func HandleAnthropicNonStream(c *gin.Context, anthropicReq types.AnthropicReques
 		}
 	}
 
-	c.JSON(http.StatusOK, anthropicResp)
+	return anthropicResp, true
 }
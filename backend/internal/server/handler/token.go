@@ -90,6 +90,7 @@ func ListTokens(c *gin.Context, authService *auth.AuthService) {
 			tokenData["failure_count"] = metrics.FailureCount
 			tokenData["in_flight"] = metrics.InFlight
 			tokenData["avg_latency"] = metrics.AvgLatency
+			tokenData["breaker"] = metrics.Breaker
 		} else {
 			// 没有 metrics 记录，填充默认值
 			tokenData["request_count"] = int64(0)
@@ -97,8 +98,12 @@ func ListTokens(c *gin.Context, authService *auth.AuthService) {
 			tokenData["failure_count"] = int64(0)
 			tokenData["in_flight"] = int64(0)
 			tokenData["avg_latency"] = float64(0)
+			tokenData["breaker"] = auth.BreakerSnapshot{State: auth.BreakerClosed}
 		}
 
+		// 模型可用性（从上游错误学习）
+		tokenData["model_access"] = authService.GetModelAccess(t.ID)
+
 		tokenList = append(tokenList, tokenData)
 	}
 
@@ -175,6 +180,23 @@ func DeleteToken(c *gin.Context, authService *auth.AuthService) {
 	c.Status(http.StatusNoContent)
 }
 
+// ResetTokenBreaker 重置 token 熔断器
+func ResetTokenBreaker(c *gin.Context, authService *auth.AuthService) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+
+	if !authService.ResetBreaker(id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token不存在或不在池中"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "熔断器已重置"})
+}
+
 // UpdateToken 更新 token
 func UpdateToken(c *gin.Context, authService *auth.AuthService) {
 	idStr := c.Param("id")
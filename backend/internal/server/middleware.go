@@ -1,7 +1,9 @@
 package server
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -9,6 +11,7 @@ import (
 	"kiro2api/internal/config"
 	"kiro2api/internal/logger"
 	"kiro2api/internal/server/handler"
+	"kiro2api/internal/service"
 	"kiro2api/internal/stats"
 	"kiro2api/internal/utils"
 
@@ -33,12 +36,51 @@ func PathBasedAuthMiddleware(keyMgr *auth.APIKeyManager, protectedPrefixes []str
 			return
 		}
 
+		// 按角色限制可访问的路由
+		if !roleAllows(keyConfig.Role, classifyRoute(c.Request.Method, path)) {
+			logger.Warn("API Key角色无权访问",
+				logger.String("path", path),
+				logger.String("method", c.Request.Method),
+				logger.String("role", string(keyConfig.Role)))
+			c.JSON(http.StatusForbidden, gin.H{"error": "权限不足"})
+			c.Abort()
+			return
+		}
+
 		// 存储 key 配置到 context
 		c.Set("api_key_config", keyConfig)
 		c.Next()
 	}
 }
 
+// KeyGroupMiddleware 为未带分组前缀的 AI API 请求（/v1/...）选择分组
+// X-Kiro-Group 头（需在 AllowedGroups 内）优先，其次为 API Key 的默认分组；
+// /:group/v1/... 路由仍以路径分组为准
+func KeyGroupMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keyConfig := GetAPIKeyConfig(c)
+		if keyConfig == nil || !strings.HasPrefix(c.Request.URL.Path, "/v1/") {
+			c.Next()
+			return
+		}
+
+		override := strings.TrimSpace(c.GetHeader(service.HeaderGroupOverride))
+		group, err := keyConfig.RouteGroup(override)
+		if err != nil {
+			logger.Warn("API Key无权访问请求头指定的分组",
+				logger.String("key_id", keyConfig.ID),
+				logger.String("group", override))
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该分组"})
+			c.Abort()
+			return
+		}
+		if group != "" {
+			service.SetGroupInContext(c, group)
+		}
+		c.Next()
+	}
+}
+
 // RequestIDMiddleware 为每个请求注入 request_id 并通过响应头返回
 // - 优先使用客户端的 X-Request-ID
 // - 若无则生成一个UUID（utils.GenerateUUID）
@@ -98,9 +140,14 @@ func requiresAuth(path string, protectedPrefixes []string) bool {
 		}
 	}
 
-	// 兼容分组端点：/:group/v1/...
-	// - /v1/...            -> parts[0] == "v1"
-	// - /group/v1/...      -> parts[1] == "v1"
+	return isAIPath(path)
+}
+
+// isAIPath 是否为 AI API 路径
+// 兼容分组端点：/:group/v1/...
+// - /v1/...            -> parts[0] == "v1"
+// - /group/v1/...      -> parts[1] == "v1"
+func isAIPath(path string) bool {
 	trimmed := strings.TrimPrefix(path, "/")
 	if trimmed == "" {
 		return false
@@ -115,6 +162,39 @@ func requiresAuth(path string, protectedPrefixes []string) bool {
 	return false
 }
 
+// routeScope 受保护路由的访问范围
+type routeScope int
+
+const (
+	scopeAI    routeScope = iota // AI API（/v1、/:group/v1）
+	scopeRead                    // 统计与日志只读接口
+	scopeAdmin                   // 管理接口（tokens/groups/keys/settings 及所有写操作）
+)
+
+// classifyRoute 判断请求所属的访问范围
+func classifyRoute(method, path string) routeScope {
+	if isAIPath(path) {
+		return scopeAI
+	}
+	if method == http.MethodGet && (strings.HasPrefix(path, "/api/stats") || strings.HasPrefix(path, "/api/logs")) {
+		return scopeRead
+	}
+	return scopeAdmin
+}
+
+// roleAllows 检查角色是否可访问指定范围
+func roleAllows(role auth.APIKeyRole, scope routeScope) bool {
+	switch role {
+	case auth.RoleAdmin:
+		return true
+	case auth.RoleViewer:
+		return scope == scopeRead
+	case auth.RoleClient:
+		return scope == scopeAI
+	}
+	return false
+}
+
 // extractAPIKey 提取API密钥的通用逻辑
 func extractAPIKey(c *gin.Context) string {
 	apiKey := c.GetHeader("Authorization")
@@ -143,9 +223,9 @@ func validateAPIKey(c *gin.Context, keyMgr *auth.APIKeyManager) *auth.APIKeyConf
 		return nil
 	}
 
-	keyConfig := keyMgr.Get(providedApiKey)
-	if keyConfig == nil {
-		logger.Error("API Key验证失败")
+	keyConfig, err := keyMgr.Authenticate(providedApiKey)
+	if err != nil {
+		logger.Error("API Key验证失败", logger.Err(err))
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "401"})
 		return nil
 	}
@@ -179,6 +259,73 @@ func GetAPIKeyConfig(c *gin.Context) *auth.APIKeyConfig {
 	return keyConfig
 }
 
+// APIKeyQuotaMiddleware API Key 配额中间件
+// 对 AI API 的非 GET 请求执行每分钟请求数、并发、token 与 credit 配额，请求结束后累计用量
+func APIKeyQuotaMiddleware(quota *auth.KeyQuotaTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keyConfig := GetAPIKeyConfig(c)
+		if keyConfig == nil || c.Request.Method == http.MethodGet || !isAIPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		release, err := quota.Acquire(keyConfig)
+		if err != nil {
+			logger.Warn("API Key配额超限",
+				logger.String("key_id", keyConfig.ID),
+				logger.String("path", c.Request.URL.Path),
+				logger.Err(err))
+			respondQuotaExceeded(c, err)
+			c.Abort()
+			return
+		}
+		defer release()
+
+		c.Next()
+
+		var tokens int64
+		if v, ok := c.Get("stats_input_tokens"); ok {
+			tokens += int64(v.(int))
+		}
+		if v, ok := c.Get("stats_output_tokens"); ok {
+			tokens += int64(v.(int))
+		}
+		var credit float64
+		if v, ok := c.Get("stats_credit_usage"); ok {
+			credit = v.(float64)
+		}
+		quota.Record(keyConfig.ID, tokens, credit)
+	}
+}
+
+// quotaHeaderNames 配额类型对应的限流响应头名称
+var quotaHeaderNames = map[string]string{
+	auth.QuotaRequests:      "requests",
+	auth.QuotaConcurrency:   "concurrent-requests",
+	auth.QuotaDailyTokens:   "tokens",
+	auth.QuotaMonthlyTokens: "tokens",
+	auth.QuotaDailyCredit:   "credits",
+}
+
+// respondQuotaExceeded 返回 Anthropic 风格的 rate_limit_error 与重置时间响应头
+func respondQuotaExceeded(c *gin.Context, err error) {
+	retryAfter := 1
+	if qe, ok := err.(*auth.QuotaExceededError); ok {
+		prefix := "anthropic-ratelimit-" + quotaHeaderNames[qe.Kind]
+		c.Header(prefix+"-limit", strconv.FormatFloat(qe.Limit, 'f', -1, 64))
+		c.Header(prefix+"-remaining", "0")
+		if !qe.ResetAt.IsZero() {
+			c.Header(prefix+"-reset", qe.ResetAt.UTC().Format(time.RFC3339))
+			retryAfter = max(int(math.Ceil(time.Until(qe.ResetAt).Seconds())), 1)
+		}
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"type":  "error",
+		"error": gin.H{"type": "rate_limit_error", "message": err.Error()},
+	})
+}
+
 // StatsMiddleware 统计中间件 - 记录请求信息
 func StatsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -279,8 +426,8 @@ func StatsMiddleware() gin.HandlerFunc {
 		if record.CreditUsage > 0 || record.ContextUsagePercent > 0 {
 			// 根据 contextUsagePercent 计算实际 input tokens
 			// 注意: contextUsagePercent 是百分比形式 (如 22.5 表示 22.5%)
-			// 公式: contextUsagePercent / 100 × 200000 = actual input tokens
-			actualInputTokens := int(record.ContextUsagePercent / 100 * 200000)
+			// 公式: contextUsagePercent / 100 × 上下文窗口 = actual input tokens
+			actualInputTokens := int(record.ContextUsagePercent / 100 * float64(config.GetModelRegistry().ContextWindow(record.Model)))
 
 			// 根据 credit 反推 output tokens
 			// 公式: credit = (input × inputPrice + output × outputPrice) / 1,000,000
@@ -288,18 +435,15 @@ func StatsMiddleware() gin.HandlerFunc {
 			var calculatedOutputTokens int
 			if record.CreditUsage > 0 && actualInputTokens > 0 {
 				// 获取模型定价
-				pricing := config.GetModelPricing(record.Model)
-				calculatedOutputTokens = int((record.CreditUsage*1000000 - float64(actualInputTokens)*pricing.InputPrice) / pricing.OutputPrice)
-				if calculatedOutputTokens < 0 {
-					calculatedOutputTokens = 0 // 可能是缓存命中，input 成本降低
-				}
+				pricing := config.GetModelRegistry().Pricing(record.Model)
+				calculatedOutputTokens = pricing.OutputTokensFromCredit(record.CreditUsage, actualInputTokens)
 			}
 
 			// 检测缓存命中：基于 Anthropic Prompt Caching 计价规则
 			var cacheHit bool
 			if record.CreditUsage > 0 && actualInputTokens > 0 && calculatedOutputTokens >= 0 {
 				// 获取模型定价
-				pricing := config.GetModelPricing(record.Model)
+				pricing := config.GetModelRegistry().Pricing(record.Model)
 
 				// 计算期望 credit（无缓存）
 				expectedCredit := float64(actualInputTokens)*pricing.InputPrice/1000000 + float64(calculatedOutputTokens)*pricing.OutputPrice/1000000
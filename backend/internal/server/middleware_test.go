@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"kiro2api/internal/auth"
+	"kiro2api/internal/service"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -16,6 +17,7 @@ func createTestKeyManager(token string) *auth.APIKeyManager {
 	keyMgr.AddKey(auth.APIKeyConfig{
 		Key:  token,
 		Name: "test",
+		Role: auth.RoleAdmin,
 	})
 	return keyMgr
 }
@@ -172,3 +174,132 @@ func TestPathBasedAuthMiddleware_MultipleProtectedPrefixes(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestPathBasedAuthMiddleware_RoleEnforcement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keyMgr := auth.NewAPIKeyManager(nil)
+	keyMgr.AddKey(auth.APIKeyConfig{Key: "admin-key", Role: auth.RoleAdmin})
+	keyMgr.AddKey(auth.APIKeyConfig{Key: "viewer-key", Role: auth.RoleViewer})
+	keyMgr.AddKey(auth.APIKeyConfig{Key: "client-key"}) // 默认 client
+
+	router := gin.New()
+	router.Use(PathBasedAuthMiddleware(keyMgr, []string{"/v1", "/api/tokens", "/api/stats", "/api/logs", "/api/keys"}))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.POST("/v1/messages", ok)
+	router.POST("/:group/v1/messages", ok)
+	router.GET("/api/tokens", ok)
+	router.POST("/api/keys", ok)
+	router.GET("/api/stats", ok)
+	router.GET("/api/logs", ok)
+	router.DELETE("/api/logs", ok)
+
+	cases := []struct {
+		key    string
+		method string
+		path   string
+		want   int
+	}{
+		{"client-key", "POST", "/v1/messages", http.StatusOK},
+		{"client-key", "POST", "/team/v1/messages", http.StatusOK},
+		{"client-key", "GET", "/api/tokens", http.StatusForbidden},
+		{"client-key", "POST", "/api/keys", http.StatusForbidden},
+		{"client-key", "GET", "/api/stats", http.StatusForbidden},
+		{"viewer-key", "GET", "/api/stats", http.StatusOK},
+		{"viewer-key", "GET", "/api/logs", http.StatusOK},
+		{"viewer-key", "DELETE", "/api/logs", http.StatusForbidden},
+		{"viewer-key", "GET", "/api/tokens", http.StatusForbidden},
+		{"viewer-key", "POST", "/v1/messages", http.StatusForbidden},
+		{"admin-key", "GET", "/api/tokens", http.StatusOK},
+		{"admin-key", "POST", "/api/keys", http.StatusOK},
+		{"admin-key", "POST", "/v1/messages", http.StatusOK},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.key)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tc.want, w.Code, "%s %s %s", tc.key, tc.method, tc.path)
+	}
+}
+
+func TestAPIKeyQuotaMiddleware_RateLimitError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keyMgr := auth.NewAPIKeyManager(nil)
+	keyMgr.AddKey(auth.APIKeyConfig{Key: "limited-key", Limits: auth.APIKeyLimits{RPM: 1, DailyTokens: 100}})
+
+	router := gin.New()
+	router.Use(PathBasedAuthMiddleware(keyMgr, []string{"/v1"}))
+	router.Use(APIKeyQuotaMiddleware(keyMgr.Quota()))
+	router.POST("/v1/messages", func(c *gin.Context) {
+		c.Set("stats_input_tokens", 60)
+		c.Set("stats_output_tokens", 50)
+		c.Status(http.StatusOK)
+	})
+	router.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("x-api-key", "limited-key")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/messages").Code)
+
+	w := send("POST", "/v1/messages")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), `"rate_limit_error"`)
+	assert.Equal(t, "1", w.Header().Get("anthropic-ratelimit-requests-limit"))
+	assert.NotEmpty(t, w.Header().Get("anthropic-ratelimit-requests-reset"))
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// GET 请求不计入配额
+	assert.Equal(t, http.StatusOK, send("GET", "/v1/models").Code)
+
+	cfg := keyMgr.Get("limited-key")
+	assert.Equal(t, int64(110), keyMgr.Quota().Usage(cfg.ID).DailyTokens)
+}
+
+func TestKeyGroupMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keyMgr := auth.NewAPIKeyManager(nil)
+	keyMgr.AddKey(auth.APIKeyConfig{Key: "team-key", AllowedGroups: []string{"team", "pro"}, DefaultGroup: "team"})
+
+	router := gin.New()
+	router.Use(PathBasedAuthMiddleware(keyMgr, []string{"/v1"}))
+	router.Use(KeyGroupMiddleware())
+	echo := func(c *gin.Context) { c.String(http.StatusOK, service.GetGroupFromContext(c)) }
+	router.POST("/v1/messages", echo)
+	router.POST("/:group/v1/messages", echo)
+
+	send := func(path, header string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("x-api-key", "team-key")
+		if header != "" {
+			req.Header.Set(service.HeaderGroupOverride, header)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("/v1/messages", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "team", w.Body.String())
+
+	w = send("/v1/messages", "pro")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "pro", w.Body.String())
+
+	w = send("/v1/messages", "other")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 分组前缀路由不受请求头影响
+	w = send("/pro/v1/messages", "other")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Body.String())
+}
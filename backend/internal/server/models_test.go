@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kiro2api/internal/auth"
+	"kiro2api/internal/config"
+	"kiro2api/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newModelsTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("api_key_config", &auth.APIKeyConfig{ID: "key_test"}) // 分组路由需要已认证的 key
+	})
+	registerAPIRoutes(r, nil, auth.NewAPIKeyManager(nil))
+	return r
+}
+
+func TestModelsRoutes_AnthropicPagination(t *testing.T) {
+	r := newModelsTestRouter()
+	total := len(config.GetModelRegistry().List())
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/models?limit=2", nil)
+	req.Header.Set("x-api-key", "k")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page types.AnthropicModelsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(t, page.Data, 2)
+	assert.True(t, page.HasMore)
+	assert.Equal(t, "model", page.Data[0].Type)
+	assert.NotEmpty(t, page.Data[0].CreatedAt)
+	assert.Equal(t, page.Data[1].ID, *page.LastID)
+
+	// 翻到最后一页
+	seen := len(page.Data)
+	for page.HasMore {
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, "/v1/models?limit=5&after_id="+*page.LastID, nil)
+		req.Header.Set("anthropic-version", "2023-06-01")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		page = types.AnthropicModelsResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		seen += len(page.Data)
+	}
+	assert.Equal(t, total, seen)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models?limit=0", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestModelsRoutes_OpenAIListAndRetrieve(t *testing.T) {
+	r := newModelsTestRouter()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer k")
+	r.ServeHTTP(w, req)
+
+	var list types.ModelsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, "list", list.Object)
+	assert.Len(t, list.Data, len(config.GetModelRegistry().List()), "OpenAI 客户端默认返回全部模型")
+	assert.False(t, list.HasMore)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models/claude-sonnet-4-5", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var model types.Model
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &model))
+	assert.Equal(t, "model", model.Object)
+	assert.Equal(t, "claude-sonnet-4-5", model.ID)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/default/v1/models/claude-sonnet-4-5", nil)
+	req.Header.Set("x-api-key", "k")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var anthropicModel types.AnthropicModel
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &anthropicModel))
+	assert.Equal(t, "claude-sonnet-4-5", anthropicModel.ID)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models/unknown-model", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
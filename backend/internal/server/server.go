@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"kiro2api/internal/auth"
+	"kiro2api/internal/batch"
 	"kiro2api/internal/config"
 	"kiro2api/internal/logger"
 	"kiro2api/internal/server/handler"
@@ -23,7 +24,7 @@ func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, DELETE, PATCH, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, x-api-key")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, x-api-key, X-Kiro-Group")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusOK)
@@ -36,7 +37,7 @@ func corsMiddleware() gin.HandlerFunc {
 
 // ========== 新版：依赖注入 ==========
 
-// Start 启动服务器（依赖注入版本）
+// Start 启动服务器（依赖注入版本），收到退出信号并优雅关闭后返回
 func Start(port string, authService *auth.AuthService) {
 	// 设置 gin 模式
 	ginMode := os.Getenv("GIN_MODE")
@@ -50,8 +51,9 @@ func Start(port string, authService *auth.AuthService) {
 	burst := service.DefaultRateLimitBurst
 	rateLimiter := service.NewRateLimiter(qps, burst)
 
-	// 创建设置管理器
-	settingsMgr := config.NewSettingsManager(auth.GetDB(), qps, burst)
+	// 初始化全局设置管理器（执行器、Token 池与 handler 共用）
+	config.InitDefaultSettingsManager(auth.GetDB(), qps, burst)
+	settingsMgr := config.GetDefaultSettingsManager()
 	if err := settingsMgr.Load(); err != nil {
 		logger.Warn("加载设置失败，使用默认值", logger.Err(err))
 	} else {
@@ -66,23 +68,36 @@ func Start(port string, authService *auth.AuthService) {
 		}
 	}
 
-	// 创建分组管理器
-	groupMgr := auth.NewGroupManager(auth.NewTokenRepository(auth.GetDB()))
+	// 模型注册表（首次启动写入内置模型）
+	if err := config.InitDefaultModelRegistry(auth.GetDB()); err != nil {
+		logger.Warn("加载模型注册表失败，使用内置模型", logger.Err(err))
+	}
+
+	// 分组管理器与 Token 池共享，分组设置修改即时生效
+	groupMgr := authService.GetGroupManager()
+	rateLimiter.SetGroupSettingsResolver(authService.GetGroupSettings)
 
 	// 创建统计收集器
 	statsCollector := stats.NewCollector(stats.GetLogDB())
 
+	// 创建 API Key 管理器
+	keyMgr := auth.NewAPIKeyManager(auth.GetDB())
+
+	// 批处理管理器（请求经内部管线执行，重启后继续未完成的批处理）
+	batchMgr := batch.NewManager(auth.GetDB(),
+		newBatchExecutor(authService, keyMgr, rateLimiter),
+		utils.GetEnvIntWithDefault("BATCH_WORKERS", batch.DefaultWorkers))
+
 	// 初始化 handler context
 	handler.InitContext(&handler.Context{
 		RateLimiter:    rateLimiter,
 		SettingsMgr:    settingsMgr,
 		GroupMgr:       groupMgr,
 		StatsCollector: statsCollector,
+		RoutingTable:   auth.NewRoutingTable(auth.GetDB()),
+		Batches:        batchMgr,
 	})
 
-	// 创建 API Key 管理器
-	keyMgr := auth.NewAPIKeyManager(auth.GetDB())
-
 	r := gin.New()
 
 	// 添加中间件
@@ -90,9 +105,11 @@ func Start(port string, authService *auth.AuthService) {
 	r.Use(gin.Recovery())
 	r.Use(RequestIDMiddleware())
 	r.Use(corsMiddleware())
-	r.Use(PathBasedAuthMiddleware(keyMgr, []string{"/v1", "/api/tokens", "/api/groups", "/api/settings", "/api/stats", "/api/keys"}))
+	r.Use(PathBasedAuthMiddleware(keyMgr, []string{"/v1", "/api/tokens", "/api/groups", "/api/settings", "/api/stats", "/api/logs", "/api/keys", "/api/routing", "/api/models"}))
+	r.Use(KeyGroupMiddleware())
 	r.Use(rateLimiter.Middleware())
 	r.Use(StatsMiddleware())
+	r.Use(APIKeyQuotaMiddleware(keyMgr.Quota()))
 
 	// 静态资源
 	r.Static("/static", "./static")
@@ -104,6 +121,15 @@ func Start(port string, authService *auth.AuthService) {
 
 	// 健康检查端点（无需认证）
 	r.GET("/health", func(c *gin.Context) {
+		// 退出流程中报告未就绪，负载均衡据此摘除实例
+		if shuttingDown.Load() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status":    "shutting_down",
+				"timestamp": time.Now().Format(time.RFC3339),
+			})
+			return
+		}
+
 		uptime := time.Since(startTime).Seconds()
 
 		// 检查数据库连接
@@ -147,6 +173,7 @@ func Start(port string, authService *auth.AuthService) {
 
 	// API 路由
 	registerAPIRoutes(r, authService, keyMgr)
+	batchMgr.Start()
 
 	logger.Info("启动服务器",
 		logger.String("port", port),
@@ -158,10 +185,15 @@ func Start(port string, authService *auth.AuthService) {
 		Handler: r,
 	}
 
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.Error("启动服务器失败", logger.Err(err))
-		os.Exit(1)
-	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("启动服务器失败", logger.Err(err))
+			os.Exit(1)
+		}
+	}()
+
+	// 阻塞直到收到退出信号并完成优雅关闭
+	waitForShutdown(server, statsCollector, batchMgr)
 }
 
 // registerAPIRoutes 注册 API 路由
@@ -173,6 +205,7 @@ func registerAPIRoutes(r *gin.Engine, authService *auth.AuthService, keyMgr *aut
 	r.DELETE("/api/tokens/:id", func(c *gin.Context) { handler.DeleteToken(c, authService) })
 	r.PATCH("/api/tokens/:id", func(c *gin.Context) { handler.UpdateToken(c, authService) })
 	r.PUT("/api/tokens/:id/move", func(c *gin.Context) { handler.MoveToken(c, authService) })
+	r.POST("/api/tokens/:id/breaker/reset", func(c *gin.Context) { handler.ResetTokenBreaker(c, authService) })
 
 	// 分组管理
 	r.GET("/api/groups", func(c *gin.Context) { handler.ListGroups(c, authService) })
@@ -191,8 +224,21 @@ func registerAPIRoutes(r *gin.Engine, authService *auth.AuthService, keyMgr *aut
 	// API Key 管理
 	r.GET("/api/keys", func(c *gin.Context) { handler.GetAPIKeys(c, keyMgr) })
 	r.POST("/api/keys", func(c *gin.Context) { handler.CreateAPIKey(c, keyMgr) })
-	r.PATCH("/api/keys/:key", func(c *gin.Context) { handler.UpdateAPIKey(c, keyMgr) })
-	r.DELETE("/api/keys/:key", func(c *gin.Context) { handler.DeleteAPIKey(c, keyMgr) })
+	r.PATCH("/api/keys/:id", func(c *gin.Context) { handler.UpdateAPIKey(c, keyMgr) })
+	r.POST("/api/keys/:id/rotate", func(c *gin.Context) { handler.RotateAPIKey(c, keyMgr) })
+	r.DELETE("/api/keys/:id", func(c *gin.Context) { handler.DeleteAPIKey(c, keyMgr) })
+
+	// 模型注册表
+	r.GET("/api/models", handler.ListRegisteredModels)
+	r.POST("/api/models", handler.CreateRegisteredModel)
+	r.PUT("/api/models/:id", handler.UpdateRegisteredModel)
+	r.DELETE("/api/models/:id", handler.DeleteRegisteredModel)
+
+	// 路由规则管理
+	r.GET("/api/routing", handler.ListRoutingRules)
+	r.POST("/api/routing", handler.CreateRoutingRule)
+	r.PUT("/api/routing/:id", handler.UpdateRoutingRule)
+	r.DELETE("/api/routing/:id", handler.DeleteRoutingRule)
 
 	// 统计
 	apiGroup := r.Group("/api")
@@ -200,9 +246,20 @@ func registerAPIRoutes(r *gin.Engine, authService *auth.AuthService, keyMgr *aut
 
 	// AI API
 	r.GET("/v1/models", handler.HandleModels)
-	r.POST("/v1/messages", func(c *gin.Context) { handler.HandleMessages(c, authService, "") })
+	r.GET("/v1/models/:id", handler.HandleModel)
+	// 未带分组前缀时使用 KeyGroupMiddleware 选择的分组（空 = 全局默认分组）
+	r.POST("/v1/messages", func(c *gin.Context) { handler.HandleMessages(c, authService, service.GetGroupFromContext(c)) })
 	r.POST("/v1/messages/count_tokens", handler.HandleCountTokens)
-	r.POST("/v1/chat/completions", func(c *gin.Context) { handler.HandleChatCompletions(c, authService, "") })
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		handler.HandleChatCompletions(c, authService, service.GetGroupFromContext(c))
+	})
+	r.POST("/v1/responses", func(c *gin.Context) {
+		handler.HandleResponses(c, authService, service.GetGroupFromContext(c))
+	})
+	r.POST("/v1/messages/batches", func(c *gin.Context) { handler.CreateMessageBatch(c, "") })
+	r.GET("/v1/messages/batches/:id", handler.GetMessageBatch)
+	r.GET("/v1/messages/batches/:id/results", handler.GetMessageBatchResults)
+	r.POST("/v1/messages/batches/:id/cancel", handler.CancelMessageBatch)
 
 	// 分组 AI API
 	r.POST("/:group/v1/messages", func(c *gin.Context) {
@@ -229,6 +286,66 @@ func registerAPIRoutes(r *gin.Engine, authService *auth.AuthService, keyMgr *aut
 		}
 		handler.HandleChatCompletions(c, authService, group)
 	})
+	r.POST("/:group/v1/responses", func(c *gin.Context) {
+		group := c.Param("group")
+		if group == "api" || group == "static" {
+			c.Next()
+			return
+		}
+		if !CheckGroupPermission(c, group) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该分组"})
+			return
+		}
+		handler.HandleResponses(c, authService, group)
+	})
+	r.POST("/:group/v1/messages/batches", func(c *gin.Context) {
+		group := c.Param("group")
+		if group == "api" || group == "static" {
+			c.Next()
+			return
+		}
+		if !CheckGroupPermission(c, group) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该分组"})
+			return
+		}
+		handler.CreateMessageBatch(c, group)
+	})
+	r.GET("/:group/v1/messages/batches/:id", func(c *gin.Context) {
+		group := c.Param("group")
+		if group == "api" || group == "static" {
+			c.Next()
+			return
+		}
+		if !CheckGroupPermission(c, group) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该分组"})
+			return
+		}
+		handler.GetMessageBatch(c)
+	})
+	r.GET("/:group/v1/messages/batches/:id/results", func(c *gin.Context) {
+		group := c.Param("group")
+		if group == "api" || group == "static" {
+			c.Next()
+			return
+		}
+		if !CheckGroupPermission(c, group) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该分组"})
+			return
+		}
+		handler.GetMessageBatchResults(c)
+	})
+	r.POST("/:group/v1/messages/batches/:id/cancel", func(c *gin.Context) {
+		group := c.Param("group")
+		if group == "api" || group == "static" {
+			c.Next()
+			return
+		}
+		if !CheckGroupPermission(c, group) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该分组"})
+			return
+		}
+		handler.CancelMessageBatch(c)
+	})
 	r.GET("/:group/v1/models", func(c *gin.Context) {
 		group := c.Param("group")
 		if group == "api" || group == "static" {
@@ -241,4 +358,16 @@ func registerAPIRoutes(r *gin.Engine, authService *auth.AuthService, keyMgr *aut
 		}
 		handler.HandleModels(c)
 	})
+	r.GET("/:group/v1/models/:id", func(c *gin.Context) {
+		group := c.Param("group")
+		if group == "api" || group == "static" {
+			c.Next()
+			return
+		}
+		if !CheckGroupPermission(c, group) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该分组"})
+			return
+		}
+		handler.HandleModel(c)
+	})
 }
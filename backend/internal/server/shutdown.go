@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"kiro2api/internal/batch"
+	"kiro2api/internal/logger"
+	"kiro2api/internal/stats"
+	"kiro2api/internal/utils"
+)
+
+const (
+	// defaultShutdownTimeoutSec 等待进行中请求（含流式）完成的默认时长
+	defaultShutdownTimeoutSec = 30
+	// statsDrainTimeout 退出时等待统计队列写完的最长时间
+	statsDrainTimeout = 5 * time.Second
+)
+
+// shuttingDown 进入退出流程后为 true，/health 返回未就绪
+var shuttingDown atomic.Bool
+
+// shutdownConfig 优雅退出配置
+type shutdownConfig struct {
+	timeout    time.Duration // 等待进行中请求完成的最长时间
+	readyDelay time.Duration // 报告未就绪后、停止接收请求前的等待（供负载均衡摘除实例）
+}
+
+// loadShutdownConfig 从环境变量读取优雅退出配置
+func loadShutdownConfig() shutdownConfig {
+	return shutdownConfig{
+		timeout:    time.Duration(utils.GetEnvIntWithDefault("SHUTDOWN_TIMEOUT_SEC", defaultShutdownTimeoutSec)) * time.Second,
+		readyDelay: time.Duration(utils.GetEnvIntWithDefault("SHUTDOWN_READY_DELAY_SEC", 0)) * time.Second,
+	}
+}
+
+// waitForShutdown 阻塞直到收到 SIGINT/SIGTERM，然后优雅关闭服务器
+func waitForShutdown(srv *http.Server, collector *stats.Collector, batches *batch.Manager) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	<-ctx.Done()
+	// 恢复默认信号处理：再次收到信号时直接退出
+	stop()
+
+	logger.Info("收到退出信号，开始优雅关闭")
+	gracefulShutdown(srv, collector, batches, loadShutdownConfig())
+}
+
+// gracefulShutdown 优雅关闭：报告未就绪 → 停止接收请求并等待进行中的流结束 → 停止批处理 → 写完统计队列
+func gracefulShutdown(srv *http.Server, collector *stats.Collector, batches *batch.Manager, cfg shutdownConfig) {
+	shuttingDown.Store(true)
+	if cfg.readyDelay > 0 {
+		time.Sleep(cfg.readyDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		// 超过期限仍未结束的连接强制断开
+		logger.Warn("等待进行中请求超时，强制关闭连接",
+			logger.Err(err),
+			logger.Duration("timeout", cfg.timeout))
+		srv.Close()
+	} else {
+		logger.Info("进行中请求已全部完成")
+	}
+
+	// 执行中的批处理请求被中断后保持 pending，下次启动继续
+	if batches != nil {
+		batches.Stop()
+	}
+
+	if collector != nil {
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), statsDrainTimeout)
+		defer drainCancel()
+		if err := collector.Close(drainCtx); err != nil {
+			logger.Warn("统计队列未能全部写入", logger.Err(err))
+		}
+	}
+}
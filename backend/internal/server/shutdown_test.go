@@ -0,0 +1,63 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"kiro2api/internal/stats"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGracefulShutdown_WaitsForInFlightRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Cleanup(func() { shuttingDown.Store(false) })
+
+	started := make(chan struct{})
+	r := gin.New()
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	srv := &http.Server{Handler: r}
+	go srv.Serve(ln)
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		resultCh <- result{status: resp.StatusCode, body: string(body)}
+	}()
+
+	<-started
+	collector := stats.NewCollector(nil)
+	gracefulShutdown(srv, collector, nil, shutdownConfig{timeout: 2 * time.Second})
+
+	res := <-resultCh
+	assert.NoError(t, res.err)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "done", res.body)
+	assert.True(t, shuttingDown.Load())
+
+	// 关闭后不再接收新连接
+	_, err = http.Get("http://" + ln.Addr().String() + "/slow")
+	assert.Error(t, err)
+}
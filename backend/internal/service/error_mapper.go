@@ -20,12 +20,15 @@ type ClaudeErrorResponse struct {
 	Type       string `json:"type"`
 	Message    string `json:"message"`
 	StopReason string `json:"stop_reason,omitempty"` // 用于内容长度超限等情况
+	StatusCode int    `json:"-"`                     // 返回客户端的状态码（0 = 默认处理）
+	Code       string `json:"-"`                     // 返回客户端的错误代码
 }
 
 // CodeWhispererErrorBody AWS CodeWhisperer错误响应体
 type CodeWhispererErrorBody struct {
 	Message string `json:"message"`
 	Reason  string `json:"reason"`
+	Type    string `json:"__type"`
 }
 
 // ContentLengthExceedsStrategy 内容长度超限错误映射策略 (SRP原则)
@@ -81,6 +84,9 @@ func NewErrorMapper() *ErrorMapper {
 	return &ErrorMapper{
 		strategies: []ErrorMappingStrategy{
 			&ContentLengthExceedsStrategy{}, // 优先处理特定错误
+			&QuotaExhaustedStrategy{},       // 额度耗尽
+			&CapacityStrategy{},             // 上游容量不足
+			&ThrottlingStrategy{},           // 限流
 			&DefaultErrorStrategy{},         // 默认处理器
 		},
 	}
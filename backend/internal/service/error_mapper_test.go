@@ -156,11 +156,14 @@ func TestNewErrorMapper(t *testing.T) {
 
 	assert.NotNil(t, mapper)
 	assert.NotNil(t, mapper.strategies)
-	assert.Len(t, mapper.strategies, 2, "应该有2个策略")
+	assert.Len(t, mapper.strategies, 5, "应该有5个策略")
 
 	// 验证策略顺序
 	assert.IsType(t, &ContentLengthExceedsStrategy{}, mapper.strategies[0], "第一个应该是ContentLengthExceedsStrategy")
-	assert.IsType(t, &DefaultErrorStrategy{}, mapper.strategies[1], "第二个应该是DefaultErrorStrategy")
+	assert.IsType(t, &QuotaExhaustedStrategy{}, mapper.strategies[1])
+	assert.IsType(t, &CapacityStrategy{}, mapper.strategies[2])
+	assert.IsType(t, &ThrottlingStrategy{}, mapper.strategies[3])
+	assert.IsType(t, &DefaultErrorStrategy{}, mapper.strategies[4], "最后一个应该是DefaultErrorStrategy")
 }
 
 // TestErrorMapper_MapCodeWhispererError 测试映射CodeWhisperer错误
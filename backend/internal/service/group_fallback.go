@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+
+	"kiro2api/internal/auth"
+	"kiro2api/internal/logger"
+	"kiro2api/internal/stats"
+	"kiro2api/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// HeaderServedGroup 响应头：实际服务请求的分组
+	HeaderServedGroup = "X-Kiro-Served-Group"
+	// HeaderGroupOverride 请求头：未带分组前缀的请求指定分组（需在 API Key 的 AllowedGroups 内）
+	HeaderGroupOverride = "X-Kiro-Group"
+)
+
+// fallbackChainProvider 分组降级链提供者
+type fallbackChainProvider interface {
+	GetFallbackChain(group string) []string
+}
+
+// resolveGroupChain 计算请求可用的分组链
+// 首位为请求分组（路由层已校验权限），后续降级分组按 API Key 的 AllowedGroups 过滤
+func resolveGroupChain(c *gin.Context, provider fallbackChainProvider, group string) []string {
+	if group == "" {
+		group = auth.GetDefaultGroup()
+	}
+	chain := provider.GetFallbackChain(group)
+	if len(chain) == 0 {
+		return []string{group}
+	}
+
+	var keyConfig *auth.APIKeyConfig
+	if v, exists := c.Get("api_key_config"); exists {
+		keyConfig, _ = v.(*auth.APIKeyConfig)
+	}
+
+	result := []string{chain[0]}
+	for _, g := range chain[1:] {
+		if keyConfig != nil && !keyConfig.HasGroupPermission(g) {
+			logger.Debug("跳过无权限的降级分组",
+				AddReqFields(c, logger.String("group", g))...)
+			continue
+		}
+		result = append(result, g)
+	}
+	return result
+}
+
+// setServedGroup 记录实际服务请求的分组（上下文、统计、响应头）
+func setServedGroup(c *gin.Context, group string) {
+	SetGroupInContext(c, group)
+	stats.SetGroup(c, group)
+	c.Header(HeaderServedGroup, group)
+}
+
+// getTokenWithFallback 沿分组降级链获取 token，返回实际使用的分组
+// model 非空时跳过已知不支持该模型的 token
+func getTokenWithFallback(c *gin.Context, authService AuthServiceForRetry, group string, model string) (types.TokenInfo, string, error) {
+	var lastErr error
+	for i, g := range resolveGroupChain(c, authService, group) {
+		token, err := authService.GetTokenForModel(g, model)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if i > 0 {
+			logger.Warn("分组无可用Token，降级到备用分组",
+				AddReqFields(c,
+					logger.String("from_group", group),
+					logger.String("to_group", g),
+				)...)
+		}
+		setServedGroup(c, g)
+		return token, g, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("分组 %s 没有可用的 Token", group)
+	}
+	return types.TokenInfo{}, group, lastErr
+}
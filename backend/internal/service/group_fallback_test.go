@@ -0,0 +1,48 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"kiro2api/internal/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubChainProvider map[string][]string
+
+func (p stubChainProvider) GetFallbackChain(group string) []string {
+	return p[group]
+}
+
+func TestResolveGroupChain_FiltersByAPIKeyPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("api_key_config", &auth.APIKeyConfig{Key: "k", AllowedGroups: []string{"pro", "overflow"}})
+
+	provider := stubChainProvider{"pro": {"pro", "default", "overflow"}}
+
+	assert.Equal(t, []string{"pro", "overflow"}, resolveGroupChain(c, provider, "pro"))
+}
+
+func TestResolveGroupChain_NoKeyConfigKeepsChain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	provider := stubChainProvider{"pro": {"pro", "default"}}
+
+	assert.Equal(t, []string{"pro", "default"}, resolveGroupChain(c, provider, "pro"))
+	assert.Equal(t, []string{"missing"}, resolveGroupChain(c, provider, "missing"))
+}
+
+func TestSetServedGroup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	setServedGroup(c, "overflow")
+
+	assert.Equal(t, "overflow", GetGroupFromContext(c))
+	assert.Equal(t, "overflow", w.Header().Get(HeaderServedGroup))
+}
@@ -2,8 +2,15 @@ package service
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"sync"
+	"time"
+
+	"kiro2api/internal/auth"
+	"kiro2api/internal/config"
+	"kiro2api/internal/logger"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
@@ -11,7 +18,9 @@ import (
 
 // RateLimiter 全局请求限流器
 type RateLimiter struct {
-	limiter *rate.Limiter
+	limiter       *rate.Limiter
+	queue         priorityQueue
+	groupSettings func(group string) auth.GroupSettings // 分组设置查询（可选）
 }
 
 // NewRateLimiter 创建限流器
@@ -38,27 +47,123 @@ func (rl *RateLimiter) Middleware() gin.HandlerFunc {
 			return
 		}
 
-		// 尝试获取令牌
-		if !rl.limiter.Allow() {
-			// 计算重试等待时间
-			reservation := rl.limiter.Reserve()
-			delay := reservation.Delay()
-			reservation.Cancel() // 取消预约，不消耗令牌
-
-			c.Header("Retry-After", strconv.Itoa(int(delay.Seconds())+1))
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"type":    "error",
-				"error":   gin.H{"type": "rate_limit_error", "message": "请求过于频繁，请稍后重试"},
-				"message": "rate limit exceeded",
-			})
+		// 分组覆盖了限流时使用分组限流器，否则使用全局限流器
+		// 路由、回退改变分组后由 executeWithRetry 按最终分组复核
+		limiter, priority := rl.limiterFor(requestGroup(c))
+		if err := limiter.admit(c.Request.Context(), priority); err != nil {
+			respondRateLimited(c, limiter)
 			c.Abort()
 			return
 		}
+		c.Set(contextKeyRateLimit, &rateLimitCharge{global: rl, limiter: limiter})
 
 		c.Next()
 	}
 }
 
+// contextKeyRateLimit 请求已扣减的限流器
+const contextKeyRateLimit = "rate_limit_charge"
+
+// rateLimitCharge 中间件扣减限流的记录（供路由、回退后复核）
+type rateLimitCharge struct {
+	global  *RateLimiter
+	limiter *RateLimiter
+}
+
+// errRateLimited 限流令牌不足
+var errRateLimited = errors.New("请求过于频繁，请稍后重试")
+
+// requestGroup 中间件阶段的请求分组：路径分组 > X-Kiro-Group / API Key 默认分组 > 全局默认分组
+func requestGroup(c *gin.Context) string {
+	if group := c.Param("group"); group != "" {
+		return group
+	}
+	if group := GetGroupFromContext(c); group != "" {
+		return group
+	}
+	return auth.GetDefaultGroup()
+}
+
+// limiterFor 返回分组使用的限流器与排队优先级（分组未覆盖限流时为全局限流器）
+func (rl *RateLimiter) limiterFor(group string) (*RateLimiter, int) {
+	if rl.groupSettings == nil {
+		return rl, 0
+	}
+	gs := rl.groupSettings(group)
+	if groupLimiter := getGroupLimiter(group, gs, config.GetDefaultSettingsManager().Get()); groupLimiter != nil {
+		return groupLimiter, gs.Priority
+	}
+	return rl, gs.Priority
+}
+
+// admit 获取一个令牌：排队时长为 0 时令牌不足立即拒绝，否则按优先级排队至多 RateLimitQueueWaitMs
+func (rl *RateLimiter) admit(ctx context.Context, priority int) error {
+	wait := time.Duration(config.GetDefaultSettingsManager().Get().RateLimitQueueWaitMs) * time.Millisecond
+	if wait <= 0 {
+		if !rl.queue.tryAcquire(rl.limiter) {
+			return errRateLimited
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	return rl.WaitPriority(ctx, priority)
+}
+
+// recheckGroupRateLimit 按最终分组（路由、回退之后）复核限流，与中间件已扣减的限流器相同时跳过
+// 令牌不足时返回 429 并返回 false
+func recheckGroupRateLimit(c *gin.Context, group string) bool {
+	v, exists := c.Get(contextKeyRateLimit)
+	if !exists {
+		return true
+	}
+	charge, ok := v.(*rateLimitCharge)
+	if !ok {
+		return true
+	}
+	if group == "" {
+		group = auth.GetDefaultGroup()
+	}
+	limiter, priority := charge.global.limiterFor(group)
+	if limiter == charge.limiter {
+		return true
+	}
+	if err := limiter.admit(c.Request.Context(), priority); err != nil {
+		logger.Warn("最终分组限流", AddReqFields(c, logger.String("group", group))...)
+		respondRateLimited(c, limiter)
+		return false
+	}
+	charge.limiter = limiter
+	return true
+}
+
+// respondRateLimited 返回 429 与按令牌恢复时间计算的 Retry-After
+func respondRateLimited(c *gin.Context, rl *RateLimiter) {
+	reservation := rl.limiter.Reserve()
+	delay := reservation.Delay()
+	reservation.Cancel() // 取消预约，不消耗令牌
+
+	c.Header("Retry-After", strconv.Itoa(int(delay.Seconds())+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"type":    "error",
+		"error":   gin.H{"type": "rate_limit_error", "message": errRateLimited.Error()},
+		"message": "rate limit exceeded",
+	})
+}
+
+// SetGroupSettingsResolver 设置分组设置查询函数（启用分组级限流与优先级）
+func (rl *RateLimiter) SetGroupSettingsResolver(fn func(group string) auth.GroupSettings) {
+	rl.groupSettings = fn
+}
+
+// WaitPriority 按优先级排队等待令牌：高优先级先获取，同优先级按到达顺序
+func (rl *RateLimiter) WaitPriority(ctx context.Context, priority int) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return rl.queue.wait(ctx, rl.limiter, priority)
+}
+
 // Wait 阻塞等待直到可以发送请求（用于内部调用）
 func (rl *RateLimiter) Wait(ctx context.Context) error {
 	if ctx == nil {
@@ -85,5 +190,94 @@ func (rl *RateLimiter) Stats() map[string]interface{} {
 // 默认配置
 const (
 	DefaultRateLimitQPS   = 50.0 // 每秒 50 个请求（提高全局限制，因为每个token已有限制）
-	DefaultRateLimitBurst = 100   // 突发容量 100
+	DefaultRateLimitBurst = 100  // 突发容量 100
 )
+
+// priorityQueue 限流等待队列
+// 同一时刻只有队首请求等待令牌，其余请求按优先级（高者优先）、到达顺序排队
+type priorityQueue struct {
+	mu      sync.Mutex
+	waiters []*priorityWaiter
+	busy    bool // 队首请求正在等待令牌
+	seq     uint64
+}
+
+type priorityWaiter struct {
+	priority int
+	seq      uint64
+	turn     chan struct{}
+}
+
+// tryAcquire 无人排队时立即尝试获取令牌（不排队）
+func (q *priorityQueue) tryAcquire(limiter *rate.Limiter) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return !q.busy && len(q.waiters) == 0 && limiter.Allow()
+}
+
+func (q *priorityQueue) wait(ctx context.Context, limiter *rate.Limiter, priority int) error {
+	q.mu.Lock()
+	if !q.busy && len(q.waiters) == 0 && limiter.Allow() {
+		q.mu.Unlock()
+		return nil
+	}
+	w := &priorityWaiter{priority: priority, seq: q.seq, turn: make(chan struct{})}
+	q.seq++
+	q.waiters = append(q.waiters, w)
+	q.dispatchLocked()
+	q.mu.Unlock()
+
+	select {
+	case <-w.turn:
+	case <-ctx.Done():
+		q.mu.Lock()
+		queued := q.removeLocked(w)
+		q.mu.Unlock()
+		if queued {
+			return ctx.Err()
+		}
+		// 取消的同时已轮到本请求，交出队首
+		q.release()
+		return ctx.Err()
+	}
+
+	err := limiter.Wait(ctx)
+	q.release()
+	return err
+}
+
+// dispatchLocked 队首空闲时选出下一个请求
+func (q *priorityQueue) dispatchLocked() {
+	if q.busy || len(q.waiters) == 0 {
+		return
+	}
+	next := 0
+	for i, w := range q.waiters {
+		best := q.waiters[next]
+		if w.priority > best.priority || (w.priority == best.priority && w.seq < best.seq) {
+			next = i
+		}
+	}
+	w := q.waiters[next]
+	q.waiters = append(q.waiters[:next], q.waiters[next+1:]...)
+	q.busy = true
+	close(w.turn)
+}
+
+// removeLocked 移出仍在排队的请求（已轮到时返回 false）
+func (q *priorityQueue) removeLocked(w *priorityWaiter) bool {
+	for i, queued := range q.waiters {
+		if queued == w {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (q *priorityQueue) release() {
+	q.mu.Lock()
+	q.busy = false
+	q.dispatchLocked()
+	q.mu.Unlock()
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"kiro2api/internal/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveLimited 经过限流中间件发送 POST 请求，返回状态码与 Retry-After
+func serveLimited(r *gin.Engine, path string) (int, string) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+	return w.Code, w.Header().Get("Retry-After")
+}
+
+func newLimitedRouter(rl *RateLimiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(rl.Middleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.POST("/v1/messages", ok)
+	r.POST("/:group/v1/messages", ok)
+	return r
+}
+
+func TestRateLimiter_MiddlewareRejectsImmediately(t *testing.T) {
+	r := newLimitedRouter(NewRateLimiter(0.01, 1))
+
+	code, _ := serveLimited(r, "/v1/messages")
+	assert.Equal(t, http.StatusOK, code)
+
+	start := time.Now()
+	code, retryAfter := serveLimited(r, "/v1/messages")
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.NotEmpty(t, retryAfter)
+	assert.Less(t, time.Since(start), time.Second, "未配置排队时长时立即拒绝")
+}
+
+func TestRateLimiter_MiddlewareUsesGroupLimiter(t *testing.T) {
+	rl := NewRateLimiter(0.01, 1)
+	rl.SetGroupSettingsResolver(func(group string) auth.GroupSettings {
+		if group == "mw-pro-test" {
+			return auth.GroupSettings{RateLimitQPS: 100, RateLimitBurst: 5}
+		}
+		return auth.GroupSettings{}
+	})
+	r := newLimitedRouter(rl)
+
+	// 分组限流替代全局限流：可超过全局 QPS
+	for i := 0; i < 3; i++ {
+		code, _ := serveLimited(r, "/mw-pro-test/v1/messages")
+		assert.Equal(t, http.StatusOK, code)
+	}
+
+	code, _ := serveLimited(r, "/v1/messages")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = serveLimited(r, "/v1/messages")
+	assert.Equal(t, http.StatusTooManyRequests, code, "未覆盖限流的分组使用全局限流")
+}
+
+func TestRateLimiter_WaitPriorityOrdersByPriority(t *testing.T) {
+	rl := NewRateLimiter(10, 1)
+	require.NoError(t, rl.WaitPriority(context.Background(), 0)) // 消耗突发令牌
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	start := func(name string, priority int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, rl.WaitPriority(context.Background(), priority))
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		}()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	start("first", 0) // 队首，等待下一个令牌
+	start("low", 0)
+	start("high", 5)
+	wg.Wait()
+
+	assert.Equal(t, []string{"first", "high", "low"}, order)
+}
+
+func TestRateLimiter_WaitPriorityRespectsContext(t *testing.T) {
+	rl := NewRateLimiter(0.1, 1)
+	require.NoError(t, rl.WaitPriority(context.Background(), 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, rl.WaitPriority(ctx, 10))
+
+	// 超时的请求不应占住队首
+	assert.False(t, rl.queue.busy)
+	assert.Empty(t, rl.queue.waiters)
+}
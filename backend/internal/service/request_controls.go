@@ -3,6 +3,9 @@ package service
 import (
 	"context"
 	"sync"
+
+	"kiro2api/internal/auth"
+	"kiro2api/internal/config"
 )
 
 type semaphore struct {
@@ -17,6 +20,8 @@ var (
 	groupSems    = make(map[string]*semaphore)
 	tokenLimitMu sync.Mutex
 	tokenLimit   = make(map[string]*RateLimiter)
+	groupLimitMu sync.Mutex
+	groupLimit   = make(map[string]*RateLimiter)
 )
 
 func acquireSemaphore(ctx context.Context, semMap map[string]*semaphore, key string, cap int, mu *sync.Mutex) (release func(), ok bool) {
@@ -40,20 +45,36 @@ func acquireSemaphore(ctx context.Context, semMap map[string]*semaphore, key str
 	}
 }
 
-func getTokenLimiter(key string, qps float64, burst int) *RateLimiter {
+func getKeyedLimiter(limiters map[string]*RateLimiter, mu *sync.Mutex, key string, qps float64, burst int) *RateLimiter {
 	if key == "" || qps <= 0 || burst <= 0 {
 		return nil
 	}
 
-	tokenLimitMu.Lock()
-	defer tokenLimitMu.Unlock()
+	mu.Lock()
+	defer mu.Unlock()
 
-	rl := tokenLimit[key]
+	rl := limiters[key]
 	if rl == nil {
 		rl = NewRateLimiter(qps, burst)
-		tokenLimit[key] = rl
+		limiters[key] = rl
 		return rl
 	}
 	rl.SetRate(qps, burst)
 	return rl
 }
+
+func getTokenLimiter(key string, qps float64, burst int) *RateLimiter {
+	return getKeyedLimiter(tokenLimit, &tokenLimitMu, key, qps, burst)
+}
+
+// getGroupLimiter 获取分组独立限流器（分组未覆盖限流时返回 nil，沿用全局限流）
+func getGroupLimiter(group string, gs auth.GroupSettings, global config.Settings) *RateLimiter {
+	if !gs.HasRateLimit() {
+		return nil
+	}
+	if group == "" {
+		group = auth.GetDefaultGroup()
+	}
+	eff := gs.Resolve(global)
+	return getKeyedLimiter(groupLimit, &groupLimitMu, group, eff.RateLimitQPS, eff.RateLimitBurst)
+}
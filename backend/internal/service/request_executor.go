@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"kiro2api/internal/auth"
 	"kiro2api/internal/config"
 	"kiro2api/internal/converter"
 	"kiro2api/internal/logger"
@@ -26,7 +27,11 @@ func RespondError(c *gin.Context, statusCode int, format string, args ...any) {
 }
 
 // RespondErrorWithCode 标准化的错误响应结构
+// 流式续写期间不写入（已下发的 SSE 流不能再插入 JSON）
 func RespondErrorWithCode(c *gin.Context, statusCode int, code string, format string, args ...any) {
+	if errorResponseSuppressed(c) {
+		return
+	}
 	errType := types.ErrorTypeFromStatus(statusCode)
 	c.JSON(statusCode, types.NewAPIError(errType, fmt.Sprintf(format, args...), code))
 }
@@ -57,22 +62,28 @@ func ExecuteCodeWhispererRequest(c *gin.Context, anthropicReq types.AnthropicReq
 	}
 
 	settings := config.GetDefaultSettingsManager().Get()
-	ctx, cancel := context.WithTimeout(req.Context(), time.Duration(settings.RequestTimeoutSec)*time.Second)
-	req = req.WithContext(ctx)
+	var groupSettings auth.GroupSettings
+	if authService := GetAuthServiceFromContext(c); authService != nil {
+		groupSettings = authService.GetGroupSettings(GetGroupFromContext(c))
+	}
+	req, wd, cancel := withUpstreamDeadline(req, isStream, settings, groupSettings)
 
 	resp, err := utils.DoRequest(req)
 	if err != nil {
 		cancel()
+		if wd != nil {
+			err = wd.wrapError(err)
+		}
 		handleRequestSendError(c, err)
 		return nil, err
 	}
 
 	resp.Body = &closeFuncReadCloser{
-		ReadCloser: resp.Body,
+		ReadCloser: attachWatchdog(resp.Body, wd),
 		onClose:    cancel,
 	}
 
-	if handleCodeWhispererError(c, resp) {
+	if handleCodeWhispererError(c, resp, tokenInfo, anthropicReq.Model) {
 		resp.Body.Close()
 		return nil, fmt.Errorf("CodeWhisperer API error")
 	}
@@ -91,9 +102,14 @@ var ExecuteCWRequest = executeWithRetry
 
 // AuthServiceForRetry 重试所需的认证服务接口
 type AuthServiceForRetry interface {
-	GetToken(group string) (types.TokenInfo, error)
+	GetTokenForModel(group string, model string) (types.TokenInfo, error)
 	MarkTokenFailed(token types.TokenInfo)
-	RecordRequest(token types.TokenInfo, latency time.Duration, success bool)
+	GetGroupSettings(group string) auth.GroupSettings
+	GetFallbackChain(group string) []string
+	RecordUpstreamResult(token types.TokenInfo, success bool)
+	MarkTokenFailedWithCooldown(token types.TokenInfo, cooldown time.Duration)
+	MarkTokenExhausted(token types.TokenInfo)
+	RecordModelAccess(token types.TokenInfo, model string, supported bool, reason string)
 }
 
 const contextKeyAuthService = "auth_service_for_retry"
@@ -166,6 +182,12 @@ func executeWithRetry(c *gin.Context, anthropicReq types.AnthropicRequest, token
 
 		settings = config.GetDefaultSettingsManager().Get()
 
+		// 路由、回退改变分组后按最终分组复核限流（令牌不足返回 429）
+		if !recheckGroupRateLimit(c, group) {
+			return nil, errRateLimited
+		}
+		groupSettings := authService.GetGroupSettings(group)
+
 		// 并发控制（可选）
 		releaseGroup, ok := acquireSemaphore(req.Context(), groupSems, group, settings.GroupMaxConcurrent, &groupSemMu)
 		if !ok {
@@ -189,27 +211,30 @@ func executeWithRetry(c *gin.Context, anthropicReq types.AnthropicRequest, token
 			}
 		}
 
-		ctx, cancel := context.WithTimeout(req.Context(), time.Duration(settings.RequestTimeoutSec)*time.Second)
-		req = req.WithContext(ctx)
+		req, wd, cancel := withUpstreamDeadline(req, isStream, settings, groupSettings)
 
 		resp, err := utils.DoRequest(req)
 		if err != nil {
 			cancel()
 			releaseToken()
 			releaseGroup()
+			if wd != nil {
+				err = wd.wrapError(err)
+			}
 			lastErr = err
 			authService.MarkTokenFailed(currentToken)
-			newToken, tokenErr := authService.GetToken(group)
+			newToken, servedGroup, tokenErr := getTokenWithFallback(c, authService, group, anthropicReq.Model)
 			if tokenErr != nil {
 				handleRequestSendError(c, err)
 				return nil, err
 			}
 			currentToken = newToken
+			group = servedGroup
 			continue
 		}
 
 		resp.Body = &closeFuncReadCloser{
-			ReadCloser: resp.Body,
+			ReadCloser: attachWatchdog(resp.Body, wd),
 			onClose: func() {
 				cancel()
 				releaseToken()
@@ -217,30 +242,99 @@ func executeWithRetry(c *gin.Context, anthropicReq types.AnthropicRequest, token
 			},
 		}
 
-		if config.IsRetryableStatus(resp.StatusCode) {
+		if resp.StatusCode != http.StatusOK {
+			body, readErr := io.ReadAll(resp.Body)
 			resp.Body.Close()
-			lastErr = fmt.Errorf("retryable status: %d", resp.StatusCode)
-
-			logger.Warn("收到可重试状态码，切换 token",
-				AddReqFields(c,
-					logger.Int("status_code", resp.StatusCode),
-					logger.Int("attempt", attempt),
-				)...)
+			if readErr != nil {
+				logger.Error("读取错误响应失败",
+					AddReqFields(c,
+						logger.String("direction", "upstream_response"),
+						logger.Err(readErr),
+					)...)
+				RespondError(c, http.StatusInternalServerError, "%s", "读取响应失败")
+				return nil, readErr
+			}
 
-			authService.MarkTokenFailed(currentToken)
-			newToken, tokenErr := authService.GetToken(group)
-			if tokenErr != nil {
-				RespondError(c, resp.StatusCode, "所有 token 不可用")
+			// 账号无权使用该模型：记录到可用性矩阵，不冷却 token，换一个 token 重试
+			if reason, unavailable := modelUnavailableReason(resp.StatusCode, body); unavailable {
+				authService.RecordModelAccess(currentToken, anthropicReq.Model, false, reason)
+				lastErr = fmt.Errorf("upstream status %d: %s", resp.StatusCode, reason)
+				logger.Warn("Token 不支持请求模型，切换 token",
+					AddReqFields(c,
+						logger.Int64("token_id", currentToken.ID),
+						logger.String("model", anthropicReq.Model),
+						logger.String("reason", reason),
+						logger.Int("attempt", attempt),
+					)...)
+				if attempt < maxRetries {
+					if newToken, servedGroup, tokenErr := getTokenWithFallback(c, authService, group, anthropicReq.Model); tokenErr == nil {
+						currentToken = newToken
+						group = servedGroup
+						continue
+					}
+				}
+				respondCodeWhispererError(c, resp.StatusCode, body)
 				return nil, lastErr
 			}
-			currentToken = newToken
-			continue
-		}
 
-		if handleCodeWhispererError(c, resp) {
-			resp.Body.Close()
+			decision := NewErrorMapper().DecideUpstreamError(resp.StatusCode, resp.Header, body)
+			if decision.Action != FailRequest && attempt < maxRetries {
+				lastErr = fmt.Errorf("upstream status %d: %s", resp.StatusCode, decision.Reason)
+
+				if decision.Action == RetrySameToken {
+					logger.Warn("上游暂时不可用，等待后使用同一 token 重试",
+						AddReqFields(c,
+							logger.Int("status_code", resp.StatusCode),
+							logger.String("reason", decision.Reason),
+							logger.Duration("wait", decision.Wait),
+							logger.Int("attempt", attempt),
+						)...)
+					if err := sleepWithContext(c.Request.Context(), decision.Wait); err != nil {
+						handleRequestSendError(c, err)
+						return nil, err
+					}
+					continue
+				}
+
+				logger.Warn("上游错误，切换 token",
+					AddReqFields(c,
+						logger.Int("status_code", resp.StatusCode),
+						logger.String("reason", decision.Reason),
+						logger.Duration("cooldown", decision.Cooldown),
+						logger.Bool("mark_exhausted", decision.MarkExhausted),
+						logger.Int("attempt", attempt),
+					)...)
+
+				if decision.MarkExhausted {
+					authService.MarkTokenExhausted(currentToken)
+				} else {
+					authService.MarkTokenFailedWithCooldown(currentToken, decision.Cooldown)
+				}
+				newToken, servedGroup, tokenErr := getTokenWithFallback(c, authService, group, anthropicReq.Model)
+				if tokenErr != nil {
+					RespondError(c, resp.StatusCode, "所有 token 不可用")
+					return nil, lastErr
+				}
+				currentToken = newToken
+				group = servedGroup
+				continue
+			}
+
+			// 不再重试：按决策处理 token 后返回映射的错误
+			switch {
+			case decision.MarkExhausted:
+				authService.MarkTokenExhausted(currentToken)
+			case decision.Action == SwitchToken:
+				authService.MarkTokenFailedWithCooldown(currentToken, decision.Cooldown)
+			case isTokenFaultStatus(resp.StatusCode):
+				authService.RecordUpstreamResult(currentToken, false)
+			}
+			respondCodeWhispererError(c, resp.StatusCode, body)
 			return nil, fmt.Errorf("CodeWhisperer API error")
 		}
+		authService.RecordUpstreamResult(currentToken, true)
+		authService.RecordModelAccess(currentToken, anthropicReq.Model, true, "")
+		setServedToken(c, currentToken)
 
 		logger.Debug("上游响应成功",
 			AddReqFields(c,
@@ -268,7 +362,9 @@ func buildCodeWhispererRequest(c *gin.Context, anthropicReq types.AnthropicReque
 	cwReq, err := converter.BuildCodeWhispererRequest(anthropicReq, c)
 	if err != nil {
 		if modelNotFoundErr, ok := err.(*types.ModelNotFoundErrorType); ok {
-			c.JSON(http.StatusBadRequest, modelNotFoundErr.ErrorData)
+			if !errorResponseSuppressed(c) {
+				c.JSON(http.StatusBadRequest, modelNotFoundErr.ErrorData)
+			}
 			return nil, err
 		}
 		return nil, fmt.Errorf("构建CodeWhisperer请求失败: %v", err)
@@ -328,7 +424,13 @@ func buildCodeWhispererRequest(c *gin.Context, anthropicReq types.AnthropicReque
 	return req, nil
 }
 
-func handleCodeWhispererError(c *gin.Context, resp *http.Response) bool {
+// isTokenFaultStatus 判断上游错误是否归因于 token（用于熔断统计，客户端请求错误不计入）
+func isTokenFaultStatus(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusForbidden || status >= http.StatusInternalServerError
+}
+
+// handleCodeWhispererError 处理非 200 上游响应；账号无权使用模型时记录到 token 可用性矩阵
+func handleCodeWhispererError(c *gin.Context, resp *http.Response, tokenInfo types.TokenInfo, model string) bool {
 	if resp.StatusCode == http.StatusOK {
 		return false
 	}
@@ -344,22 +446,45 @@ func handleCodeWhispererError(c *gin.Context, resp *http.Response) bool {
 		return true
 	}
 
+	if reason, unavailable := modelUnavailableReason(resp.StatusCode, body); unavailable {
+		if authService := GetAuthServiceFromContext(c); authService != nil {
+			authService.RecordModelAccess(tokenInfo, model, false, reason)
+		}
+	}
+	respondCodeWhispererError(c, resp.StatusCode, body)
+	return true
+}
+
+// respondCodeWhispererError 记录上游错误并按错误映射策略返回客户端
+func respondCodeWhispererError(c *gin.Context, statusCode int, body []byte) {
 	logger.Error("上游响应错误",
 		AddReqFields(c,
 			logger.String("direction", "upstream_response"),
-			logger.Int("status_code", resp.StatusCode),
+			logger.Int("status_code", statusCode),
 			logger.Int("response_len", len(body)),
 			logger.String("response_body", string(body)),
 		)...)
 
-	if resp.StatusCode == http.StatusForbidden {
-		logger.Warn("收到403错误，token可能已失效")
-		RespondErrorWithCode(c, http.StatusUnauthorized, "unauthorized", "%s", "Token已失效，请重试")
-		return true
+	if _, unavailable := modelUnavailableReason(statusCode, body); unavailable {
+		RespondErrorWithCode(c, http.StatusBadRequest, "model_not_available", "没有可使用该模型的账号: %s",
+			parseCodeWhispererError(body).Message)
+		return
 	}
 
 	errorMapper := NewErrorMapper()
-	claudeError := errorMapper.MapCodeWhispererError(resp.StatusCode, body)
+	claudeError := errorMapper.MapCodeWhispererError(statusCode, body)
+
+	// 额度耗尽、限流、容量不足等按策略映射的状态码返回
+	if claudeError.StatusCode != 0 {
+		RespondErrorWithCode(c, claudeError.StatusCode, claudeError.Code, "%s", claudeError.Message)
+		return
+	}
+
+	if statusCode == http.StatusForbidden {
+		logger.Warn("收到403错误，token可能已失效")
+		RespondErrorWithCode(c, http.StatusUnauthorized, "unauthorized", "%s", "Token已失效，请重试")
+		return
+	}
 
 	if claudeError.StopReason == "max_tokens" {
 		logger.Info("内容长度超限，映射为max_tokens stop_reason",
@@ -371,8 +496,21 @@ func handleCodeWhispererError(c *gin.Context, resp *http.Response) bool {
 	} else {
 		RespondErrorWithCode(c, http.StatusInternalServerError, "cw_error", "CodeWhisperer Error: %s", string(body))
 	}
+}
 
-	return true
+// sleepWithContext 等待指定时长，上下文取消时提前返回
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func FilterSupportedTools(tools []types.AnthropicTool) []types.AnthropicTool {
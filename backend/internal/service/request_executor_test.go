@@ -0,0 +1,142 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"kiro2api/internal/auth"
+	"kiro2api/internal/types"
+	"kiro2api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubAuthService 记录 token 处理结果的认证服务桩
+type stubAuthService struct {
+	exhausted int
+	failed    int
+	groups    map[string]auth.GroupSettings
+}
+
+func (s *stubAuthService) GetTokenForModel(group string, model string) (types.TokenInfo, error) {
+	return types.TokenInfo{AccessToken: "access", RefreshToken: "refresh"}, nil
+}
+func (s *stubAuthService) MarkTokenFailed(token types.TokenInfo) { s.failed++ }
+func (s *stubAuthService) GetGroupSettings(group string) auth.GroupSettings {
+	return s.groups[group]
+}
+func (s *stubAuthService) GetFallbackChain(group string) []string                   { return nil }
+func (s *stubAuthService) RecordUpstreamResult(token types.TokenInfo, success bool) {}
+func (s *stubAuthService) MarkTokenFailedWithCooldown(token types.TokenInfo, cooldown time.Duration) {
+	s.failed++
+}
+func (s *stubAuthService) MarkTokenExhausted(token types.TokenInfo) { s.exhausted++ }
+func (s *stubAuthService) RecordModelAccess(token types.TokenInfo, model string, supported bool, reason string) {
+}
+
+// upstreamStub 以固定响应替代上游
+type upstreamStub struct {
+	status int
+	body   string
+	calls  int
+}
+
+func (u *upstreamStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	u.calls++
+	return &http.Response{
+		StatusCode: u.status,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(u.body)),
+		Request:    req,
+	}, nil
+}
+
+// executeWithUpstream 在给定分组下执行请求（group 为空时使用默认分组）
+// limiter 非 nil 时模拟限流中间件已按该限流器扣减
+func executeWithUpstream(t *testing.T, upstream *upstreamStub, authService *stubAuthService, limiter *RateLimiter, group string) (*httptest.ResponseRecorder, error) {
+	t.Helper()
+	original := utils.SharedHTTPClient
+	utils.SharedHTTPClient = &http.Client{Transport: upstream}
+	defer func() { utils.SharedHTTPClient = original }()
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	SetAuthServiceInContext(c, authService)
+	if limiter != nil {
+		c.Set(contextKeyRateLimit, &rateLimitCharge{global: limiter, limiter: limiter})
+	}
+	if group != "" {
+		SetGroupInContext(c, group)
+	}
+
+	req := types.AnthropicRequest{
+		Model:     "claude-sonnet-4-20250514",
+		MaxTokens: 100,
+		Messages:  []types.AnthropicRequestMessage{{Role: "user", Content: "hi"}},
+	}
+	token, err := authService.GetTokenForModel(group, req.Model)
+	require.NoError(t, err)
+
+	resp, err := executeWithRetry(c, req, token, false)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return w, err
+}
+
+func TestExecuteWithRetry_FinalThrottleReturns429(t *testing.T) {
+	upstream := &upstreamStub{status: http.StatusTooManyRequests, body: `{"message":"slow down","__type":"ThrottlingException"}`}
+	authService := &stubAuthService{}
+
+	w, err := executeWithUpstream(t, upstream, authService, nil, "")
+	assert.Error(t, err)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "rate_limit_error")
+	assert.Contains(t, w.Body.String(), "throttled")
+	assert.Greater(t, upstream.calls, 1)
+}
+
+func TestExecuteWithRetry_FinalQuotaReturns429(t *testing.T) {
+	upstream := &upstreamStub{status: http.StatusTooManyRequests, body: `{"message":"used up","reason":"MONTHLY_REQUEST_COUNT"}`}
+	authService := &stubAuthService{}
+
+	w, err := executeWithUpstream(t, upstream, authService, nil, "")
+	assert.Error(t, err)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "quota_exhausted")
+	assert.Equal(t, upstream.calls, authService.exhausted)
+}
+
+func TestExecuteWithRetry_RechecksLimitOfRoutedGroup(t *testing.T) {
+	upstream := &upstreamStub{status: http.StatusOK}
+	authService := &stubAuthService{groups: map[string]auth.GroupSettings{
+		"routed-limit-test": {RateLimitQPS: 0.01, RateLimitBurst: 1},
+	}}
+	global := NewRateLimiter(1000, 1000)
+	global.SetGroupSettingsResolver(authService.GetGroupSettings)
+
+	// 中间件已按全局限流放行，路由规则随后将请求改到 routed-limit-test：执行时按该分组复核
+	_, err := executeWithUpstream(t, upstream, authService, global, "routed-limit-test")
+	require.NoError(t, err)
+
+	w, err := executeWithUpstream(t, upstream, authService, global, "routed-limit-test")
+	assert.ErrorIs(t, err, errRateLimited)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Equal(t, 1, upstream.calls)
+
+	// 未覆盖限流的分组使用中间件已扣减的全局限流器，不重复扣减
+	_, err = executeWithUpstream(t, upstream, authService, global, "unlimited-test")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, upstream.calls)
+}
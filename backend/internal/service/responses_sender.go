@@ -0,0 +1,366 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"kiro2api/internal/converter"
+	"kiro2api/internal/logger"
+	"kiro2api/internal/types"
+	"kiro2api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responsesItemState 单个输出项（对应一个 Anthropic 内容块）的流式状态
+type responsesItemState struct {
+	outputIndex int
+	item        types.ResponsesOutputItem
+	text        strings.Builder // message 累计文本
+	args        strings.Builder // function_call 累计参数
+	done        bool
+}
+
+// ResponsesStreamSender OpenAI Responses 格式的流事件发送器
+// 将 Anthropic 流事件转换为 response.* 事件（有状态，每个请求一个实例）
+type ResponsesStreamSender struct {
+	responseID string
+	model      string
+	createdAt  int64
+	sequence   int
+	started    bool
+	finished   bool
+	stopReason string
+	usage      types.ResponsesUsage
+	items      []*responsesItemState       // 按输出序号排列
+	blocks     map[int]*responsesItemState // Anthropic 内容块 index -> 输出项（thinking 块不映射）
+}
+
+// NewResponsesStreamSender 创建 Responses 流事件发送器
+func NewResponsesStreamSender(responseID, model string) *ResponsesStreamSender {
+	return &ResponsesStreamSender{
+		responseID: responseID,
+		model:      model,
+		createdAt:  time.Now().Unix(),
+		blocks:     make(map[int]*responsesItemState),
+	}
+}
+
+func (s *ResponsesStreamSender) SendEvent(c *gin.Context, data any) error {
+	dataMap, ok := data.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	switch dataMap["type"] {
+	case "message_start":
+		if s.started {
+			return nil
+		}
+		s.started = true
+		if message, ok := dataMap["message"].(map[string]any); ok {
+			if usage, ok := message["usage"].(map[string]any); ok {
+				s.usage.InputTokens = anyToInt(usage["input_tokens"])
+			}
+		}
+		if err := s.write(c, "response.created", map[string]any{"response": s.snapshot("in_progress")}); err != nil {
+			return err
+		}
+		return s.write(c, "response.in_progress", map[string]any{"response": s.snapshot("in_progress")})
+
+	case "ping":
+		// Responses 协议无 ping 事件，使用 SSE 注释行
+		if _, err := fmt.Fprint(c.Writer, keepaliveComment); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+
+	case "content_block_start":
+		block, _ := dataMap["content_block"].(map[string]any)
+		blockType, _ := block["type"].(string)
+		return s.startItem(c, anyToInt(dataMap["index"]), blockType, block)
+
+	case "content_block_delta":
+		state, ok := s.blocks[anyToInt(dataMap["index"])]
+		if !ok || state.done {
+			return nil
+		}
+		delta, _ := dataMap["delta"].(map[string]any)
+		switch delta["type"] {
+		case "text_delta":
+			text, _ := delta["text"].(string)
+			if text == "" {
+				return nil
+			}
+			state.text.WriteString(text)
+			return s.write(c, "response.output_text.delta", map[string]any{
+				"item_id":       state.item.ID,
+				"output_index":  state.outputIndex,
+				"content_index": 0,
+				"delta":         text,
+			})
+		case "input_json_delta":
+			var partial string
+			switch pj := delta["partial_json"].(type) {
+			case string:
+				partial = pj
+			case *string:
+				if pj != nil {
+					partial = *pj
+				}
+			}
+			if partial == "" {
+				return nil
+			}
+			state.args.WriteString(partial)
+			return s.write(c, "response.function_call_arguments.delta", map[string]any{
+				"item_id":      state.item.ID,
+				"output_index": state.outputIndex,
+				"delta":        partial,
+			})
+		}
+		return nil
+
+	case "content_block_stop":
+		if state, ok := s.blocks[anyToInt(dataMap["index"])]; ok {
+			return s.finishItem(c, state)
+		}
+		return nil
+
+	case "message_delta":
+		if delta, ok := dataMap["delta"].(map[string]any); ok {
+			if sr, ok := delta["stop_reason"].(string); ok {
+				s.stopReason = sr
+			}
+		}
+		if usage, ok := dataMap["usage"].(map[string]any); ok {
+			if v := anyToInt(usage["input_tokens"]); v > 0 {
+				s.usage.InputTokens = v
+			}
+			s.usage.OutputTokens = anyToInt(usage["output_tokens"])
+		}
+		return nil
+
+	case "message_stop":
+		return s.complete(c)
+
+	case "error":
+		message := "上游服务错误"
+		if errObj, ok := dataMap["error"].(map[string]any); ok {
+			if m, ok := errObj["message"].(string); ok {
+				message = m
+			}
+		}
+		return s.fail(c, message)
+	}
+	return nil
+}
+
+func (s *ResponsesStreamSender) SendError(c *gin.Context, message string, _ error) error {
+	return s.fail(c, message)
+}
+
+// startItem 内容块开始：text -> message 输出项，tool_use -> function_call 输出项
+func (s *ResponsesStreamSender) startItem(c *gin.Context, index int, blockType string, block map[string]any) error {
+	if existing, ok := s.blocks[index]; ok && !existing.done {
+		return nil
+	}
+
+	state := &responsesItemState{outputIndex: len(s.items)}
+	switch blockType {
+	case "text":
+		state.item = types.ResponsesOutputItem{
+			Type:    "message",
+			ID:      converter.ResponsesItemID("msg", s.responseID, state.outputIndex),
+			Status:  "in_progress",
+			Role:    "assistant",
+			Content: []types.ResponsesOutputContent{},
+		}
+	case "tool_use":
+		callID, _ := block["id"].(string)
+		name, _ := block["name"].(string)
+		empty := ""
+		state.item = types.ResponsesOutputItem{
+			Type:      "function_call",
+			ID:        converter.ResponsesItemID("fc", s.responseID, state.outputIndex),
+			Status:    "in_progress",
+			CallID:    callID,
+			Name:      name,
+			Arguments: &empty,
+		}
+	default:
+		// thinking 等块不对外输出
+		return nil
+	}
+	s.items = append(s.items, state)
+	s.blocks[index] = state
+
+	if err := s.write(c, "response.output_item.added", map[string]any{
+		"output_index": state.outputIndex,
+		"item":         state.item,
+	}); err != nil {
+		return err
+	}
+	if state.item.Type == "message" {
+		return s.write(c, "response.content_part.added", map[string]any{
+			"item_id":       state.item.ID,
+			"output_index":  state.outputIndex,
+			"content_index": 0,
+			"part":          types.ResponsesOutputContent{Type: "output_text", Annotations: []any{}},
+		})
+	}
+	return nil
+}
+
+// finishItem 内容块结束：发送 done 事件并固化输出项
+func (s *ResponsesStreamSender) finishItem(c *gin.Context, state *responsesItemState) error {
+	if state.done {
+		return nil
+	}
+	state.done = true
+	state.item.Status = "completed"
+
+	switch state.item.Type {
+	case "message":
+		part := types.ResponsesOutputContent{Type: "output_text", Text: state.text.String(), Annotations: []any{}}
+		state.item.Content = []types.ResponsesOutputContent{part}
+		if err := s.write(c, "response.output_text.done", map[string]any{
+			"item_id":       state.item.ID,
+			"output_index":  state.outputIndex,
+			"content_index": 0,
+			"text":          part.Text,
+		}); err != nil {
+			return err
+		}
+		if err := s.write(c, "response.content_part.done", map[string]any{
+			"item_id":       state.item.ID,
+			"output_index":  state.outputIndex,
+			"content_index": 0,
+			"part":          part,
+		}); err != nil {
+			return err
+		}
+	case "function_call":
+		args := state.args.String()
+		if args == "" {
+			args = "{}"
+		}
+		state.item.Arguments = &args
+		if err := s.write(c, "response.function_call_arguments.done", map[string]any{
+			"item_id":      state.item.ID,
+			"output_index": state.outputIndex,
+			"arguments":    args,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return s.write(c, "response.output_item.done", map[string]any{
+		"output_index": state.outputIndex,
+		"item":         state.item,
+	})
+}
+
+// complete 消息结束：补齐未关闭的输出项并发送 response.completed / response.incomplete
+func (s *ResponsesStreamSender) complete(c *gin.Context) error {
+	if s.finished {
+		return nil
+	}
+	for _, state := range s.items {
+		if err := s.finishItem(c, state); err != nil {
+			return err
+		}
+	}
+	s.finished = true
+
+	if s.stopReason == "max_tokens" {
+		resp := s.snapshot("incomplete")
+		resp.IncompleteDetails = &types.ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+		return s.write(c, "response.incomplete", map[string]any{"response": resp})
+	}
+	return s.write(c, "response.completed", map[string]any{"response": s.snapshot("completed")})
+}
+
+// fail 发送 error 事件；已创建响应时追加 response.failed
+func (s *ResponsesStreamSender) fail(c *gin.Context, message string) error {
+	if s.finished {
+		return nil
+	}
+	s.finished = true
+	if err := s.write(c, "error", map[string]any{
+		"code":    "server_error",
+		"message": message,
+		"param":   nil,
+	}); err != nil {
+		return err
+	}
+	if !s.started {
+		return nil
+	}
+	resp := s.snapshot("failed")
+	resp.Error = map[string]any{"code": "server_error", "message": message}
+	return s.write(c, "response.failed", map[string]any{"response": resp})
+}
+
+// snapshot 当前响应对象（只包含已完成的输出项）
+func (s *ResponsesStreamSender) snapshot(status string) types.ResponsesResponse {
+	resp := types.ResponsesResponse{
+		ID:        s.responseID,
+		Object:    "response",
+		CreatedAt: s.createdAt,
+		Status:    status,
+		Model:     s.model,
+		Output:    []types.ResponsesOutputItem{},
+	}
+	for _, state := range s.items {
+		if state.done {
+			resp.Output = append(resp.Output, state.item)
+		}
+	}
+	if status != "in_progress" {
+		usage := s.usage
+		usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+		resp.Usage = &usage
+	}
+	return resp
+}
+
+// write 写出一个 Responses 事件（type 与 sequence_number 自动填充）
+func (s *ResponsesStreamSender) write(c *gin.Context, eventType string, payload map[string]any) error {
+	payload["type"] = eventType
+	payload["sequence_number"] = s.sequence
+	s.sequence++
+
+	data, err := utils.SafeMarshal(payload)
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("发送Responses SSE事件",
+		AddReqFields(c,
+			logger.String("event", eventType),
+			logger.Int("payload_len", len(data)),
+		)...)
+
+	fmt.Fprintf(c.Writer, "event: %s\n", eventType)
+	fmt.Fprintf(c.Writer, "data: %s\n\n", string(data))
+	c.Writer.Flush()
+	return nil
+}
+
+// anyToInt 将 JSON 数值（int / float64）转换为 int
+func anyToInt(v any) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
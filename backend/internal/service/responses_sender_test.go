@@ -0,0 +1,117 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// parseResponsesEvents 解析 SSE 输出为 (事件名, 数据) 列表
+func parseResponsesEvents(t *testing.T, body string) ([]string, []map[string]any) {
+	var names []string
+	var payloads []map[string]any
+	for _, frame := range strings.Split(body, "\n\n") {
+		var name, data string
+		for _, line := range strings.Split(frame, "\n") {
+			if v, ok := strings.CutPrefix(line, "event: "); ok {
+				name = v
+			}
+			if v, ok := strings.CutPrefix(line, "data: "); ok {
+				data = v
+			}
+		}
+		if name == "" {
+			continue
+		}
+		var payload map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(data), &payload))
+		assert.Equal(t, name, payload["type"])
+		names = append(names, name)
+		payloads = append(payloads, payload)
+	}
+	return names, payloads
+}
+
+func TestResponsesStreamSender_TextAndFunctionCall(t *testing.T) {
+	c, w := newKeepaliveTestContext()
+	s := NewResponsesStreamSender("resp_test", "claude-sonnet-4-5")
+
+	partial := `{"city":`
+	for _, event := range []map[string]any{
+		{"type": "message_start", "message": map[string]any{"id": "msg_1", "usage": map[string]any{"input_tokens": 12}}},
+		{"type": "ping"},
+		{"type": "content_block_start", "index": 0, "content_block": map[string]any{"type": "thinking"}},
+		{"type": "content_block_delta", "index": 0, "delta": map[string]any{"type": "thinking_delta", "thinking": "..."}},
+		{"type": "content_block_stop", "index": 0},
+		{"type": "content_block_start", "index": 1, "content_block": map[string]any{"type": "text", "text": ""}},
+		{"type": "content_block_delta", "index": 1, "delta": map[string]any{"type": "text_delta", "text": "你"}},
+		{"type": "content_block_delta", "index": 1, "delta": map[string]any{"type": "text_delta", "text": "好"}},
+		{"type": "content_block_stop", "index": 1},
+		{"type": "content_block_start", "index": float64(2), "content_block": map[string]any{"type": "tool_use", "id": "toolu_1", "name": "get_weather"}},
+		{"type": "content_block_delta", "index": 2, "delta": map[string]any{"type": "input_json_delta", "partial_json": &partial}},
+		{"type": "content_block_delta", "index": 2, "delta": map[string]any{"type": "input_json_delta", "partial_json": `"北京"}`}},
+		{"type": "message_delta", "delta": map[string]any{"stop_reason": "tool_use"}, "usage": map[string]any{"output_tokens": 7}},
+		{"type": "message_stop"},
+	} {
+		assert.NoError(t, s.SendEvent(c, event))
+	}
+
+	assert.Contains(t, w.Body.String(), keepaliveComment)
+	names, payloads := parseResponsesEvents(t, w.Body.String())
+	assert.Equal(t, []string{
+		"response.created",
+		"response.in_progress",
+		"response.output_item.added",
+		"response.content_part.added",
+		"response.output_text.delta",
+		"response.output_text.delta",
+		"response.output_text.done",
+		"response.content_part.done",
+		"response.output_item.done",
+		"response.output_item.added",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.done",
+		"response.output_item.done",
+		"response.completed",
+	}, names)
+
+	for i, payload := range payloads {
+		assert.Equal(t, float64(i), payload["sequence_number"])
+	}
+	assert.Equal(t, "msg_test_0", payloads[4]["item_id"])
+	assert.Equal(t, `{"city":"北京"}`, payloads[12]["arguments"])
+
+	completed := payloads[len(payloads)-1]["response"].(map[string]any)
+	assert.Equal(t, "completed", completed["status"])
+	output := completed["output"].([]any)
+	assert.Len(t, output, 2)
+	assert.Equal(t, "你好", output[0].(map[string]any)["content"].([]any)[0].(map[string]any)["text"])
+	assert.Equal(t, "toolu_1", output[1].(map[string]any)["call_id"])
+	usage := completed["usage"].(map[string]any)
+	assert.Equal(t, float64(19), usage["total_tokens"])
+}
+
+func TestResponsesStreamSender_IncompleteAndError(t *testing.T) {
+	c, w := newKeepaliveTestContext()
+	s := NewResponsesStreamSender("resp_test", "claude-sonnet-4-5")
+	_ = s.SendEvent(c, map[string]any{"type": "message_start"})
+	_ = s.SendEvent(c, map[string]any{"type": "message_delta", "delta": map[string]any{"stop_reason": "max_tokens"}})
+	_ = s.SendEvent(c, map[string]any{"type": "message_stop"})
+
+	names, payloads := parseResponsesEvents(t, w.Body.String())
+	assert.Equal(t, "response.incomplete", names[len(names)-1])
+	resp := payloads[len(payloads)-1]["response"].(map[string]any)
+	assert.Equal(t, "max_output_tokens", resp["incomplete_details"].(map[string]any)["reason"])
+
+	c, w = newKeepaliveTestContext()
+	s = NewResponsesStreamSender("resp_test", "claude-sonnet-4-5")
+	_ = s.SendEvent(c, map[string]any{"type": "message_start"})
+	_ = s.SendError(c, "上游不可用", nil)
+	_ = s.SendEvent(c, map[string]any{"type": "message_stop"})
+
+	names, _ = parseResponsesEvents(t, w.Body.String())
+	assert.Equal(t, []string{"response.created", "response.in_progress", "error", "response.failed"}, names)
+}
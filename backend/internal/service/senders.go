@@ -2,6 +2,8 @@ package service
 
 import (
 	"fmt"
+	"time"
+
 	"kiro2api/internal/logger"
 	"kiro2api/internal/utils"
 
@@ -57,7 +59,54 @@ func (s *AnthropicStreamSender) SendError(c *gin.Context, message string, _ erro
 }
 
 // OpenAIStreamSender OpenAI格式的流事件发送器
-type OpenAIStreamSender struct{}
+// 零值只负责发送；构建 chat.completion.chunk 需通过 NewOpenAIStreamSender 指定 id/model
+type OpenAIStreamSender struct {
+	ID           string
+	Model        string
+	Created      int64
+	IncludeUsage bool // stream_options.include_usage：每个分片带 "usage": null，结束前发送 usage 分片
+}
+
+// NewOpenAIStreamSender 创建 OpenAI 流事件发送器
+func NewOpenAIStreamSender(id, model string, includeUsage bool) *OpenAIStreamSender {
+	return &OpenAIStreamSender{ID: id, Model: model, Created: time.Now().Unix(), IncludeUsage: includeUsage}
+}
+
+// Chunk 构建单个 choice 的 chat.completion.chunk（finishReason 为 nil 表示未结束）
+func (s *OpenAIStreamSender) Chunk(delta map[string]any, finishReason any) map[string]any {
+	chunk := s.chunk([]map[string]any{
+		{
+			"index":         0,
+			"delta":         delta,
+			"finish_reason": finishReason,
+		},
+	})
+	if s.IncludeUsage {
+		chunk["usage"] = nil
+	}
+	return chunk
+}
+
+// UsageChunk 构建 include_usage 的最终分片（choices 为空）
+func (s *OpenAIStreamSender) UsageChunk(promptTokens, completionTokens int) map[string]any {
+	chunk := s.chunk([]map[string]any{})
+	chunk["usage"] = map[string]any{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": completionTokens,
+		"total_tokens":      promptTokens + completionTokens,
+	}
+	return chunk
+}
+
+func (s *OpenAIStreamSender) chunk(choices []map[string]any) map[string]any {
+	return map[string]any{
+		"id":      s.ID,
+		"object":  "chat.completion.chunk",
+		"created": s.Created,
+		"model":   s.Model,
+		"choices": choices,
+	}
+}
 
 func (s *OpenAIStreamSender) SendEvent(c *gin.Context, data any) error {
 
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAIStreamSender_Chunk(t *testing.T) {
+	s := NewOpenAIStreamSender("chatcmpl-1", "claude-sonnet-4-5", false)
+	chunk := s.Chunk(map[string]any{"content": "hi"}, nil)
+
+	data, err := json.Marshal(chunk)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"id": "chatcmpl-1",
+		"object": "chat.completion.chunk",
+		"created": `+jsonNumber(s.Created)+`,
+		"model": "claude-sonnet-4-5",
+		"choices": [{"index": 0, "delta": {"content": "hi"}, "finish_reason": null}]
+	}`, string(data))
+	_, hasUsage := chunk["usage"]
+	assert.False(t, hasUsage, "未开启 include_usage 时不带 usage 字段")
+}
+
+func TestOpenAIStreamSender_IncludeUsage(t *testing.T) {
+	s := NewOpenAIStreamSender("chatcmpl-1", "claude-sonnet-4-5", true)
+
+	chunk := s.Chunk(map[string]any{}, "tool_calls")
+	usage, hasUsage := chunk["usage"]
+	assert.True(t, hasUsage)
+	assert.Nil(t, usage, "普通分片 usage 为 null")
+
+	final := s.UsageChunk(12, 5)
+	data, err := json.Marshal(final)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"id": "chatcmpl-1",
+		"object": "chat.completion.chunk",
+		"created": `+jsonNumber(s.Created)+`,
+		"model": "claude-sonnet-4-5",
+		"choices": [],
+		"usage": {"prompt_tokens": 12, "completion_tokens": 5, "total_tokens": 17}
+	}`, string(data))
+}
+
+func jsonNumber(n int64) string {
+	data, _ := json.Marshal(n)
+	return string(data)
+}
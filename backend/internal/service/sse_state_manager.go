@@ -400,6 +400,11 @@ func (ssm *SSEStateManager) GetActiveBlocks() map[int]*BlockState {
 	return ssm.activeBlocks
 }
 
+// NextBlockIndex 下一个可用的块索引
+func (ssm *SSEStateManager) NextBlockIndex() int {
+	return ssm.nextBlockIndex
+}
+
 // IsMessageStarted 检查消息是否已开始
 func (ssm *SSEStateManager) IsMessageStarted() bool {
 	return ssm.messageStarted
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"errors"
+	"strings"
+)
+
+// errStopSequenceMatched 流式输出命中停止序列，结束读取上游
+var errStopSequenceMatched = errors.New("命中停止序列")
+
+// StopSequenceMatcher 流式扫描 stop_sequences（上游不支持，由代理模拟）
+// 可能是停止序列开头的文本尾部会暂存到下一个分片，以识别跨分片的停止序列
+type StopSequenceMatcher struct {
+	sequences []string
+	pending   string // 暂存的文本尾部
+	matched   string // 命中的停止序列
+}
+
+// NewStopSequenceMatcher 创建停止序列扫描器（没有非空停止序列时返回 nil）
+func NewStopSequenceMatcher(sequences []string) *StopSequenceMatcher {
+	var valid []string
+	for _, seq := range sequences {
+		if seq != "" {
+			valid = append(valid, seq)
+		}
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+	return &StopSequenceMatcher{sequences: valid}
+}
+
+// Feed 扫描新文本，返回可以下发的部分；命中时返回停止序列之前的文本与 true
+func (m *StopSequenceMatcher) Feed(text string) (string, bool) {
+	if m.matched != "" {
+		return "", true
+	}
+	buf := m.pending + text
+	m.pending = ""
+
+	if idx, seq := findStopSequence(buf, m.sequences); idx >= 0 {
+		m.matched = seq
+		return buf[:idx], true
+	}
+
+	// 暂存与任一停止序列前缀相同的最长尾部
+	hold := 0
+	for _, seq := range m.sequences {
+		for k := min(len(seq)-1, len(buf)); k > hold; k-- {
+			if strings.HasSuffix(buf, seq[:k]) {
+				hold = k
+				break
+			}
+		}
+	}
+	m.pending = buf[len(buf)-hold:]
+	return buf[:len(buf)-hold], false
+}
+
+// Flush 取出暂存的文本（文本块结束或流结束时下发）
+func (m *StopSequenceMatcher) Flush() string {
+	pending := m.pending
+	m.pending = ""
+	return pending
+}
+
+// Matched 命中的停止序列（未命中为空）
+func (m *StopSequenceMatcher) Matched() string {
+	return m.matched
+}
+
+// TruncateAtStopSequence 在第一个停止序列处截断完整文本，返回截断后的文本与命中的停止序列
+func TruncateAtStopSequence(text string, sequences []string) (string, string) {
+	if idx, seq := findStopSequence(text, sequences); idx >= 0 {
+		return text[:idx], seq
+	}
+	return text, ""
+}
+
+// findStopSequence 查找最早出现的停止序列（同一位置取较长者，忽略空序列）
+func findStopSequence(text string, sequences []string) (int, string) {
+	best, matched := -1, ""
+	for _, seq := range sequences {
+		idx := strings.Index(text, seq)
+		if seq == "" || idx < 0 {
+			continue
+		}
+		if best < 0 || idx < best || (idx == best && len(seq) > len(matched)) {
+			best, matched = idx, seq
+		}
+	}
+	return best, matched
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"kiro2api/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStopSequenceMatcher_SplitAcrossChunks(t *testing.T) {
+	m := NewStopSequenceMatcher([]string{"", "END"})
+
+	emit, matched := m.Feed("hello E")
+	assert.Equal(t, "hello ", emit, "可能是停止序列开头的尾部暂存")
+	assert.False(t, matched)
+
+	emit, matched = m.Feed("N")
+	assert.Empty(t, emit)
+	assert.False(t, matched)
+
+	emit, matched = m.Feed("D tail")
+	assert.Empty(t, emit)
+	assert.True(t, matched)
+	assert.Equal(t, "END", m.Matched())
+
+	emit, matched = m.Feed("more")
+	assert.Empty(t, emit, "命中后不再下发")
+	assert.True(t, matched)
+}
+
+func TestStopSequenceMatcher_ReleasesNonMatchingPrefix(t *testing.T) {
+	m := NewStopSequenceMatcher([]string{"</answer>"})
+
+	emit, _ := m.Feed("a </ans")
+	assert.Equal(t, "a ", emit)
+	emit, matched := m.Feed("wer is")
+	assert.Equal(t, "</answer is", emit, "后续文本不匹配时释放暂存内容")
+	assert.False(t, matched)
+
+	emit, _ = m.Feed(" </")
+	assert.Equal(t, " ", emit)
+	assert.Equal(t, "</", m.Flush())
+	assert.Empty(t, m.Flush())
+
+	assert.Nil(t, NewStopSequenceMatcher(nil))
+	assert.Nil(t, NewStopSequenceMatcher([]string{""}))
+}
+
+func TestTruncateAtStopSequence(t *testing.T) {
+	text, seq := TruncateAtStopSequence("one two three", []string{"three", "two"})
+	assert.Equal(t, "one ", text, "取最早出现的停止序列")
+	assert.Equal(t, "two", seq)
+
+	text, seq = TruncateAtStopSequence("one two", []string{"", "four"})
+	assert.Equal(t, "one two", text)
+	assert.Empty(t, seq)
+}
+
+func TestEventStreamProcessor_StopSequence(t *testing.T) {
+	inner := &recordingSender{}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	req := types.AnthropicRequest{Model: "claude-sonnet-4", StopSequences: []string{"###"}}
+	ctx := NewStreamProcessorContext(c, req, &types.TokenWithUsage{}, inner, "msg_test", 10)
+	_ = ctx.SendInitialEvents(CreateAnthropicStreamEvents)
+	esp := NewEventStreamProcessor(ctx)
+
+	textDelta := func(text string) error {
+		return esp.processEvent(parserEvent(map[string]any{
+			"type":  "content_block_delta",
+			"index": 0,
+			"delta": map[string]any{"type": "text_delta", "text": text},
+		}))
+	}
+	assert.NoError(t, esp.processEvent(parserEvent(map[string]any{
+		"type":          "content_block_start",
+		"index":         0,
+		"content_block": map[string]any{"type": "text", "text": ""},
+	})))
+	assert.NoError(t, textDelta("answer #"))
+	assert.ErrorIs(t, textDelta("## ignored"), errStopSequenceMatched)
+	assert.NoError(t, ctx.SendFinalEvents())
+
+	var text string
+	var delta map[string]any
+	for _, e := range inner.events {
+		switch e["type"] {
+		case "content_block_delta":
+			text += e["delta"].(map[string]any)["text"].(string)
+		case "message_delta":
+			delta = e["delta"].(map[string]any)
+		}
+	}
+	assert.Equal(t, "answer ", text)
+	assert.Equal(t, "stop_sequence", delta["stop_reason"])
+	assert.Equal(t, "###", delta["stop_sequence"])
+}
+
+func TestEventStreamProcessor_StopSequenceFlushesAtEnd(t *testing.T) {
+	inner := &recordingSender{}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	req := types.AnthropicRequest{Model: "claude-sonnet-4", StopSequences: []string{"###"}}
+	ctx := NewStreamProcessorContext(c, req, &types.TokenWithUsage{}, inner, "msg_test", 10)
+	_ = ctx.SendInitialEvents(CreateAnthropicStreamEvents)
+	esp := NewEventStreamProcessor(ctx)
+
+	assert.NoError(t, esp.processEvent(parserEvent(map[string]any{
+		"type":  "content_block_delta",
+		"index": 0,
+		"delta": map[string]any{"type": "text_delta", "text": "price #"},
+	})))
+	assert.NoError(t, esp.processEvent(parserEvent(map[string]any{"type": "content_block_stop", "index": 0})))
+
+	var text string
+	stopIdx, lastDeltaIdx := -1, -1
+	for i, e := range inner.events {
+		switch e["type"] {
+		case "content_block_delta":
+			text += e["delta"].(map[string]any)["text"].(string)
+			lastDeltaIdx = i
+		case "content_block_stop":
+			stopIdx = i
+		}
+	}
+	assert.Equal(t, "price #", text, "未命中时暂存文本在块结束前下发")
+	assert.Less(t, lastDeltaIdx, stopIdx)
+	assert.Empty(t, ctx.matchedStopSequence())
+}
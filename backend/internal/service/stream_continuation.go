@@ -0,0 +1,57 @@
+package service
+
+import (
+	"errors"
+
+	"kiro2api/internal/config"
+	"kiro2api/internal/logger"
+	"kiro2api/internal/parser"
+	"kiro2api/internal/types"
+)
+
+// ErrStreamInterrupted 已下发内容后上游流中断（可换 token 续写）
+var ErrStreamInterrupted = errors.New("上游流在输出过程中中断")
+
+// canContinue 已下发内容且允许续写
+// 已开始工具调用时不续写：部分 tool_use 无法作为历史安全回放
+func (ctx *StreamProcessorContext) canContinue() bool {
+	if !ctx.allowContinuation || ctx.canFailover() {
+		return false
+	}
+	return len(ctx.toolUseIdByBlockIndex) == 0 && len(ctx.completedToolUseIds) == 0
+}
+
+// beginContinuation 续写前关闭已下发的内容块，并重置上游解析状态
+// 续写流的块索引从下一个可用索引开始，客户端看到的仍是同一条消息
+func (ctx *StreamProcessorContext) beginContinuation() {
+	for index, block := range ctx.sseStateManager.GetActiveBlocks() {
+		if block.Started && !block.Stopped {
+			stopEvent := map[string]any{
+				"type":  "content_block_stop",
+				"index": index,
+			}
+			if err := ctx.sseStateManager.SendEvent(ctx.c, ctx.sender, stopEvent); err != nil {
+				logger.Error("续写前关闭content_block失败", logger.Err(err), logger.Int("index", index))
+			}
+		}
+	}
+
+	ctx.blockIndexOffset = ctx.sseStateManager.NextBlockIndex()
+	ctx.compliantParser = parser.NewCompliantEventStreamParser()
+	// 续写请求不再注入 thinking 指令，续写内容按普通文本处理
+	ctx.thinkingParser = NewThinkingParser(false)
+	ctx.thinkingBlockStarted = false
+}
+
+// buildContinuationRequest 构建续写请求：原始消息 + 已输出的部分回答 + 续写指令
+func buildContinuationRequest(req types.AnthropicRequest, partial string) types.AnthropicRequest {
+	cont := req
+	cont.Thinking = nil
+	cont.Messages = make([]types.AnthropicRequestMessage, 0, len(req.Messages)+2)
+	cont.Messages = append(cont.Messages, req.Messages...)
+	if partial != "" {
+		cont.Messages = append(cont.Messages, types.AnthropicRequestMessage{Role: "assistant", Content: partial})
+	}
+	cont.Messages = append(cont.Messages, types.AnthropicRequestMessage{Role: "user", Content: config.ContinuationPrompt})
+	return cont
+}
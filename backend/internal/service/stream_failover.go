@@ -0,0 +1,215 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"kiro2api/internal/config"
+	"kiro2api/internal/logger"
+	"kiro2api/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrStreamFailedBeforeContent 上游流在首个内容事件下发前失败（可透明切换 token 重试）
+var ErrStreamFailedBeforeContent = errors.New("上游流在首个内容事件前失败")
+
+const contextKeyServedToken = "served_token"
+
+// contextKeySuppressErrorResponse 为 true 时错误不再以 JSON 写入响应（SSE 流已开始）
+const contextKeySuppressErrorResponse = "suppress_error_response"
+
+// errorResponseSuppressed 是否禁止写入 JSON 错误响应
+func errorResponseSuppressed(c *gin.Context) bool {
+	return c.GetBool(contextKeySuppressErrorResponse)
+}
+
+// setServedToken 记录实际返回响应的 token（重试可能已切换）
+func setServedToken(c *gin.Context, token types.TokenInfo) {
+	c.Set(contextKeyServedToken, token)
+}
+
+// servedTokenFromContext 获取实际返回响应的 token，未记录时返回 fallback
+func servedTokenFromContext(c *gin.Context, fallback types.TokenInfo) types.TokenInfo {
+	if v, exists := c.Get(contextKeyServedToken); exists {
+		if token, ok := v.(types.TokenInfo); ok {
+			return token
+		}
+	}
+	return fallback
+}
+
+// firstContentBuffer 首个内容事件下发前缓冲所有事件的发送器 (Decorator Pattern)
+// 未提交前失败时丢弃缓冲，客户端不会看到被放弃的 message_start
+type firstContentBuffer struct {
+	inner     StreamEventSender
+	pending   []any
+	committed bool
+}
+
+func newFirstContentBuffer(inner StreamEventSender) *firstContentBuffer {
+	return &firstContentBuffer{inner: inner}
+}
+
+func (b *firstContentBuffer) SendEvent(c *gin.Context, data any) error {
+	if b.committed {
+		return b.inner.SendEvent(c, data)
+	}
+	b.pending = append(b.pending, data)
+	if isContentEvent(data) {
+		return b.commit(c)
+	}
+	return nil
+}
+
+func (b *firstContentBuffer) SendError(c *gin.Context, message string, err error) error {
+	if commitErr := b.commit(c); commitErr != nil {
+		return commitErr
+	}
+	return b.inner.SendError(c, message, err)
+}
+
+// commit 下发缓冲事件，之后直接透传
+func (b *firstContentBuffer) commit(c *gin.Context) error {
+	if b.committed {
+		return nil
+	}
+	b.committed = true
+	pending := b.pending
+	b.pending = nil
+	for _, event := range pending {
+		if err := b.inner.SendEvent(c, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isContentEvent 是否为需要立即下发的内容事件（内容增量、工具调用、消息结束）
+func isContentEvent(data any) bool {
+	dataMap, ok := data.(map[string]any)
+	if !ok {
+		return false
+	}
+	switch dataMap["type"] {
+	case "content_block_delta", "message_delta", "message_stop":
+		return true
+	case "content_block_start":
+		if cb, ok := dataMap["content_block"].(map[string]any); ok {
+			return cb["type"] == "tool_use"
+		}
+	}
+	return false
+}
+
+// canFailover 首个内容事件尚未下发，失败可透明重试
+func (ctx *StreamProcessorContext) canFailover() bool {
+	buf, ok := ctx.sender.(*firstContentBuffer)
+	return ok && !buf.committed
+}
+
+// ProcessStreamWithFailover 执行流式请求并处理事件流
+// 首个内容事件下发前上游失败（exception/error 事件、解析失败、断流）时切换 token 重试
+// 开启续写时，已下发内容后断流则换 token 续写并拼接到同一响应
+// 返回的上下文为 nil 表示未能建立上游流
+func ProcessStreamWithFailover(
+	c *gin.Context,
+	req types.AnthropicRequest,
+	token *types.TokenWithUsage,
+	sender StreamEventSender,
+	messageID string,
+	inputTokens int,
+	eventCreator func(string, int, string) []map[string]any,
+) (*StreamProcessorContext, error) {
+	startTime := time.Now()
+	authService := GetAuthServiceFromContext(c)
+	settings := config.GetDefaultSettingsManager().Get()
+
+	maxRetries := 0
+	if authService != nil {
+		maxRetries = max(settings.MaxRetries, 0)
+	}
+
+	var ctx *StreamProcessorContext
+	currentToken := token
+	upstreamReq := req
+	failovers, continuations := 0, 0
+	for {
+		if ctx != nil {
+			// 续写：已下发的内容不能被 JSON 错误打断，执行器的错误响应被抑制
+			c.Set(contextKeySuppressErrorResponse, true)
+		}
+		resp, err := ExecuteCWRequest(c, upstreamReq, currentToken.TokenInfo, true)
+		c.Set(contextKeySuppressErrorResponse, false)
+		if err != nil {
+			if ctx != nil {
+				// 续写失败（执行器已换 token 重试）：按原有行为正常结束已输出的消息
+				logger.Warn("续写请求失败，结束已输出的消息", AddReqFields(c, logger.Err(err))...)
+				return ctx, nil
+			}
+			return nil, err
+		}
+
+		if ctx == nil {
+			// 最后一次尝试直接透传，不再缓冲
+			var attemptSender StreamEventSender = sender
+			if failovers < maxRetries {
+				attemptSender = newFirstContentBuffer(sender)
+			}
+
+			ctx = NewStreamProcessorContext(c, req, currentToken, attemptSender, messageID, inputTokens)
+			ctx.StartTime = startTime
+			if err := ctx.SendInitialEvents(eventCreator); err != nil {
+				resp.Body.Close()
+				return ctx, err
+			}
+		} else {
+			ctx.beginContinuation()
+		}
+		ctx.allowContinuation = settings.StreamContinuation && continuations < maxRetries
+
+		err = NewEventStreamProcessor(ctx).ProcessEventStream(resp.Body)
+		resp.Body.Close()
+
+		failedToken := servedTokenFromContext(c, currentToken.TokenInfo)
+		switch {
+		case errors.Is(err, ErrStreamFailedBeforeContent):
+			failovers++
+			logger.Warn("上游流在首个内容事件前失败，切换 token 重试",
+				AddReqFields(c,
+					logger.Err(err),
+					logger.Int64("token_id", failedToken.ID),
+					logger.Int("attempt", failovers),
+				)...)
+			ctx.Cleanup()
+			ctx = nil
+
+		case errors.Is(err, ErrStreamInterrupted):
+			continuations++
+			partial := ctx.emittedText.String()
+			logger.Warn("上游流输出中断，换 token 续写",
+				AddReqFields(c,
+					logger.Err(err),
+					logger.Int64("token_id", failedToken.ID),
+					logger.Int("emitted_chars", len(partial)),
+					logger.Int("continuation", continuations),
+				)...)
+			upstreamReq = buildContinuationRequest(req, partial)
+
+		default:
+			return ctx, err
+		}
+
+		authService.MarkTokenFailed(failedToken)
+		newToken, _, tokenErr := getTokenWithFallback(c, authService, GetGroupFromContext(c), req.Model)
+		if tokenErr != nil {
+			if ctx != nil {
+				// 无可用 token 续写：按原有行为正常结束已输出的消息
+				logger.Warn("无可用 token 续写，结束已输出的消息", AddReqFields(c, logger.Err(tokenErr))...)
+				return ctx, nil
+			}
+			return nil, tokenErr
+		}
+		currentToken = &types.TokenWithUsage{TokenInfo: newToken}
+	}
+}
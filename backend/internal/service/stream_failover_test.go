@@ -0,0 +1,253 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/iotest"
+
+	"kiro2api/internal/config"
+	"kiro2api/internal/parser"
+	"kiro2api/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingSender 记录下发事件的测试发送器
+type recordingSender struct {
+	events []map[string]any
+}
+
+func (s *recordingSender) SendEvent(_ *gin.Context, data any) error {
+	if m, ok := data.(map[string]any); ok {
+		s.events = append(s.events, m)
+	}
+	return nil
+}
+
+func (s *recordingSender) SendError(_ *gin.Context, message string, _ error) error {
+	s.events = append(s.events, map[string]any{"type": "error", "message": message})
+	return nil
+}
+
+func (s *recordingSender) types() []string {
+	result := make([]string, len(s.events))
+	for i, e := range s.events {
+		result[i], _ = e["type"].(string)
+	}
+	return result
+}
+
+func parserEvent(data map[string]any) parser.SSEEvent {
+	eventType, _ := data["type"].(string)
+	return parser.SSEEvent{Event: eventType, Data: data}
+}
+
+func newFailoverTestContext(sender StreamEventSender) *StreamProcessorContext {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	req := types.AnthropicRequest{Model: "claude-sonnet-4"}
+	ctx := NewStreamProcessorContext(c, req, &types.TokenWithUsage{}, sender, "msg_test", 10)
+	_ = ctx.SendInitialEvents(CreateAnthropicStreamEvents)
+	return ctx
+}
+
+func TestFirstContentBuffer_HoldsUntilContent(t *testing.T) {
+	inner := &recordingSender{}
+	ctx := newFailoverTestContext(newFirstContentBuffer(inner))
+
+	assert.Empty(t, inner.events, "首个内容事件前不应下发")
+	assert.True(t, ctx.canFailover())
+
+	esp := NewEventStreamProcessor(ctx)
+	err := esp.processEvent(parserEvent(map[string]any{
+		"type":  "content_block_delta",
+		"index": 0,
+		"delta": map[string]any{"type": "text_delta", "text": "hi"},
+	}))
+
+	assert.NoError(t, err)
+	assert.False(t, ctx.canFailover())
+	assert.Equal(t, "message_start", inner.types()[0])
+	assert.Contains(t, inner.types(), "content_block_delta")
+}
+
+func TestEventStreamProcessor_ExceptionBeforeContentFailsOver(t *testing.T) {
+	inner := &recordingSender{}
+	ctx := newFailoverTestContext(newFirstContentBuffer(inner))
+
+	err := NewEventStreamProcessor(ctx).processEvent(parserEvent(map[string]any{
+		"type":           "exception",
+		"exception_type": "ThrottlingException",
+	}))
+
+	assert.ErrorIs(t, err, ErrStreamFailedBeforeContent)
+	assert.Empty(t, inner.events, "失败前的缓冲事件不应下发")
+}
+
+func TestEventStreamProcessor_ExceptionAfterContentForwarded(t *testing.T) {
+	inner := &recordingSender{}
+	ctx := newFailoverTestContext(newFirstContentBuffer(inner))
+	esp := NewEventStreamProcessor(ctx)
+
+	_ = esp.processEvent(parserEvent(map[string]any{
+		"type":  "content_block_delta",
+		"index": 0,
+		"delta": map[string]any{"type": "text_delta", "text": "hi"},
+	}))
+	err := esp.processEvent(parserEvent(map[string]any{
+		"type":           "exception",
+		"exception_type": "ThrottlingException",
+	}))
+
+	assert.NoError(t, err)
+	assert.Contains(t, inner.types(), "exception")
+}
+
+func TestEventStreamProcessor_EmptyStreamDoesNotFailOver(t *testing.T) {
+	// 正常结束的空回复不是失败
+	ctx := newFailoverTestContext(newFirstContentBuffer(&recordingSender{}))
+	err := NewEventStreamProcessor(ctx).ProcessEventStream(bytes.NewReader(nil))
+	assert.NoError(t, err)
+}
+
+func TestEventStreamProcessor_ReadErrorBeforeContentFailsOver(t *testing.T) {
+	ctx := newFailoverTestContext(newFirstContentBuffer(&recordingSender{}))
+	err := NewEventStreamProcessor(ctx).ProcessEventStream(iotest.ErrReader(io.ErrUnexpectedEOF))
+	assert.ErrorIs(t, err, ErrStreamFailedBeforeContent)
+
+	// 未启用缓冲（最后一次尝试）时不触发重试
+	ctx = newFailoverTestContext(&recordingSender{})
+	err = NewEventStreamProcessor(ctx).ProcessEventStream(iotest.ErrReader(io.ErrUnexpectedEOF))
+	assert.NoError(t, err)
+}
+
+func TestEventStreamProcessor_InterruptAfterContentContinues(t *testing.T) {
+	inner := &recordingSender{}
+	ctx := newFailoverTestContext(inner)
+	ctx.allowContinuation = true
+	esp := NewEventStreamProcessor(ctx)
+
+	_ = esp.processEvent(parserEvent(map[string]any{
+		"type":  "content_block_delta",
+		"index": 0,
+		"delta": map[string]any{"type": "text_delta", "text": "Hello, wor"},
+	}))
+	err := esp.processEvent(parserEvent(map[string]any{
+		"type":           "exception",
+		"exception_type": "InternalServerException",
+	}))
+	assert.ErrorIs(t, err, ErrStreamInterrupted)
+	assert.Equal(t, "Hello, wor", ctx.emittedText.String())
+
+	// 续写流从下一个块索引开始，且不会重复 message_start
+	ctx.beginContinuation()
+	assert.Equal(t, 1, ctx.blockIndexOffset)
+	_ = NewEventStreamProcessor(ctx).processEvent(parserEvent(map[string]any{
+		"type":  "content_block_delta",
+		"index": 0,
+		"delta": map[string]any{"type": "text_delta", "text": "ld!"},
+	}))
+
+	assert.Equal(t, []string{
+		"message_start", "ping",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta",
+	}, inner.types())
+	assert.Equal(t, 1, inner.events[len(inner.events)-1]["index"])
+	assert.Equal(t, "Hello, world!", ctx.emittedText.String())
+}
+
+// assistantFrame 构造无头部（默认 assistantResponseEvent）的上游事件帧
+func assistantFrame(payload string) []byte {
+	frame := make([]byte, 12, 16+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(16+len(payload)))
+	frame = append(frame, payload...)
+	return append(frame, 0, 0, 0, 0)
+}
+
+func TestProcessStreamWithFailover_ContinuationRequestFails(t *testing.T) {
+	settingsMgr := config.GetDefaultSettingsManager()
+	original := settingsMgr.Get()
+	settings := original
+	settings.StreamContinuation = true
+	settings.MaxRetries = 2
+	assert.NoError(t, settingsMgr.Update(settings))
+	defer settingsMgr.Update(original)
+
+	calls := 0
+	originalExecute := ExecuteCWRequest
+	ExecuteCWRequest = func(c *gin.Context, req types.AnthropicRequest, token types.TokenInfo, isStream bool) (*http.Response, error) {
+		calls++
+		if calls == 1 {
+			// 输出部分内容后断流
+			body := io.MultiReader(bytes.NewReader(assistantFrame(`{"content":"Hello, wor"}`)), iotest.ErrReader(io.ErrUnexpectedEOF))
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(body)}, nil
+		}
+		// 续写请求失败：执行器照常写错误响应
+		RespondError(c, http.StatusServiceUnavailable, "%s", "所有 token 不可用")
+		return nil, errors.New("upstream unavailable")
+	}
+	defer func() { ExecuteCWRequest = originalExecute }()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	SetAuthServiceInContext(c, &stubAuthService{})
+
+	inner := &recordingSender{}
+	req := types.AnthropicRequest{Model: "claude-sonnet-4", Messages: []types.AnthropicRequestMessage{{Role: "user", Content: "hi"}}}
+	ctx, err := ProcessStreamWithFailover(c, req, &types.TokenWithUsage{}, inner, "msg_test", 10, CreateAnthropicStreamEvents)
+	assert.NoError(t, err, "续写失败时正常结束已输出的消息")
+	if assert.NotNil(t, ctx) {
+		defer ctx.Cleanup()
+		assert.NoError(t, ctx.SendFinalEvents())
+	}
+
+	assert.Equal(t, 2, calls)
+	assert.Empty(t, w.Body.String(), "续写失败不应向 SSE 流写入 JSON 错误")
+	eventTypes := inner.types()
+	assert.Contains(t, eventTypes, "content_block_stop")
+	assert.Contains(t, eventTypes, "message_delta")
+	assert.Equal(t, "message_stop", eventTypes[len(eventTypes)-1])
+}
+
+func TestEventStreamProcessor_NoContinuationAfterToolUse(t *testing.T) {
+	ctx := newFailoverTestContext(&recordingSender{})
+	ctx.allowContinuation = true
+	esp := NewEventStreamProcessor(ctx)
+
+	_ = esp.processEvent(parserEvent(map[string]any{
+		"type":  "content_block_start",
+		"index": 0,
+		"content_block": map[string]any{
+			"type": "tool_use", "id": "toolu_1", "name": "read_file",
+		},
+	}))
+	err := esp.processEvent(parserEvent(map[string]any{
+		"type":           "exception",
+		"exception_type": "InternalServerException",
+	}))
+	assert.NoError(t, err, "工具调用开始后不续写")
+}
+
+func TestBuildContinuationRequest(t *testing.T) {
+	req := types.AnthropicRequest{
+		Model:    "claude-sonnet-4",
+		Messages: []types.AnthropicRequestMessage{{Role: "user", Content: "hi"}},
+		Thinking: &types.ThinkingConfig{Type: "enabled"},
+	}
+
+	cont := buildContinuationRequest(req, "partial")
+
+	assert.Len(t, req.Messages, 1, "不修改原请求")
+	assert.Nil(t, cont.Thinking)
+	assert.Len(t, cont.Messages, 3)
+	assert.Equal(t, "assistant", cont.Messages[1].Role)
+	assert.Equal(t, "partial", cont.Messages[1].Content)
+	assert.Equal(t, "user", cont.Messages[2].Role)
+}
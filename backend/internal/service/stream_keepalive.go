@@ -0,0 +1,194 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"kiro2api/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeepaliveFormat 心跳帧格式
+type KeepaliveFormat int
+
+const (
+	// KeepaliveAnthropic message_start 下发后发送 event: ping，之前发送 SSE 注释行
+	KeepaliveAnthropic KeepaliveFormat = iota
+	// KeepaliveComment 仅发送 SSE 注释行（OpenAI 格式无 ping 事件）
+	KeepaliveComment
+)
+
+// keepaliveComment SSE 注释行，客户端解析时忽略
+const keepaliveComment = ": ping\n\n"
+
+// keepaliveWriter 串行化写入的 ResponseWriter，记录最后一次写入时间
+type keepaliveWriter struct {
+	gin.ResponseWriter
+	mu        sync.Mutex
+	lastWrite time.Time
+}
+
+func (w *keepaliveWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastWrite = time.Now()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *keepaliveWriter) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastWrite = time.Now()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *keepaliveWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *keepaliveWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *keepaliveWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ResponseWriter.Flush()
+}
+
+// idleFor 距最后一次写入的时长
+func (w *keepaliveWriter) idleFor() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return time.Since(w.lastWrite)
+}
+
+// KeepaliveSender 流式心跳发送器 (Decorator Pattern)
+// 客户端持续无数据时按间隔发送心跳，避免反向代理/SDK 因空闲断开连接
+// 事件整体加锁写入，心跳只会插在完整事件之间；ping 仅在客户端已收到 message_start
+// 且未收到 message_stop 时发送，与 SSEStateManager 的事件顺序约束一致
+// （首内容缓冲期间 message_start 尚未下发，此时只发注释行）
+type KeepaliveSender struct {
+	inner    StreamEventSender
+	format   KeepaliveFormat
+	writer   *keepaliveWriter
+	mu       sync.Mutex
+	started  bool // 客户端已收到 message_start
+	ended    bool // 客户端已收到 message_stop 或错误事件
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// StartKeepalive 包装发送器并启动心跳，间隔取自全局设置；调用方必须 Stop
+func StartKeepalive(c *gin.Context, inner StreamEventSender, format KeepaliveFormat) *KeepaliveSender {
+	return startKeepalive(c, inner, format, resolveKeepaliveInterval(config.GetDefaultSettingsManager().Get()))
+}
+
+// resolveKeepaliveInterval 计算心跳间隔（0=默认，负数=关闭）
+func resolveKeepaliveInterval(settings config.Settings) time.Duration {
+	switch {
+	case settings.StreamKeepaliveSec < 0:
+		return 0
+	case settings.StreamKeepaliveSec == 0:
+		return config.DefaultStreamKeepalive
+	default:
+		return time.Duration(settings.StreamKeepaliveSec) * time.Second
+	}
+}
+
+func startKeepalive(c *gin.Context, inner StreamEventSender, format KeepaliveFormat, interval time.Duration) *KeepaliveSender {
+	k := &KeepaliveSender{
+		inner:  inner,
+		format: format,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if interval <= 0 {
+		close(k.done)
+		return k
+	}
+
+	k.writer = &keepaliveWriter{ResponseWriter: c.Writer, lastWrite: time.Now()}
+	c.Writer = k.writer
+	go k.run(c, interval)
+	return k
+}
+
+func (k *KeepaliveSender) SendEvent(c *gin.Context, data any) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.inner.SendEvent(c, data); err != nil {
+		return err
+	}
+	if dataMap, ok := data.(map[string]any); ok {
+		switch dataMap["type"] {
+		case "message_start":
+			k.started = true
+		case "message_stop", "error":
+			k.ended = true
+		}
+	}
+	return nil
+}
+
+func (k *KeepaliveSender) SendError(c *gin.Context, message string, err error) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.ended = true
+	return k.inner.SendError(c, message, err)
+}
+
+// Stop 停止心跳并等待心跳协程退出（可重复调用）
+func (k *KeepaliveSender) Stop() {
+	k.stopOnce.Do(func() { close(k.stop) })
+	<-k.done
+}
+
+// run 心跳循环：仅在距最后一次写入满一个间隔时发送
+func (k *KeepaliveSender) run(c *gin.Context, interval time.Duration) {
+	defer close(k.done)
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-c.Request.Context().Done():
+			return
+		case <-timer.C:
+		}
+
+		if idle := k.writer.idleFor(); idle < interval {
+			timer.Reset(interval - idle)
+			continue
+		}
+		if err := k.ping(c); err != nil {
+			return
+		}
+		timer.Reset(interval)
+	}
+}
+
+// ping 发送一次心跳
+func (k *KeepaliveSender) ping(c *gin.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.ended {
+		return nil
+	}
+	if k.format == KeepaliveAnthropic && k.started {
+		return k.inner.SendEvent(c, map[string]any{"type": "ping"})
+	}
+	if _, err := k.writer.WriteString(keepaliveComment); err != nil {
+		return err
+	}
+	k.writer.Flush()
+	return nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"kiro2api/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testKeepaliveInterval = 20 * time.Millisecond
+
+func newKeepaliveTestContext() (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+	return c, w
+}
+
+func TestKeepalive_CommentBeforeMessageStart(t *testing.T) {
+	c, w := newKeepaliveTestContext()
+	k := startKeepalive(c, &AnthropicStreamSender{}, KeepaliveAnthropic, testKeepaliveInterval)
+
+	time.Sleep(4 * testKeepaliveInterval)
+	k.Stop()
+
+	body := w.Body.String()
+	assert.Contains(t, body, keepaliveComment)
+	assert.NotContains(t, body, "event: ping", "message_start 前不应发送 ping 事件")
+}
+
+func TestKeepalive_PingBetweenStartAndStop(t *testing.T) {
+	c, w := newKeepaliveTestContext()
+	k := startKeepalive(c, &AnthropicStreamSender{}, KeepaliveAnthropic, testKeepaliveInterval)
+
+	_ = k.SendEvent(c, map[string]any{"type": "message_start", "message": map[string]any{"id": "msg_test"}})
+	time.Sleep(4 * testKeepaliveInterval)
+	_ = k.SendEvent(c, map[string]any{"type": "message_stop"})
+	time.Sleep(4 * testKeepaliveInterval)
+	k.Stop()
+
+	body := w.Body.String()
+	startIdx := strings.Index(body, "event: message_start")
+	pingIdx := strings.Index(body, "event: ping")
+	stopIdx := strings.Index(body, "event: message_stop")
+	assert.True(t, startIdx >= 0 && pingIdx > startIdx && stopIdx > pingIdx, "ping 应位于 message_start 与 message_stop 之间")
+	assert.NotContains(t, body[stopIdx:], "ping", "message_stop 后不应再有心跳")
+}
+
+func TestKeepalive_CommentOnlyFormat(t *testing.T) {
+	c, w := newKeepaliveTestContext()
+	k := startKeepalive(c, &OpenAIStreamSender{}, KeepaliveComment, testKeepaliveInterval)
+
+	_ = k.SendEvent(c, map[string]any{"object": "chat.completion.chunk"})
+	time.Sleep(4 * testKeepaliveInterval)
+	k.Stop()
+
+	body := w.Body.String()
+	assert.Contains(t, body, keepaliveComment)
+	assert.NotContains(t, body, "ping\"")
+}
+
+func TestKeepalive_Disabled(t *testing.T) {
+	c, w := newKeepaliveTestContext()
+	original := c.Writer
+	k := startKeepalive(c, &AnthropicStreamSender{}, KeepaliveAnthropic, 0)
+
+	time.Sleep(2 * testKeepaliveInterval)
+	k.Stop()
+	k.Stop() // 可重复调用
+
+	assert.Equal(t, original, c.Writer)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestResolveKeepaliveInterval(t *testing.T) {
+	assert.Equal(t, config.DefaultStreamKeepalive, resolveKeepaliveInterval(config.Settings{}))
+	assert.Equal(t, 5*time.Second, resolveKeepaliveInterval(config.Settings{StreamKeepaliveSec: 5}))
+	assert.Equal(t, time.Duration(0), resolveKeepaliveInterval(config.Settings{StreamKeepaliveSec: -1}))
+}
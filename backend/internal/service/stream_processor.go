@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -59,6 +60,15 @@ type StreamProcessorContext struct {
 	thinkingParser       *ThinkingParser
 	thinkingBlockStarted bool // thinking 块是否已开始
 	thinkingBlockIndex   int  // thinking 块的索引
+
+	// 流中断续写
+	allowContinuation bool            // 已下发内容后断流时是否允许续写
+	blockIndexOffset  int             // 续写流的块索引偏移（接在已下发块之后）
+	emittedText       strings.Builder // 已下发的文本（续写时作为 assistant 历史）
+
+	// stop_sequences 模拟
+	stopMatcher   *StopSequenceMatcher
+	stopTextIndex int // 暂存文本所属的内容块索引
 }
 
 // NewStreamProcessorContext 创建流处理上下文
@@ -90,6 +100,7 @@ func NewStreamProcessorContext(
 		completedToolUseIds:   make(map[string]bool),
 		jsonBytesByBlockIndex: make(map[int]int),
 		thinkingParser:        NewThinkingParser(thinkingEnabled),
+		stopMatcher:           NewStopSequenceMatcher(req.StopSequences),
 	}
 }
 
@@ -283,6 +294,10 @@ func (ctx *StreamProcessorContext) SendFinalEvents() error {
 
 	// 确定stop_reason
 	stopReason := ctx.stopReasonManager.DetermineStopReason()
+	stopSequence := ctx.matchedStopSequence()
+	if stopSequence != "" {
+		stopReason = "stop_sequence"
+	}
 
 	logger.Debug("创建结束事件",
 		logger.String("stop_reason", stopReason),
@@ -291,6 +306,9 @@ func (ctx *StreamProcessorContext) SendFinalEvents() error {
 
 	// 创建并发送结束事件
 	finalEvents := CreateAnthropicFinalEvents(outputTokens, ctx.InputTokens, stopReason)
+	if stopSequence != "" {
+		finalEvents[0]["delta"].(map[string]any)["stop_sequence"] = stopSequence
+	}
 	for _, event := range finalEvents {
 		if err := ctx.sseStateManager.SendEvent(ctx.c, ctx.sender, event); err != nil {
 			logger.Error("结束事件发送违规", logger.Err(err))
@@ -302,6 +320,22 @@ func (ctx *StreamProcessorContext) SendFinalEvents() error {
 	return nil
 }
 
+// matchedStopSequence 命中的停止序列（未设置或未命中为空）
+func (ctx *StreamProcessorContext) matchedStopSequence() string {
+	if ctx.stopMatcher == nil {
+		return ""
+	}
+	return ctx.stopMatcher.Matched()
+}
+
+// stopSequenceErr 命中停止序列后返回 errStopSequenceMatched，结束读取上游
+func (ctx *StreamProcessorContext) stopSequenceErr() error {
+	if ctx.matchedStopSequence() != "" {
+		return errStopSequenceMatched
+	}
+	return nil
+}
+
 // 辅助函数
 
 // extractIndex 从数据映射中提取索引
@@ -356,6 +390,9 @@ func (esp *EventStreamProcessor) ProcessEventStream(reader io.Reader) error {
 						logger.Int("read_bytes", n),
 						logger.String("direction", "upstream_response"),
 					)...)
+				if esp.ctx.canFailover() {
+					return fmt.Errorf("%w: %v", ErrStreamFailedBeforeContent, parseErr)
+				}
 			}
 
 			esp.ctx.TotalProcessedEvents += len(events)
@@ -363,6 +400,15 @@ func (esp *EventStreamProcessor) ProcessEventStream(reader io.Reader) error {
 			// 处理每个事件
 			for _, event := range events {
 				if err := esp.processEvent(event); err != nil {
+					if errors.Is(err, errStopSequenceMatched) {
+						// 命中停止序列：关闭上游连接，不再读取剩余输出
+						if closer, ok := reader.(io.Closer); ok {
+							closer.Close()
+						}
+						logger.Debug("命中停止序列，结束上游流",
+							AddReqFields(esp.ctx.c, logger.String("stop_sequence", esp.ctx.matchedStopSequence()))...)
+						return nil
+					}
 					return err
 				}
 			}
@@ -382,11 +428,19 @@ func (esp *EventStreamProcessor) ProcessEventStream(reader io.Reader) error {
 						logger.String("direction", "upstream_response"),
 					)...)
 			}
+			// 正常结束（EOF）的空回复是合法结果，只有读取错误才切换 token
+			if err != io.EOF && esp.ctx.canFailover() {
+				return fmt.Errorf("%w: 上游流在返回内容前中断: %v", ErrStreamFailedBeforeContent, err)
+			}
+			if err != io.EOF && esp.ctx.canContinue() {
+				return fmt.Errorf("%w: %v", ErrStreamInterrupted, err)
+			}
 			break
 		}
 	}
 
-	// 直传模式：无需冲刷剩余文本
+	// 下发 stop_sequences 扫描暂存的文本尾部
+	esp.flushStopSequenceText()
 	return nil
 }
 
@@ -400,6 +454,19 @@ func (esp *EventStreamProcessor) processEvent(event parser.SSEEvent) error {
 
 	eventType, _ := dataMap["type"].(string)
 
+	// 续写流的块索引接在已下发块之后
+	if esp.ctx.blockIndexOffset > 0 {
+		if idx := extractIndex(dataMap); idx >= 0 {
+			dataMap["index"] = idx + esp.ctx.blockIndexOffset
+		}
+	}
+
+	// 非文本增量事件前先下发 stop_sequences 扫描暂存的文本，保持事件顺序
+	text, isText := textDeltaContent(dataMap)
+	if !isText {
+		esp.flushStopSequenceText()
+	}
+
 	// 调试：记录所有事件类型
 	logger.Debug("收到事件",
 		logger.String("event_type", eventType),
@@ -414,9 +481,14 @@ func (esp *EventStreamProcessor) processEvent(event parser.SSEEvent) error {
 		// 检查是否需要处理 thinking 解析
 		if esp.ctx.thinkingParser != nil && esp.ctx.thinkingParser.enabled {
 			if handled := esp.handleThinkingDelta(dataMap); handled {
-				return nil // thinking 解析器已处理，不直传原始事件
+				return esp.ctx.stopSequenceErr() // thinking 解析器已处理，不直传原始事件
 			}
 		}
+		// 设置了 stop_sequences 时文本经扫描后下发
+		if isText && esp.ctx.stopMatcher != nil {
+			esp.sendTextDelta(text, extractIndex(dataMap))
+			return esp.ctx.stopSequenceErr()
+		}
 		// 直传：不做聚合
 
 	case "content_block_stop":
@@ -429,6 +501,21 @@ func (esp *EventStreamProcessor) processEvent(event parser.SSEEvent) error {
 		if esp.handleExceptionEvent(dataMap) {
 			return nil // 已转换并发送，不转发原始exception事件
 		}
+		if esp.ctx.canFailover() {
+			return fmt.Errorf("%w: %s", ErrStreamFailedBeforeContent, getStringField(dataMap, "exception_type"))
+		}
+		if esp.ctx.canContinue() {
+			return fmt.Errorf("%w: %s", ErrStreamInterrupted, getStringField(dataMap, "exception_type"))
+		}
+
+	case "error":
+		// 上游错误事件：尚未下发内容时切换 token 重试，已下发内容时尝试续写
+		if esp.ctx.canFailover() {
+			return fmt.Errorf("%w: %s", ErrStreamFailedBeforeContent, getStringField(dataMap, "error_code"))
+		}
+		if esp.ctx.canContinue() {
+			return fmt.Errorf("%w: %s", ErrStreamInterrupted, getStringField(dataMap, "error_code"))
+		}
 
 	case "metering":
 		// 计量事件：记录 credit 使用量，不转发给客户端
@@ -479,6 +566,7 @@ func (esp *EventStreamProcessor) processEvent(event parser.SSEEvent) error {
 				// 文本内容增量
 				if text, ok := delta["text"].(string); ok {
 					esp.ctx.TotalOutputTokens += esp.ctx.tokenEstimator.EstimateTextTokens(text)
+					esp.ctx.emittedText.WriteString(text)
 				}
 
 			case "input_json_delta":
@@ -705,6 +793,38 @@ func (esp *EventStreamProcessor) sendTextChunk(content string, index int) {
 	}
 
 	// 发送 text_delta
+	esp.sendTextDelta(content, index)
+}
+
+// sendTextDelta 发送文本增量；设置了 stop_sequences 时先扫描（跨分片的停止序列会暂存尾部），命中后截断并停止下发
+func (esp *EventStreamProcessor) sendTextDelta(content string, index int) {
+	if m := esp.ctx.stopMatcher; m != nil {
+		if m.Matched() != "" {
+			return
+		}
+		esp.ctx.stopTextIndex = index
+		content, _ = m.Feed(content)
+	}
+	esp.emitTextDelta(content, index)
+}
+
+// flushStopSequenceText 下发 stop_sequences 扫描暂存的文本尾部
+func (esp *EventStreamProcessor) flushStopSequenceText() {
+	if esp.ctx.stopMatcher != nil {
+		esp.emitTextDelta(esp.ctx.stopMatcher.Flush(), esp.ctx.stopTextIndex)
+	}
+}
+
+// emitTextDelta 下发 text_delta 并累计 token
+func (esp *EventStreamProcessor) emitTextDelta(content string, index int) {
+	if content == "" {
+		return
+	}
+	if esp.ctx.FirstContentTime.IsZero() {
+		esp.ctx.FirstContentTime = time.Now()
+		esp.ctx.TTFB = esp.ctx.FirstContentTime.Sub(esp.ctx.StartTime).Milliseconds()
+	}
+
 	deltaEvent := map[string]any{
 		"type":  "content_block_delta",
 		"index": index,
@@ -714,9 +834,23 @@ func (esp *EventStreamProcessor) sendTextChunk(content string, index int) {
 		},
 	}
 	_ = esp.ctx.sseStateManager.SendEvent(esp.ctx.c, esp.ctx.sender, deltaEvent)
+	esp.ctx.emittedText.WriteString(content)
 
 	// 累计 token
 	esp.ctx.TotalOutputTokens += esp.ctx.tokenEstimator.EstimateTextTokens(content)
 	esp.ctx.c.Writer.Flush()
 }
 
+// textDeltaContent 读取 text_delta 事件的文本
+func textDeltaContent(dataMap map[string]any) (string, bool) {
+	if dataMap["type"] != "content_block_delta" {
+		return "", false
+	}
+	delta, _ := dataMap["delta"].(map[string]any)
+	if delta["type"] != "text_delta" {
+		return "", false
+	}
+	text, _ := delta["text"].(string)
+	return text, true
+}
+
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"kiro2api/internal/auth"
+	"kiro2api/internal/config"
+)
+
+var (
+	// ErrFirstByteTimeout 上游在首字节超时内未返回任何数据
+	ErrFirstByteTimeout = errors.New("上游首字节超时")
+	// ErrStreamIdleTimeout 上游数据块间空闲超时
+	ErrStreamIdleTimeout = errors.New("上游流空闲超时")
+)
+
+// streamTimeouts 流式请求生效的超时配置
+type streamTimeouts struct {
+	firstByte time.Duration
+	idle      time.Duration
+	total     time.Duration // 0 = 不限制
+}
+
+// resolveStreamTimeouts 合并全局与分组设置，计算流式超时
+func resolveStreamTimeouts(global config.Settings, gs auth.GroupSettings) streamTimeouts {
+	resolved := gs.Resolve(global)
+	return streamTimeouts{
+		firstByte: time.Duration(resolved.StreamFirstByteTimeoutSec) * time.Second,
+		idle:      time.Duration(resolved.StreamIdleTimeoutSec) * time.Second,
+		total:     time.Duration(resolved.StreamTotalTimeoutSec) * time.Second,
+	}
+}
+
+// streamWatchdog 由读取驱动的流式超时看门狗
+// 首字节前按首字节超时计时（含等待响应头），之后每收到数据重置为空闲超时，超时即取消上游请求
+type streamWatchdog struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	timer  *time.Timer
+	idle   time.Duration
+	err    error // 已触发的超时
+}
+
+// startStreamWatchdog 创建带看门狗的上游请求上下文
+func startStreamWatchdog(parent context.Context, t streamTimeouts) (context.Context, *streamWatchdog) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if t.total > 0 {
+		ctx, cancel = context.WithTimeout(parent, t.total)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+
+	wd := &streamWatchdog{cancel: cancel, idle: t.idle}
+	if t.firstByte > 0 {
+		wd.timer = time.AfterFunc(t.firstByte, func() { wd.fire(ErrFirstByteTimeout) })
+	}
+	return ctx, wd
+}
+
+// fire 记录超时原因并取消上游请求
+func (wd *streamWatchdog) fire(err error) {
+	wd.mu.Lock()
+	if wd.err == nil {
+		wd.err = err
+	}
+	wd.mu.Unlock()
+	wd.cancel()
+}
+
+// touch 收到数据，重新按空闲超时计时
+func (wd *streamWatchdog) touch() {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	if wd.err != nil {
+		return
+	}
+	if wd.timer != nil {
+		wd.timer.Stop()
+	}
+	if wd.idle > 0 {
+		wd.timer = time.AfterFunc(wd.idle, func() { wd.fire(ErrStreamIdleTimeout) })
+	} else {
+		wd.timer = nil
+	}
+}
+
+// Err 已触发的超时（未超时返回 nil）
+func (wd *streamWatchdog) Err() error {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	return wd.err
+}
+
+// Stop 停止计时并释放上下文
+func (wd *streamWatchdog) Stop() {
+	wd.mu.Lock()
+	if wd.timer != nil {
+		wd.timer.Stop()
+	}
+	wd.mu.Unlock()
+	wd.cancel()
+}
+
+// wrapError 将看门狗取消导致的错误替换为具体超时原因
+func (wd *streamWatchdog) wrapError(err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	if timeoutErr := wd.Err(); timeoutErr != nil {
+		return timeoutErr
+	}
+	return err
+}
+
+// watchdogReader 读取上游响应体并驱动看门狗
+type watchdogReader struct {
+	io.ReadCloser
+	wd *streamWatchdog
+}
+
+func (r *watchdogReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.wd.touch()
+	}
+	return n, r.wd.wrapError(err)
+}
+
+// withUpstreamDeadline 为上游请求设置超时
+// 非流式使用 RequestTimeoutSec 总超时；流式由看门狗控制首字节/空闲超时，总时长仅作为可选上限
+func withUpstreamDeadline(req *http.Request, isStream bool, settings config.Settings, gs auth.GroupSettings) (*http.Request, *streamWatchdog, context.CancelFunc) {
+	if !isStream {
+		ctx, cancel := context.WithTimeout(req.Context(), time.Duration(settings.RequestTimeoutSec)*time.Second)
+		return req.WithContext(ctx), nil, cancel
+	}
+	ctx, wd := startStreamWatchdog(req.Context(), resolveStreamTimeouts(settings, gs))
+	return req.WithContext(ctx), wd, wd.Stop
+}
+
+// attachWatchdog 将看门狗挂到响应体上（非流式直接返回原响应体）
+func attachWatchdog(body io.ReadCloser, wd *streamWatchdog) io.ReadCloser {
+	if wd == nil {
+		return body
+	}
+	return &watchdogReader{ReadCloser: body, wd: wd}
+}
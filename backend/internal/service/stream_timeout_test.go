@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"kiro2api/internal/auth"
+	"kiro2api/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowReader 按给定间隔逐块返回数据，读取受上下文取消约束
+type slowReader struct {
+	ctx    context.Context
+	delays []time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.delays) == 0 {
+		return 0, io.EOF
+	}
+	delay := r.delays[0]
+	r.delays = r.delays[1:]
+	select {
+	case <-time.After(delay):
+		p[0] = 'x'
+		return 1, nil
+	case <-r.ctx.Done():
+		return 0, r.ctx.Err()
+	}
+}
+
+func (r *slowReader) Close() error { return nil }
+
+func readAllWithWatchdog(t streamTimeouts, delays ...time.Duration) (int, error) {
+	ctx, wd := startStreamWatchdog(context.Background(), t)
+	defer wd.Stop()
+	data, err := io.ReadAll(attachWatchdog(&slowReader{ctx: ctx, delays: delays}, wd))
+	return len(data), err
+}
+
+func TestStreamWatchdog_FirstByteTimeout(t *testing.T) {
+	n, err := readAllWithWatchdog(streamTimeouts{firstByte: 20 * time.Millisecond, idle: time.Second}, time.Second)
+	assert.Equal(t, 0, n)
+	assert.ErrorIs(t, err, ErrFirstByteTimeout)
+}
+
+func TestStreamWatchdog_IdleTimeout(t *testing.T) {
+	n, err := readAllWithWatchdog(streamTimeouts{firstByte: time.Second, idle: 20 * time.Millisecond},
+		time.Millisecond, time.Millisecond, time.Second)
+	assert.Equal(t, 2, n)
+	assert.ErrorIs(t, err, ErrStreamIdleTimeout)
+}
+
+func TestStreamWatchdog_LongHealthyStream(t *testing.T) {
+	// 总时长超过空闲超时，但每个数据块间隔都在空闲超时内
+	delays := make([]time.Duration, 10)
+	for i := range delays {
+		delays[i] = 10 * time.Millisecond
+	}
+	n, err := readAllWithWatchdog(streamTimeouts{firstByte: 50 * time.Millisecond, idle: 50 * time.Millisecond}, delays...)
+	assert.Equal(t, 10, n)
+	assert.NoError(t, err)
+}
+
+func TestResolveStreamTimeouts(t *testing.T) {
+	global := config.Settings{StreamIdleTimeoutSec: 30, StreamTotalTimeoutSec: 600}
+
+	timeouts := resolveStreamTimeouts(global, auth.GroupSettings{StreamIdleTimeoutSec: 90})
+	assert.Equal(t, config.DefaultStreamFirstByteTimeout, timeouts.firstByte)
+	assert.Equal(t, 90*time.Second, timeouts.idle)
+	assert.Equal(t, 600*time.Second, timeouts.total)
+
+	timeouts = resolveStreamTimeouts(config.Settings{}, auth.GroupSettings{})
+	assert.Equal(t, time.Duration(0), timeouts.total, "未配置总时长上限时不限制")
+}
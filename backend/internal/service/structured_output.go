@@ -0,0 +1,290 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"kiro2api/internal/converter"
+	"kiro2api/internal/logger"
+	"kiro2api/internal/types"
+	"kiro2api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StructuredOutput 结构化输出响应处理
+// 请求侧由 converter.ApplyOutputFormat 注入合成工具，这里将该工具的输入还原为回答文本并按 schema 校验
+type StructuredOutput struct {
+	schema     map[string]any
+	blocks     map[int]bool     // 合成工具所在的内容块 index
+	textBlocks map[int]bool     // 文本内容块 index
+	dropped    map[int]bool     // 因调用合成工具而丢弃的文本块 index
+	held       []map[string]any // 尚不确定是否调用合成工具时暂存的文本事件
+	toolJSON   strings.Builder  // 合成工具的输入
+	text       strings.Builder  // 模型直接输出的文本（未调用合成工具时作为回答）
+	usedTool   bool
+	otherTools bool
+}
+
+// NewStructuredOutput 创建结构化输出处理器（请求未设置 output_format 时返回 nil）
+func NewStructuredOutput(req types.AnthropicRequest) *StructuredOutput {
+	if req.OutputFormat == nil {
+		return nil
+	}
+	return &StructuredOutput{
+		schema:     req.OutputFormat.Schema,
+		blocks:     make(map[int]bool),
+		textBlocks: make(map[int]bool),
+		dropped:    make(map[int]bool),
+	}
+}
+
+// OtherToolUse 是否调用了业务工具（此时 stop_reason 保持 tool_use）
+func (s *StructuredOutput) OtherToolUse() bool {
+	return s.otherTools
+}
+
+// TransformEvent 改写流事件，返回应下发的事件（可能为空或多个，不修改原事件）
+// 合成工具事件改写为文本事件；模型直接输出的文本先暂存：随后调用了合成工具则丢弃（与非流式一致），
+// 否则在下一个非文本内容块或 message_delta 之前按原顺序下发
+func (s *StructuredOutput) TransformEvent(event map[string]any) []map[string]any {
+	index := extractIndex(event)
+	switch event["type"] {
+	case "content_block_start":
+		block, _ := event["content_block"].(map[string]any)
+		switch block["type"] {
+		case "text":
+			s.textBlocks[index] = true
+			return s.hold(event)
+		case "tool_use":
+			if name, _ := block["name"].(string); name != converter.StructuredOutputToolName {
+				s.otherTools = true
+				return s.release(event)
+			}
+			s.usedTool = true
+			s.blocks[index] = true
+			for _, held := range s.held {
+				s.dropped[extractIndex(held)] = true
+			}
+			s.held = nil
+			return []map[string]any{s.reindex(map[string]any{
+				"type":          "content_block_start",
+				"index":         event["index"],
+				"content_block": map[string]any{"type": "text", "text": ""},
+			})}
+		}
+		return s.release(event)
+
+	case "content_block_delta":
+		delta, _ := event["delta"].(map[string]any)
+		switch delta["type"] {
+		case "text_delta":
+			text, _ := delta["text"].(string)
+			s.text.WriteString(text)
+			if s.textBlocks[index] {
+				return s.hold(event)
+			}
+		case "input_json_delta":
+			if !s.blocks[index] {
+				return s.release(event)
+			}
+			partial, _ := delta["partial_json"].(string)
+			s.toolJSON.WriteString(partial)
+			return []map[string]any{s.reindex(map[string]any{
+				"type":  "content_block_delta",
+				"index": event["index"],
+				"delta": map[string]any{"type": "text_delta", "text": partial},
+			})}
+		}
+		return s.release(event)
+
+	case "content_block_stop":
+		if s.textBlocks[index] {
+			return s.hold(event)
+		}
+		return s.release(event)
+
+	case "message_delta":
+		delta, _ := event["delta"].(map[string]any)
+		if delta["stop_reason"] != "tool_use" || s.otherTools {
+			return s.release(event)
+		}
+		rewritten := make(map[string]any, len(event))
+		for k, v := range event {
+			rewritten[k] = v
+		}
+		newDelta := make(map[string]any, len(delta))
+		for k, v := range delta {
+			newDelta[k] = v
+		}
+		newDelta["stop_reason"] = "end_turn"
+		rewritten["delta"] = newDelta
+		return s.release(rewritten)
+
+	case "message_stop":
+		return s.release(event)
+	}
+	// message_start、ping 等与内容块无关的事件不影响暂存的文本
+	return []map[string]any{event}
+}
+
+// Flush 返回仍在暂存的文本事件（流在 message_delta 之前结束时调用）
+func (s *StructuredOutput) Flush() []map[string]any {
+	return s.release()
+}
+
+// hold 暂存文本事件；已调用合成工具时丢弃
+func (s *StructuredOutput) hold(event map[string]any) []map[string]any {
+	if s.usedTool {
+		s.dropped[extractIndex(event)] = true
+		return nil
+	}
+	s.held = append(s.held, event)
+	return nil
+}
+
+// release 按原顺序返回暂存的文本事件与当前事件
+func (s *StructuredOutput) release(events ...map[string]any) []map[string]any {
+	out := make([]map[string]any, 0, len(s.held)+len(events))
+	for _, event := range append(s.held, events...) {
+		out = append(out, s.reindex(event))
+	}
+	s.held = nil
+	return out
+}
+
+// reindex 丢弃文本块后前移后续内容块的 index，保持 index 连续
+func (s *StructuredOutput) reindex(event map[string]any) map[string]any {
+	index := extractIndex(event)
+	if index < 0 || len(s.dropped) == 0 {
+		return event
+	}
+	shift := 0
+	for dropped := range s.dropped {
+		if dropped < index {
+			shift++
+		}
+	}
+	if shift == 0 {
+		return event
+	}
+	rewritten := make(map[string]any, len(event))
+	for k, v := range event {
+		rewritten[k] = v
+	}
+	rewritten["index"] = index - shift
+	return rewritten
+}
+
+// UnwrapBlocks 将非流式响应中的合成工具调用替换为 JSON 文本块并校验
+func (s *StructuredOutput) UnwrapBlocks(blocks []map[string]any) ([]map[string]any, error) {
+	rest := make([]map[string]any, 0, len(blocks))
+	for _, block := range blocks {
+		switch block["type"] {
+		case "text":
+			text, _ := block["text"].(string)
+			s.text.WriteString(text)
+		case "tool_use":
+			if name, _ := block["name"].(string); name == converter.StructuredOutputToolName {
+				input := block["input"]
+				if input == nil {
+					input = map[string]any{}
+				}
+				data, err := utils.SafeMarshal(input)
+				if err != nil {
+					return nil, err
+				}
+				s.usedTool = true
+				s.toolJSON.Reset()
+				s.toolJSON.Write(data)
+				continue
+			}
+			s.otherTools = true
+		}
+		rest = append(rest, block)
+	}
+
+	answer, err := s.Result()
+	if err != nil || !s.usedTool {
+		return rest, err
+	}
+
+	// 调用了合成工具时以工具输入作为唯一的文本回答
+	unwrapped := []map[string]any{{"type": "text", "text": answer}}
+	for _, block := range rest {
+		if block["type"] != "text" {
+			unwrapped = append(unwrapped, block)
+		}
+	}
+	return unwrapped, nil
+}
+
+// Result 返回最终回答并按 schema 校验（优先使用合成工具输入，否则使用模型输出的文本）
+// 仅调用了业务工具时本轮没有最终回答，不做校验
+func (s *StructuredOutput) Result() (string, error) {
+	if s.otherTools && !s.usedTool {
+		return "", nil
+	}
+	answer := s.text.String()
+	if s.usedTool {
+		answer = s.toolJSON.String()
+	}
+
+	var value any
+	if err := utils.SafeUnmarshal([]byte(strings.TrimSpace(answer)), &value); err != nil {
+		return answer, fmt.Errorf("结构化输出不是合法的 JSON: %v", err)
+	}
+	if err := converter.ValidateJSONSchema(value, s.schema); err != nil {
+		return answer, fmt.Errorf("结构化输出不符合 JSON Schema: %v", err)
+	}
+	return answer, nil
+}
+
+// StructuredOutputSender Anthropic 流的结构化输出发送器：改写合成工具事件，结束前校验回答
+// 校验失败时以 error 事件代替 message_delta / message_stop
+type StructuredOutputSender struct {
+	inner  StreamEventSender
+	output *StructuredOutput
+	failed bool
+}
+
+// NewStructuredOutputSender 包装流事件发送器
+func NewStructuredOutputSender(inner StreamEventSender, output *StructuredOutput) *StructuredOutputSender {
+	return &StructuredOutputSender{inner: inner, output: output}
+}
+
+func (s *StructuredOutputSender) SendEvent(c *gin.Context, data any) error {
+	event, ok := data.(map[string]any)
+	if !ok {
+		return s.inner.SendEvent(c, data)
+	}
+	for _, event := range s.output.TransformEvent(event) {
+		if err := s.send(c, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *StructuredOutputSender) send(c *gin.Context, event map[string]any) error {
+	switch event["type"] {
+	case "message_delta":
+		if _, err := s.output.Result(); err != nil {
+			s.failed = true
+			logger.Warn("结构化输出校验失败", AddReqFields(c, logger.Err(err))...)
+			return s.inner.SendEvent(c, map[string]any{
+				"type":  "error",
+				"error": map[string]any{"type": "api_error", "message": err.Error()},
+			})
+		}
+	case "message_stop":
+		if s.failed {
+			return nil
+		}
+	}
+	return s.inner.SendEvent(c, event)
+}
+
+func (s *StructuredOutputSender) SendError(c *gin.Context, message string, err error) error {
+	return s.inner.SendError(c, message, err)
+}
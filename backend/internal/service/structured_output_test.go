@@ -0,0 +1,186 @@
+package service
+
+import (
+	"testing"
+
+	"kiro2api/internal/converter"
+	"kiro2api/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStructuredOutput() *StructuredOutput {
+	return NewStructuredOutput(types.AnthropicRequest{OutputFormat: &types.OutputFormat{
+		Type: "json_schema",
+		Schema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"answer": map[string]any{"type": "string"}},
+			"required":   []any{"answer"},
+		},
+	}})
+}
+
+func TestStructuredOutput_TransformEvent(t *testing.T) {
+	s := newTestStructuredOutput()
+
+	start := s.TransformEvent(map[string]any{
+		"type":          "content_block_start",
+		"index":         0,
+		"content_block": map[string]any{"type": "tool_use", "id": "toolu_1", "name": converter.StructuredOutputToolName, "input": map[string]any{}},
+	})
+	assert.Len(t, start, 1)
+	assert.Equal(t, map[string]any{"type": "text", "text": ""}, start[0]["content_block"])
+
+	original := map[string]any{"type": "content_block_delta", "index": 0, "delta": map[string]any{"type": "input_json_delta", "partial_json": `{"answer":`}}
+	delta := s.TransformEvent(original)
+	assert.Equal(t, map[string]any{"type": "text_delta", "text": `{"answer":`}, delta[0]["delta"])
+	assert.Equal(t, "input_json_delta", original["delta"].(map[string]any)["type"], "不修改原事件")
+	s.TransformEvent(map[string]any{"type": "content_block_delta", "index": 0, "delta": map[string]any{"type": "input_json_delta", "partial_json": `"42"}`}})
+
+	end := s.TransformEvent(map[string]any{"type": "message_delta", "delta": map[string]any{"stop_reason": "tool_use"}})
+	assert.Equal(t, "end_turn", end[0]["delta"].(map[string]any)["stop_reason"])
+
+	answer, err := s.Result()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"answer":"42"}`, answer)
+}
+
+func TestStructuredOutput_OtherToolKeepsToolUse(t *testing.T) {
+	s := newTestStructuredOutput()
+	s.TransformEvent(map[string]any{
+		"type":          "content_block_start",
+		"index":         0,
+		"content_block": map[string]any{"type": "tool_use", "id": "toolu_1", "name": "get_weather"},
+	})
+	end := s.TransformEvent(map[string]any{"type": "message_delta", "delta": map[string]any{"stop_reason": "tool_use"}})
+	assert.Equal(t, "tool_use", end[0]["delta"].(map[string]any)["stop_reason"])
+	_, err := s.Result()
+	assert.NoError(t, err, "只调用业务工具时不校验")
+}
+
+func TestStructuredOutput_HoldsTextUntilToolDecided(t *testing.T) {
+	textBlock := func(index int, text string) []map[string]any {
+		return []map[string]any{
+			{"type": "content_block_start", "index": index, "content_block": map[string]any{"type": "text", "text": ""}},
+			{"type": "content_block_delta", "index": index, "delta": map[string]any{"type": "text_delta", "text": text}},
+			{"type": "content_block_stop", "index": index},
+		}
+	}
+
+	// 调用了合成工具：前置文本被丢弃，合成工具块前移到 index 0
+	s := newTestStructuredOutput()
+	for _, event := range textBlock(0, "Here you go:") {
+		assert.Empty(t, s.TransformEvent(event))
+	}
+	assert.Len(t, s.TransformEvent(map[string]any{"type": "ping"}), 1, "与内容块无关的事件直接下发")
+	start := s.TransformEvent(map[string]any{
+		"type":          "content_block_start",
+		"index":         1,
+		"content_block": map[string]any{"type": "tool_use", "id": "toolu_1", "name": converter.StructuredOutputToolName},
+	})
+	assert.Len(t, start, 1)
+	assert.Equal(t, 0, start[0]["index"])
+	delta := s.TransformEvent(map[string]any{"type": "content_block_delta", "index": 1, "delta": map[string]any{"type": "input_json_delta", "partial_json": `{"answer":"42"}`}})
+	assert.Equal(t, 0, delta[0]["index"])
+	for _, event := range textBlock(2, "done") {
+		assert.Empty(t, s.TransformEvent(event), "合成工具之后的文本同样丢弃")
+	}
+	end := s.TransformEvent(map[string]any{"type": "message_delta", "delta": map[string]any{"stop_reason": "tool_use"}})
+	assert.Len(t, end, 1)
+
+	// 未调用合成工具：文本在 message_delta 之前按原顺序下发
+	s = newTestStructuredOutput()
+	for _, event := range textBlock(0, `{"answer":"ok"}`) {
+		assert.Empty(t, s.TransformEvent(event))
+	}
+	end = s.TransformEvent(map[string]any{"type": "message_delta", "delta": map[string]any{"stop_reason": "end_turn"}})
+	assert.Equal(t, []any{"content_block_start", "content_block_delta", "content_block_stop", "message_delta"}, eventTypes(end))
+	_, err := s.Result()
+	assert.NoError(t, err)
+
+	// 调用业务工具：文本在工具块之前下发
+	s = newTestStructuredOutput()
+	for _, event := range textBlock(0, "Let me check.") {
+		s.TransformEvent(event)
+	}
+	tool := s.TransformEvent(map[string]any{
+		"type":          "content_block_start",
+		"index":         1,
+		"content_block": map[string]any{"type": "tool_use", "id": "toolu_1", "name": "get_weather"},
+	})
+	assert.Equal(t, []any{"content_block_start", "content_block_delta", "content_block_stop", "content_block_start"}, eventTypes(tool))
+	assert.Equal(t, 1, tool[3]["index"])
+}
+
+func eventTypes(events []map[string]any) []any {
+	got := make([]any, 0, len(events))
+	for _, event := range events {
+		got = append(got, event["type"])
+	}
+	return got
+}
+
+func TestStructuredOutput_UnwrapBlocks(t *testing.T) {
+	s := newTestStructuredOutput()
+	blocks, err := s.UnwrapBlocks([]map[string]any{
+		{"type": "text", "text": "Here you go:"},
+		{"type": "tool_use", "id": "toolu_1", "name": converter.StructuredOutputToolName, "input": map[string]any{"answer": "42"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"type": "text", "text": `{"answer":"42"}`}}, blocks)
+	assert.False(t, s.OtherToolUse())
+
+	// 未调用合成工具时校验文本回答
+	s = newTestStructuredOutput()
+	_, err = s.UnwrapBlocks([]map[string]any{{"type": "text", "text": `{"answer":"ok"}`}})
+	assert.NoError(t, err)
+
+	s = newTestStructuredOutput()
+	_, err = s.UnwrapBlocks([]map[string]any{{"type": "tool_use", "name": converter.StructuredOutputToolName, "input": map[string]any{"answer": 1}}})
+	assert.Error(t, err)
+
+	s = newTestStructuredOutput()
+	_, err = s.UnwrapBlocks([]map[string]any{{"type": "text", "text": "not json"}})
+	assert.Error(t, err)
+}
+
+func TestStructuredOutputSender_ValidationFailure(t *testing.T) {
+	c, w := newKeepaliveTestContext()
+	s := NewStructuredOutputSender(&AnthropicStreamSender{}, newTestStructuredOutput())
+
+	_ = s.SendEvent(c, map[string]any{"type": "content_block_start", "index": 0, "content_block": map[string]any{"type": "text", "text": ""}})
+	_ = s.SendEvent(c, map[string]any{"type": "content_block_delta", "index": 0, "delta": map[string]any{"type": "text_delta", "text": "plain text"}})
+	_ = s.SendEvent(c, map[string]any{"type": "message_delta", "delta": map[string]any{"stop_reason": "end_turn"}})
+	_ = s.SendEvent(c, map[string]any{"type": "message_stop"})
+
+	body := w.Body.String()
+	assert.Contains(t, body, "event: error")
+	assert.NotContains(t, body, "event: message_delta")
+	assert.NotContains(t, body, "event: message_stop")
+}
+
+func TestStructuredOutputSender_DropsTextBeforeTool(t *testing.T) {
+	c, w := newKeepaliveTestContext()
+	s := NewStructuredOutputSender(&AnthropicStreamSender{}, newTestStructuredOutput())
+
+	_ = s.SendEvent(c, map[string]any{"type": "content_block_start", "index": 0, "content_block": map[string]any{"type": "text", "text": ""}})
+	_ = s.SendEvent(c, map[string]any{"type": "content_block_delta", "index": 0, "delta": map[string]any{"type": "text_delta", "text": "Here you go:"}})
+	_ = s.SendEvent(c, map[string]any{"type": "content_block_stop", "index": 0})
+	_ = s.SendEvent(c, map[string]any{
+		"type":          "content_block_start",
+		"index":         1,
+		"content_block": map[string]any{"type": "tool_use", "id": "toolu_1", "name": converter.StructuredOutputToolName},
+	})
+	_ = s.SendEvent(c, map[string]any{"type": "content_block_delta", "index": 1, "delta": map[string]any{"type": "input_json_delta", "partial_json": `{"answer":"42"}`}})
+	_ = s.SendEvent(c, map[string]any{"type": "content_block_stop", "index": 1})
+	_ = s.SendEvent(c, map[string]any{"type": "message_delta", "delta": map[string]any{"stop_reason": "tool_use"}})
+	_ = s.SendEvent(c, map[string]any{"type": "message_stop"})
+
+	body := w.Body.String()
+	assert.NotContains(t, body, "Here you go:")
+	assert.NotContains(t, body, `"index":1`)
+	assert.Contains(t, body, `"text":"{\"answer\":\"42\"}"`)
+	assert.Contains(t, body, `"stop_reason":"end_turn"`)
+	assert.Contains(t, body, "event: message_stop")
+	assert.NotContains(t, body, "event: error")
+}
@@ -20,6 +20,7 @@ type TokenRequestLifecycle struct {
 	token       types.TokenInfo
 	tokenUsage  *types.TokenWithUsage
 	group       string
+	model       string // 请求模型（跳过已知不支持该模型的 token）
 	startTime   time.Time
 	started     bool
 	ended       bool
@@ -37,14 +38,15 @@ func NewTokenRequestLifecycle(c *gin.Context, authService *auth.AuthService, gro
 	}
 }
 
-// GetToken 获取 token 并开始请求追踪
+// GetToken 获取 token 并开始请求追踪（本组无可用 token 时沿降级链尝试）
 func (trl *TokenRequestLifecycle) GetToken() (types.TokenInfo, error) {
-	tokenInfo, err := trl.authService.GetToken(trl.group)
+	tokenInfo, group, err := getTokenWithFallback(trl.c, trl.authService, trl.group, trl.model)
 	if err != nil {
 		return types.TokenInfo{}, err
 	}
 
 	trl.token = tokenInfo
+	trl.group = group
 	trl.start()
 	return tokenInfo, nil
 }
@@ -58,7 +60,25 @@ func (trl *TokenRequestLifecycle) GetTokenWithUsage() (*types.TokenWithUsage, er
 		sessionID = utils.GenerateStableConversationID(trl.c)
 	}
 
-	tokenWithUsage, err := trl.authService.GetTokenWithUsage(trl.group, sessionID)
+	// 本组无可用 token 时沿降级链尝试
+	var tokenWithUsage *types.TokenWithUsage
+	var err error
+	for i, group := range resolveGroupChain(trl.c, trl.authService, trl.group) {
+		tokenWithUsage, err = trl.authService.GetTokenWithUsage(group, sessionID, trl.model)
+		if err != nil {
+			continue
+		}
+		if i > 0 {
+			logger.Warn("分组无可用Token，降级到备用分组",
+				AddReqFields(trl.c,
+					logger.String("from_group", trl.group),
+					logger.String("to_group", group),
+				)...)
+		}
+		trl.group = group
+		setServedGroup(trl.c, group)
+		break
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -89,8 +109,8 @@ func (trl *TokenRequestLifecycle) start() {
 		logger.String("group", trl.group))
 }
 
-// End 结束请求，记录 metrics
-// success: 请求是否成功（用于统计成功率）
+// End 结束请求，记录耗时
+// success: 请求是否成功（用于日志）
 func (trl *TokenRequestLifecycle) End(success bool) {
 	if !trl.started || trl.ended {
 		return
@@ -102,8 +122,8 @@ func (trl *TokenRequestLifecycle) End(success bool) {
 	// 减少 in-flight 计数
 	trl.authService.EndRequest(trl.token)
 
-	// 记录请求 metrics
-	trl.authService.RecordRequest(trl.token, latency, success)
+	// 记录请求耗时（成功/失败由请求执行时按上游结果记录）
+	trl.authService.RecordLatency(trl.token, latency)
 
 	logger.Debug("Token请求结束",
 		logger.Int64("token_id", trl.token.ID),
@@ -135,6 +155,19 @@ func (trl *TokenRequestLifecycle) Group() string {
 	return trl.group
 }
 
+// SetGroup 在获取 token 前改写目标分组（路由规则）
+func (trl *TokenRequestLifecycle) SetGroup(group string) {
+	if trl.started || group == "" {
+		return
+	}
+	trl.group = group
+}
+
+// SetModel 设置请求模型，获取 token 时跳过已知不支持该模型的 token
+func (trl *TokenRequestLifecycle) SetModel(model string) {
+	trl.model = model
+}
+
 // Latency 获取当前请求延迟
 func (trl *TokenRequestLifecycle) Latency() time.Duration {
 	if !trl.started {
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"kiro2api/internal/config"
+)
+
+// RetryAction 上游错误后的重试动作
+type RetryAction string
+
+const (
+	RetrySameToken RetryAction = "retry_same"   // 等待后使用同一 token 重试
+	SwitchToken    RetryAction = "switch_token" // 冷却当前 token 并切换
+	FailRequest    RetryAction = "fail"         // 不重试，直接返回错误
+)
+
+// maxSameTokenWait 同 token 重试的最长等待，超过则切换 token
+const maxSameTokenWait = 5 * time.Second
+
+// capacityRetryWait 上游容量不足且无 Retry-After 时的默认等待
+const capacityRetryWait = time.Second
+
+// UpstreamErrorDecision 上游错误处理决策
+type UpstreamErrorDecision struct {
+	Action        RetryAction
+	Wait          time.Duration // RetrySameToken 时的等待时间
+	Cooldown      time.Duration // SwitchToken 时的冷却时长，0 = 分组默认
+	MarkExhausted bool          // 是否标记 token 额度耗尽
+	Reason        string        // 上游错误原因（用于日志）
+}
+
+// UpstreamDecisionStrategy 可给出重试决策的错误映射策略 (ISP原则)
+type UpstreamDecisionStrategy interface {
+	ErrorMappingStrategy
+	Decide(statusCode int, header http.Header, responseBody []byte) (*UpstreamErrorDecision, bool)
+}
+
+// parseCodeWhispererError 解析上游错误体（失败返回零值）
+func parseCodeWhispererError(responseBody []byte) CodeWhispererErrorBody {
+	var errorBody CodeWhispererErrorBody
+	_ = json.Unmarshal(responseBody, &errorBody)
+	return errorBody
+}
+
+// parseRetryAfter 解析 Retry-After 头（秒数或 HTTP-date），无效返回 0
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if header == nil {
+		return 0
+	}
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// isQuotaError 是否为额度耗尽类错误（仅 429/403，其他状态码中提及额度不视为耗尽）
+func isQuotaError(statusCode int, reason string) bool {
+	if statusCode != http.StatusTooManyRequests && statusCode != http.StatusForbidden {
+		return false
+	}
+	r := strings.ToUpper(reason)
+	return strings.Contains(r, "QUOTA") || strings.Contains(r, "REQUEST_COUNT")
+}
+
+// isCapacityReason 是否为上游容量不足类原因
+func isCapacityReason(reason string) bool {
+	return strings.Contains(strings.ToUpper(reason), "CAPACITY")
+}
+
+// isThrottlingReason 是否为限流类原因
+func isThrottlingReason(errorBody CodeWhispererErrorBody) bool {
+	r := strings.ToUpper(errorBody.Reason + " " + errorBody.Type)
+	return strings.Contains(r, "THROTTL") || strings.Contains(r, "TOO_MANY_REQUESTS")
+}
+
+// modelUnavailableMessages 账号无权使用模型时上游错误信息的特征片段（小写）
+var modelUnavailableMessages = []string{
+	"invalid model",
+	"model is not available",
+	"model not available",
+	"model is not supported",
+	"model not supported",
+	"not available for your account",
+	"not enabled for your account",
+	"do not have access to",
+	"don't have access to",
+}
+
+// modelUnavailableReason 识别"账号无权使用请求模型"类错误（与 token 相关而非故障，不应冷却）
+func modelUnavailableReason(statusCode int, responseBody []byte) (string, bool) {
+	if statusCode != http.StatusBadRequest && statusCode != http.StatusForbidden {
+		return "", false
+	}
+	errorBody := parseCodeWhispererError(responseBody)
+	reason := strings.ToUpper(errorBody.Reason)
+	if strings.Contains(reason, "INVALID_MODEL") || strings.Contains(reason, "MODEL_NOT_") || strings.Contains(reason, "MODEL_ACCESS") {
+		return errorBody.Reason, true
+	}
+	message := strings.ToLower(errorBody.Message)
+	for _, pattern := range modelUnavailableMessages {
+		if strings.Contains(message, pattern) {
+			if errorBody.Reason != "" {
+				return errorBody.Reason, true
+			}
+			return "MODEL_NOT_AVAILABLE", true
+		}
+	}
+	return "", false
+}
+
+// QuotaExhaustedStrategy 额度耗尽错误策略：标记耗尽并切换 token (SRP原则)
+type QuotaExhaustedStrategy struct{}
+
+func (s *QuotaExhaustedStrategy) MapError(statusCode int, responseBody []byte) (*ClaudeErrorResponse, bool) {
+	errorBody := parseCodeWhispererError(responseBody)
+	if !isQuotaError(statusCode, errorBody.Reason) {
+		return nil, false
+	}
+	return &ClaudeErrorResponse{
+		Type:       "error",
+		Message:    fmt.Sprintf("Upstream quota exhausted: %s", errorBody.Message),
+		StatusCode: http.StatusTooManyRequests,
+		Code:       s.GetErrorType(),
+	}, true
+}
+
+func (s *QuotaExhaustedStrategy) Decide(statusCode int, header http.Header, responseBody []byte) (*UpstreamErrorDecision, bool) {
+	errorBody := parseCodeWhispererError(responseBody)
+	if !isQuotaError(statusCode, errorBody.Reason) {
+		return nil, false
+	}
+	return &UpstreamErrorDecision{
+		Action:        SwitchToken,
+		Cooldown:      parseRetryAfter(header, time.Now()),
+		MarkExhausted: true,
+		Reason:        errorBody.Reason,
+	}, true
+}
+
+func (s *QuotaExhaustedStrategy) GetErrorType() string {
+	return "quota_exhausted"
+}
+
+// CapacityStrategy 上游模型容量不足策略：与 token 无关，等待后同 token 重试 (SRP原则)
+type CapacityStrategy struct{}
+
+func (s *CapacityStrategy) MapError(statusCode int, responseBody []byte) (*ClaudeErrorResponse, bool) {
+	errorBody := parseCodeWhispererError(responseBody)
+	if !isCapacityReason(errorBody.Reason) {
+		return nil, false
+	}
+	return &ClaudeErrorResponse{
+		Type:       "error",
+		Message:    fmt.Sprintf("Upstream capacity insufficient: %s", errorBody.Message),
+		StatusCode: http.StatusServiceUnavailable,
+		Code:       s.GetErrorType(),
+	}, true
+}
+
+func (s *CapacityStrategy) Decide(statusCode int, header http.Header, responseBody []byte) (*UpstreamErrorDecision, bool) {
+	errorBody := parseCodeWhispererError(responseBody)
+	if !isCapacityReason(errorBody.Reason) {
+		return nil, false
+	}
+	wait := parseRetryAfter(header, time.Now())
+	if wait == 0 {
+		wait = capacityRetryWait
+	}
+	if wait > maxSameTokenWait {
+		return &UpstreamErrorDecision{Action: FailRequest, Reason: errorBody.Reason}, true
+	}
+	return &UpstreamErrorDecision{Action: RetrySameToken, Wait: wait, Reason: errorBody.Reason}, true
+}
+
+func (s *CapacityStrategy) GetErrorType() string {
+	return "capacity"
+}
+
+// ThrottlingStrategy 限流错误策略：按 Retry-After 决定同 token 等待或冷却切换 (SRP原则)
+type ThrottlingStrategy struct{}
+
+func (s *ThrottlingStrategy) matches(statusCode int, errorBody CodeWhispererErrorBody) bool {
+	return statusCode == http.StatusTooManyRequests || isThrottlingReason(errorBody)
+}
+
+func (s *ThrottlingStrategy) MapError(statusCode int, responseBody []byte) (*ClaudeErrorResponse, bool) {
+	errorBody := parseCodeWhispererError(responseBody)
+	if !s.matches(statusCode, errorBody) {
+		return nil, false
+	}
+	return &ClaudeErrorResponse{
+		Type:       "error",
+		Message:    fmt.Sprintf("Upstream throttled: %s", string(responseBody)),
+		StatusCode: http.StatusTooManyRequests,
+		Code:       s.GetErrorType(),
+	}, true
+}
+
+func (s *ThrottlingStrategy) Decide(statusCode int, header http.Header, responseBody []byte) (*UpstreamErrorDecision, bool) {
+	errorBody := parseCodeWhispererError(responseBody)
+	if !s.matches(statusCode, errorBody) {
+		return nil, false
+	}
+	reason := errorBody.Reason
+	if reason == "" {
+		reason = "THROTTLING"
+	}
+
+	retryAfter := parseRetryAfter(header, time.Now())
+	if retryAfter > 0 && retryAfter <= maxSameTokenWait {
+		return &UpstreamErrorDecision{Action: RetrySameToken, Wait: retryAfter, Reason: reason}, true
+	}
+	return &UpstreamErrorDecision{Action: SwitchToken, Cooldown: retryAfter, Reason: reason}, true
+}
+
+func (s *ThrottlingStrategy) GetErrorType() string {
+	return "throttling"
+}
+
+// DecideUpstreamError 根据策略链给出上游错误处理决策
+// 无策略命中时：可重试状态码切换 token，其余直接失败
+func (em *ErrorMapper) DecideUpstreamError(statusCode int, header http.Header, responseBody []byte) UpstreamErrorDecision {
+	for _, strategy := range em.strategies {
+		ds, ok := strategy.(UpstreamDecisionStrategy)
+		if !ok {
+			continue
+		}
+		if decision, handled := ds.Decide(statusCode, header, responseBody); handled {
+			return *decision
+		}
+	}
+	if config.IsRetryableStatus(statusCode) {
+		return UpstreamErrorDecision{Action: SwitchToken, Reason: http.StatusText(statusCode)}
+	}
+	return UpstreamErrorDecision{Action: FailRequest, Reason: http.StatusText(statusCode)}
+}
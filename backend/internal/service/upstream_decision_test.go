@@ -0,0 +1,146 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	header := http.Header{}
+	assert.Equal(t, time.Duration(0), parseRetryAfter(header, now))
+
+	header.Set("Retry-After", "3")
+	assert.Equal(t, 3*time.Second, parseRetryAfter(header, now))
+
+	header.Set("Retry-After", now.Add(90*time.Second).Format(http.TimeFormat))
+	assert.Equal(t, 90*time.Second, parseRetryAfter(header, now))
+
+	header.Set("Retry-After", "-1")
+	assert.Equal(t, time.Duration(0), parseRetryAfter(header, now))
+
+	header.Set("Retry-After", "soon")
+	assert.Equal(t, time.Duration(0), parseRetryAfter(header, now))
+
+	assert.Equal(t, time.Duration(0), parseRetryAfter(nil, now))
+}
+
+func TestErrorMapper_DecideUpstreamError(t *testing.T) {
+	mapper := NewErrorMapper()
+	retryAfter := func(v string) http.Header {
+		h := http.Header{}
+		h.Set("Retry-After", v)
+		return h
+	}
+
+	tests := []struct {
+		name       string
+		statusCode int
+		header     http.Header
+		body       string
+		want       UpstreamErrorDecision
+	}{
+		{
+			name:       "额度耗尽标记exhausted并切换",
+			statusCode: http.StatusTooManyRequests,
+			body:       `{"message":"limit","reason":"MONTHLY_REQUEST_COUNT"}`,
+			want:       UpstreamErrorDecision{Action: SwitchToken, MarkExhausted: true, Reason: "MONTHLY_REQUEST_COUNT"},
+		},
+		{
+			name:       "容量不足同token重试",
+			statusCode: http.StatusInternalServerError,
+			body:       `{"message":"busy","reason":"INSUFFICIENT_MODEL_CAPACITY"}`,
+			want:       UpstreamErrorDecision{Action: RetrySameToken, Wait: capacityRetryWait, Reason: "INSUFFICIENT_MODEL_CAPACITY"},
+		},
+		{
+			name:       "容量不足等待过长直接失败",
+			statusCode: http.StatusServiceUnavailable,
+			header:     retryAfter("60"),
+			body:       `{"reason":"INSUFFICIENT_MODEL_CAPACITY"}`,
+			want:       UpstreamErrorDecision{Action: FailRequest, Reason: "INSUFFICIENT_MODEL_CAPACITY"},
+		},
+		{
+			name:       "限流短Retry-After同token重试",
+			statusCode: http.StatusTooManyRequests,
+			header:     retryAfter("2"),
+			body:       `{"message":"slow down"}`,
+			want:       UpstreamErrorDecision{Action: RetrySameToken, Wait: 2 * time.Second, Reason: "THROTTLING"},
+		},
+		{
+			name:       "限流长Retry-After按时长冷却并切换",
+			statusCode: http.StatusTooManyRequests,
+			header:     retryAfter("120"),
+			body:       `{"__type":"ThrottlingException"}`,
+			want:       UpstreamErrorDecision{Action: SwitchToken, Cooldown: 120 * time.Second, Reason: "THROTTLING"},
+		},
+		{
+			name:       "可重试状态码默认切换",
+			statusCode: http.StatusBadGateway,
+			body:       `bad gateway`,
+			want:       UpstreamErrorDecision{Action: SwitchToken, Reason: "Bad Gateway"},
+		},
+		{
+			name:       "非429/403提及额度不标记exhausted",
+			statusCode: http.StatusInternalServerError,
+			body:       `{"message":"quota service error","reason":"QUOTA_SERVICE_UNAVAILABLE"}`,
+			want:       UpstreamErrorDecision{Action: SwitchToken, Reason: "Internal Server Error"},
+		},
+		{
+			name:       "不可重试状态码失败",
+			statusCode: http.StatusBadRequest,
+			body:       `{"reason":"CONTENT_LENGTH_EXCEEDS_THRESHOLD"}`,
+			want:       UpstreamErrorDecision{Action: FailRequest, Reason: "Bad Request"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mapper.DecideUpstreamError(tt.statusCode, tt.header, []byte(tt.body))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestErrorMapper_MapThrottlingAndQuota(t *testing.T) {
+	mapper := NewErrorMapper()
+
+	quota := mapper.MapCodeWhispererError(http.StatusTooManyRequests, []byte(`{"message":"used up","reason":"MONTHLY_REQUEST_COUNT"}`))
+	assert.Contains(t, quota.Message, "quota exhausted")
+	assert.Equal(t, http.StatusTooManyRequests, quota.StatusCode)
+
+	throttled := mapper.MapCodeWhispererError(http.StatusTooManyRequests, []byte(`{"message":"slow down"}`))
+	assert.Contains(t, throttled.Message, "throttled")
+	assert.Equal(t, http.StatusTooManyRequests, throttled.StatusCode)
+
+	// 其他状态码中提及额度不视为额度耗尽
+	other := mapper.MapCodeWhispererError(http.StatusBadRequest, []byte(`{"message":"bad","reason":"QUOTA_FIELD_INVALID"}`))
+	assert.NotContains(t, other.Message, "quota exhausted")
+	assert.Zero(t, other.StatusCode)
+}
+
+func TestModelUnavailableReason(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		reason     string
+		ok         bool
+	}{
+		{"INVALID_MODEL_ID原因", http.StatusBadRequest, `{"message":"Invalid model. Please select a different model to continue.","reason":"INVALID_MODEL_ID"}`, "INVALID_MODEL_ID", true},
+		{"按错误信息识别", http.StatusForbidden, `{"message":"The requested model is not available for your account"}`, "MODEL_NOT_AVAILABLE", true},
+		{"容量不足不是模型不可用", http.StatusBadRequest, `{"reason":"INSUFFICIENT_MODEL_CAPACITY"}`, "", false},
+		{"内容超限不是模型不可用", http.StatusBadRequest, `{"reason":"CONTENT_LENGTH_EXCEEDS_THRESHOLD"}`, "", false},
+		{"5xx不识别", http.StatusInternalServerError, `{"reason":"INVALID_MODEL_ID"}`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, ok := modelUnavailableReason(tt.statusCode, []byte(tt.body))
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package stats
 
 import (
+	"context"
 	"database/sql"
 	"sync"
 	"time"
@@ -15,9 +16,12 @@ const (
 
 // Collector 统计收集器（依赖注入版本）
 type Collector struct {
-	db    *sql.DB
-	queue chan RequestRecord
-	once  sync.Once
+	db     *sql.DB
+	queue  chan RequestRecord
+	once   sync.Once
+	mu     sync.RWMutex // 保护 closed 与关闭队列
+	closed bool
+	wg     sync.WaitGroup
 }
 
 // NewCollector 创建统计收集器
@@ -28,6 +32,7 @@ func NewCollector(db *sql.DB) *Collector {
 	}
 	// 启动 worker
 	for i := 0; i < workerCount; i++ {
+		c.wg.Add(1)
 		go c.worker()
 	}
 	return c
@@ -38,6 +43,11 @@ func (c *Collector) Record(r RequestRecord) {
 	if r.Timestamp.IsZero() {
 		r.Timestamp = time.Now()
 	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return
+	}
 	select {
 	case c.queue <- r:
 	default:
@@ -45,8 +55,31 @@ func (c *Collector) Record(r RequestRecord) {
 	}
 }
 
+// Close 停止接收新记录并等待队列中的记录写完（ctx 到期则放弃剩余记录）
+func (c *Collector) Close(ctx context.Context) error {
+	c.once.Do(func() {
+		c.mu.Lock()
+		c.closed = true
+		close(c.queue)
+		c.mu.Unlock()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // worker 处理写入
 func (c *Collector) worker() {
+	defer c.wg.Done()
 	for r := range c.queue {
 		c.persistRecord(r)
 	}
@@ -0,0 +1,21 @@
+package stats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectorClose_DropsRecordsAfterClose(t *testing.T) {
+	collector := NewCollector(nil)
+	collector.Record(RequestRecord{ID: "before"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, collector.Close(ctx))
+	assert.NoError(t, collector.Close(ctx), "重复关闭不应出错")
+
+	assert.NotPanics(t, func() { collector.Record(RequestRecord{ID: "after"}) })
+}
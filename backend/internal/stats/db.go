@@ -109,17 +109,14 @@ func CloseLogDB() {
 // persistRecordToDB 持久化记录到指定数据库（依赖注入版本）
 func persistRecordToDB(db *sql.DB, r RequestRecord) {
 	// 计算 actual_input_tokens 和 calculated_output_tokens
-	actualInputTokens := int(r.ContextUsagePercent / 100 * 200000)
+	actualInputTokens := int(r.ContextUsagePercent / 100 * float64(config.GetModelRegistry().ContextWindow(r.Model)))
 	var calculatedOutputTokens int
 	var cacheHit int
 
 	if r.CreditUsage > 0 && actualInputTokens > 0 {
 		// 获取模型定价
-		pricing := config.GetModelPricing(r.Model)
-		calculatedOutputTokens = int((r.CreditUsage*1000000 - float64(actualInputTokens)*pricing.InputPrice) / pricing.OutputPrice)
-		if calculatedOutputTokens < 0 {
-			calculatedOutputTokens = 0
-		}
+		pricing := config.GetModelRegistry().Pricing(r.Model)
+		calculatedOutputTokens = pricing.OutputTokensFromCredit(r.CreditUsage, actualInputTokens)
 		// 检测缓存：基于 Anthropic Prompt Caching 计价规则
 		expectedCredit := float64(actualInputTokens)*pricing.InputPrice/1000000 + float64(calculatedOutputTokens)*pricing.OutputPrice/1000000
 		if r.CreditUsage < expectedCredit*0.6 {
@@ -8,7 +8,7 @@ type RequestRecord struct {
 	Timestamp            time.Time `json:"timestamp"`
 	Method               string    `json:"method"`
 	Path                 string    `json:"path"`
-	RequestType          string    `json:"request_type,omitempty"` // "anthropic" | "openai"
+	RequestType          string    `json:"request_type,omitempty"` // "anthropic" | "openai" | "responses"
 	Model                string    `json:"model"`
 	Stream               bool      `json:"stream"`
 	StatusCode           int       `json:"status_code"`
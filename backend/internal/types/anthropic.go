@@ -9,8 +9,9 @@ type AnthropicTool struct {
 
 // ToolChoice 表示工具选择策略
 type ToolChoice struct {
-	Type string `json:"type"`           // "auto", "any", "tool"
-	Name string `json:"name,omitempty"` // 当type为"tool"时指定的工具名称
+	Type                   string `json:"type"`                                // "auto", "any", "tool"
+	Name                   string `json:"name,omitempty"`                      // 当type为"tool"时指定的工具名称
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"` // 最多调用一个工具
 }
 
 // ThinkingConfig 表示 extended thinking 配置
@@ -21,16 +22,25 @@ type ThinkingConfig struct {
 
 // AnthropicRequest 表示 Anthropic API 的请求结构
 type AnthropicRequest struct {
-	Model       string                    `json:"model"`
-	MaxTokens   int                       `json:"max_tokens"`
-	Messages    []AnthropicRequestMessage `json:"messages"`
-	System      []AnthropicSystemMessage  `json:"system,omitempty"`
-	Tools       []AnthropicTool           `json:"tools,omitempty"`
-	ToolChoice  any                       `json:"tool_choice,omitempty"` // 可以是string或ToolChoice对象
-	Stream      bool                      `json:"stream"`
-	Temperature *float64                  `json:"temperature,omitempty"`
-	Metadata    map[string]any            `json:"metadata,omitempty"`
-	Thinking    *ThinkingConfig           `json:"thinking,omitempty"` // extended thinking 配置
+	Model         string                    `json:"model"`
+	MaxTokens     int                       `json:"max_tokens"`
+	Messages      []AnthropicRequestMessage `json:"messages"`
+	System        []AnthropicSystemMessage  `json:"system,omitempty"`
+	Tools         []AnthropicTool           `json:"tools,omitempty"`
+	ToolChoice    any                       `json:"tool_choice,omitempty"` // 可以是string或ToolChoice对象
+	Stream        bool                      `json:"stream"`
+	Temperature   *float64                  `json:"temperature,omitempty"`
+	StopSequences []string                  `json:"stop_sequences,omitempty"` // 上游不支持，由代理扫描输出文本模拟
+	Metadata      map[string]any            `json:"metadata,omitempty"`
+	Thinking      *ThinkingConfig           `json:"thinking,omitempty"` // extended thinking 配置
+	// OutputFormat 结构化输出（{"type":"json_schema","schema":{...}}），回答为符合 schema 的 JSON 文本
+	OutputFormat *OutputFormat `json:"output_format,omitempty"`
+}
+
+// OutputFormat 结构化输出格式
+type OutputFormat struct {
+	Type   string         `json:"type"` // "json_schema"
+	Schema map[string]any `json:"schema,omitempty"`
 }
 
 // AnthropicStreamResponse 表示 Anthropic 流式响应的结构
@@ -0,0 +1,55 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Anthropic Message Batches API（/v1/messages/batches）数据结构
+
+// MessageBatchRequest 批处理中的单个请求
+type MessageBatchRequest struct {
+	CustomID string          `json:"custom_id"`
+	Params   json.RawMessage `json:"params"` // 与 /v1/messages 请求体相同
+}
+
+// MessageBatchCreateRequest 创建批处理请求
+type MessageBatchCreateRequest struct {
+	Requests []MessageBatchRequest `json:"requests"`
+}
+
+// MessageBatchRequestCounts 各状态的请求数量
+type MessageBatchRequestCounts struct {
+	Processing int `json:"processing"`
+	Succeeded  int `json:"succeeded"`
+	Errored    int `json:"errored"`
+	Canceled   int `json:"canceled"`
+	Expired    int `json:"expired"`
+}
+
+// MessageBatch 批处理对象
+type MessageBatch struct {
+	ID                string                    `json:"id"`
+	Type              string                    `json:"type"`              // message_batch
+	ProcessingStatus  string                    `json:"processing_status"` // in_progress / canceling / ended
+	RequestCounts     MessageBatchRequestCounts `json:"request_counts"`
+	EndedAt           *time.Time                `json:"ended_at"`
+	CreatedAt         time.Time                 `json:"created_at"`
+	ExpiresAt         time.Time                 `json:"expires_at"`
+	ArchivedAt        *time.Time                `json:"archived_at"`
+	CancelInitiatedAt *time.Time                `json:"cancel_initiated_at"`
+	ResultsURL        *string                   `json:"results_url"` // 结束后可用
+}
+
+// MessageBatchResult 结果文件（JSONL）中的一行
+type MessageBatchResult struct {
+	CustomID string                 `json:"custom_id"`
+	Result   MessageBatchResultBody `json:"result"`
+}
+
+// MessageBatchResultBody 单个请求的结果
+type MessageBatchResultBody struct {
+	Type    string          `json:"type"`              // succeeded / errored / canceled / expired
+	Message json.RawMessage `json:"message,omitempty"` // succeeded 时为 Anthropic 响应
+	Error   json.RawMessage `json:"error,omitempty"`   // errored 时为 {"type":"error","error":{...}}
+}
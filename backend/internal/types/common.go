@@ -51,11 +51,16 @@ type ModelNotFoundErrorDetail struct {
 
 // NewModelNotFoundError 创建模型未找到错误
 func NewModelNotFoundError(model, requestId string) *ModelNotFoundError {
+	return NewGroupModelNotFoundError("default", model, requestId)
+}
+
+// NewGroupModelNotFoundError 创建指定分组下的模型未找到错误
+func NewGroupModelNotFoundError(group, model, requestId string) *ModelNotFoundError {
 	return &ModelNotFoundError{
 		Error: ModelNotFoundErrorDetail{
 			Code: "model_not_found",
-			Message: fmt.Sprintf("分组 default 下模型 %s 无可用渠道（distributor） (request id: %s)",
-				model, requestId),
+			Message: fmt.Sprintf("分组 %s 下模型 %s 无可用渠道（distributor） (request id: %s)",
+				group, model, requestId),
 			Type: "new_api_error",
 		},
 	}
@@ -1,6 +1,6 @@
 package types
 
-// Model 表示模型信息
+// Model 表示模型信息（OpenAI 格式，附带 display_name 等扩展字段）
 type Model struct {
 	ID          string `json:"id"`
 	Object      string `json:"object"`
@@ -8,11 +8,29 @@ type Model struct {
 	OwnedBy     string `json:"owned_by"`
 	DisplayName string `json:"display_name"`
 	Type        string `json:"type"`
-	MaxTokens   int    `json:"max_tokens"`
+	MaxTokens   int    `json:"max_tokens"` // 上下文窗口
+	MaxOutput   int    `json:"max_output_tokens,omitempty"`
 }
 
-// ModelsResponse 表示模型列表响应
+// ModelsResponse 表示模型列表响应（OpenAI 格式）
 type ModelsResponse struct {
-	Object string  `json:"object"`
-	Data   []Model `json:"data"`
+	Object  string  `json:"object"`
+	Data    []Model `json:"data"`
+	HasMore bool    `json:"has_more"`
+}
+
+// AnthropicModel 表示模型信息（Anthropic 格式）
+type AnthropicModel struct {
+	Type        string `json:"type"` // 固定为 "model"
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	CreatedAt   string `json:"created_at"` // RFC 3339
+}
+
+// AnthropicModelsResponse 表示模型列表响应（Anthropic 格式）
+type AnthropicModelsResponse struct {
+	Data    []AnthropicModel `json:"data"`
+	HasMore bool             `json:"has_more"`
+	FirstID *string          `json:"first_id"`
+	LastID  *string          `json:"last_id"`
 }
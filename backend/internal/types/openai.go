@@ -41,13 +41,36 @@ type OpenAIToolChoiceFunction struct {
 }
 
 type OpenAIRequest struct {
-	Model       string          `json:"model"`
-	Messages    []OpenAIMessage `json:"messages"`
-	MaxTokens   *int            `json:"max_tokens,omitempty"`
-	Temperature *float64        `json:"temperature,omitempty"`
-	Stream      *bool           `json:"stream,omitempty"`
-	Tools       []OpenAITool    `json:"tools,omitempty"`
-	ToolChoice  any             `json:"tool_choice,omitempty"` // 可以是 "auto", "none", "required" 或 OpenAIToolChoice
+	Model             string                `json:"model"`
+	Messages          []OpenAIMessage       `json:"messages"`
+	MaxTokens         *int                  `json:"max_tokens,omitempty"`
+	Temperature       *float64              `json:"temperature,omitempty"`
+	Stop              any                   `json:"stop,omitempty"` // string 或 []string
+	Stream            *bool                 `json:"stream,omitempty"`
+	StreamOptions     *OpenAIStreamOptions  `json:"stream_options,omitempty"`
+	Tools             []OpenAITool          `json:"tools,omitempty"`
+	ToolChoice        any                   `json:"tool_choice,omitempty"`         // 可以是 "auto", "none", "required" 或 OpenAIToolChoice
+	ParallelToolCalls *bool                 `json:"parallel_tool_calls,omitempty"` // false 时最多返回一个工具调用
+	ResponseFormat    *OpenAIResponseFormat `json:"response_format,omitempty"`
+}
+
+// OpenAIResponseFormat 响应格式："text"、"json_object" 或 "json_schema"
+type OpenAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+// OpenAIJSONSchema json_schema 响应格式定义
+type OpenAIJSONSchema struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
+}
+
+// OpenAIStreamOptions 流式选项
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"` // 结束前额外发送一个 choices 为空、带 usage 的分片
 }
 
 type OpenAIChoice struct {
@@ -0,0 +1,85 @@
+package types
+
+// OpenAI Responses API（/v1/responses）数据结构
+
+// ResponsesRequest Responses API 请求
+type ResponsesRequest struct {
+	Model              string          `json:"model"`
+	Input              any             `json:"input"` // string 或 []ResponsesInputItem
+	Instructions       string          `json:"instructions,omitempty"`
+	MaxOutputTokens    *int            `json:"max_output_tokens,omitempty"`
+	Temperature        *float64        `json:"temperature,omitempty"`
+	Stream             *bool           `json:"stream,omitempty"`
+	Tools              []ResponsesTool `json:"tools,omitempty"`
+	ToolChoice         any             `json:"tool_choice,omitempty"` // "auto"/"none"/"required" 或 {"type":"function","name":...}
+	ParallelToolCalls  *bool           `json:"parallel_tool_calls,omitempty"`
+	PreviousResponseID string          `json:"previous_response_id,omitempty"` // 不支持（无服务端会话存储）
+	Store              *bool           `json:"store,omitempty"`
+	Metadata           map[string]any  `json:"metadata,omitempty"`
+}
+
+// ResponsesInputItem Responses 输入项（message / function_call / function_call_output）
+type ResponsesInputItem struct {
+	Type      string `json:"type,omitempty"` // 为空时按 message 处理
+	ID        string `json:"id,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Content   any    `json:"content,omitempty"` // string 或内容数组（input_text/output_text/input_image）
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    any    `json:"output,omitempty"` // function_call_output 的结果（string 或内容数组）
+}
+
+// ResponsesTool Responses 工具定义（函数字段平铺，不嵌套 function）
+type ResponsesTool struct {
+	Type        string         `json:"type"`
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
+}
+
+// ResponsesOutputContent 输出消息的内容片段
+type ResponsesOutputContent struct {
+	Type        string `json:"type"` // output_text
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations"`
+}
+
+// ResponsesOutputItem 输出项（message 或 function_call）
+type ResponsesOutputItem struct {
+	Type      string                   `json:"type"`
+	ID        string                   `json:"id"`
+	Status    string                   `json:"status"`
+	Role      string                   `json:"role,omitempty"`
+	Content   []ResponsesOutputContent `json:"content,omitempty"`
+	CallID    string                   `json:"call_id,omitempty"`
+	Name      string                   `json:"name,omitempty"`
+	Arguments *string                  `json:"arguments,omitempty"`
+}
+
+// ResponsesUsage 用量统计
+type ResponsesUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// ResponsesIncompleteDetails 未完成原因
+type ResponsesIncompleteDetails struct {
+	Reason string `json:"reason"` // max_output_tokens
+}
+
+// ResponsesResponse Responses API 响应对象
+type ResponsesResponse struct {
+	ID                string                      `json:"id"`
+	Object            string                      `json:"object"` // response
+	CreatedAt         int64                       `json:"created_at"`
+	Status            string                      `json:"status"` // in_progress/completed/incomplete
+	Model             string                      `json:"model"`
+	Output            []ResponsesOutputItem       `json:"output"`
+	Usage             *ResponsesUsage             `json:"usage,omitempty"`
+	IncompleteDetails *ResponsesIncompleteDetails `json:"incomplete_details"`
+	Error             any                         `json:"error"`
+	Metadata          map[string]any              `json:"metadata,omitempty"`
+}
@@ -14,8 +14,19 @@ const (
 	ComplexRequest                          // 复杂请求
 )
 
+// ComplexRequestThreshold 复杂度评分达到该值视为复杂请求
+const ComplexRequestThreshold = 3
+
 // AnalyzeRequestComplexity 分析请求复杂度
 func AnalyzeRequestComplexity(req types.AnthropicRequest) RequestComplexity {
+	if RequestComplexityScore(req) >= ComplexRequestThreshold {
+		return ComplexRequest
+	}
+	return SimpleRequest
+}
+
+// RequestComplexityScore 计算请求复杂度评分（max_tokens、内容长度、工具、系统提示、关键词）
+func RequestComplexityScore(req types.AnthropicRequest) int {
 	complexityScore := 0
 
 	// 1. 检查最大token数量
@@ -74,9 +85,5 @@ func AnalyzeRequestComplexity(req types.AnthropicRequest) RequestComplexity {
 		}
 	}
 
-	// 根据复杂度评分判断
-	if complexityScore >= 3 {
-		return ComplexRequest
-	}
-	return SimpleRequest
+	return complexityScore
 }
@@ -221,3 +221,17 @@ func TestAnalyzeRequestComplexity_MultipleMessages(t *testing.T) {
 	// MaxTokens (+1) + 内容长度 (+1) = 2分，未达到3分阈值
 	assert.Equal(t, SimpleRequest, complexity)
 }
+
+func TestRequestComplexityScore(t *testing.T) {
+	req := types.AnthropicRequest{
+		Model:     "claude-3-sonnet-20240229",
+		MaxTokens: 8000, // > 4000, score +2
+		Messages: []types.AnthropicRequestMessage{
+			{Role: "user", Content: "hi"},
+		},
+		Tools: []types.AnthropicTool{{Name: "get_weather"}}, // score +2
+	}
+
+	assert.Equal(t, 4, RequestComplexityScore(req))
+	assert.Equal(t, ComplexRequest, AnalyzeRequestComplexity(req))
+}
@@ -1,20 +1,24 @@
 import { http } from './client'
-import type { APIKey, CreateAPIKeyRequest } from '@/types'
+import type { APIKey, CreateAPIKeyRequest, IssuedAPIKey, UpdateAPIKeyRequest } from '@/types'
 
 export const keysApi = {
   list(): Promise<APIKey[]> {
     return http.get('/api/keys')
   },
 
-  create(data: CreateAPIKeyRequest): Promise<APIKey> {
+  create(data: CreateAPIKeyRequest): Promise<IssuedAPIKey> {
     return http.post('/api/keys', data)
   },
 
-  update(key: string, allowedGroups: string[]): Promise<{ message: string }> {
-    return http.patch(`/api/keys/${key}`, { allowed_groups: allowedGroups })
+  update(id: string, data: UpdateAPIKeyRequest): Promise<{ message: string }> {
+    return http.patch(`/api/keys/${id}`, data)
   },
 
-  delete(key: string): Promise<void> {
-    return http.delete(`/api/keys/${key}`)
+  rotate(id: string, graceSec?: number): Promise<IssuedAPIKey> {
+    return http.post(`/api/keys/${id}/rotate`, graceSec === undefined ? {} : { grace_sec: graceSec })
+  },
+
+  delete(id: string): Promise<void> {
+    return http.delete(`/api/keys/${id}`)
   },
 }
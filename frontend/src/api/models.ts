@@ -0,0 +1,20 @@
+import { http } from './client'
+import type { ModelInfo } from '@/types'
+
+export const modelsApi = {
+  list(): Promise<{ models: ModelInfo[] }> {
+    return http.get('/api/models')
+  },
+
+  create(data: ModelInfo): Promise<ModelInfo> {
+    return http.post('/api/models', data)
+  },
+
+  update(id: string, data: ModelInfo): Promise<ModelInfo> {
+    return http.put(`/api/models/${encodeURIComponent(id)}`, data)
+  },
+
+  delete(id: string): Promise<void> {
+    return http.delete(`/api/models/${encodeURIComponent(id)}`)
+  },
+}
@@ -0,0 +1,20 @@
+import { http } from './client'
+import type { RoutingRule, RoutingRuleInput } from '@/types'
+
+export const routingApi = {
+  list(): Promise<{ rules: RoutingRule[] }> {
+    return http.get('/api/routing')
+  },
+
+  create(data: RoutingRuleInput): Promise<RoutingRule> {
+    return http.post('/api/routing', data)
+  },
+
+  update(id: number, data: RoutingRuleInput): Promise<RoutingRule> {
+    return http.put(`/api/routing/${id}`, data)
+  },
+
+  delete(id: number): Promise<void> {
+    return http.delete(`/api/routing/${id}`)
+  },
+}
@@ -28,6 +28,16 @@ const router = createRouter({
           name: 'groups',
           component: () => import('@/views/Groups.vue'),
         },
+        {
+          path: 'routing',
+          name: 'routing',
+          component: () => import('@/views/Routing.vue'),
+        },
+        {
+          path: 'models',
+          name: 'models',
+          component: () => import('@/views/Models.vue'),
+        },
         {
           path: 'keys',
           name: 'keys',
@@ -26,13 +26,19 @@ export const useKeysStore = defineStore('keys', () => {
     return newKey
   }
 
-  async function update(key: string, allowedGroups: string[]) {
-    await keysApi.update(key, allowedGroups)
+  async function update(id: string, data: Parameters<typeof keysApi.update>[1]) {
+    await keysApi.update(id, data)
     await fetch()
   }
 
-  async function remove(key: string) {
-    await keysApi.delete(key)
+  async function rotate(id: string, graceSec?: number) {
+    const issued = await keysApi.rotate(id, graceSec)
+    await fetch()
+    return issued
+  }
+
+  async function remove(id: string) {
+    await keysApi.delete(id)
     await fetch()
   }
 
@@ -43,6 +49,7 @@ export const useKeysStore = defineStore('keys', () => {
     fetch,
     create,
     update,
+    rotate,
     remove,
   }
 })
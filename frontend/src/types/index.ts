@@ -5,6 +5,20 @@ export interface UsageLimits {
   is_exceeded: boolean
 }
 
+export interface BreakerSnapshot {
+  state: 'closed' | 'open' | 'half_open'
+  trips: number
+  open_until?: string
+}
+
+// Token 对上游模型的可用性（从上游错误学习）
+export interface ModelAccess {
+  model: string
+  supported: boolean
+  reason?: string
+  updated_at: string
+}
+
 export interface Token {
   index: number
   user_email: string
@@ -25,6 +39,8 @@ export interface Token {
   failure_count: number
   in_flight: number
   avg_latency: number
+  breaker?: BreakerSnapshot
+  model_access?: ModelAccess[]
 }
 
 export interface TokenListResponse {
@@ -94,12 +110,17 @@ export interface RefreshTokensResponse {
 export interface GroupSettings {
   priority?: number
   disabled?: boolean
+  strategy?: string
+  stream_first_byte_timeout_sec?: number
+  stream_idle_timeout_sec?: number
+  stream_total_timeout_sec?: number
 }
 
 export interface Group {
   name: string
   display_name: string
   settings: GroupSettings
+  fallback_groups?: string[]
   token_count: number
   active_count: number
 }
@@ -112,6 +133,7 @@ export interface GroupListResponse {
 export interface Settings {
   rate_limit_qps: number
   rate_limit_burst: number
+  rate_limit_queue_wait_ms: number
   request_timeout_sec: number
   max_retries: number
   cooldown_sec: number
@@ -121,6 +143,11 @@ export interface Settings {
   group_max_concurrent: number
   refresh_concurrency: number
   session_duration_min: number
+  stream_continuation: boolean
+  stream_first_byte_timeout_sec: number
+  stream_idle_timeout_sec: number
+  stream_total_timeout_sec: number
+  stream_keepalive_sec: number
 }
 
 export interface RateLimiterStats {
@@ -138,19 +165,123 @@ export interface SettingsResponse {
 }
 
 // API Key 相关类型
+export type APIKeyRole = 'admin' | 'viewer' | 'client'
+
+// API Key 配额（0 或不传 = 不限制）
+export interface APIKeyLimits {
+  rpm?: number
+  max_concurrent?: number
+  daily_tokens?: number
+  monthly_tokens?: number
+  daily_credit?: number
+}
+
+// 模型白名单与请求上限（0 = 不限制）
+export interface APIKeyRequestCaps {
+  allowed_models: string[] // 支持 * 通配，空 = 全部
+  max_tokens: number
+  max_input_tokens: number
+  max_tools: number
+}
+
+export interface APIKeyUsage {
+  requests_last_minute: number
+  concurrent: number
+  daily_tokens: number
+  monthly_tokens: number
+  daily_credit: number
+}
+
 export interface APIKey {
-  key: string
+  id: string
+  prefix: string
   masked_key: string
   name: string
   allowed_groups: string[]
+  default_group?: string
+  role: APIKeyRole
+  expires_at?: string | null
+  last_used_at?: string | null
+  disabled: boolean
+  replaced_by?: string
+  limits: APIKeyLimits
+  usage?: APIKeyUsage
+  allowed_models: string[] | null
+  max_tokens: number
+  max_input_tokens: number
+  max_tools: number
+  created_at: string
+}
+
+// 创建/轮换响应，明文 key 只返回一次
+export interface IssuedAPIKey extends APIKey {
+  key: string
+  previous_id?: string // 仅轮换
+  previous_expires_at?: string | null
 }
 
 export interface CreateAPIKeyRequest {
   key?: string
   name?: string
   allowed_groups?: string[]
+  default_group?: string
+  role?: APIKeyRole
+  expires_at?: string
+  limits?: APIKeyLimits
+  request_caps?: APIKeyRequestCaps
 }
 
+export interface UpdateAPIKeyRequest {
+  allowed_groups?: string[]
+  default_group?: string // 空串 = 全局默认分组
+  role?: APIKeyRole
+  disabled?: boolean
+  expires_at?: string // 空串 = 永不过期
+  limits?: APIKeyLimits
+  request_caps?: APIKeyRequestCaps
+}
+
+// 模型注册表（价格为每百万 tokens）
+export interface ModelPricing {
+  input_price: number
+  output_price: number
+  cache_read: number
+}
+
+export interface ModelInfo {
+  id: string // 对外模型名
+  upstream_id: string
+  display_name?: string
+  context_window: number
+  max_output: number
+  pricing: ModelPricing
+  enabled: boolean
+  groups?: string[] // 空 = 所有分组
+  created_at?: string
+}
+
+// 路由规则
+export interface RoutingTarget {
+  group: string
+  weight: number
+}
+
+export interface RoutingRule {
+  id: number
+  name?: string
+  priority: number // 越大越先匹配
+  enabled: boolean
+  models?: string[] // 模型通配，如 claude-*opus*
+  api_keys?: string[] // API Key ID
+  has_tools?: boolean | null
+  thinking?: boolean | null
+  min_complexity?: number
+  max_complexity?: number // 0 = 不限
+  targets: RoutingTarget[]
+}
+
+export type RoutingRuleInput = Omit<RoutingRule, 'id'>
+
 // 统计相关类型
 export interface RequestRecord {
   id: string